@@ -2,33 +2,68 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"updockly/backend/internal/config"
 	"updockly/backend/internal/database"
 	"updockly/backend/internal/httpapi"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/tracing"
 )
 
 func main() {
 	cfg := config.Load()
+	logger := logging.New(cfg.LogLevel)
+	slog.SetDefault(logger)
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingEndpoint)
+	if err != nil {
+		logger.Error("tracing setup failed", "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("flushing traces failed", "error", err)
+		}
+	}()
 
 	db, err := database.Connect(cfg)
+	if errors.Is(err, database.ErrSchemaTooNew) {
+		logger.Error("refusing to start", "error", err)
+		os.Exit(1)
+	}
 	if err != nil {
-		log.Printf("warning: could not connect to database, starting in setup mode: %v", err)
+		logger.Warn("could not connect to database, starting in setup mode", "error", err)
 		db = nil
 	}
 
 	srv, err := httpapi.New(cfg, db)
 	if err != nil {
-		log.Fatalf("server bootstrap failed: %v", err)
+		logger.Error("server bootstrap failed", "error", err)
+		os.Exit(1)
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	if err := srv.Run(ctx); err != nil {
-		log.Fatalf("server exited: %v", err)
+		logger.Error("server exited", "error", err)
+		os.Exit(1)
 	}
 }
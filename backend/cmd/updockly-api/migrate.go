@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/database"
+)
+
+const migrateUsage = `usage: updockly-api migrate <command>
+
+commands:
+  up                 apply pending migrations
+  down [-steps N]    roll back the last N migrations (default 1)
+  status             list migrations and whether they are applied`
+
+// runMigrate runs the migrate subcommand against the configured database.
+func runMigrate(cfg config.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	db, err := database.Open(cfg)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		if err := database.Migrate(db); err != nil {
+			return err
+		}
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		fs.SetOutput(out)
+		steps := fs.Int("steps", 1, "number of migrations to roll back")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := database.MigrateDown(db, *steps); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", args[0], migrateUsage)
+	}
+	return printMigrationStatus(db, out)
+}
+
+func printMigrationStatus(db *gorm.DB, out io.Writer) error {
+	statuses, err := database.Status(db)
+	if err != nil {
+		return err
+	}
+	current, pending := 0, 0
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, st := range statuses {
+		applied := "pending"
+		if st.AppliedAt != nil {
+			applied = st.AppliedAt.Local().Format(time.RFC3339)
+			current = max(current, st.Version)
+		} else {
+			pending++
+		}
+		name := st.Name
+		if !st.Known {
+			name += " (unknown to this build)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", st.Version, name, applied)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nschema version %d, latest %d, %d pending\n", current, database.LatestVersion(), pending)
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"gorm.io/gorm/logger"
 
 	"updockly/backend/internal/domain"
+	"updockly/backend/internal/tracing"
 	"updockly/backend/internal/util"
 )
 
@@ -128,6 +129,12 @@ func (s *AgentService) Update(id, name, hostname, notes string, tlsEnabled bool)
 	return agent, nil
 }
 
+// SetRequireApproval switches whether auto-updates of the agent's containers wait for
+// an approved update request.
+func (s *AgentService) SetRequireApproval(id string, required bool) error {
+	return s.db.Model(&domain.Agent{}).Where("id = ?", id).Update("require_approval", required).Error
+}
+
 func (s *AgentService) Delete(id string) error {
 	return s.db.Delete(&domain.Agent{}, "id = ?", id).Error
 }
@@ -151,17 +158,23 @@ func (s *AgentService) RotateToken(id string) (*domain.Agent, error) {
 }
 
 func (s *AgentService) CreateCommand(agentID, cmdType string, payload domain.JSONMap) (*domain.AgentCommand, error) {
+	return s.CreateCommandWithContext(context.Background(), agentID, cmdType, payload)
+}
+
+// CreateCommandWithContext queues a command carrying the trace of ctx to the agent.
+func (s *AgentService) CreateCommandWithContext(ctx context.Context, agentID, cmdType string, payload domain.JSONMap) (*domain.AgentCommand, error) {
 	var agent domain.Agent
-	if err := s.db.Where("id = ?", agentID).First(&agent).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("id = ?", agentID).First(&agent).Error; err != nil {
 		return nil, err
 	}
 	cmd := domain.AgentCommand{
-		AgentID: agent.ID,
-		Type:    cmdType,
-		Status:  "pending",
-		Payload: payload,
+		AgentID:     agent.ID,
+		Type:        cmdType,
+		Status:      "pending",
+		Payload:     payload,
+		TraceParent: tracing.TraceParent(ctx),
 	}
-	if err := s.db.Create(&cmd).Error; err != nil {
+	if err := s.db.WithContext(ctx).Create(&cmd).Error; err != nil {
 		return nil, err
 	}
 	return &cmd, nil
@@ -1,10 +1,16 @@
 package agents
 
 import (
+	"context"
+	"strings"
 	"testing"
 
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+
+	"updockly/backend/internal/tracing"
 )
 
 func setupAgentTestDB(t *testing.T) *gorm.DB {
@@ -144,6 +150,38 @@ func TestAgentCommands(t *testing.T) {
 	}
 }
 
+func TestCreateCommandCarriesTrace(t *testing.T) {
+	db := setupAgentTestDB(t)
+	svc := NewAgentService(db, false)
+	agent, _ := svc.Create("traced", "host", "", false)
+
+	cmd, err := svc.CreateCommand(agent.ID, "check-update", nil)
+	if err != nil {
+		t.Fatalf("CreateCommand failed: %v", err)
+	}
+	if cmd.TraceParent != "" {
+		t.Errorf("TraceParent = %q, want empty without a trace", cmd.TraceParent)
+	}
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	defer otel.SetTracerProvider(previous)
+	ctx, span := tracing.Start(context.Background(), "auto-update.cycle")
+	defer span.End()
+
+	cmd, err = svc.CreateCommandWithContext(ctx, agent.ID, "update-container", nil)
+	if err != nil {
+		t.Fatalf("CreateCommandWithContext failed: %v", err)
+	}
+	next, err := svc.GetCommand(cmd.ID, agent.ID)
+	if err != nil {
+		t.Fatalf("GetCommand failed: %v", err)
+	}
+	if !strings.Contains(next.TraceParent, span.SpanContext().TraceID().String()) {
+		t.Errorf("TraceParent = %q, want the trace of the queuing span", next.TraceParent)
+	}
+}
+
 func TestToggleContainerAutoUpdate_Agent(t *testing.T) {
 	db := setupAgentTestDB(t)
 	svc := NewAgentService(db, false)
@@ -0,0 +1,217 @@
+// Package approvals tracks update requests for agents that require approval before
+// their containers are updated. See domain.UpdateApproval for the lifecycle.
+package approvals
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/domain"
+)
+
+// Request statuses.
+const (
+	StatusPending   = "pending"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusQueued    = "queued"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusExpired   = "expired"
+)
+
+// ErrNotPending is returned when deciding a request that was already decided or closed.
+var ErrNotPending = errors.New("update request is not pending")
+
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+func (s *Service) silent() *gorm.DB {
+	return s.db.Session(&gorm.Session{Logger: logger.Discard})
+}
+
+// Request opens a pending request for the update available to a container, unless one
+// is already open for the same image. An open request for another image, left when the
+// tag moved since, is closed first, so neither an approval nor a rejection carries over
+// to an image the approver has not seen. created reports whether a new request was made.
+func (s *Service) Request(agent domain.Agent, cont domain.ContainerSnapshot) (req domain.UpdateApproval, created bool, err error) {
+	if s.db == nil {
+		return req, false, errors.New("database not ready")
+	}
+	digest := strings.TrimSpace(cont.AvailableDigest)
+	err = s.silent().Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("agent_id = ? AND container_id = ? AND closed_at IS NULL", agent.ID, cont.ID).First(&req).Error
+		if err == nil {
+			if digest == "" || req.Digest == digest || req.Status == StatusQueued {
+				return nil
+			}
+			if err := supersede(tx, req); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		req = domain.UpdateApproval{
+			AgentID:       agent.ID,
+			AgentName:     agent.Name,
+			ContainerID:   cont.ID,
+			ContainerName: cont.Name,
+			Image:         cont.Image,
+			Digest:        digest,
+			Status:        StatusPending,
+		}
+		created = true
+		return tx.Create(&req).Error
+	})
+	return req, created, err
+}
+
+// supersede closes an open request whose image is no longer the one available. Pending
+// and approved requests expire; rejected ones keep their decision.
+func supersede(tx *gorm.DB, req domain.UpdateApproval) error {
+	updates := map[string]any{"closed_at": time.Now(), "message": "A newer image is available"}
+	if req.Status == StatusPending || req.Status == StatusApproved {
+		updates["status"] = StatusExpired
+	}
+	return tx.Model(&domain.UpdateApproval{}).Where("id = ? AND closed_at IS NULL", req.ID).Updates(updates).Error
+}
+
+// Close expires the open requests of a container whose update is no longer available.
+// Queued requests are left for their command to finish.
+func (s *Service) Close(agentID, containerID string) error {
+	if s.db == nil {
+		return errors.New("database not ready")
+	}
+	now := time.Now()
+	tx := s.silent().Model(&domain.UpdateApproval{}).
+		Where("agent_id = ? AND container_id = ? AND closed_at IS NULL", agentID, containerID)
+	if err := tx.Where("status IN ?", []string{StatusPending, StatusApproved}).
+		Updates(map[string]any{"status": StatusExpired, "closed_at": now, "message": "Update no longer available"}).Error; err != nil {
+		return err
+	}
+	return s.silent().Model(&domain.UpdateApproval{}).
+		Where("agent_id = ? AND container_id = ? AND closed_at IS NULL AND status = ?", agentID, containerID, StatusRejected).
+		Update("closed_at", now).Error
+}
+
+// List returns requests newest first, optionally only those with status or only open
+// ones.
+func (s *Service) List(status string, open bool) ([]domain.UpdateApproval, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	q := s.db.Order("created_at DESC").Limit(500)
+	if status = strings.TrimSpace(status); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if open {
+		q = q.Where("closed_at IS NULL")
+	}
+	rows := []domain.UpdateApproval{}
+	return rows, q.Find(&rows).Error
+}
+
+func (s *Service) Get(id string) (domain.UpdateApproval, error) {
+	var req domain.UpdateApproval
+	if s.db == nil {
+		return req, errors.New("database not ready")
+	}
+	err := s.db.First(&req, "id = ?", id).Error
+	return req, err
+}
+
+// Decide approves or rejects a pending request on behalf of actor. The decision is a
+// single conditional update, so of two racing decisions only the first one counts.
+func (s *Service) Decide(id string, approve bool, actor, note string) (domain.UpdateApproval, error) {
+	var req domain.UpdateApproval
+	if s.db == nil {
+		return req, errors.New("database not ready")
+	}
+	status := StatusRejected
+	if approve {
+		status = StatusApproved
+	}
+	res := s.db.Model(&domain.UpdateApproval{}).
+		Where("id = ? AND status = ? AND closed_at IS NULL", id, StatusPending).
+		Updates(map[string]any{
+			"status":     status,
+			"decided_by": actor,
+			"decided_at": time.Now(),
+			"note":       strings.TrimSpace(note),
+		})
+	if res.Error != nil {
+		return req, res.Error
+	}
+	if err := s.db.First(&req, "id = ?", id).Error; err != nil {
+		return req, err
+	}
+	if res.RowsAffected == 0 {
+		return req, ErrNotPending
+	}
+	return req, nil
+}
+
+// Approved returns the open, approved request of a container, if any.
+func (s *Service) Approved(agentID, containerID string) (*domain.UpdateApproval, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	var req domain.UpdateApproval
+	err := s.silent().Where("agent_id = ? AND container_id = ? AND status = ? AND closed_at IS NULL", agentID, containerID, StatusApproved).
+		First(&req).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// MarkQueued records the command that applies an approved request.
+func (s *Service) MarkQueued(id, commandID string) error {
+	if s.db == nil {
+		return errors.New("database not ready")
+	}
+	return s.silent().Model(&domain.UpdateApproval{}).Where("id = ?", id).
+		Updates(map[string]any{"status": StatusQueued, "command_id": commandID}).Error
+}
+
+// Finish closes the request applied by a command. The bool is false when the command
+// did not apply a request.
+func (s *Service) Finish(commandID string, success bool, message string) (domain.UpdateApproval, bool, error) {
+	var req domain.UpdateApproval
+	if s.db == nil || commandID == "" {
+		return req, false, nil
+	}
+	err := s.silent().Where("command_id = ? AND status = ?", commandID, StatusQueued).First(&req).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return req, false, nil
+	}
+	if err != nil {
+		return req, false, err
+	}
+	now := time.Now()
+	req.Status = StatusCompleted
+	if !success {
+		req.Status = StatusFailed
+	}
+	req.Message = message
+	req.ClosedAt = &now
+	res := s.silent().Model(&domain.UpdateApproval{}).
+		Where("id = ? AND status = ?", req.ID, StatusQueued).
+		Updates(map[string]any{"status": req.Status, "message": message, "closed_at": now})
+	if res.Error != nil {
+		return req, false, res.Error
+	}
+	return req, res.RowsAffected == 1, nil
+}
@@ -0,0 +1,208 @@
+package approvals
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/domain"
+)
+
+func setupApprovalsDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.UpdateApproval{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestRequestLifecycle(t *testing.T) {
+	svc := NewService(setupApprovalsDB(t))
+	agent := domain.Agent{ID: "a1", Name: "prod-1"}
+	cont := domain.ContainerSnapshot{ID: "c1", Name: "web", Image: "nginx:1.27"}
+
+	req, created, err := svc.Request(agent, cont)
+	if err != nil || !created || req.Status != StatusPending {
+		t.Fatalf("expected a new pending request, got %+v created=%v (%v)", req, created, err)
+	}
+	if again, created, err := svc.Request(agent, cont); err != nil || created || again.ID != req.ID {
+		t.Fatalf("expected the open request to be reused, got %+v created=%v (%v)", again, created, err)
+	}
+	if approved, err := svc.Approved("a1", "c1"); err != nil || approved != nil {
+		t.Fatalf("expected no approved request yet, got %+v (%v)", approved, err)
+	}
+
+	decided, err := svc.Decide(req.ID, true, "alice", " ship it ")
+	if err != nil || decided.Status != StatusApproved || decided.DecidedBy != "alice" || decided.Note != "ship it" || decided.DecidedAt == nil {
+		t.Fatalf("unexpected decision %+v (%v)", decided, err)
+	}
+	if _, err := svc.Decide(req.ID, false, "bob", ""); !errors.Is(err, ErrNotPending) {
+		t.Fatalf("expected a second decision to fail, got %v", err)
+	}
+
+	approved, err := svc.Approved("a1", "c1")
+	if err != nil || approved == nil || approved.ID != req.ID {
+		t.Fatalf("expected the approved request, got %+v (%v)", approved, err)
+	}
+	if err := svc.MarkQueued(req.ID, "cmd-1"); err != nil {
+		t.Fatalf("mark queued: %v", err)
+	}
+	// A queued request stays open while the update is still reported available.
+	if err := svc.Close("a1", "c1"); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, created, _ := svc.Request(agent, cont); created {
+		t.Fatalf("expected the queued request to stay open")
+	}
+
+	if _, ok, err := svc.Finish("cmd-other", true, ""); err != nil || ok {
+		t.Fatalf("expected an unrelated command to be ignored, got ok=%v (%v)", ok, err)
+	}
+	done, ok, err := svc.Finish("cmd-1", false, "pull failed")
+	if err != nil || !ok || done.Status != StatusFailed || done.Message != "pull failed" || done.ClosedAt == nil {
+		t.Fatalf("unexpected finished request %+v ok=%v (%v)", done, ok, err)
+	}
+
+	if _, created, _ := svc.Request(agent, cont); !created {
+		t.Fatalf("expected a new request once the last one closed")
+	}
+	open, err := svc.List("", true)
+	if err != nil || len(open) != 1 || open[0].Status != StatusPending {
+		t.Fatalf("expected one open request, got %+v (%v)", open, err)
+	}
+	failed, err := svc.List(StatusFailed, false)
+	if err != nil || len(failed) != 1 || failed[0].ID != req.ID {
+		t.Fatalf("expected the failed request, got %+v (%v)", failed, err)
+	}
+}
+
+func TestCloseExpiresUndecidedRequests(t *testing.T) {
+	svc := NewService(setupApprovalsDB(t))
+	agent := domain.Agent{ID: "a1", Name: "prod-1"}
+
+	pending, _, _ := svc.Request(agent, domain.ContainerSnapshot{ID: "c1", Name: "web"})
+	rejected, _, _ := svc.Request(agent, domain.ContainerSnapshot{ID: "c2", Name: "db"})
+	if _, err := svc.Decide(rejected.ID, false, "alice", ""); err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+
+	if err := svc.Close("a1", "c1"); err != nil {
+		t.Fatalf("close c1: %v", err)
+	}
+	if err := svc.Close("a1", "c2"); err != nil {
+		t.Fatalf("close c2: %v", err)
+	}
+	if got, _ := svc.Get(pending.ID); got.Status != StatusExpired || got.ClosedAt == nil {
+		t.Fatalf("expected the pending request to expire, got %+v", got)
+	}
+	if got, _ := svc.Get(rejected.ID); got.Status != StatusRejected || got.ClosedAt == nil {
+		t.Fatalf("expected the rejected request to close as rejected, got %+v", got)
+	}
+	if _, err := svc.Decide(pending.ID, true, "alice", ""); !errors.Is(err, ErrNotPending) {
+		t.Fatalf("expected an expired request to refuse decisions, got %v", err)
+	}
+}
+
+func TestConcurrentDecisionsOnlyOneWins(t *testing.T) {
+	svc := NewService(setupApprovalsDB(t))
+	req, _, err := svc.Request(domain.Agent{ID: "a1", Name: "prod-1"}, domain.ContainerSnapshot{ID: "c1", Name: "web"})
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	const deciders = 8
+	var wg sync.WaitGroup
+	errs := make([]error, deciders)
+	for i := 0; i < deciders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = svc.Decide(req.ID, i%2 == 0, "user", "")
+		}(i)
+	}
+	wg.Wait()
+
+	won := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, ErrNotPending):
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("expected exactly one decision to succeed, got %d", won)
+	}
+}
+
+func TestDecideKeepsQueuedRequests(t *testing.T) {
+	svc := NewService(setupApprovalsDB(t))
+	req, _, _ := svc.Request(domain.Agent{ID: "a1"}, domain.ContainerSnapshot{ID: "c1"})
+	if _, err := svc.Decide(req.ID, true, "alice", ""); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	if err := svc.MarkQueued(req.ID, "cmd-1"); err != nil {
+		t.Fatalf("mark queued: %v", err)
+	}
+	if _, err := svc.Decide(req.ID, false, "bob", ""); !errors.Is(err, ErrNotPending) {
+		t.Fatalf("expected a late decision to fail, got %v", err)
+	}
+	got, _ := svc.Get(req.ID)
+	if got.Status != StatusQueued || got.CommandID != "cmd-1" || got.DecidedBy != "alice" {
+		t.Fatalf("expected the queued request to be untouched, got %+v", got)
+	}
+}
+
+func TestNewImageReopensRejectedRequest(t *testing.T) {
+	svc := NewService(setupApprovalsDB(t))
+	agent := domain.Agent{ID: "a1", Name: "prod-1"}
+	cont := domain.ContainerSnapshot{ID: "c1", Name: "web", Image: "nginx:1.27", AvailableDigest: "nginx@sha256:aaa"}
+
+	req, _, err := svc.Request(agent, cont)
+	if err != nil || req.Digest != "nginx@sha256:aaa" {
+		t.Fatalf("expected a request for the available image, got %+v (%v)", req, err)
+	}
+	if _, err := svc.Decide(req.ID, false, "alice", "not this one"); err != nil {
+		t.Fatalf("reject: %v", err)
+	}
+	if again, created, err := svc.Request(agent, cont); err != nil || created || again.ID != req.ID {
+		t.Fatalf("expected the rejection to hold for the same image, got %+v created=%v (%v)", again, created, err)
+	}
+
+	// The tag moved: the rejection does not block the new image.
+	cont.AvailableDigest = "nginx@sha256:bbb"
+	next, created, err := svc.Request(agent, cont)
+	if err != nil || !created || next.Status != StatusPending || next.Digest != "nginx@sha256:bbb" {
+		t.Fatalf("expected a new request for the new image, got %+v created=%v (%v)", next, created, err)
+	}
+	old, _ := svc.Get(req.ID)
+	if old.Status != StatusRejected || old.ClosedAt == nil {
+		t.Fatalf("expected the rejected request to be closed, got %+v", old)
+	}
+
+	// An approval does not carry over to an image the approver has not seen.
+	if _, err := svc.Decide(next.ID, true, "alice", ""); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	cont.AvailableDigest = "nginx@sha256:ccc"
+	if _, created, err := svc.Request(agent, cont); err != nil || !created {
+		t.Fatalf("expected a new request for another image, got created=%v (%v)", created, err)
+	}
+	if expired, _ := svc.Get(next.ID); expired.Status != StatusExpired || expired.ClosedAt == nil {
+		t.Fatalf("expected the approval to expire, got %+v", expired)
+	}
+	if approved, err := svc.Approved("a1", "c1"); err != nil || approved != nil {
+		t.Fatalf("expected no approved request, got %+v (%v)", approved, err)
+	}
+}
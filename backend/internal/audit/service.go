@@ -1,7 +1,16 @@
 package audit
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -9,45 +18,467 @@ import (
 	"updockly/backend/internal/domain"
 )
 
+const (
+	defaultLimit = 100
+	maxLimit     = 500
+
+	// chainLockKey serialises appends across replicas sharing a Postgres database.
+	chainLockKey = 0x75706461756469
+
+	// headID is the primary key of the single chain head row.
+	headID = 1
+)
+
+// KeyPurpose names the vault keys that sign the chain; see vault.Vault.MACKeys.
+const KeyPurpose = "audit-chain"
+
+// chainMu serialises appends within the process; services are rebuilt when settings change.
+var chainMu sync.Mutex
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type Service struct {
-	db *gorm.DB
+	db   *gorm.DB
+	keys [][]byte
+}
+
+// NewService returns the audit service. Entries are chained with an HMAC under keys: the
+// first signs new entries and any of them verifies, so entries signed before a vault key
+// rotation stay valid.
+func NewService(db *gorm.DB, keys ...[]byte) *Service {
+	return &Service{db: db, keys: keys}
+}
+
+// Event is a structured audit record. Before and After are marshalled to JSON; when both
+// are objects only the keys that changed are kept. Secret-looking keys are redacted.
+type Event struct {
+	ActorID    string
+	ActorName  string
+	Action     string
+	TargetType string
+	TargetID   string
+	Details    string
+	Before     interface{}
+	After      interface{}
+	IPAddress  string
+}
+
+// Query filters audit entries. Cursor is the value returned as the next cursor by a
+// previous page; entries are returned newest first.
+type Query struct {
+	User       string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       *time.Time
+	To         *time.Time
+	Cursor     string
+	Limit      int
 }
 
-func NewService(db *gorm.DB) *Service {
-	return &Service{db: db}
+// VerifyResult reports the state of the hash chain.
+type VerifyResult struct {
+	Valid    bool   `json:"valid"`
+	Checked  int    `json:"checked"`
+	Legacy   int    `json:"legacy"`
+	BrokenAt uint   `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
 }
 
 func (s *Service) List(limit int) ([]domain.AuditLog, error) {
+	logs, _, err := s.Search(Query{Limit: limit})
+	return logs, err
+}
+
+// Search returns a page of entries matching q and the cursor for the next page, which is
+// empty once there are no more entries.
+func (s *Service) Search(q Query) ([]domain.AuditLog, string, error) {
 	if s.db == nil {
-		return nil, errors.New("database not ready")
+		return nil, "", errors.New("database not ready")
 	}
-	if limit <= 0 {
-		limit = 100
+	if q.Limit <= 0 {
+		q.Limit = defaultLimit
 	}
-	if limit > 500 {
-		limit = 500
+	if q.Limit > maxLimit {
+		q.Limit = maxLimit
 	}
 
+	tx, err := applyQuery(s.db.Model(&domain.AuditLog{}), q)
+	if err != nil {
+		return nil, "", err
+	}
 	var logs []domain.AuditLog
-	if err := s.db.Order("created_at DESC").Limit(limit).Find(&logs).Error; err != nil {
-		return nil, err
+	if err := tx.Order("id DESC").Limit(q.Limit + 1).Find(&logs).Error; err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(logs) > q.Limit {
+		logs = logs[:q.Limit]
+		next = strconv.FormatUint(uint64(logs[len(logs)-1].ID), 10)
 	}
-	return logs, nil
+	return logs, next, nil
+}
+
+// Each walks every entry matching q, newest first, in pages. q.Limit sets the page size.
+func (s *Service) Each(q Query, fn func(domain.AuditLog) error) error {
+	for {
+		logs, next, err := s.Search(q)
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			if err := fn(log); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		q.Cursor = next
+	}
+}
+
+func applyQuery(tx *gorm.DB, q Query) (*gorm.DB, error) {
+	if q.User != "" {
+		tx = tx.Where("user_id = ? OR user_name = ?", q.User, q.User)
+	}
+	if q.Action != "" {
+		tx = tx.Where("action = ?", q.Action)
+	}
+	if q.TargetType != "" {
+		tx = tx.Where("target_type = ?", q.TargetType)
+	}
+	if q.TargetID != "" {
+		tx = tx.Where("target_id = ?", q.TargetID)
+	}
+	if q.From != nil {
+		tx = tx.Where("created_at >= ?", q.From.UTC())
+	}
+	if q.To != nil {
+		tx = tx.Where("created_at <= ?", q.To.UTC())
+	}
+	if q.Cursor != "" {
+		id, err := strconv.ParseUint(q.Cursor, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		tx = tx.Where("id < ?", id)
+	}
+	return tx, nil
 }
 
 func (s *Service) Record(userID, username, action, details, ip string) error {
+	return s.RecordEvent(Event{
+		ActorID:   userID,
+		ActorName: username,
+		Action:    action,
+		Details:   details,
+		IPAddress: ip,
+	})
+}
+
+// RecordEvent appends an entry to the chain.
+func (s *Service) RecordEvent(event Event) error {
 	if s.db == nil {
 		return nil // Fail open if DB not ready? Or return error. For logging, fail open is often safer for availability.
 	}
 
+	before, after, err := snapshots(event.Before, event.After)
+	if err != nil {
+		return err
+	}
 	log := domain.AuditLog{
-		UserID:    userID,
-		UserName:  username,
-		Action:    action,
-		Details:   details,
-		IPAddress: ip,
+		UserID:     event.ActorID,
+		UserName:   event.ActorName,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Details:    event.Details,
+		Before:     before,
+		After:      after,
+		IPAddress:  event.IPAddress,
+		// Postgres keeps microseconds; truncate so the hash survives the round trip.
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
 	}
 
+	return s.locked(func(tx *gorm.DB) error {
+		var last domain.AuditLog
+		res := tx.Select("hash").Order("id DESC").Limit(1).Find(&last)
+		if res.Error != nil {
+			return res.Error
+		}
+		log.PrevHash = last.Hash
+		log.Hash = entryHash(s.signingKey(), log)
+		if err := tx.Create(&log).Error; err != nil {
+			return err
+		}
+
+		head, found, err := loadHead(tx)
+		if err != nil {
+			return err
+		}
+		if found {
+			head.Count++
+		} else if err := tx.Model(&domain.AuditLog{}).Count(&head.Count).Error; err != nil {
+			return err
+		}
+		head.ID = headID
+		head.LastID = log.ID
+		head.Hash = log.Hash
+		head.MAC = headMAC(s.signingKey(), head)
+		return tx.Save(&head).Error
+	})
+}
+
+// locked runs fn in a transaction that holds the chain lock, so the chain and its head
+// do not change underneath it.
+func (s *Service) locked(fn func(tx *gorm.DB) error) error {
+	chainMu.Lock()
+	defer chainMu.Unlock()
+
 	// Use silent logger to avoid noise for every action
-	return s.db.Session(&gorm.Session{Logger: logger.Discard}).Create(&log).Error
+	return s.db.Session(&gorm.Session{Logger: logger.Discard}).Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLockKey).Error; err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+func loadHead(tx *gorm.DB) (domain.AuditChainHead, bool, error) {
+	var head domain.AuditChainHead
+	res := tx.Where("id = ?", headID).Limit(1).Find(&head)
+	return head, res.RowsAffected > 0, res.Error
+}
+
+func (s *Service) signingKey() []byte {
+	if len(s.keys) == 0 {
+		return nil
+	}
+	return s.keys[0]
+}
+
+// signedByAny reports whether sign produces want under one of the service's keys.
+func (s *Service) signedByAny(want string, sign func(key []byte) string) bool {
+	keys := s.keys
+	if len(keys) == 0 {
+		keys = [][]byte{nil}
+	}
+	for _, key := range keys {
+		if hmac.Equal([]byte(sign(key)), []byte(want)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify walks the whole chain oldest first and checks that it ends at the signed chain
+// head. Entries written before chaining was introduced have no hash and are only accepted
+// before the first chained entry.
+func (s *Service) Verify() (VerifyResult, error) {
+	result := VerifyResult{Valid: true}
+	if s.db == nil {
+		return result, errors.New("database not ready")
+	}
+
+	fail := func(id uint, reason string) {
+		result.Valid = false
+		result.BrokenAt = id
+		result.Reason = reason
+	}
+	err := s.locked(func(tx *gorm.DB) error {
+		head, found, err := loadHead(tx)
+		if err != nil {
+			return err
+		}
+
+		var (
+			lastID   uint
+			prevHash string
+			chained  bool
+			count    int64
+		)
+		for {
+			var batch []domain.AuditLog
+			if err := tx.Where("id > ?", lastID).Order("id ASC").Limit(maxLimit).Find(&batch).Error; err != nil {
+				return err
+			}
+			for _, log := range batch {
+				lastID = log.ID
+				count++
+				if log.Hash == "" && !chained {
+					result.Legacy++
+					continue
+				}
+				result.Checked++
+				switch {
+				case log.Hash == "":
+					fail(log.ID, "entry has no hash")
+				case chained && log.PrevHash != prevHash:
+					fail(log.ID, "previous hash does not match; an entry was removed or reordered")
+				case !s.signedByAny(log.Hash, func(key []byte) string { return entryHash(key, log) }):
+					fail(log.ID, "entry contents do not match its hash")
+				}
+				if !result.Valid {
+					return nil
+				}
+				chained = true
+				prevHash = log.Hash
+			}
+			if len(batch) < maxLimit {
+				break
+			}
+		}
+
+		switch {
+		case !found:
+			if chained {
+				fail(lastID, "chain head is missing")
+			}
+		case !s.signedByAny(head.MAC, func(key []byte) string { return headMAC(key, head) }):
+			fail(head.LastID, "chain head signature does not match")
+		case count < head.Count || lastID < head.LastID:
+			fail(head.LastID, "entries were removed from the end of the chain")
+		case head.LastID != lastID || head.Hash != prevHash || head.Count != count:
+			fail(lastID, "chain does not end at the chain head; an entry was added outside the audit log")
+		}
+		return nil
+	})
+	return result, err
+}
+
+// entryHash is HMAC-SHA256 under key over the previous hash and the entry's fields.
+func entryHash(key []byte, log domain.AuditLog) string {
+	fields := []string{
+		log.PrevHash,
+		log.CreatedAt.UTC().Format(time.RFC3339Nano),
+		log.UserID,
+		log.UserName,
+		log.Action,
+		log.TargetType,
+		log.TargetID,
+		log.Details,
+		string(log.Before),
+		string(log.After),
+		log.IPAddress,
+	}
+	h := hmac.New(sha256.New, key)
+	for _, f := range fields {
+		// Length-prefix each field so values cannot bleed into their neighbours.
+		fmt.Fprintf(h, "%d:%s\n", len(f), f)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// headMAC signs the chain head.
+func headMAC(key []byte, head domain.AuditChainHead) string {
+	h := hmac.New(sha256.New, key)
+	fmt.Fprintf(h, "%d|%s|%d", head.LastID, head.Hash, head.Count)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func snapshots(before, after interface{}) (domain.RawJSON, domain.RawJSON, error) {
+	b, err := toJSONValue(before)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal audit before: %w", err)
+	}
+	a, err := toJSONValue(after)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal audit after: %w", err)
+	}
+	if bm, ok := b.(map[string]interface{}); ok {
+		if am, ok := a.(map[string]interface{}); ok {
+			diffMaps(bm, am)
+		}
+	}
+	return encode(redact(b)), encode(redact(a)), nil
+}
+
+func toJSONValue(v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// diffMaps removes keys whose values are equal on both sides, recursing into objects.
+func diffMaps(before, after map[string]interface{}) {
+	for key, bv := range before {
+		av, ok := after[key]
+		if !ok {
+			continue
+		}
+		bm, bIsMap := bv.(map[string]interface{})
+		am, aIsMap := av.(map[string]interface{})
+		if bIsMap && aIsMap {
+			diffMaps(bm, am)
+			if len(bm) == 0 && len(am) == 0 {
+				delete(before, key)
+				delete(after, key)
+			}
+			continue
+		}
+		if jsonEqual(bv, av) {
+			delete(before, key)
+			delete(after, key)
+		}
+	}
+}
+
+func jsonEqual(a, b interface{}) bool {
+	ra, _ := json.Marshal(a)
+	rb, _ := json.Marshal(b)
+	return string(ra) == string(rb)
+}
+
+func sensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	for _, marker := range []string{"password", "secret", "token", "privatekey", "webhookurl", "databaseurl"} {
+		if strings.Contains(k, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, val := range t {
+			if sensitiveKey(key) {
+				if s, ok := val.(string); ok && s == "" {
+					continue
+				}
+				t[key] = "[redacted]"
+				continue
+			}
+			t[key] = redact(val)
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redact(t[i])
+		}
+	}
+	return v
+}
+
+func encode(v interface{}) domain.RawJSON {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return raw
 }
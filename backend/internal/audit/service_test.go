@@ -1,7 +1,10 @@
 package audit
 
 import (
+	"encoding/json"
+	"strconv"
 	"testing"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -14,7 +17,9 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("failed to open database: %v", err)
 	}
-	if err := db.AutoMigrate(&domain.AuditLog{}); err != nil {
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.AuditLog{}, &domain.AuditChainHead{}); err != nil {
 		t.Fatalf("failed to migrate database: %v", err)
 	}
 	return db
@@ -115,3 +120,163 @@ func TestService_NilDB(t *testing.T) {
 		t.Error("expected error for nil db in List, got nil")
 	}
 }
+
+func TestService_SearchFiltersAndCursor(t *testing.T) {
+	db := setupTestDB(t)
+	svc := NewService(db)
+
+	for i := 0; i < 5; i++ {
+		_ = svc.RecordEvent(Event{ActorID: "alice", ActorName: "Alice", Action: "start-container", TargetType: "container", TargetID: "c" + strconv.Itoa(i)})
+	}
+	_ = svc.RecordEvent(Event{ActorID: "bob", ActorName: "Bob", Action: "create-agent", TargetType: "agent", TargetID: "a1"})
+
+	logs, next, err := svc.Search(Query{User: "alice", Limit: 2})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(logs) != 2 || next == "" || logs[0].TargetID != "c4" {
+		t.Fatalf("unexpected first page: %d entries, next %q", len(logs), next)
+	}
+	seen := len(logs)
+	for next != "" {
+		logs, next, err = svc.Search(Query{User: "alice", Limit: 2, Cursor: next})
+		if err != nil {
+			t.Fatalf("search page: %v", err)
+		}
+		seen += len(logs)
+	}
+	if seen != 5 {
+		t.Fatalf("expected 5 entries across pages, got %d", seen)
+	}
+
+	logs, _, _ = svc.Search(Query{TargetType: "agent", TargetID: "a1"})
+	if len(logs) != 1 || logs[0].UserName != "Bob" {
+		t.Fatalf("expected target filter to match bob's entry, got %+v", logs)
+	}
+	logs, _, _ = svc.Search(Query{Action: "create-agent", User: "Bob"})
+	if len(logs) != 1 {
+		t.Fatalf("expected user filter to match by name, got %d", len(logs))
+	}
+
+	future := time.Now().Add(time.Hour)
+	logs, _, _ = svc.Search(Query{From: &future})
+	if len(logs) != 0 {
+		t.Fatalf("expected no entries after the from bound, got %d", len(logs))
+	}
+	past := time.Now().Add(-time.Hour)
+	logs, _, _ = svc.Search(Query{From: &past, To: &future})
+	if len(logs) != 6 {
+		t.Fatalf("expected all entries within range, got %d", len(logs))
+	}
+
+	if _, _, err := svc.Search(Query{Cursor: "abc"}); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestService_BeforeAfterDiff(t *testing.T) {
+	db := setupTestDB(t)
+	svc := NewService(db)
+
+	before := map[string]interface{}{"name": "web", "autoUpdate": false, "smtp": map[string]interface{}{"host": "mail", "password": "old"}}
+	after := map[string]interface{}{"name": "web", "autoUpdate": true, "smtp": map[string]interface{}{"host": "mail", "password": "new"}}
+	if err := svc.RecordEvent(Event{Action: "update", Before: before, After: after}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	var log domain.AuditLog
+	if err := db.First(&log).Error; err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(log.After, &got); err != nil {
+		t.Fatalf("decode after: %v", err)
+	}
+	if _, ok := got["name"]; ok {
+		t.Fatalf("expected unchanged keys to be dropped, got %s", log.After)
+	}
+	if got["autoUpdate"] != true {
+		t.Fatalf("expected changed key to be kept, got %s", log.After)
+	}
+	smtp, _ := got["smtp"].(map[string]interface{})
+	if smtp["password"] != "[redacted]" || smtp["host"] != nil {
+		t.Fatalf("expected changed secret to be redacted and unchanged host dropped, got %s", log.After)
+	}
+}
+
+func TestService_VerifyChain(t *testing.T) {
+	db := setupTestDB(t)
+	key := []byte("chain-key")
+	svc := NewService(db, key)
+
+	// A row written before chaining existed.
+	if err := db.Create(&domain.AuditLog{UserID: "legacy", Action: "login"}).Error; err != nil {
+		t.Fatalf("create legacy: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		_ = svc.Record("u", "user", "action"+strconv.Itoa(i), "detail", "ip")
+	}
+
+	result, err := svc.Verify()
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !result.Valid || result.Checked != 4 || result.Legacy != 1 {
+		t.Fatalf("expected intact chain, got %+v", result)
+	}
+
+	var logs []domain.AuditLog
+	db.Order("id ASC").Find(&logs)
+
+	t.Run("Edited", func(t *testing.T) {
+		db.Model(&domain.AuditLog{}).Where("id = ?", logs[2].ID).Update("details", "tampered")
+		result, _ := svc.Verify()
+		if result.Valid || result.BrokenAt != logs[2].ID {
+			t.Fatalf("expected edit to be detected at %d, got %+v", logs[2].ID, result)
+		}
+		db.Model(&domain.AuditLog{}).Where("id = ?", logs[2].ID).Update("details", "detail")
+	})
+
+	t.Run("TailDeleted", func(t *testing.T) {
+		last := logs[4]
+		db.Delete(&domain.AuditLog{}, last.ID)
+		result, _ := svc.Verify()
+		if result.Valid || result.BrokenAt != last.ID {
+			t.Fatalf("expected removal of the last entry to be detected at %d, got %+v", last.ID, result)
+		}
+		if err := db.Create(&last).Error; err != nil {
+			t.Fatalf("restore entry: %v", err)
+		}
+	})
+
+	t.Run("HeadForged", func(t *testing.T) {
+		var head domain.AuditChainHead
+		db.First(&head)
+		count := head.Count
+		db.Model(&head).Update("count", count-1)
+		result, _ := svc.Verify()
+		if result.Valid || result.Reason != "chain head signature does not match" {
+			t.Fatalf("expected a forged head to be detected, got %+v", result)
+		}
+		db.Model(&head).Update("count", count)
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		other := []byte("other-key")
+		if result, _ := NewService(db, other).Verify(); result.Valid || result.BrokenAt != logs[1].ID {
+			t.Fatalf("expected entries signed with another key to be rejected, got %+v", result)
+		}
+		// After a key rotation the old key still verifies.
+		if result, _ := NewService(db, other, key).Verify(); !result.Valid {
+			t.Fatalf("expected a rotated key to verify, got %+v", result)
+		}
+	})
+
+	t.Run("Deleted", func(t *testing.T) {
+		db.Delete(&domain.AuditLog{}, logs[3].ID)
+		result, _ := svc.Verify()
+		if result.Valid || result.BrokenAt != logs[4].ID {
+			t.Fatalf("expected deletion to be detected at %d, got %+v", logs[4].ID, result)
+		}
+	})
+}
@@ -143,7 +143,7 @@ func TestAccountManagement(t *testing.T) {
 	vault := NewVault("test-secret-key-32-bytes-long-exactly!", "", "")
 	authService := NewAuthService(db, vault, "jwt-secret")
 
-	_, err := authService.CreateAdmin("user1", "user1@test.com", "pass", "User One", "JBSWY3DPEHPK3PXP")
+	_, err := authService.CreateAdmin("user1", "user1@test.com", "initial-pass-1", "User One", "JBSWY3DPEHPK3PXP")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -167,18 +167,18 @@ func TestAccountManagement(t *testing.T) {
 	}
 
 	// Test Password Change
-	_, err = authService.UpdateAccount("user1", "", "", "wrong", "newpass")
+	_, err = authService.UpdateAccount("user1", "", "", "wrong", "changed-pass-2")
 	if err == nil || err.Error() != "invalid current password" {
 		t.Error("expected invalid current password error")
 	}
 
-	_, err = authService.UpdateAccount("user1", "", "", "pass", "newpass")
+	_, err = authService.UpdateAccount("user1", "", "", "initial-pass-1", "changed-pass-2")
 	if err != nil {
 		t.Fatalf("Change password failed: %v", err)
 	}
 
 	// Verify new password
-	if _, err := authService.Authenticate("user1", "newpass"); err != nil {
+	if _, err := authService.Authenticate("user1", "changed-pass-2"); err != nil {
 		t.Error("failed to authenticate with new password")
 	}
 }
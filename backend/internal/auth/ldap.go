@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"updockly/backend/internal/config"
+)
+
+const (
+	AuthSourceLDAP = "ldap"
+
+	defaultLDAPUserFilter = "(|(uid={username})(sAMAccountName={username}))"
+	ldapTimeout           = 10 * time.Second
+)
+
+var (
+	ErrLDAPUserNotFound = errors.New("ldap user not found")
+	ErrLDAPNoRole       = errors.New("ldap user is not in a mapped group")
+)
+
+// LDAPIdentity is the directory view of a user after a successful bind.
+type LDAPIdentity struct {
+	DN       string
+	Username string
+	Email    string
+	Name     string
+	Groups   []string
+	Role     string
+}
+
+type ldapGroupRole struct {
+	group string
+	role  string
+}
+
+// LDAPProvider authenticates users by searching for their entry and binding as it.
+type LDAPProvider struct {
+	settings config.LDAPSettings
+	roles    []ldapGroupRole
+}
+
+func NewLDAPProvider(settings config.LDAPSettings) *LDAPProvider {
+	if strings.TrimSpace(settings.UserFilter) == "" {
+		settings.UserFilter = defaultLDAPUserFilter
+	}
+	if settings.EmailAttribute == "" {
+		settings.EmailAttribute = "mail"
+	}
+	if settings.NameAttribute == "" {
+		settings.NameAttribute = "displayName"
+	}
+	if settings.GroupAttribute == "" {
+		settings.GroupAttribute = "memberOf"
+	}
+	return &LDAPProvider{settings: settings, roles: parseGroupRoles(settings.GroupRoles)}
+}
+
+// parseGroupRoles reads "group=role;group=role". Group DNs contain '=' so the role is
+// taken after the last one.
+func parseGroupRoles(raw string) []ldapGroupRole {
+	out := make([]ldapGroupRole, 0)
+	for _, entry := range strings.Split(raw, ";") {
+		entry = strings.TrimSpace(entry)
+		idx := strings.LastIndex(entry, "=")
+		if idx <= 0 || idx == len(entry)-1 {
+			continue
+		}
+		out = append(out, ldapGroupRole{
+			group: strings.TrimSpace(entry[:idx]),
+			role:  strings.TrimSpace(entry[idx+1:]),
+		})
+	}
+	return out
+}
+
+func (p *LDAPProvider) Enabled() bool {
+	return p != nil && p.settings.Enabled && strings.TrimSpace(p.settings.URL) != ""
+}
+
+func (p *LDAPProvider) JITProvisioning() bool {
+	return p.Enabled() && p.settings.JITProvisioning
+}
+
+// RoleFor maps directory groups to a role. Groups match by full DN or by their CN.
+func (p *LDAPProvider) RoleFor(groups []string) string {
+	for _, mapping := range p.roles {
+		for _, group := range groups {
+			if groupMatches(group, mapping.group) {
+				return mapping.role
+			}
+		}
+	}
+	return p.settings.DefaultRole
+}
+
+func groupMatches(memberOf, configured string) bool {
+	if strings.EqualFold(memberOf, configured) {
+		return true
+	}
+	if dn, err := ldap.ParseDN(memberOf); err == nil && len(dn.RDNs) > 0 {
+		for _, attr := range dn.RDNs[0].Attributes {
+			if strings.EqualFold(attr.Type, "cn") && strings.EqualFold(attr.Value, configured) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticate looks up the user with the service account (or anonymously) and binds as them.
+func (p *LDAPProvider) Authenticate(username, password string) (*LDAPIdentity, error) {
+	if !p.Enabled() {
+		return nil, errors.New("ldap not enabled")
+	}
+	// An empty password would be an unauthenticated bind, which many servers accept.
+	if username == "" || password == "" {
+		return nil, errors.New("invalid credentials")
+	}
+
+	conn, err := p.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p.settings.BindDN != "" {
+		if err := conn.Bind(p.settings.BindDN, p.settings.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+
+	attrs := []string{p.settings.EmailAttribute, p.settings.NameAttribute, p.settings.GroupAttribute, "cn"}
+	if p.settings.UsernameAttribute != "" {
+		attrs = append(attrs, p.settings.UsernameAttribute)
+	}
+	filter := strings.ReplaceAll(p.settings.UserFilter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.settings.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		filter, attrs, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrLDAPUserNotFound
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, errors.New("invalid credentials")
+	}
+
+	identity := &LDAPIdentity{
+		DN:       entry.DN,
+		Username: username,
+		Email:    entry.GetAttributeValue(p.settings.EmailAttribute),
+		Name:     entry.GetAttributeValue(p.settings.NameAttribute),
+		Groups:   entry.GetAttributeValues(p.settings.GroupAttribute),
+	}
+	if p.settings.UsernameAttribute != "" {
+		if v := entry.GetAttributeValue(p.settings.UsernameAttribute); v != "" {
+			identity.Username = v
+		}
+	}
+	if identity.Name == "" {
+		identity.Name = entry.GetAttributeValue("cn")
+	}
+	identity.Role = p.RoleFor(identity.Groups)
+	if identity.Role == "" {
+		return nil, ErrLDAPNoRole
+	}
+	return identity, nil
+}
+
+func (p *LDAPProvider) connect() (*ldap.Conn, error) {
+	u, err := url.Parse(p.settings.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ldap url: %w", err)
+	}
+	tlsConfig, err := p.tlsConfig(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := ldap.DialURL(p.settings.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if p.settings.StartTLS && strings.EqualFold(u.Scheme, "ldap") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (p *LDAPProvider) tlsConfig(host string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: p.settings.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if p.settings.CACertFile != "" {
+		pem, err := os.ReadFile(p.settings.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ldap ca cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("ldap ca cert contains no certificates")
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
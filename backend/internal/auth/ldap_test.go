@@ -0,0 +1,402 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+)
+
+const (
+	stubServiceDN       = "cn=svc,dc=example,dc=com"
+	stubServicePassword = "svc-pass"
+)
+
+type ldapStubUser struct {
+	dn       string
+	uid      string
+	password string
+	mail     string
+	name     string
+	groups   []string
+}
+
+// ldapStub is a minimal in-process LDAP server supporting simple bind, subtree
+// search by uid and StartTLS; enough to exercise LDAPProvider end to end.
+type ldapStub struct {
+	ln       net.Listener
+	tlsConf  *tls.Config
+	mu       sync.Mutex
+	users    []ldapStubUser
+	startTLS bool
+}
+
+func startLDAPStub(t *testing.T, users ...ldapStubUser) *ldapStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	stub := &ldapStub{ln: ln, users: users, tlsConf: selfSignedTLS(t)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+	return stub
+}
+
+func (s *ldapStub) url() string { return "ldap://" + s.ln.Addr().String() }
+
+func (s *ldapStub) setGroups(uid string, groups []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.users {
+		if s.users[i].uid == uid {
+			s.users[i].groups = groups
+		}
+	}
+}
+
+func (s *ldapStub) usedStartTLS() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.startTLS
+}
+
+func (s *ldapStub) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if s.validBind(name, password) {
+				code = ldap.LDAPResultSuccess
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			s.mu.Lock()
+			for _, u := range s.users {
+				if strings.Contains(filter, "="+ldap.EscapeFilter(u.uid)+")") {
+					conn.Write(searchEntry(id, u).Bytes())
+				}
+			}
+			s.mu.Unlock()
+			conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationExtendedRequest:
+			conn.Write(ldapResult(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess).Bytes())
+			tlsConn := tls.Server(conn, s.tlsConf)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.startTLS = true
+			s.mu.Unlock()
+			conn = tlsConn
+		default:
+			return
+		}
+	}
+}
+
+func (s *ldapStub) validBind(dn, password string) bool {
+	if dn == stubServiceDN {
+		return password == stubServicePassword
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if strings.EqualFold(u.dn, dn) {
+			return password != "" && password == u.password
+		}
+	}
+	return false
+}
+
+func ldapEnvelope(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	packet.AppendChild(op)
+	return packet
+}
+
+func ldapResult(id int64, tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return ldapEnvelope(id, op)
+}
+
+func searchEntry(id int64, u ldapStubUser) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, u.dn, ""))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for name, values := range map[string][]string{
+		"uid":         {u.uid},
+		"mail":        {u.mail},
+		"displayName": {u.name},
+		"memberOf":    u.groups,
+	} {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return ldapEnvelope(id, op)
+}
+
+func selfSignedTLS(t *testing.T) *tls.Config {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ldap-stub"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create cert: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func stubLDAPSettings(stub *ldapStub) config.LDAPSettings {
+	return config.LDAPSettings{
+		Enabled:      true,
+		URL:          stub.url(),
+		BindDN:       stubServiceDN,
+		BindPassword: stubServicePassword,
+		BaseDN:       "dc=example,dc=com",
+		GroupRoles:   "cn=docker-admins,ou=groups,dc=example,dc=com=admin;operators=user",
+	}
+}
+
+var stubAlice = ldapStubUser{
+	dn:       "uid=alice,ou=people,dc=example,dc=com",
+	uid:      "alice",
+	password: "alice-pass",
+	mail:     "alice@example.com",
+	name:     "Alice Liddell",
+	groups:   []string{"cn=docker-admins,ou=groups,dc=example,dc=com"},
+}
+
+func TestLDAPGroupRoleMapping(t *testing.T) {
+	p := NewLDAPProvider(config.LDAPSettings{
+		GroupRoles:  "cn=Admins,ou=groups,dc=example,dc=com=admin; operators = user",
+		DefaultRole: "",
+	})
+	if got := p.RoleFor([]string{"CN=admins,OU=groups,DC=example,DC=com"}); got != "admin" {
+		t.Fatalf("expected DN match to map to admin, got %q", got)
+	}
+	if got := p.RoleFor([]string{"cn=operators,ou=groups,dc=example,dc=com"}); got != "user" {
+		t.Fatalf("expected CN match to map to user, got %q", got)
+	}
+	if got := p.RoleFor([]string{"cn=guests,dc=example,dc=com"}); got != "" {
+		t.Fatalf("expected no role for unmapped group, got %q", got)
+	}
+}
+
+func TestLDAPProviderAuthenticate(t *testing.T) {
+	stub := startLDAPStub(t, stubAlice)
+	p := NewLDAPProvider(stubLDAPSettings(stub))
+
+	identity, err := p.Authenticate("alice", "alice-pass")
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if identity.DN != stubAlice.dn || identity.Email != "alice@example.com" || identity.Name != "Alice Liddell" || identity.Role != "admin" {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+
+	if _, err := p.Authenticate("alice", "wrong"); err == nil {
+		t.Fatalf("expected wrong password to fail")
+	}
+	if _, err := p.Authenticate("alice", ""); err == nil {
+		t.Fatalf("expected empty password to be refused before binding")
+	}
+	if _, err := p.Authenticate("mallory", "x"); !errors.Is(err, ErrLDAPUserNotFound) {
+		t.Fatalf("expected ErrLDAPUserNotFound, got %v", err)
+	}
+	if _, err := p.Authenticate("*)(uid=*", "x"); !errors.Is(err, ErrLDAPUserNotFound) {
+		t.Fatalf("expected filter metacharacters to be escaped, got %v", err)
+	}
+}
+
+func TestLDAPProviderStartTLS(t *testing.T) {
+	stub := startLDAPStub(t, stubAlice)
+	settings := stubLDAPSettings(stub)
+	settings.StartTLS = true
+
+	if _, err := NewLDAPProvider(settings).Authenticate("alice", "alice-pass"); err == nil {
+		t.Fatalf("expected untrusted certificate to be rejected")
+	}
+
+	settings.InsecureSkipVerify = true
+	if _, err := NewLDAPProvider(settings).Authenticate("alice", "alice-pass"); err != nil {
+		t.Fatalf("authenticate over starttls: %v", err)
+	}
+	if !stub.usedStartTLS() {
+		t.Fatalf("expected the stub to have negotiated StartTLS")
+	}
+}
+
+func TestLDAPProviderRequiresMappedGroup(t *testing.T) {
+	bob := ldapStubUser{dn: "uid=bob,dc=example,dc=com", uid: "bob", password: "bob-pass", groups: []string{"cn=guests,dc=example,dc=com"}}
+	stub := startLDAPStub(t, bob)
+	settings := stubLDAPSettings(stub)
+
+	if _, err := NewLDAPProvider(settings).Authenticate("bob", "bob-pass"); !errors.Is(err, ErrLDAPNoRole) {
+		t.Fatalf("expected ErrLDAPNoRole, got %v", err)
+	}
+	settings.DefaultRole = "user"
+	identity, err := NewLDAPProvider(settings).Authenticate("bob", "bob-pass")
+	if err != nil || identity.Role != "user" {
+		t.Fatalf("expected default role, got %+v %v", identity, err)
+	}
+}
+
+func TestAuthServiceLDAPProvisioning(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&Account{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	stub := startLDAPStub(t, stubAlice)
+	settings := stubLDAPSettings(stub)
+	svc := NewAuthService(db, nil, "secret")
+	svc.SetLDAP(settings)
+
+	if _, err := svc.Authenticate("alice", "alice-pass"); err == nil {
+		t.Fatalf("expected login to fail without JIT provisioning")
+	}
+
+	settings.JITProvisioning = true
+	svc.SetLDAP(settings)
+	account, err := svc.Authenticate("alice", "alice-pass")
+	if err != nil {
+		t.Fatalf("authenticate with JIT: %v", err)
+	}
+	if account.AuthSource != AuthSourceLDAP || account.Role != "admin" || account.Email != "alice@example.com" {
+		t.Fatalf("unexpected provisioned account: %+v", account)
+	}
+
+	// Role follows directory group changes on the next login.
+	stub.setGroups("alice", []string{"cn=operators,ou=groups,dc=example,dc=com"})
+	account, err = svc.Authenticate("alice", "alice-pass")
+	if err != nil || account.Role != "user" {
+		t.Fatalf("expected role to sync to user, got %+v %v", account, err)
+	}
+
+	if _, err := svc.UpdateAccount("alice", "", "", "alice-pass", "another-pass-1"); err == nil {
+		t.Fatalf("expected directory users to be unable to set a local password")
+	}
+	if _, _, err := svc.GeneratePasswordResetToken("alice@example.com"); err == nil {
+		t.Fatalf("expected no local reset token for directory users")
+	}
+
+	// Local accounts keep using their own password even with LDAP enabled.
+	local := &Account{Username: "localadmin", Role: "admin"}
+	svc.policy.apply(local, "local-admin-pass")
+	if err := db.Create(local).Error; err != nil {
+		t.Fatalf("create local account: %v", err)
+	}
+	if _, err := svc.Authenticate("localadmin", "local-admin-pass"); err != nil {
+		t.Fatalf("local login: %v", err)
+	}
+}
+
+func TestAuthServiceLDAPMappedUsername(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&Account{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	alice := stubAlice
+	alice.mail = "Alice@Example.com"
+	bob := ldapStubUser{dn: "uid=bob,dc=example,dc=com", uid: "bob", password: "bob-pass", mail: "bob@example.com",
+		groups: []string{"cn=docker-admins,ou=groups,dc=example,dc=com"}}
+	stub := startLDAPStub(t, alice, bob)
+	settings := stubLDAPSettings(stub)
+	settings.JITProvisioning = true
+	settings.UsernameAttribute = "mail"
+	svc := NewAuthService(db, nil, "secret")
+	svc.SetLDAP(settings)
+
+	// Users sign in with their uid; the account is named after the mapped attribute.
+	first, err := svc.Authenticate("alice", "alice-pass")
+	if err != nil || first.Username != "Alice@Example.com" {
+		t.Fatalf("expected an account named by the mail attribute, got %+v (%v)", first, err)
+	}
+	again, err := svc.Authenticate("alice", "alice-pass")
+	if err != nil || again.ID != first.ID {
+		t.Fatalf("expected the next login to find the provisioned account, got %+v (%v)", again, err)
+	}
+	var count int64
+	db.Model(&Account{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected one account, got %d", count)
+	}
+
+	// A local account with the directory username is not taken over by the directory user.
+	local := &Account{Username: "Bob@example.com", Role: "admin"}
+	svc.policy.apply(local, "local-admin-pass")
+	if err := db.Create(local).Error; err != nil {
+		t.Fatalf("create local account: %v", err)
+	}
+	if _, err := svc.Authenticate("bob", "bob-pass"); err == nil {
+		t.Fatalf("expected the directory login to be refused")
+	}
+}
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+)
+
+const minPasswordLength = 8
+
+// PasswordPolicyError lists every rule a candidate password failed. Err is set when a
+// rule could not be checked, such as an unreadable breach list.
+type PasswordPolicyError struct {
+	Violations []string
+	Err        error
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet policy: " + strings.Join(e.Violations, "; ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error { return e.Err }
+
+// BreachedPasswordChecker reports whether a password appears in a breach corpus.
+type BreachedPasswordChecker interface {
+	Breached(password string) (bool, error)
+}
+
+// PasswordPolicy validates new passwords for local accounts.
+type PasswordPolicy struct {
+	settings config.PasswordPolicySettings
+	breached BreachedPasswordChecker
+}
+
+func NewPasswordPolicy(settings config.PasswordPolicySettings) PasswordPolicy {
+	if settings.MinLength < minPasswordLength {
+		settings.MinLength = minPasswordLength
+	}
+	if settings.HistorySize < 0 {
+		settings.HistorySize = 0
+	}
+	policy := PasswordPolicy{settings: settings}
+	if path := strings.TrimSpace(settings.BreachedListPath); path != "" {
+		policy.breached = BreachedPasswordFile{Path: path}
+	}
+	return policy
+}
+
+// Validate checks composition rules, the breach list and the account's password history.
+// account may be nil when creating a new account.
+func (p PasswordPolicy) Validate(password string, account *domain.Account) error {
+	var violations []string
+	if len([]rune(password)) < p.settings.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.settings.MinLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.settings.RequireUpper && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.settings.RequireLower && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.settings.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.settings.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if account != nil && len(account.Username) >= 3 &&
+		strings.Contains(strings.ToLower(password), strings.ToLower(account.Username)) {
+		violations = append(violations, "must not contain the username")
+	}
+
+	if account != nil && p.reused(password, account) {
+		violations = append(violations, fmt.Sprintf("must not match any of the last %d passwords", p.settings.HistorySize))
+	}
+
+	var checkErr error
+	if p.breached != nil {
+		// The breach check fails closed: a list that cannot be read rejects the password
+		// rather than letting a breached one through.
+		found, err := p.breached.Breached(password)
+		switch {
+		case err != nil:
+			checkErr = fmt.Errorf("check breached passwords: %w", err)
+			violations = append(violations, "cannot be checked against the breached password list; ask an administrator")
+		case found:
+			violations = append(violations, "appears in a known data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations, Err: checkErr}
+	}
+	return nil
+}
+
+func (p PasswordPolicy) reused(password string, account *domain.Account) bool {
+	if p.settings.HistorySize == 0 {
+		return false
+	}
+	if account.PasswordHash != "" && checkPassword(account.PasswordHash, password) {
+		return true
+	}
+	for _, hash := range account.PasswordHistory {
+		if checkPassword(hash, password) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply stores the new password hash and rotates the previous one into history.
+func (p PasswordPolicy) apply(account *domain.Account, password string) {
+	// HistorySize counts the current password, so only HistorySize-1 previous hashes are kept.
+	keep := p.settings.HistorySize - 1
+	if account.PasswordHash != "" && keep > 0 {
+		history := append(domain.StringList{account.PasswordHash}, account.PasswordHistory...)
+		if len(history) > keep {
+			history = history[:keep]
+		}
+		account.PasswordHistory = history
+	} else if keep <= 0 {
+		account.PasswordHistory = nil
+	}
+	account.PasswordHash = hashSecret(password)
+	now := time.Now()
+	account.PasswordChangedAt = &now
+}
+
+// Expired reports whether the account password is older than the configured maximum age.
+func (p PasswordPolicy) Expired(account *domain.Account) bool {
+	if p.settings.MaxAgeDays <= 0 || account == nil || account.PasswordHash == "" {
+		return false
+	}
+	changed := account.CreatedAt
+	if account.PasswordChangedAt != nil {
+		changed = *account.PasswordChangedAt
+	}
+	return time.Since(changed) > time.Duration(p.settings.MaxAgeDays)*24*time.Hour
+}
+
+// BreachedPasswordFile looks up SHA-1 hashes in an offline Pwned Passwords export.
+// A directory is treated as k-anonymity range files (<PREFIX> containing SUFFIX:COUNT);
+// a regular file must contain full HASH:COUNT lines sorted by hash.
+type BreachedPasswordFile struct {
+	Path string
+}
+
+// ValidateBreachedList checks that path holds a breach list BreachedPasswordFile can read:
+// a directory, or a file whose first line is a HASH:COUNT entry.
+func ValidateBreachedList(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("breached password list: %w", err)
+	}
+	if info.IsDir() {
+		if _, err := os.ReadDir(path); err != nil {
+			return fmt.Errorf("breached password list: %w", err)
+		}
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("breached password list: %w", err)
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("breached password list: %w", err)
+	}
+	hash, _, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if _, hexErr := hex.DecodeString(hash); !ok || len(hash) != 2*sha1.Size || hexErr != nil {
+		return fmt.Errorf("breached password list: %s does not start with a SHA-1 HASH:COUNT line", path)
+	}
+	return nil
+}
+
+func (b BreachedPasswordFile) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	info, err := os.Stat(b.Path)
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() {
+		return b.lookupRange(hash)
+	}
+	return b.lookupSorted(hash, info.Size())
+}
+
+func (b BreachedPasswordFile) lookupRange(hash string) (bool, error) {
+	prefix, suffix := hash[:5], hash[5:]
+	var f *os.File
+	var err error
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		if f, err = os.Open(filepath.Join(b.Path, name)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if matchHashLine(scanner.Text(), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// lookupSorted binary-searches the byte range of a sorted file, resyncing on line boundaries.
+func (b BreachedPasswordFile) lookupSorted(hash string, size int64) (bool, error) {
+	f, err := os.Open(b.Path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, next, line, err := lineAt(f, mid, lo)
+		if err != nil {
+			return false, err
+		}
+		if line == "" || start >= hi {
+			hi = mid
+			continue
+		}
+		candidate := strings.ToUpper(strings.SplitN(line, ":", 2)[0])
+		switch {
+		case candidate == hash:
+			return true, nil
+		case candidate < hash:
+			lo = next
+		default:
+			hi = start
+		}
+	}
+	return false, nil
+}
+
+// lineAt returns the first complete line starting at or after off, along with its start
+// offset and the offset of the following line. off == floor is assumed to be a line start.
+func lineAt(f *os.File, off, floor int64) (int64, int64, string, error) {
+	start := off
+	if off > floor {
+		// Step back one byte so a line starting exactly at off is not skipped.
+		start = off - 1
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return 0, 0, "", err
+	}
+	reader := bufio.NewReader(f)
+	if off > floor {
+		skipped, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return off, off, "", nil
+			}
+			return 0, 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+	raw, err := reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, 0, "", err
+	}
+	return start, start + int64(len(raw)), strings.TrimRight(raw, "\r\n"), nil
+}
+
+func matchHashLine(line, suffix string) bool {
+	candidate := strings.SplitN(strings.TrimSpace(line), ":", 2)[0]
+	return strings.EqualFold(candidate, suffix)
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+)
+
+func sha1Hex(value string) string {
+	sum := sha1.Sum([]byte(value))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestPasswordPolicyComposition(t *testing.T) {
+	policy := NewPasswordPolicy(config.PasswordPolicySettings{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	})
+
+	err := policy.Validate("short", nil)
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected policy error, got %v", err)
+	}
+	if len(policyErr.Violations) != 4 {
+		t.Fatalf("expected length, upper, digit and symbol violations, got %v", policyErr.Violations)
+	}
+
+	if err := policy.Validate("Correct-Horse-42", nil); err != nil {
+		t.Fatalf("expected compliant password to pass: %v", err)
+	}
+	if err := policy.Validate("Admin-Password-42", &domain.Account{Username: "admin"}); err == nil {
+		t.Fatalf("expected password containing username to be rejected")
+	}
+}
+
+func TestPasswordPolicyMinimumFloor(t *testing.T) {
+	policy := NewPasswordPolicy(config.PasswordPolicySettings{MinLength: 2})
+	if err := policy.Validate("abc", nil); err == nil {
+		t.Fatalf("expected the built-in minimum length to apply")
+	}
+}
+
+func TestPasswordPolicyHistory(t *testing.T) {
+	policy := NewPasswordPolicy(config.PasswordPolicySettings{HistorySize: 2})
+	account := &domain.Account{Username: "bob"}
+
+	policy.apply(account, "first-password")
+	policy.apply(account, "second-password")
+	policy.apply(account, "third-password")
+
+	if len(account.PasswordHistory) != 1 {
+		t.Fatalf("expected one previous hash besides the current one, got %d", len(account.PasswordHistory))
+	}
+	for _, reused := range []string{"third-password", "second-password"} {
+		if err := policy.Validate(reused, account); err == nil {
+			t.Fatalf("expected %q to be rejected as reused", reused)
+		}
+	}
+	if err := policy.Validate("first-password", account); err != nil {
+		t.Fatalf("expected password older than history to be accepted: %v", err)
+	}
+	if account.PasswordChangedAt == nil {
+		t.Fatalf("expected PasswordChangedAt to be set")
+	}
+}
+
+func TestPasswordPolicyExpiry(t *testing.T) {
+	policy := NewPasswordPolicy(config.PasswordPolicySettings{MaxAgeDays: 30})
+	old := time.Now().Add(-31 * 24 * time.Hour)
+	account := &domain.Account{PasswordHash: "x", PasswordChangedAt: &old}
+	if !policy.Expired(account) {
+		t.Fatalf("expected password to be expired")
+	}
+	recent := time.Now()
+	account.PasswordChangedAt = &recent
+	if policy.Expired(account) {
+		t.Fatalf("expected recent password to be valid")
+	}
+	if NewPasswordPolicy(config.PasswordPolicySettings{}).Expired(&domain.Account{PasswordHash: "x"}) {
+		t.Fatalf("expected no expiry when max age is disabled")
+	}
+}
+
+func TestBreachedPasswordRangeDirectory(t *testing.T) {
+	dir := t.TempDir()
+	hash := sha1Hex("password123")
+	content := "0000000000000000000000000000000000A:1\r\n" + hash[5:] + ":250\r\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := NewPasswordPolicy(config.PasswordPolicySettings{BreachedListPath: dir})
+	if err := policy.Validate("password123", nil); err == nil {
+		t.Fatalf("expected breached password to be rejected")
+	}
+	if err := policy.Validate("not-in-the-list-77", nil); err != nil {
+		t.Fatalf("expected unknown password to pass: %v", err)
+	}
+}
+
+func TestBreachedPasswordSortedFile(t *testing.T) {
+	words := []string{"letmein", "qwerty", "dragon", "monkey", "sunshine", "iloveyou", "trustno1", "baseball1"}
+	lines := make([]string, 0, len(words))
+	for i, w := range words {
+		lines = append(lines, sha1Hex(w)+":"+strings.Repeat("9", i+1))
+	}
+	sort.Strings(lines)
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list := BreachedPasswordFile{Path: path}
+	for _, w := range words {
+		found, err := list.Breached(w)
+		if err != nil || !found {
+			t.Fatalf("expected %q to be found, got %v %v", w, found, err)
+		}
+	}
+	for _, w := range []string{"", "correct horse battery staple", "zzzzzz"} {
+		found, err := list.Breached(w)
+		if err != nil || found {
+			t.Fatalf("expected %q to be absent, got %v %v", w, found, err)
+		}
+	}
+}
+
+func TestBreachedListValidation(t *testing.T) {
+	dir := t.TempDir()
+	sorted := filepath.Join(dir, "pwned.txt")
+	if err := os.WriteFile(sorted, []byte(sha1Hex("dragon")+":12\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("not a breach list\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{dir, sorted} {
+		if err := ValidateBreachedList(path); err != nil {
+			t.Fatalf("expected %s to be accepted: %v", path, err)
+		}
+	}
+	for _, path := range []string{filepath.Join(dir, "missing"), notes} {
+		if err := ValidateBreachedList(path); err == nil {
+			t.Fatalf("expected %s to be refused", path)
+		}
+	}
+
+	// A list that disappears later rejects passwords with a reason instead of failing.
+	policy := NewPasswordPolicy(config.PasswordPolicySettings{BreachedListPath: filepath.Join(dir, "missing")})
+	var policyErr *PasswordPolicyError
+	err := policy.Validate("Correct-Horse-7", nil)
+	if !errors.As(err, &policyErr) || policyErr.Err == nil || !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a policy error carrying the cause, got %v", err)
+	}
+}
+
+func TestResetPasswordWithTokenEnforcesPolicy(t *testing.T) {
+	db := newTestDB(t)
+	svc := NewAuthService(db, nil, "secret")
+	svc.SetPasswordPolicy(config.PasswordPolicySettings{HistorySize: 3})
+	account := &Account{Username: "carol", Email: "carol@example.com"}
+	svc.policy.apply(account, "original-secret-1")
+	if err := db.Create(account).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+
+	token, _, err := svc.GeneratePasswordResetToken("carol@example.com")
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	if err := svc.ResetPasswordWithToken(token, "original-secret-1"); err == nil {
+		t.Fatalf("expected reuse of the current password to be rejected")
+	}
+	if err := svc.ResetPasswordWithToken(token, "brand-new-secret-2"); err != nil {
+		t.Fatalf("expected token to remain usable after a policy failure: %v", err)
+	}
+}
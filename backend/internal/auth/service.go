@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"image/png"
 	"strings"
 	"time"
@@ -15,6 +16,7 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
+	"updockly/backend/internal/config"
 	"updockly/backend/internal/domain"
 	"updockly/backend/internal/util"
 	"updockly/backend/internal/vault"
@@ -32,6 +34,8 @@ type AuthService struct {
 	vault        *vault.Vault
 	jwtPrimary   []byte
 	jwtFallbacks [][]byte
+	policy       PasswordPolicy
+	ldap         *LDAPProvider
 }
 
 func NewAuthService(db *gorm.DB, vault *vault.Vault, jwtPrimary string, jwtFallbacks ...string) *AuthService {
@@ -66,6 +70,7 @@ func NewAuthService(db *gorm.DB, vault *vault.Vault, jwtPrimary string, jwtFallb
 			}
 			return nil
 		}(),
+		policy: NewPasswordPolicy(config.PasswordPolicySettings{}),
 	}
 }
 
@@ -162,19 +167,116 @@ func (s *AuthService) VerifyToken(tokenString string) (*TokenClaims, error) {
 	return nil, errors.New("invalid token")
 }
 
+// Authenticate checks local accounts first; directory users (and unknown usernames when
+// LDAP is enabled) are verified with an LDAP bind.
 func (s *AuthService) Authenticate(username, password string) (*domain.Account, error) {
 	var account domain.Account
-	if err := s.db.Where("username = ?", username).First(&account).Error; err != nil {
+	err := s.db.Where("username = ?", username).First(&account).Error
+	if err == nil && account.AuthSource != AuthSourceLDAP {
+		if !checkPassword(account.PasswordHash, password) {
+			return nil, errors.New("invalid credentials")
+		}
+		return &account, nil
+	}
+	if !s.ldap.Enabled() {
 		return nil, errors.New("invalid credentials")
 	}
 
-	if !checkPassword(account.PasswordHash, password) {
-		return nil, errors.New("invalid credentials")
+	identity, ldapErr := s.ldap.Authenticate(username, password)
+	if ldapErr != nil {
+		return nil, fmt.Errorf("invalid credentials: %w", ldapErr)
 	}
+	if err != nil {
+		// The directory may name the user differently from how they typed it, through
+		// UsernameAttribute or in case, so its username finds an account provisioned before.
+		err = s.db.Where("LOWER(username) = LOWER(?)", identity.Username).First(&account).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.provisionLDAPAccount(identity)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if account.AuthSource != AuthSourceLDAP {
+			return nil, errors.New("invalid credentials: a local account has the directory username")
+		}
+	}
+	return s.syncLDAPAccount(&account, identity)
+}
 
+// SetLDAP replaces the directory provider used by Authenticate.
+func (s *AuthService) SetLDAP(settings config.LDAPSettings) {
+	s.ldap = NewLDAPProvider(settings)
+}
+
+func (s *AuthService) provisionLDAPAccount(identity *LDAPIdentity) (*domain.Account, error) {
+	if !s.ldap.JITProvisioning() {
+		return nil, errors.New("invalid credentials: ldap user has no local account")
+	}
+	name := identity.Name
+	if name == "" {
+		name = identity.Username
+	}
+	account := domain.Account{
+		Username: identity.Username,
+		Email:    identity.Email,
+		Name:     name,
+		Role:     identity.Role,
+		// Directory users never authenticate with a local password.
+		PasswordHash: hashSecret(util.RandomString(32)),
+		AuthSource:   AuthSourceLDAP,
+	}
+	if err := s.db.Create(&account).Error; err != nil {
+		return nil, err
+	}
 	return &account, nil
 }
 
+// syncLDAPAccount refreshes profile and role from the directory on each login.
+func (s *AuthService) syncLDAPAccount(account *domain.Account, identity *LDAPIdentity) (*domain.Account, error) {
+	updates := map[string]interface{}{"role": identity.Role}
+	account.Role = identity.Role
+	if identity.Email != "" {
+		updates["email"] = identity.Email
+		account.Email = identity.Email
+	}
+	if identity.Name != "" {
+		updates["name"] = identity.Name
+		account.Name = identity.Name
+	}
+	if err := s.db.Model(&domain.Account{}).Where("id = ?", account.ID).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// VerifyPassword re-checks the password of an authenticated user before sensitive changes.
+func (s *AuthService) VerifyPassword(username, password string) error {
+	var account domain.Account
+	if err := s.db.Where("username = ?", username).First(&account).Error; err != nil {
+		return err
+	}
+	if account.AuthSource == AuthSourceLDAP {
+		if _, err := s.ldap.Authenticate(account.Username, password); err != nil {
+			return errors.New("invalid password")
+		}
+		return nil
+	}
+	if !checkPassword(account.PasswordHash, password) {
+		return errors.New("invalid password")
+	}
+	return nil
+}
+
+// SetPasswordPolicy replaces the policy enforced when passwords are set or changed.
+func (s *AuthService) SetPasswordPolicy(settings config.PasswordPolicySettings) {
+	s.policy = NewPasswordPolicy(settings)
+}
+
+// PasswordExpired reports whether the account must change its password under the max-age rule.
+func (s *AuthService) PasswordExpired(account *domain.Account) bool {
+	return s.policy.Expired(account)
+}
+
 func (s *AuthService) GetAccount(username string) (*domain.Account, error) {
 	var account domain.Account
 	if err := s.db.Where("username = ?", username).First(&account).Error; err != nil {
@@ -190,13 +292,19 @@ func (s *AuthService) UpdateAccount(username, name, email, currentPassword, newP
 	}
 
 	if newPassword != "" {
+		if account.AuthSource == AuthSourceLDAP {
+			return nil, errors.New("password is managed by the directory")
+		}
 		if currentPassword == "" {
 			return nil, errors.New("current password required to change password")
 		}
 		if !checkPassword(account.PasswordHash, currentPassword) {
 			return nil, errors.New("invalid current password")
 		}
-		account.PasswordHash = hashSecret(newPassword)
+		if err := s.policy.Validate(newPassword, &account); err != nil {
+			return nil, err
+		}
+		s.policy.apply(&account, newPassword)
 	}
 
 	if strings.TrimSpace(name) != "" {
@@ -239,6 +347,10 @@ func verifyRecoveryCode(code string, hashedCodes []string) (int, bool) {
 }
 
 func (s *AuthService) CreateAdmin(username, email, password, name, totpSecret string) ([]string, error) {
+	if err := s.policy.Validate(password, &domain.Account{Username: username}); err != nil {
+		return nil, err
+	}
+
 	cipher, err := s.vault.Encrypt(totpSecret)
 	if err != nil {
 		return nil, err
@@ -253,11 +365,11 @@ func (s *AuthService) CreateAdmin(username, email, password, name, totpSecret st
 		Username:         username,
 		Email:            email,
 		Name:             fullName,
-		PasswordHash:     hashSecret(password),
 		Role:             "admin",
 		TwoFactorSecret:  cipher,
 		TwoFactorEnabled: true,
 	}
+	s.policy.apply(&account, password)
 
 	codes := make([]string, 10)
 	for i := 0; i < 10; i++ {
@@ -536,9 +648,13 @@ func (s *AuthService) ResetPasswordWithRecoveryCode(username, code, newPassword
 		return errors.New("invalid recovery code")
 	}
 
+	if err := s.policy.Validate(newPassword, &account); err != nil {
+		return err
+	}
+
 	// Remove used code
 	account.RecoveryCodes = append(account.RecoveryCodes[:idx], account.RecoveryCodes[idx+1:]...)
-	account.PasswordHash = hashSecret(newPassword)
+	s.policy.apply(&account, newPassword)
 
 	return s.db.Save(&account).Error
 }
@@ -605,7 +721,7 @@ func (s *AuthService) FindAccountForSSO(identifier string) (*domain.Account, err
 
 func (s *AuthService) GeneratePasswordResetToken(email string) (string, *domain.Account, error) {
 	var account domain.Account
-	if err := s.db.Where("email = ?", email).First(&account).Error; err != nil {
+	if err := s.db.Where("email = ? AND (auth_source IS NULL OR auth_source <> ?)", email, AuthSourceLDAP).First(&account).Error; err != nil {
 		return "", nil, errors.New("user not found")
 	}
 
@@ -640,7 +756,12 @@ func (s *AuthService) ResetPasswordWithToken(token, newPassword string) error {
 		return errors.New("token expired")
 	}
 
-	account.PasswordHash = hashSecret(newPassword)
+	// Keep the token valid on policy failures so the user can retry with a stronger password.
+	if err := s.policy.Validate(newPassword, &account); err != nil {
+		return err
+	}
+
+	s.policy.apply(&account, newPassword)
 	account.ResetToken = ""
 	account.ResetTokenHash = ""
 	account.ResetTokenExpiry = nil
@@ -0,0 +1,528 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+)
+
+const (
+	webAuthnPurposeRegister     = "register"
+	webAuthnPurposeLogin        = "login"
+	webAuthnPurposePasswordless = "passwordless"
+
+	webAuthnSessionTTL = 5 * time.Minute
+)
+
+var (
+	ErrWebAuthnDisabled      = errors.New("webauthn not enabled")
+	ErrWebAuthnSession       = errors.New("invalid or expired webauthn session")
+	ErrWebAuthnNoCredentials = errors.New("no webauthn credentials registered")
+	ErrWebAuthnPasswordless  = errors.New("passwordless login not enabled")
+	// ErrWebAuthnHardwareKey refuses a synced passkey where a hardware key is mandated.
+	ErrWebAuthnHardwareKey = errors.New("admins must register a hardware security key; synced passkeys are not accepted")
+	// ErrWebAuthnLastHardwareKey refuses removing the last hardware key of an admin who
+	// must use one.
+	ErrWebAuthnLastHardwareKey = errors.New("register another hardware security key before removing the last one")
+)
+
+// WebAuthnService manages security keys and passkeys registered against accounts.
+// Ceremony state is kept in the database so begin/finish calls may hit different replicas.
+type WebAuthnService struct {
+	db       *gorm.DB
+	wa       *webauthn.WebAuthn
+	settings config.WebAuthnSettings
+}
+
+// NewWebAuthnService builds the relying party from settings. When WebAuthn is disabled the
+// returned service is still usable for listing/removing credentials but refuses ceremonies.
+func NewWebAuthnService(db *gorm.DB, settings config.WebAuthnSettings, clientOrigin string) (*WebAuthnService, error) {
+	svc := &WebAuthnService{db: db, settings: settings}
+	if !settings.Enabled {
+		return svc, nil
+	}
+
+	rpID, origins := WebAuthnRelyingParty(settings, clientOrigin)
+	displayName := strings.TrimSpace(settings.RPDisplayName)
+	if displayName == "" {
+		displayName = "Updockly"
+	}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: displayName,
+		RPOrigins:     origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnSessionTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnSessionTTL},
+		},
+	})
+	if err != nil {
+		return svc, err
+	}
+	svc.wa = wa
+	return svc, nil
+}
+
+// WebAuthnRelyingParty resolves the RP ID and allowed origins, defaulting to CLIENT_ORIGIN.
+func WebAuthnRelyingParty(settings config.WebAuthnSettings, clientOrigin string) (string, []string) {
+	rawOrigins := strings.TrimSpace(settings.Origins)
+	if rawOrigins == "" {
+		rawOrigins = clientOrigin
+	}
+	origins := make([]string, 0)
+	for _, origin := range strings.Split(rawOrigins, ",") {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	rpID := strings.TrimSpace(settings.RPID)
+	if rpID == "" && len(origins) > 0 {
+		if u, err := url.Parse(origins[0]); err == nil {
+			rpID = u.Hostname()
+		}
+	}
+	return rpID, origins
+}
+
+func (s *WebAuthnService) Enabled() bool {
+	return s != nil && s.wa != nil && s.db != nil
+}
+
+func (s *WebAuthnService) PasswordlessEnabled() bool {
+	return s.Enabled() && s.settings.AllowPasswordless
+}
+
+func (s *WebAuthnService) RequiredForAdmins() bool {
+	return s.Enabled() && s.settings.RequireForAdmins
+}
+
+// HardwareKeyRequired reports whether the account must use a hardware key. Only keys
+// that are not backup eligible count: a synced passkey can be copied off the device.
+func (s *WebAuthnService) HardwareKeyRequired(account domain.Account) bool {
+	return s.RequiredForAdmins() && account.Role == "admin"
+}
+
+type webAuthnUser struct {
+	account     domain.Account
+	credentials []domain.WebAuthnCredential
+}
+
+func (u webAuthnUser) WebAuthnID() []byte { return []byte(u.account.ID) }
+
+func (u webAuthnUser) WebAuthnName() string { return u.account.Username }
+
+func (u webAuthnUser) WebAuthnDisplayName() string {
+	if strings.TrimSpace(u.account.Name) != "" {
+		return u.account.Name
+	}
+	return u.account.Username
+}
+
+func (u webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	out := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, cred := range u.credentials {
+		out = append(out, toLibraryCredential(cred))
+	}
+	return out
+}
+
+func toLibraryCredential(cred domain.WebAuthnCredential) webauthn.Credential {
+	id, _ := base64.RawURLEncoding.DecodeString(cred.CredentialID)
+	transports := make([]protocol.AuthenticatorTransport, 0, len(cred.Transports))
+	for _, t := range cred.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(t))
+	}
+	return webauthn.Credential{
+		ID:              id,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserPresent:    cred.UserPresent,
+			UserVerified:   cred.UserVerified,
+			BackupEligible: cred.BackupEligible,
+			BackupState:    cred.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    cred.AAGUID,
+			SignCount: cred.SignCount,
+		},
+	}
+}
+
+// loadUser returns the account with the credentials it may sign in with; an account that
+// must use a hardware key cannot sign in with a synced passkey.
+func (s *WebAuthnService) loadUser(account domain.Account) (webAuthnUser, error) {
+	creds, err := s.ListCredentials(account.ID)
+	if err != nil {
+		return webAuthnUser{}, err
+	}
+	if s.HardwareKeyRequired(account) {
+		hardware := creds[:0]
+		for _, cred := range creds {
+			if !cred.BackupEligible {
+				hardware = append(hardware, cred)
+			}
+		}
+		creds = hardware
+	}
+	return webAuthnUser{account: account, credentials: creds}, nil
+}
+
+// ListCredentials returns the credentials registered by an account, newest first.
+func (s *WebAuthnService) ListCredentials(accountID string) ([]domain.WebAuthnCredential, error) {
+	if s == nil || s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	creds := []domain.WebAuthnCredential{}
+	err := s.db.Session(&gorm.Session{Logger: logger.Discard}).
+		Where("account_id = ?", accountID).
+		Order("created_at DESC").
+		Find(&creds).Error
+	return creds, err
+}
+
+func (s *WebAuthnService) HasCredentials(accountID string) bool {
+	if s == nil || s.db == nil {
+		return false
+	}
+	var count int64
+	if err := s.db.Session(&gorm.Session{Logger: logger.Discard}).
+		Model(&domain.WebAuthnCredential{}).
+		Where("account_id = ?", accountID).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// HasHardwareKey reports whether the account registered a key that is not backup
+// eligible.
+func (s *WebAuthnService) HasHardwareKey(accountID string) bool {
+	if s == nil || s.db == nil {
+		return false
+	}
+	var count int64
+	if err := s.db.Session(&gorm.Session{Logger: logger.Discard}).
+		Model(&domain.WebAuthnCredential{}).
+		Where("account_id = ? AND backup_eligible = ?", accountID, false).
+		Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+func (s *WebAuthnService) RenameCredential(accountID, id, name string) error {
+	if s == nil || s.db == nil {
+		return errors.New("database not ready")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("name is required")
+	}
+	result := s.db.Model(&domain.WebAuthnCredential{}).
+		Where("id = ? AND account_id = ?", id, accountID).
+		Update("name", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteCredential removes a credential of the account. The last hardware key of an
+// account that must use one is kept.
+func (s *WebAuthnService) DeleteCredential(account domain.Account, id string) error {
+	if s == nil || s.db == nil {
+		return errors.New("database not ready")
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var cred domain.WebAuthnCredential
+		if err := tx.Where("id = ? AND account_id = ?", id, account.ID).First(&cred).Error; err != nil {
+			return err
+		}
+		if s.HardwareKeyRequired(account) && !cred.BackupEligible {
+			var others int64
+			if err := tx.Model(&domain.WebAuthnCredential{}).
+				Where("account_id = ? AND id <> ? AND backup_eligible = ?", account.ID, id, false).
+				Count(&others).Error; err != nil {
+				return err
+			}
+			if others == 0 {
+				return ErrWebAuthnLastHardwareKey
+			}
+		}
+		return tx.Delete(&cred).Error
+	})
+}
+
+// BeginRegistration starts enrolling a new credential for the account.
+func (s *WebAuthnService) BeginRegistration(account domain.Account) (*protocol.CredentialCreation, string, error) {
+	if !s.Enabled() {
+		return nil, "", ErrWebAuthnDisabled
+	}
+	user, err := s.loadUser(account)
+	if err != nil {
+		return nil, "", err
+	}
+
+	residentKey := protocol.ResidentKeyRequirementDiscouraged
+	if s.settings.AllowPasswordless {
+		residentKey = protocol.ResidentKeyRequirementPreferred
+	}
+	opts := []webauthn.RegistrationOption{
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(residentKey),
+	}
+	if s.HardwareKeyRequired(account) {
+		// Ask the browser for a roaming key, not the platform authenticator. The client can
+		// ignore this, so FinishRegistration checks the backup flag the key signs.
+		opts = append(opts, func(cco *protocol.PublicKeyCredentialCreationOptions) {
+			cco.AuthenticatorSelection.AuthenticatorAttachment = protocol.CrossPlatform
+		})
+	}
+	creation, session, err := s.wa.BeginRegistration(user, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	sessionID, err := s.saveSession(account.ID, webAuthnPurposeRegister, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, sessionID, nil
+}
+
+// FinishRegistration verifies the attestation response and stores the credential.
+func (s *WebAuthnService) FinishRegistration(account domain.Account, sessionID, name string, response []byte) (*domain.WebAuthnCredential, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnDisabled
+	}
+	session, err := s.consumeSession(sessionID, account.ID, webAuthnPurposeRegister)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.loadUser(account)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := s.wa.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, err
+	}
+	if s.HardwareKeyRequired(account) && cred.Flags.BackupEligible {
+		return nil, ErrWebAuthnHardwareKey
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Security key"
+	}
+	transports := make(domain.StringList, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+	record := domain.WebAuthnCredential{
+		AccountID:       account.ID,
+		Name:            name,
+		CredentialID:    base64.RawURLEncoding.EncodeToString(cred.ID),
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transports:      transports,
+		AAGUID:          cred.Authenticator.AAGUID,
+		SignCount:       cred.Authenticator.SignCount,
+		UserPresent:     cred.Flags.UserPresent,
+		UserVerified:    cred.Flags.UserVerified,
+		BackupEligible:  cred.Flags.BackupEligible,
+		BackupState:     cred.Flags.BackupState,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// BeginLogin starts a second-factor assertion for an account that already passed the password step.
+func (s *WebAuthnService) BeginLogin(account domain.Account) (*protocol.CredentialAssertion, string, error) {
+	if !s.Enabled() {
+		return nil, "", ErrWebAuthnDisabled
+	}
+	user, err := s.loadUser(account)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(user.credentials) == 0 {
+		return nil, "", ErrWebAuthnNoCredentials
+	}
+	assertion, session, err := s.wa.BeginLogin(user)
+	if err != nil {
+		return nil, "", err
+	}
+	sessionID, err := s.saveSession(account.ID, webAuthnPurposeLogin, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, sessionID, nil
+}
+
+// FinishLogin validates the assertion and records last-used details on the credential.
+func (s *WebAuthnService) FinishLogin(account domain.Account, sessionID string, response []byte, ip string) (*domain.WebAuthnCredential, error) {
+	if !s.Enabled() {
+		return nil, ErrWebAuthnDisabled
+	}
+	session, err := s.consumeSession(sessionID, account.ID, webAuthnPurposeLogin)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.loadUser(account)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := s.wa.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		return nil, err
+	}
+	return s.markUsed(account.ID, cred, ip)
+}
+
+// BeginPasswordless starts a discoverable (passkey) login where the user is not yet known.
+func (s *WebAuthnService) BeginPasswordless() (*protocol.CredentialAssertion, string, error) {
+	if !s.PasswordlessEnabled() {
+		return nil, "", ErrWebAuthnPasswordless
+	}
+	// Without a password the authenticator must verify the user (PIN/biometric).
+	assertion, session, err := s.wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+	sessionID, err := s.saveSession("", webAuthnPurposePasswordless, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, sessionID, nil
+}
+
+// FinishPasswordless resolves the account from the user handle and validates the assertion.
+func (s *WebAuthnService) FinishPasswordless(sessionID string, response []byte, ip string) (*domain.Account, *domain.WebAuthnCredential, error) {
+	if !s.PasswordlessEnabled() {
+		return nil, nil, ErrWebAuthnPasswordless
+	}
+	session, err := s.consumeSession(sessionID, "", webAuthnPurposePasswordless)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var resolved webAuthnUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		var account domain.Account
+		if err := s.db.Where("id = ?", string(userHandle)).First(&account).Error; err != nil {
+			return nil, err
+		}
+		user, err := s.loadUser(account)
+		if err != nil {
+			return nil, err
+		}
+		resolved = user
+		return user, nil
+	}
+	cred, err := s.wa.ValidateDiscoverableLogin(handler, *session, parsed)
+	if err != nil {
+		return nil, nil, err
+	}
+	record, err := s.markUsed(resolved.account.ID, cred, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &resolved.account, record, nil
+}
+
+func (s *WebAuthnService) markUsed(accountID string, cred *webauthn.Credential, ip string) (*domain.WebAuthnCredential, error) {
+	if cred.Authenticator.CloneWarning {
+		return nil, errors.New("security key signature counter mismatch; possible cloned authenticator")
+	}
+	var record domain.WebAuthnCredential
+	credID := base64.RawURLEncoding.EncodeToString(cred.ID)
+	if err := s.db.Where("credential_id = ? AND account_id = ?", credID, accountID).First(&record).Error; err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	record.SignCount = cred.Authenticator.SignCount
+	record.BackupState = cred.Flags.BackupState
+	record.LastUsedAt = &now
+	record.LastUsedIP = ip
+	if err := s.db.Session(&gorm.Session{Logger: logger.Discard}).Save(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *WebAuthnService) saveSession(accountID, purpose string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	silent := s.db.Session(&gorm.Session{Logger: logger.Discard})
+	// Opportunistically drop abandoned ceremonies.
+	_ = silent.Where("expires_at < ?", time.Now()).Delete(&domain.WebAuthnSession{}).Error
+
+	rec := domain.WebAuthnSession{
+		AccountID: accountID,
+		Purpose:   purpose,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(webAuthnSessionTTL),
+	}
+	if err := silent.Create(&rec).Error; err != nil {
+		return "", err
+	}
+	return rec.ID, nil
+}
+
+// consumeSession loads and deletes a ceremony so each challenge can only be answered once.
+func (s *WebAuthnService) consumeSession(id, accountID, purpose string) (*webauthn.SessionData, error) {
+	if strings.TrimSpace(id) == "" {
+		return nil, ErrWebAuthnSession
+	}
+	silent := s.db.Session(&gorm.Session{Logger: logger.Discard})
+	var rec domain.WebAuthnSession
+	if err := silent.Where("id = ?", id).First(&rec).Error; err != nil {
+		return nil, ErrWebAuthnSession
+	}
+	result := silent.Delete(&domain.WebAuthnSession{}, "id = ?", rec.ID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, ErrWebAuthnSession
+	}
+	if rec.Purpose != purpose || rec.AccountID != accountID || time.Now().After(rec.ExpiresAt) {
+		return nil, ErrWebAuthnSession
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(rec.Data), &session); err != nil {
+		return nil, ErrWebAuthnSession
+	}
+	return &session, nil
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+)
+
+func newWebAuthnTestService(t *testing.T, settings config.WebAuthnSettings) (*WebAuthnService, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&Account{}, &domain.WebAuthnCredential{}, &domain.WebAuthnSession{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	svc, err := NewWebAuthnService(db, settings, "https://updockly.example.com")
+	if err != nil {
+		t.Fatalf("new webauthn service: %v", err)
+	}
+	return svc, db
+}
+
+func TestWebAuthnRelyingPartyDefaults(t *testing.T) {
+	rpID, origins := WebAuthnRelyingParty(config.WebAuthnSettings{}, "https://updockly.example.com:8443/, http://localhost:5173")
+	if rpID != "updockly.example.com" {
+		t.Fatalf("expected rp id from first origin, got %q", rpID)
+	}
+	if len(origins) != 2 || origins[0] != "https://updockly.example.com:8443" || origins[1] != "http://localhost:5173" {
+		t.Fatalf("unexpected origins: %v", origins)
+	}
+
+	rpID, origins = WebAuthnRelyingParty(config.WebAuthnSettings{RPID: "example.com", Origins: "https://a.example.com"}, "https://ignored")
+	if rpID != "example.com" || len(origins) != 1 || origins[0] != "https://a.example.com" {
+		t.Fatalf("explicit settings not honoured: %q %v", rpID, origins)
+	}
+}
+
+func TestWebAuthnDisabledRefusesCeremonies(t *testing.T) {
+	svc, _ := newWebAuthnTestService(t, config.WebAuthnSettings{})
+	if svc.Enabled() {
+		t.Fatalf("expected service to be disabled")
+	}
+	if _, _, err := svc.BeginRegistration(domain.Account{ID: "acc"}); err != ErrWebAuthnDisabled {
+		t.Fatalf("expected ErrWebAuthnDisabled, got %v", err)
+	}
+	if _, _, err := svc.BeginPasswordless(); err != ErrWebAuthnPasswordless {
+		t.Fatalf("expected ErrWebAuthnPasswordless, got %v", err)
+	}
+}
+
+func TestWebAuthnBeginLoginRequiresCredentials(t *testing.T) {
+	svc, db := newWebAuthnTestService(t, config.WebAuthnSettings{Enabled: true})
+	account := Account{Username: "alice", Role: "admin"}
+	if err := db.Create(&account).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+
+	if _, _, err := svc.BeginLogin(account); err != ErrWebAuthnNoCredentials {
+		t.Fatalf("expected ErrWebAuthnNoCredentials, got %v", err)
+	}
+
+	_, sessionID, err := svc.BeginRegistration(account)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	if sessionID == "" {
+		t.Fatalf("expected session id")
+	}
+}
+
+func TestWebAuthnSessionSingleUse(t *testing.T) {
+	svc, db := newWebAuthnTestService(t, config.WebAuthnSettings{Enabled: true})
+
+	id, err := svc.saveSession("acc-1", webAuthnPurposeLogin, &webauthn.SessionData{Challenge: "abc"})
+	if err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	if _, err := svc.consumeSession(id, "acc-2", webAuthnPurposeLogin); err != ErrWebAuthnSession {
+		t.Fatalf("expected mismatch on other account, got %v", err)
+	}
+	// A failed attempt still burns the challenge.
+	if _, err := svc.consumeSession(id, "acc-1", webAuthnPurposeLogin); err != ErrWebAuthnSession {
+		t.Fatalf("expected consumed session to be rejected, got %v", err)
+	}
+
+	id, _ = svc.saveSession("acc-1", webAuthnPurposeLogin, &webauthn.SessionData{Challenge: "def"})
+	session, err := svc.consumeSession(id, "acc-1", webAuthnPurposeLogin)
+	if err != nil || session.Challenge != "def" {
+		t.Fatalf("expected session to load, got %v %v", session, err)
+	}
+
+	id, _ = svc.saveSession("acc-1", webAuthnPurposeLogin, &webauthn.SessionData{Challenge: "ghi"})
+	db.Model(&domain.WebAuthnSession{}).Where("id = ?", id).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := svc.consumeSession(id, "acc-1", webAuthnPurposeLogin); err != ErrWebAuthnSession {
+		t.Fatalf("expected expired session to be rejected, got %v", err)
+	}
+}
+
+func TestWebAuthnCredentialManagement(t *testing.T) {
+	svc, db := newWebAuthnTestService(t, config.WebAuthnSettings{Enabled: true})
+	cred := domain.WebAuthnCredential{AccountID: "acc-1", Name: "YubiKey", CredentialID: "Y3JlZA", PublicKey: []byte{1}}
+	if err := db.Create(&cred).Error; err != nil {
+		t.Fatalf("create credential: %v", err)
+	}
+
+	if !svc.HasCredentials("acc-1") || svc.HasCredentials("acc-2") {
+		t.Fatalf("unexpected HasCredentials result")
+	}
+	if err := svc.RenameCredential("acc-2", cred.ID, "Stolen"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("expected not found renaming another user's key, got %v", err)
+	}
+	if err := svc.RenameCredential("acc-1", cred.ID, "Backup key"); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	creds, err := svc.ListCredentials("acc-1")
+	if err != nil || len(creds) != 1 || creds[0].Name != "Backup key" {
+		t.Fatalf("unexpected credentials: %v %v", creds, err)
+	}
+
+	used, err := svc.markUsed("acc-1", &webauthn.Credential{
+		ID:            []byte("cred"),
+		Authenticator: webauthn.Authenticator{SignCount: 7},
+	}, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("mark used: %v", err)
+	}
+	if used.SignCount != 7 || used.LastUsedAt == nil || used.LastUsedIP != "10.0.0.1" {
+		t.Fatalf("last-used info not recorded: %+v", used)
+	}
+
+	if err := svc.DeleteCredential(domain.Account{ID: "acc-1"}, cred.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if svc.HasCredentials("acc-1") {
+		t.Fatalf("expected credential to be removed")
+	}
+}
+
+func TestWebAuthnHardwareKeyMandate(t *testing.T) {
+	svc, db := newWebAuthnTestService(t, config.WebAuthnSettings{Enabled: true, RequireForAdmins: true})
+	admin := Account{Username: "alice", Role: "admin"}
+	user := Account{Username: "bob", Role: "user"}
+	if err := db.Create(&admin).Error; err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	creation, _, err := svc.BeginRegistration(admin)
+	if err != nil || creation.Response.AuthenticatorSelection.AuthenticatorAttachment != protocol.CrossPlatform {
+		t.Fatalf("expected admins to be asked for a roaming key, got %+v (%v)", creation, err)
+	}
+	if creation, _, err := svc.BeginRegistration(user); err != nil || creation.Response.AuthenticatorSelection.AuthenticatorAttachment != "" {
+		t.Fatalf("expected users to register any key, got %+v (%v)", creation, err)
+	}
+
+	// A synced passkey neither satisfies the mandate nor signs an admin in.
+	synced := domain.WebAuthnCredential{AccountID: admin.ID, Name: "Phone", CredentialID: "c3luY2Vk", PublicKey: []byte{1}, BackupEligible: true}
+	if err := db.Create(&synced).Error; err != nil {
+		t.Fatalf("create passkey: %v", err)
+	}
+	if svc.HasHardwareKey(admin.ID) {
+		t.Fatalf("expected a synced passkey not to count as a hardware key")
+	}
+	if _, _, err := svc.BeginLogin(admin); err != ErrWebAuthnNoCredentials {
+		t.Fatalf("expected the passkey not to be offered, got %v", err)
+	}
+
+	key := domain.WebAuthnCredential{AccountID: admin.ID, Name: "YubiKey", CredentialID: "a2V5", PublicKey: []byte{1}}
+	if err := db.Create(&key).Error; err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	if err := svc.DeleteCredential(admin, key.ID); err != ErrWebAuthnLastHardwareKey {
+		t.Fatalf("expected the last hardware key to be kept, got %v", err)
+	}
+	if err := svc.DeleteCredential(admin, synced.ID); err != nil {
+		t.Fatalf("delete passkey: %v", err)
+	}
+
+	spare := domain.WebAuthnCredential{AccountID: admin.ID, Name: "Spare", CredentialID: "c3BhcmU", PublicKey: []byte{1}}
+	if err := db.Create(&spare).Error; err != nil {
+		t.Fatalf("create spare: %v", err)
+	}
+	if err := svc.DeleteCredential(admin, key.ID); err != nil {
+		t.Fatalf("expected a key with a spare to be removable, got %v", err)
+	}
+	if !svc.HasHardwareKey(admin.ID) {
+		t.Fatalf("expected the spare key to remain")
+	}
+}
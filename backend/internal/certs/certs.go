@@ -7,7 +7,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
-	"fmt"
+	"log/slog"
 	"math/big"
 	"net"
 	"os"
@@ -102,7 +102,7 @@ func (cm *CertManager) generateSelfSigned() error {
 			if ip := net.ParseIP(strings.TrimSpace(ipStr)); ip != nil {
 				cert.IPAddresses = append(cert.IPAddresses, ip)
 			} else {
-				fmt.Printf("Warning: ignoring invalid SERVER_SAN_IPS entry: %s\n", ipStr)
+				slog.Warn("ignoring invalid SERVER_SAN_IPS entry", "entry", ipStr)
 			}
 		}
 	}
@@ -110,7 +110,7 @@ func (cm *CertManager) generateSelfSigned() error {
 		for _, domain := range strings.Split(extraDomains, ",") {
 			if d := strings.TrimSpace(domain); d != "" {
 				if strings.ContainsAny(d, " *") {
-					fmt.Printf("Warning: ignoring invalid SERVER_SAN_DOMAINS entry: %s\n", d)
+					slog.Warn("ignoring invalid SERVER_SAN_DOMAINS entry", "entry", d)
 					continue
 				}
 				cert.DNSNames = append(cert.DNSNames, d)
@@ -28,10 +28,33 @@ type Config struct {
 	AutoPruneImages       bool
 	Notifications         NotificationSettings
 	SSO                   SSOSettings
+	WebAuthn              WebAuthnSettings
+	PasswordPolicy        PasswordPolicySettings
+	LDAP                  LDAPSettings
 	DBHost                string
 	DBPort                int
 	DBName                string
 	AgentRequireIPBinding bool
+	// GitHubToken authenticates release notes lookups, which are otherwise limited to
+	// 60 requests an hour.
+	GitHubToken string
+	// RollbackImages is how many replaced images are kept tagged per container so a
+	// rollback works without the registry; 0 keeps none.
+	RollbackImages int
+	// HistoryRetentionDays prunes update history older than this many days; 0 keeps it.
+	HistoryRetentionDays int
+	// MetricsToken, when set, is the bearer token /metrics requires.
+	MetricsToken string
+	// StatsRetentionDays keeps hourly resource usage of agents and their containers;
+	// 0 stops storing it. StatsFineHours keeps the 5-minute buckets.
+	StatsRetentionDays int
+	StatsFineHours     int
+	// RunningHistoryDays keeps the 5-minute running container samples and the
+	// container uptime derived from them.
+	RunningHistoryDays int
+	// TracingEndpoint is the OTLP/HTTP endpoint traces are exported to; empty turns
+	// tracing off.
+	TracingEndpoint string
 	// Flags indicating the secrets were generated at runtime because env was empty.
 	JWTSecretGenerated bool
 	VaultKeyGenerated  bool
@@ -92,10 +115,21 @@ func Load() Config {
 		LogLevel:              getEnv("LOG_LEVEL", "info"),
 		HideSupportButton:     boolFromEnv("HIDE_SUPPORT_BUTTON"),
 		AgentRequireIPBinding: boolFromEnv("AGENT_REQUIRE_IP_BINDING"),
+		GitHubToken:           getEnv("GITHUB_TOKEN", ""),
+		RollbackImages:        max(atoiOrElse(getEnv("ROLLBACK_IMAGES", ""), 3), 0),
+		HistoryRetentionDays:  max(atoiOrElse(getEnv("HISTORY_RETENTION_DAYS", ""), 0), 0),
+		MetricsToken:          getEnv("METRICS_TOKEN", ""),
+		StatsRetentionDays:    max(atoiOrElse(getEnv("STATS_RETENTION_DAYS", ""), 30), 0),
+		StatsFineHours:        max(atoiOrElse(getEnv("STATS_FINE_RETENTION_HOURS", ""), 48), 1),
+		RunningHistoryDays:    max(atoiOrElse(getEnv("RUNNING_HISTORY_RETENTION_DAYS", ""), 90), 1),
+		TracingEndpoint:       getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
 		Timezone:              getEnv("TIMEZONE", "UTC"),
 		AutoPruneImages:       settings.AutoPrune,
 		Notifications:         settings.Notifications,
 		SSO:                   settings.SSO,
+		WebAuthn:              settings.WebAuthn,
+		PasswordPolicy:        settings.PasswordPolicy,
+		LDAP:                  settings.LDAP,
 		JWTSecretGenerated:    jwtGenerated,
 		VaultKeyGenerated:     vaultGenerated,
 	}
@@ -36,6 +36,15 @@ type NotificationSettings struct {
 	RecapTime        string       `json:"recapTime"`
 	NotificationCron string       `json:"notificationCron"`
 	SMTP             SMTPSettings `json:"smtp"`
+	// UpdateDigest sends pending updates of containers without auto-update.
+	UpdateDigest DigestSettings `json:"updateDigest"`
+}
+
+// DigestSettings schedules the update digest. An empty Frequency disables it.
+type DigestSettings struct {
+	Frequency string `json:"frequency"` // "daily" or "weekly"
+	Time      string `json:"time"`      // HH:MM in the server timezone
+	Weekday   string `json:"weekday"`   // for weekly digests, e.g. "monday"
 }
 
 type SMTPSettings struct {
@@ -45,6 +54,9 @@ type SMTPSettings struct {
 	Password string `json:"password"`
 	From     string `json:"from"`
 	TLS      bool   `json:"tls"`
+	// Security is starttls, tls (implicit) or none. Empty keeps the legacy behaviour:
+	// implicit TLS when TLS is set, otherwise STARTTLS when the server offers it.
+	Security string `json:"security"`
 	Enabled  bool   `json:"enabled"`
 }
 
@@ -57,15 +69,66 @@ type SSOSettings struct {
 	RedirectURL  string `json:"redirectUrl"`
 }
 
+// WebAuthnSettings configures security keys and passkeys as a second factor.
+// RPID and Origins default to the primary CLIENT_ORIGIN when left empty.
+type WebAuthnSettings struct {
+	Enabled           bool   `json:"enabled"`
+	RPID              string `json:"rpId"`
+	RPDisplayName     string `json:"rpDisplayName"`
+	Origins           string `json:"origins"` // comma separated
+	AllowPasswordless bool   `json:"allowPasswordless"`
+	RequireForAdmins  bool   `json:"requireForAdmins"`
+}
+
+// PasswordPolicySettings controls which passwords are accepted for local accounts.
+// BreachedListPath points at an offline Pwned Passwords export: either a directory of
+// k-anonymity range files named by SHA-1 prefix, or a single sorted HASH:COUNT file.
+type PasswordPolicySettings struct {
+	MinLength        int    `json:"minLength"`
+	RequireUpper     bool   `json:"requireUpper"`
+	RequireLower     bool   `json:"requireLower"`
+	RequireDigit     bool   `json:"requireDigit"`
+	RequireSymbol    bool   `json:"requireSymbol"`
+	HistorySize      int    `json:"historySize"`
+	MaxAgeDays       int    `json:"maxAgeDays"`
+	BreachedListPath string `json:"breachedListPath"`
+}
+
+// LDAPSettings configures bind authentication against LDAP or Active Directory.
+// UserFilter may reference the login name as {username}. GroupRoles maps directory
+// groups to roles as "group=role" pairs separated by semicolons; the first match wins.
+type LDAPSettings struct {
+	Enabled            bool   `json:"enabled"`
+	URL                string `json:"url"` // ldap:// or ldaps://
+	StartTLS           bool   `json:"startTls"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	CACertFile         string `json:"caCertFile"`
+	BindDN             string `json:"bindDn"`
+	BindPassword       string `json:"bindPassword"`
+	BaseDN             string `json:"baseDn"`
+	UserFilter         string `json:"userFilter"`
+	UsernameAttribute  string `json:"usernameAttribute"`
+	EmailAttribute     string `json:"emailAttribute"`
+	NameAttribute      string `json:"nameAttribute"`
+	GroupAttribute     string `json:"groupAttribute"`
+	GroupRoles         string `json:"groupRoles"`
+	DefaultRole        string `json:"defaultRole"`
+	JITProvisioning    bool   `json:"jitProvisioning"`
+}
+
 type RuntimeSettings struct {
-	DatabaseURL   string               `json:"databaseUrl"`
-	ClientOrigin  string               `json:"clientOrigin"`
-	SecretKey     string               `json:"secretKey"`
-	HideSupport   bool                 `json:"hideSupportButton"`
-	Timezone      string               `json:"timezone"`
-	AutoPrune     bool                 `json:"autoPruneImages"`
-	Notifications NotificationSettings `json:"notifications"`
-	SSO           SSOSettings          `json:"sso"`
+	DatabaseURL    string                 `json:"databaseUrl"`
+	ClientOrigin   string                 `json:"clientOrigin"`
+	SecretKey      string                 `json:"secretKey"`
+	HideSupport    bool                   `json:"hideSupportButton"`
+	Timezone       string                 `json:"timezone"`
+	LogLevel       string                 `json:"logLevel"`
+	AutoPrune      bool                   `json:"autoPruneImages"`
+	Notifications  NotificationSettings   `json:"notifications"`
+	SSO            SSOSettings            `json:"sso"`
+	WebAuthn       WebAuthnSettings       `json:"webauthn"`
+	PasswordPolicy PasswordPolicySettings `json:"passwordPolicy"`
+	LDAP           LDAPSettings           `json:"ldap"`
 }
 
 func loadEnvFile(path string) {
@@ -140,6 +203,7 @@ func CurrentRuntimeSettings() RuntimeSettings {
 		SecretKey:   getEnvWithFile("SECRET_KEY"),
 		HideSupport: boolFromEnv("HIDE_SUPPORT_BUTTON"),
 		Timezone:    getEnvWithFile("TIMEZONE"),
+		LogLevel:    strings.ToLower(getEnvWithFile("LOG_LEVEL")),
 		AutoPrune:   boolFromEnv("AUTO_PRUNE_IMAGES"),
 		Notifications: NotificationSettings{
 			WebhookURL:       getEnvWithFile("NOTIFICATION_WEBHOOK_URL"),
@@ -149,6 +213,11 @@ func CurrentRuntimeSettings() RuntimeSettings {
 			OnFailure:        boolFromEnv("NOTIFICATION_ON_FAILURE"),
 			RecapTime:        getEnvWithFile("NOTIFICATION_RECAP_TIME"),
 			NotificationCron: getEnvWithFile("NOTIFICATION_CRON"),
+			UpdateDigest: DigestSettings{
+				Frequency: getEnvWithFile("NOTIFICATION_DIGEST_FREQUENCY"),
+				Time:      getEnvWithFile("NOTIFICATION_DIGEST_TIME"),
+				Weekday:   getEnvWithFile("NOTIFICATION_DIGEST_WEEKDAY"),
+			},
 			SMTP: SMTPSettings{
 				Host:     getEnvWithFile("SMTP_HOST"),
 				Port:     atoiOrElse(getEnvWithFile("SMTP_PORT"), 587),
@@ -156,6 +225,7 @@ func CurrentRuntimeSettings() RuntimeSettings {
 				Password: getEnvWithFile("SMTP_PASSWORD"),
 				From:     cleanAddress(getEnvWithFile("SMTP_FROM")),
 				TLS:      boolFromEnv("SMTP_TLS"),
+				Security: strings.ToLower(strings.TrimSpace(getEnvWithFile("SMTP_SECURITY"))),
 				Enabled:  boolFromEnv("SMTP_ENABLED"),
 			},
 		},
@@ -167,6 +237,42 @@ func CurrentRuntimeSettings() RuntimeSettings {
 			ClientSecret: getEnvWithFile("SSO_CLIENT_SECRET"),
 			RedirectURL:  getEnvWithFile("SSO_REDIRECT_URL"),
 		},
+		WebAuthn: WebAuthnSettings{
+			Enabled:           boolFromEnv("WEBAUTHN_ENABLED"),
+			RPID:              getEnvWithFile("WEBAUTHN_RP_ID"),
+			RPDisplayName:     getEnvWithFile("WEBAUTHN_RP_DISPLAY_NAME"),
+			Origins:           getEnvWithFile("WEBAUTHN_ORIGINS"),
+			AllowPasswordless: boolFromEnv("WEBAUTHN_ALLOW_PASSWORDLESS"),
+			RequireForAdmins:  boolFromEnv("WEBAUTHN_REQUIRE_FOR_ADMINS"),
+		},
+		PasswordPolicy: PasswordPolicySettings{
+			MinLength:        atoiOrElse(getEnvWithFile("PASSWORD_MIN_LENGTH"), 8),
+			RequireUpper:     boolFromEnv("PASSWORD_REQUIRE_UPPER"),
+			RequireLower:     boolFromEnv("PASSWORD_REQUIRE_LOWER"),
+			RequireDigit:     boolFromEnv("PASSWORD_REQUIRE_DIGIT"),
+			RequireSymbol:    boolFromEnv("PASSWORD_REQUIRE_SYMBOL"),
+			HistorySize:      atoiOrElse(getEnvWithFile("PASSWORD_HISTORY"), 5),
+			MaxAgeDays:       atoiOrElse(getEnvWithFile("PASSWORD_MAX_AGE_DAYS"), 0),
+			BreachedListPath: getEnvWithFile("PASSWORD_BREACHED_LIST"),
+		},
+		LDAP: LDAPSettings{
+			Enabled:            boolFromEnv("LDAP_ENABLED"),
+			URL:                getEnvWithFile("LDAP_URL"),
+			StartTLS:           boolFromEnv("LDAP_START_TLS"),
+			InsecureSkipVerify: boolFromEnv("LDAP_INSECURE_SKIP_VERIFY"),
+			CACertFile:         getEnvWithFile("LDAP_CA_CERT_FILE"),
+			BindDN:             getEnvWithFile("LDAP_BIND_DN"),
+			BindPassword:       getEnvWithFile("LDAP_BIND_PASSWORD"),
+			BaseDN:             getEnvWithFile("LDAP_BASE_DN"),
+			UserFilter:         getEnvWithFile("LDAP_USER_FILTER"),
+			UsernameAttribute:  getEnvWithFile("LDAP_USERNAME_ATTRIBUTE"),
+			EmailAttribute:     getEnvWithFile("LDAP_EMAIL_ATTRIBUTE"),
+			NameAttribute:      getEnvWithFile("LDAP_NAME_ATTRIBUTE"),
+			GroupAttribute:     getEnvWithFile("LDAP_GROUP_ATTRIBUTE"),
+			GroupRoles:         getEnvWithFile("LDAP_GROUP_ROLES"),
+			DefaultRole:        getEnvWithFile("LDAP_DEFAULT_ROLE"),
+			JITProvisioning:    boolFromEnv("LDAP_JIT_PROVISIONING"),
+		},
 	}
 }
 
@@ -213,12 +319,16 @@ func SaveRuntimeSettings(path string, settings RuntimeSettings) error {
 	write("NOTIFICATION_ON_FAILURE", strconv.FormatBool(settings.Notifications.OnFailure))
 	write("NOTIFICATION_RECAP_TIME", settings.Notifications.RecapTime)
 	write("NOTIFICATION_CRON", settings.Notifications.NotificationCron)
+	write("NOTIFICATION_DIGEST_FREQUENCY", settings.Notifications.UpdateDigest.Frequency)
+	write("NOTIFICATION_DIGEST_TIME", settings.Notifications.UpdateDigest.Time)
+	write("NOTIFICATION_DIGEST_WEEKDAY", settings.Notifications.UpdateDigest.Weekday)
 	write("SMTP_HOST", settings.Notifications.SMTP.Host)
 	write("SMTP_PORT", strconv.Itoa(settings.Notifications.SMTP.Port))
 	write("SMTP_USER", settings.Notifications.SMTP.User)
 	write("SMTP_PASSWORD", settings.Notifications.SMTP.Password)
 	write("SMTP_FROM", settings.Notifications.SMTP.From)
 	write("SMTP_TLS", strconv.FormatBool(settings.Notifications.SMTP.TLS))
+	write("SMTP_SECURITY", settings.Notifications.SMTP.Security)
 	write("SMTP_ENABLED", strconv.FormatBool(settings.Notifications.SMTP.Enabled))
 	write("SSO_ENABLED", strconv.FormatBool(settings.SSO.Enabled))
 	write("SSO_PROVIDER", settings.SSO.Provider)
@@ -226,6 +336,36 @@ func SaveRuntimeSettings(path string, settings RuntimeSettings) error {
 	write("SSO_CLIENT_ID", settings.SSO.ClientID)
 	write("SSO_CLIENT_SECRET", settings.SSO.ClientSecret)
 	write("SSO_REDIRECT_URL", settings.SSO.RedirectURL)
+	write("WEBAUTHN_ENABLED", strconv.FormatBool(settings.WebAuthn.Enabled))
+	write("WEBAUTHN_RP_ID", settings.WebAuthn.RPID)
+	write("WEBAUTHN_RP_DISPLAY_NAME", settings.WebAuthn.RPDisplayName)
+	write("WEBAUTHN_ORIGINS", settings.WebAuthn.Origins)
+	write("WEBAUTHN_ALLOW_PASSWORDLESS", strconv.FormatBool(settings.WebAuthn.AllowPasswordless))
+	write("WEBAUTHN_REQUIRE_FOR_ADMINS", strconv.FormatBool(settings.WebAuthn.RequireForAdmins))
+	write("PASSWORD_MIN_LENGTH", strconv.Itoa(settings.PasswordPolicy.MinLength))
+	write("PASSWORD_REQUIRE_UPPER", strconv.FormatBool(settings.PasswordPolicy.RequireUpper))
+	write("PASSWORD_REQUIRE_LOWER", strconv.FormatBool(settings.PasswordPolicy.RequireLower))
+	write("PASSWORD_REQUIRE_DIGIT", strconv.FormatBool(settings.PasswordPolicy.RequireDigit))
+	write("PASSWORD_REQUIRE_SYMBOL", strconv.FormatBool(settings.PasswordPolicy.RequireSymbol))
+	write("PASSWORD_HISTORY", strconv.Itoa(settings.PasswordPolicy.HistorySize))
+	write("PASSWORD_MAX_AGE_DAYS", strconv.Itoa(settings.PasswordPolicy.MaxAgeDays))
+	write("PASSWORD_BREACHED_LIST", settings.PasswordPolicy.BreachedListPath)
+	write("LDAP_ENABLED", strconv.FormatBool(settings.LDAP.Enabled))
+	write("LDAP_URL", settings.LDAP.URL)
+	write("LDAP_START_TLS", strconv.FormatBool(settings.LDAP.StartTLS))
+	write("LDAP_INSECURE_SKIP_VERIFY", strconv.FormatBool(settings.LDAP.InsecureSkipVerify))
+	write("LDAP_CA_CERT_FILE", settings.LDAP.CACertFile)
+	write("LDAP_BIND_DN", settings.LDAP.BindDN)
+	write("LDAP_BIND_PASSWORD", settings.LDAP.BindPassword)
+	write("LDAP_BASE_DN", settings.LDAP.BaseDN)
+	write("LDAP_USER_FILTER", settings.LDAP.UserFilter)
+	write("LDAP_USERNAME_ATTRIBUTE", settings.LDAP.UsernameAttribute)
+	write("LDAP_EMAIL_ATTRIBUTE", settings.LDAP.EmailAttribute)
+	write("LDAP_NAME_ATTRIBUTE", settings.LDAP.NameAttribute)
+	write("LDAP_GROUP_ATTRIBUTE", settings.LDAP.GroupAttribute)
+	write("LDAP_GROUP_ROLES", settings.LDAP.GroupRoles)
+	write("LDAP_DEFAULT_ROLE", settings.LDAP.DefaultRole)
+	write("LDAP_JIT_PROVISIONING", strconv.FormatBool(settings.LDAP.JITProvisioning))
 
 	// Preserve SERVER_ADDR if present, even though it's not part of settings.
 	if addr, ok := existing["SERVER_ADDR"]; ok && addr != "" {
@@ -234,35 +374,69 @@ func SaveRuntimeSettings(path string, settings RuntimeSettings) error {
 
 	// Preserve any extra keys that we don't manage directly (e.g., SERVER_ADDR).
 	known := map[string]struct{}{
-		"DATABASE_URL":                 {},
-		"CLIENT_ORIGIN":                {},
-		"SECRET_KEY":                   {},
-		"JWT_SECRET":                   {},
-		"VAULT_KEY":                    {},
-		"TIMEZONE":                     {},
-		"HIDE_SUPPORT_BUTTON":          {},
-		"SERVER_ADDR":                  {},
-		"AUTO_PRUNE_IMAGES":            {},
-		"NOTIFICATION_WEBHOOK_URL":     {},
-		"NOTIFICATION_DISCORD_TOKEN":   {},
-		"NOTIFICATION_DISCORD_CHANNEL": {},
-		"NOTIFICATION_ON_SUCCESS":      {},
-		"NOTIFICATION_ON_FAILURE":      {},
-		"NOTIFICATION_RECAP_TIME":      {},
-		"NOTIFICATION_CRON":            {},
-		"SMTP_HOST":                    {},
-		"SMTP_PORT":                    {},
-		"SMTP_USER":                    {},
-		"SMTP_PASSWORD":                {},
-		"SMTP_FROM":                    {},
-		"SMTP_TLS":                     {},
-		"SMTP_ENABLED":                 {},
-		"SSO_ENABLED":                  {},
-		"SSO_PROVIDER":                 {},
-		"SSO_ISSUER_URL":               {},
-		"SSO_CLIENT_ID":                {},
-		"SSO_CLIENT_SECRET":            {},
-		"SSO_REDIRECT_URL":             {},
+		"DATABASE_URL":                  {},
+		"CLIENT_ORIGIN":                 {},
+		"SECRET_KEY":                    {},
+		"JWT_SECRET":                    {},
+		"VAULT_KEY":                     {},
+		"TIMEZONE":                      {},
+		"HIDE_SUPPORT_BUTTON":           {},
+		"SERVER_ADDR":                   {},
+		"AUTO_PRUNE_IMAGES":             {},
+		"NOTIFICATION_WEBHOOK_URL":      {},
+		"NOTIFICATION_DISCORD_TOKEN":    {},
+		"NOTIFICATION_DISCORD_CHANNEL":  {},
+		"NOTIFICATION_ON_SUCCESS":       {},
+		"NOTIFICATION_ON_FAILURE":       {},
+		"NOTIFICATION_RECAP_TIME":       {},
+		"NOTIFICATION_CRON":             {},
+		"NOTIFICATION_DIGEST_FREQUENCY": {},
+		"NOTIFICATION_DIGEST_TIME":      {},
+		"NOTIFICATION_DIGEST_WEEKDAY":   {},
+		"SMTP_HOST":                     {},
+		"SMTP_PORT":                     {},
+		"SMTP_USER":                     {},
+		"SMTP_PASSWORD":                 {},
+		"SMTP_FROM":                     {},
+		"SMTP_TLS":                      {},
+		"SMTP_SECURITY":                 {},
+		"SMTP_ENABLED":                  {},
+		"SSO_ENABLED":                   {},
+		"SSO_PROVIDER":                  {},
+		"SSO_ISSUER_URL":                {},
+		"SSO_CLIENT_ID":                 {},
+		"SSO_CLIENT_SECRET":             {},
+		"SSO_REDIRECT_URL":              {},
+		"WEBAUTHN_ENABLED":              {},
+		"WEBAUTHN_RP_ID":                {},
+		"WEBAUTHN_RP_DISPLAY_NAME":      {},
+		"WEBAUTHN_ORIGINS":              {},
+		"WEBAUTHN_ALLOW_PASSWORDLESS":   {},
+		"WEBAUTHN_REQUIRE_FOR_ADMINS":   {},
+		"PASSWORD_MIN_LENGTH":           {},
+		"PASSWORD_REQUIRE_UPPER":        {},
+		"PASSWORD_REQUIRE_LOWER":        {},
+		"PASSWORD_REQUIRE_DIGIT":        {},
+		"PASSWORD_REQUIRE_SYMBOL":       {},
+		"PASSWORD_HISTORY":              {},
+		"PASSWORD_MAX_AGE_DAYS":         {},
+		"PASSWORD_BREACHED_LIST":        {},
+		"LDAP_ENABLED":                  {},
+		"LDAP_URL":                      {},
+		"LDAP_START_TLS":                {},
+		"LDAP_INSECURE_SKIP_VERIFY":     {},
+		"LDAP_CA_CERT_FILE":             {},
+		"LDAP_BIND_DN":                  {},
+		"LDAP_BIND_PASSWORD":            {},
+		"LDAP_BASE_DN":                  {},
+		"LDAP_USER_FILTER":              {},
+		"LDAP_USERNAME_ATTRIBUTE":       {},
+		"LDAP_EMAIL_ATTRIBUTE":          {},
+		"LDAP_NAME_ATTRIBUTE":           {},
+		"LDAP_GROUP_ATTRIBUTE":          {},
+		"LDAP_GROUP_ROLES":              {},
+		"LDAP_DEFAULT_ROLE":             {},
+		"LDAP_JIT_PROVISIONING":         {},
 	}
 	for k, v := range existing {
 		if _, ok := known[k]; ok {
@@ -284,24 +458,57 @@ func SaveRuntimeSettings(path string, settings RuntimeSettings) error {
 
 	// push values into environment for current process
 	for key, value := range map[string]string{
-		"DATABASE_URL":                 settings.DatabaseURL,
-		"CLIENT_ORIGIN":                settings.ClientOrigin,
-		"SECRET_KEY":                   settings.SecretKey,
-		"TIMEZONE":                     settings.Timezone,
-		"AUTO_PRUNE_IMAGES":            strconv.FormatBool(settings.AutoPrune),
-		"NOTIFICATION_WEBHOOK_URL":     settings.Notifications.WebhookURL,
-		"NOTIFICATION_DISCORD_TOKEN":   settings.Notifications.DiscordToken,
-		"NOTIFICATION_DISCORD_CHANNEL": settings.Notifications.DiscordChannel,
-		"NOTIFICATION_ON_SUCCESS":      strconv.FormatBool(settings.Notifications.OnSuccess),
-		"NOTIFICATION_ON_FAILURE":      strconv.FormatBool(settings.Notifications.OnFailure),
-		"NOTIFICATION_RECAP_TIME":      settings.Notifications.RecapTime,
-		"NOTIFICATION_CRON":            settings.Notifications.NotificationCron,
-		"SSO_ENABLED":                  strconv.FormatBool(settings.SSO.Enabled),
-		"SSO_PROVIDER":                 settings.SSO.Provider,
-		"SSO_ISSUER_URL":               settings.SSO.IssuerURL,
-		"SSO_CLIENT_ID":                settings.SSO.ClientID,
-		"SSO_CLIENT_SECRET":            settings.SSO.ClientSecret,
-		"SSO_REDIRECT_URL":             settings.SSO.RedirectURL,
+		"DATABASE_URL":                  settings.DatabaseURL,
+		"CLIENT_ORIGIN":                 settings.ClientOrigin,
+		"SECRET_KEY":                    settings.SecretKey,
+		"TIMEZONE":                      settings.Timezone,
+		"AUTO_PRUNE_IMAGES":             strconv.FormatBool(settings.AutoPrune),
+		"NOTIFICATION_WEBHOOK_URL":      settings.Notifications.WebhookURL,
+		"NOTIFICATION_DISCORD_TOKEN":    settings.Notifications.DiscordToken,
+		"NOTIFICATION_DISCORD_CHANNEL":  settings.Notifications.DiscordChannel,
+		"NOTIFICATION_ON_SUCCESS":       strconv.FormatBool(settings.Notifications.OnSuccess),
+		"NOTIFICATION_ON_FAILURE":       strconv.FormatBool(settings.Notifications.OnFailure),
+		"NOTIFICATION_RECAP_TIME":       settings.Notifications.RecapTime,
+		"NOTIFICATION_CRON":             settings.Notifications.NotificationCron,
+		"NOTIFICATION_DIGEST_FREQUENCY": settings.Notifications.UpdateDigest.Frequency,
+		"NOTIFICATION_DIGEST_TIME":      settings.Notifications.UpdateDigest.Time,
+		"NOTIFICATION_DIGEST_WEEKDAY":   settings.Notifications.UpdateDigest.Weekday,
+		"SSO_ENABLED":                   strconv.FormatBool(settings.SSO.Enabled),
+		"SSO_PROVIDER":                  settings.SSO.Provider,
+		"SSO_ISSUER_URL":                settings.SSO.IssuerURL,
+		"SSO_CLIENT_ID":                 settings.SSO.ClientID,
+		"SSO_CLIENT_SECRET":             settings.SSO.ClientSecret,
+		"SSO_REDIRECT_URL":              settings.SSO.RedirectURL,
+		"WEBAUTHN_ENABLED":              strconv.FormatBool(settings.WebAuthn.Enabled),
+		"WEBAUTHN_RP_ID":                settings.WebAuthn.RPID,
+		"WEBAUTHN_RP_DISPLAY_NAME":      settings.WebAuthn.RPDisplayName,
+		"WEBAUTHN_ORIGINS":              settings.WebAuthn.Origins,
+		"WEBAUTHN_ALLOW_PASSWORDLESS":   strconv.FormatBool(settings.WebAuthn.AllowPasswordless),
+		"WEBAUTHN_REQUIRE_FOR_ADMINS":   strconv.FormatBool(settings.WebAuthn.RequireForAdmins),
+		"PASSWORD_MIN_LENGTH":           strconv.Itoa(settings.PasswordPolicy.MinLength),
+		"PASSWORD_REQUIRE_UPPER":        strconv.FormatBool(settings.PasswordPolicy.RequireUpper),
+		"PASSWORD_REQUIRE_LOWER":        strconv.FormatBool(settings.PasswordPolicy.RequireLower),
+		"PASSWORD_REQUIRE_DIGIT":        strconv.FormatBool(settings.PasswordPolicy.RequireDigit),
+		"PASSWORD_REQUIRE_SYMBOL":       strconv.FormatBool(settings.PasswordPolicy.RequireSymbol),
+		"PASSWORD_HISTORY":              strconv.Itoa(settings.PasswordPolicy.HistorySize),
+		"PASSWORD_MAX_AGE_DAYS":         strconv.Itoa(settings.PasswordPolicy.MaxAgeDays),
+		"PASSWORD_BREACHED_LIST":        settings.PasswordPolicy.BreachedListPath,
+		"LDAP_ENABLED":                  strconv.FormatBool(settings.LDAP.Enabled),
+		"LDAP_URL":                      settings.LDAP.URL,
+		"LDAP_START_TLS":                strconv.FormatBool(settings.LDAP.StartTLS),
+		"LDAP_INSECURE_SKIP_VERIFY":     strconv.FormatBool(settings.LDAP.InsecureSkipVerify),
+		"LDAP_CA_CERT_FILE":             settings.LDAP.CACertFile,
+		"LDAP_BIND_DN":                  settings.LDAP.BindDN,
+		"LDAP_BIND_PASSWORD":            settings.LDAP.BindPassword,
+		"LDAP_BASE_DN":                  settings.LDAP.BaseDN,
+		"LDAP_USER_FILTER":              settings.LDAP.UserFilter,
+		"LDAP_USERNAME_ATTRIBUTE":       settings.LDAP.UsernameAttribute,
+		"LDAP_EMAIL_ATTRIBUTE":          settings.LDAP.EmailAttribute,
+		"LDAP_NAME_ATTRIBUTE":           settings.LDAP.NameAttribute,
+		"LDAP_GROUP_ATTRIBUTE":          settings.LDAP.GroupAttribute,
+		"LDAP_GROUP_ROLES":              settings.LDAP.GroupRoles,
+		"LDAP_DEFAULT_ROLE":             settings.LDAP.DefaultRole,
+		"LDAP_JIT_PROVISIONING":         strconv.FormatBool(settings.LDAP.JITProvisioning),
 	} {
 		_ = os.Setenv(key, value)
 	}
@@ -0,0 +1,122 @@
+package containers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// Provenance records what an update or rollback replaced: the image the container ran
+// before and after, by ID and repo digest (repo@sha256:…), and the container config
+// before and after, as ConfigSnapshots in JSON. Digests are empty for images that were
+// never pulled from a registry.
+type Provenance struct {
+	PreviousImageID string
+	PreviousDigest  string
+	NewImageID      string
+	NewDigest       string
+	Config          []byte
+	NewConfig       []byte
+}
+
+// ConfigSnapshot is the part of a container inspect needed to create it again.
+type ConfigSnapshot struct {
+	Name       string                               `json:"name"`
+	Config     *container.Config                    `json:"config"`
+	HostConfig *container.HostConfig                `json:"hostConfig"`
+	Networks   map[string]*network.EndpointSettings `json:"networks,omitempty"`
+}
+
+// SnapshotConfig captures the config of an inspected container as JSON.
+func SnapshotConfig(info container.InspectResponse) []byte {
+	snap := ConfigSnapshot{Config: info.Config}
+	if info.ContainerJSONBase != nil {
+		snap.Name = strings.TrimPrefix(info.Name, "/")
+		snap.HostConfig = info.HostConfig
+	}
+	if info.NetworkSettings != nil {
+		snap.Networks = info.NetworkSettings.Networks
+	}
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// CurrentConfig returns the name, ID and image of a container with a snapshot of its
+// config.
+func (s *ContainerService) CurrentConfig(ctx context.Context, id string) (string, string, string, []byte, error) {
+	cli, err := s.getDockerClient()
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	defer cli.Close()
+
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", "", "", nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	if info.ContainerJSONBase == nil || info.Config == nil {
+		return "", "", "", nil, errors.New("incomplete container inspect")
+	}
+	return strings.TrimPrefix(info.Name, "/"), info.ID, info.Config.Image, SnapshotConfig(info), nil
+}
+
+// newConfig snapshots the config of a container just created by an update or rollback.
+func newConfig(ctx context.Context, cli client.APIClient, id string) []byte {
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil || info.Config == nil {
+		return nil
+	}
+	return SnapshotConfig(info)
+}
+
+// ParseConfigSnapshot reads a snapshot taken by SnapshotConfig.
+func ParseConfigSnapshot(raw []byte) (*ConfigSnapshot, error) {
+	var snap ConfigSnapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return nil, err
+	}
+	if snap.Config == nil || snap.HostConfig == nil {
+		return nil, errors.New("incomplete config snapshot")
+	}
+	return &snap, nil
+}
+
+// RepoDigest picks the repo digest of an image in the repository of ref, so an image
+// pushed to several repositories is pinned where it came from. It falls back to the
+// first repo digest.
+func RepoDigest(digests []string, ref string) string {
+	if len(digests) == 0 {
+		return ""
+	}
+	if named, err := reference.ParseNormalizedNamed(ref); err == nil {
+		for _, d := range digests {
+			if candidate, err := reference.ParseNormalizedNamed(d); err == nil && candidate.Name() == named.Name() {
+				return d
+			}
+		}
+	}
+	return digests[0]
+}
+
+// imageProvenance returns the ID of an image and its repo digest in the repository of
+// ref; both are empty when the image cannot be inspected.
+func imageProvenance(ctx context.Context, cli client.APIClient, imageRef, ref string) (string, string) {
+	if strings.TrimSpace(imageRef) == "" {
+		return "", ""
+	}
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, imageRef)
+	if err != nil {
+		return "", ""
+	}
+	return inspect.ID, RepoDigest(inspect.RepoDigests, ref)
+}
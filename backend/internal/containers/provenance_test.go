@@ -0,0 +1,132 @@
+package containers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestRepoDigest(t *testing.T) {
+	sum := "sha256:" + strings.Repeat("ab", 32)
+	digests := []string{
+		"mirror.example.com/library/nginx@" + sum,
+		"nginx@" + sum,
+	}
+	if got := RepoDigest(digests, "nginx:1.27"); got != digests[1] {
+		t.Fatalf("expected the digest of the docker hub repository, got %q", got)
+	}
+	if got := RepoDigest(digests, "ghcr.io/acme/web:latest"); got != digests[0] {
+		t.Fatalf("expected the first digest as fallback, got %q", got)
+	}
+	if got := RepoDigest(nil, "nginx"); got != "" {
+		t.Fatalf("expected no digest for a local image, got %q", got)
+	}
+}
+
+func TestRollbackContainerUsesSnapshot(t *testing.T) {
+	svc, mockClient, _ := setupContainerServiceTest(t)
+
+	// The running container has since moved to a new image and env.
+	current := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "new-id", Name: "/web", Image: "sha256:new", HostConfig: &container.HostConfig{}},
+		Config:            &container.Config{Image: "nginx:1.27", Env: []string{"MODE=new"}},
+		NetworkSettings:   &types.NetworkSettings{},
+	}
+	mockClient.ContainerInspectFunc = func(ctx context.Context, id string) (types.ContainerJSON, error) {
+		return current, nil
+	}
+	mockClient.ImageInspectWithRawFunc = func(ctx context.Context, ref string) (image.InspectResponse, []byte, error) {
+		if ref == "sha256:new" {
+			return image.InspectResponse{ID: "sha256:new", RepoDigests: []string{"nginx@sha256:new"}}, nil, nil
+		}
+		return image.InspectResponse{ID: "sha256:old", RepoDigests: []string{"nginx@sha256:old"}}, nil, nil
+	}
+	var pulled string
+	mockClient.ImagePullFunc = func(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
+		pulled = ref
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	var created *container.Config
+	var createdName string
+	mockClient.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, name string) (container.CreateResponse, error) {
+		created, createdName = config, name
+		return container.CreateResponse{ID: "rolled-back"}, nil
+	}
+
+	before := current
+	before.Config = &container.Config{Image: "nginx:1.27", Env: []string{"MODE=old"}}
+	snapshot := SnapshotConfig(before)
+
+	name, newID, prov, err := svc.RollbackContainer(context.Background(), "new-id", "nginx@sha256:old", snapshot)
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if name != "web" || newID != "rolled-back" || createdName != "web" {
+		t.Fatalf("unexpected container %q %q (created as %q)", name, newID, createdName)
+	}
+	if pulled != "" || created.Image != "nginx@sha256:old" || created.Env[0] != "MODE=old" {
+		t.Fatalf("expected the local pinned image with the snapshot config, pulled %q, created %+v", pulled, created)
+	}
+	if prov.PreviousDigest != "nginx@sha256:new" || prov.NewDigest != "nginx@sha256:old" || prov.NewImageID != "sha256:old" {
+		t.Fatalf("unexpected provenance %+v", prov)
+	}
+	if snap, err := ParseConfigSnapshot(prov.Config); err != nil || snap.Config.Env[0] != "MODE=new" {
+		t.Fatalf("expected the replaced config in the provenance, got %+v (%v)", snap, err)
+	}
+
+	if _, _, _, err := svc.RollbackContainer(context.Background(), "new-id", "nginx@sha256:old", []byte(`{"name":"web"}`)); err == nil {
+		t.Fatalf("expected an incomplete snapshot to be refused")
+	}
+}
+
+func TestRollbackContainerRestoresOnFailure(t *testing.T) {
+	svc, mockClient, _ := setupContainerServiceTest(t)
+
+	mockClient.ContainerInspectFunc = func(ctx context.Context, id string) (types.ContainerJSON, error) {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "c1", Name: "/web", Image: "sha256:new", HostConfig: &container.HostConfig{}},
+			Config:            &container.Config{Image: "nginx:1.27"},
+			NetworkSettings:   &types.NetworkSettings{},
+		}, nil
+	}
+	var renames []string
+	mockClient.ContainerRenameFunc = func(ctx context.Context, id, name string) error {
+		renames = append(renames, id+"="+name)
+		return nil
+	}
+	var started, removed []string
+	mockClient.ContainerStartFunc = func(ctx context.Context, id string, options container.StartOptions) error {
+		started = append(started, id)
+		if id == "rolled-back" {
+			return errors.New("port is already allocated")
+		}
+		return nil
+	}
+	mockClient.ContainerRemoveFunc = func(ctx context.Context, id string, options container.RemoveOptions) error {
+		removed = append(removed, id)
+		return nil
+	}
+	mockClient.ContainerCreateFunc = func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, name string) (container.CreateResponse, error) {
+		return container.CreateResponse{ID: "rolled-back"}, nil
+	}
+
+	_, _, _, err := svc.RollbackContainer(context.Background(), "c1", "nginx@sha256:old", nil)
+	var ue *UpdateError
+	if !errors.As(err, &ue) || !ue.RolledBack {
+		t.Fatalf("expected the original container to be restored, got %v", err)
+	}
+	if len(renames) != 2 || !strings.HasPrefix(renames[0], "c1=web-updockly-backup-") || renames[1] != "c1=web" {
+		t.Fatalf("expected a backup rename and its restore, got %v", renames)
+	}
+	if len(removed) != 1 || removed[0] != "rolled-back" || started[len(started)-1] != "c1" {
+		t.Fatalf("expected only the failed container to be removed and the original restarted, removed %v started %v", removed, started)
+	}
+}
@@ -0,0 +1,162 @@
+package containers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/client"
+)
+
+// RollbackRepository holds the tags that keep replaced images on the host, as
+// updockly/rollback/<container>:<n> with n counting up per container. A tagged image is
+// never dangling, so pruning leaves it alone until the tag is dropped.
+const RollbackRepository = "updockly/rollback"
+
+// RollbackRepo returns the retention repository of a container name; characters that
+// are not valid in a repository name become dashes.
+func RollbackRepo(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimPrefix(name, "/")) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	repo := strings.Trim(b.String(), "-")
+	if repo == "" {
+		repo = "container"
+	}
+	return RollbackRepository + "/" + repo
+}
+
+type retainedImage struct {
+	tag string
+	seq int
+	id  string
+}
+
+// retainedImages lists the retention tags on the host by repository, newest first.
+func retainedImages(ctx context.Context, cli client.APIClient) (map[string][]retainedImage, error) {
+	list, err := cli.ImageList(ctx, image.ListOptions{Filters: filters.NewArgs(filters.Arg("reference", RollbackRepository+"/*"))})
+	if err != nil {
+		return nil, err
+	}
+	byRepo := make(map[string][]retainedImage)
+	for _, img := range list {
+		for _, tag := range img.RepoTags {
+			idx := strings.LastIndex(tag, ":")
+			if idx < 0 || !strings.HasPrefix(tag, RollbackRepository+"/") {
+				continue
+			}
+			seq, err := strconv.Atoi(tag[idx+1:])
+			if err != nil {
+				continue
+			}
+			byRepo[tag[:idx]] = append(byRepo[tag[:idx]], retainedImage{tag: tag, seq: seq, id: img.ID})
+		}
+	}
+	for _, imgs := range byRepo {
+		sort.Slice(imgs, func(i, j int) bool { return imgs[i].seq > imgs[j].seq })
+	}
+	return byRepo, nil
+}
+
+// dropRetained removes the retention tags beyond the newest keep. Removing a tag only
+// deletes the image when nothing else references it.
+func dropRetained(ctx context.Context, cli client.APIClient, imgs []retainedImage, keep int) error {
+	if len(imgs) <= keep {
+		return nil
+	}
+	var errs []error
+	for _, img := range imgs[keep:] {
+		if _, err := cli.ImageRemove(ctx, img.tag, image.RemoveOptions{}); err != nil {
+			errs = append(errs, fmt.Errorf("remove %s: %w", img.tag, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// retainImage tags the image a container ran before an update or rollback, and drops
+// its oldest retention tags beyond the configured count.
+func (s *ContainerService) retainImage(ctx context.Context, cli client.APIClient, name, imageID string) error {
+	if s.retainImages <= 0 || strings.TrimSpace(imageID) == "" {
+		return nil
+	}
+	byRepo, err := retainedImages(ctx, cli)
+	if err != nil {
+		return err
+	}
+	repo := RollbackRepo(name)
+	imgs := byRepo[repo]
+	for _, img := range imgs {
+		if img.id == imageID {
+			return dropRetained(ctx, cli, imgs, s.retainImages)
+		}
+	}
+	next := 1
+	if len(imgs) > 0 {
+		next = imgs[0].seq + 1
+	}
+	tag := fmt.Sprintf("%s:%d", repo, next)
+	if err := cli.ImageTag(ctx, imageID, tag); err != nil {
+		return fmt.Errorf("tag %s: %w", tag, err)
+	}
+	imgs = append([]retainedImage{{tag: tag, seq: next, id: imageID}}, imgs...)
+	return dropRetained(ctx, cli, imgs, s.retainImages)
+}
+
+// EnforceImageRetention drops retention tags beyond the configured count for every
+// container, so a following prune can remove the images they kept.
+func (s *ContainerService) EnforceImageRetention(ctx context.Context) error {
+	cli, err := s.getDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	byRepo, err := retainedImages(ctx, cli)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, imgs := range byRepo {
+		if err := dropRetained(ctx, cli, imgs, max(s.retainImages, 0)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ensureRollbackImage makes targetImage available for a rollback. Digest references and
+// image IDs are immutable, so a local copy is used without contacting the registry. Tags
+// are pulled, falling back to the local copy when the registry cannot be reached.
+func ensureRollbackImage(ctx context.Context, cli client.APIClient, targetImage string) error {
+	_, _, inspectErr := cli.ImageInspectWithRaw(ctx, targetImage)
+	if strings.HasPrefix(targetImage, "sha256:") {
+		if inspectErr != nil {
+			return fmt.Errorf("image %s is no longer on the host: %w", targetImage, inspectErr)
+		}
+		return nil
+	}
+	if inspectErr == nil && strings.Contains(targetImage, "@sha256:") {
+		return nil
+	}
+	pullResp, err := cli.ImagePull(ctx, targetImage, image.PullOptions{})
+	if err != nil {
+		if inspectErr == nil {
+			return nil
+		}
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+	defer pullResp.Close()
+	_, _ = io.Copy(io.Discard, pullResp)
+	return nil
+}
@@ -0,0 +1,117 @@
+package containers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/image"
+)
+
+// fakeImageStore keeps retention tags the way the daemon would for ImageList,
+// ImageTag and ImageRemove.
+type fakeImageStore struct {
+	tags    map[string]string // tag -> image ID
+	removed []string
+}
+
+func (f *fakeImageStore) install(m *MockDockerClient) {
+	m.ImageListFunc = func(ctx context.Context, options image.ListOptions) ([]image.Summary, error) {
+		byID := map[string][]string{}
+		for tag, id := range f.tags {
+			byID[id] = append(byID[id], tag)
+		}
+		var out []image.Summary
+		for id, tags := range byID {
+			out = append(out, image.Summary{ID: id, RepoTags: tags})
+		}
+		return out, nil
+	}
+	m.ImageTagFunc = func(ctx context.Context, source, target string) error {
+		f.tags[target] = source
+		return nil
+	}
+	m.ImageRemoveFunc = func(ctx context.Context, ref string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+		delete(f.tags, ref)
+		f.removed = append(f.removed, ref)
+		return nil, nil
+	}
+}
+
+func TestRollbackRepo(t *testing.T) {
+	if got := RollbackRepo("/My_App.web"); got != "updockly/rollback/my-app-web" {
+		t.Fatalf("unexpected repository %q", got)
+	}
+	if got := RollbackRepo("__"); got != "updockly/rollback/container" {
+		t.Fatalf("unexpected repository %q", got)
+	}
+}
+
+func TestRetainImageKeepsLastImages(t *testing.T) {
+	svc, mockClient, _ := setupContainerServiceTest(t)
+	store := &fakeImageStore{tags: map[string]string{}}
+	store.install(mockClient)
+	ctx := context.Background()
+
+	for _, id := range []string{"sha256:one", "sha256:two", "sha256:two", "sha256:three"} {
+		if err := svc.retainImage(ctx, mockClient, "web", id); err != nil {
+			t.Fatalf("retain %s: %v", id, err)
+		}
+	}
+	want := map[string]string{
+		"updockly/rollback/web:2": "sha256:two",
+		"updockly/rollback/web:3": "sha256:three",
+	}
+	if len(store.tags) != len(want) {
+		t.Fatalf("expected %v, got %v", want, store.tags)
+	}
+	for tag, id := range want {
+		if store.tags[tag] != id {
+			t.Fatalf("expected %v, got %v", want, store.tags)
+		}
+	}
+
+	// A lower retention count releases the older tags before a prune.
+	svc.retainImages = 1
+	store.tags["updockly/rollback/db:7"] = "sha256:db"
+	if err := svc.EnforceImageRetention(ctx); err != nil {
+		t.Fatalf("enforce retention: %v", err)
+	}
+	if len(store.tags) != 2 || store.tags["updockly/rollback/web:3"] == "" || store.tags["updockly/rollback/db:7"] == "" {
+		t.Fatalf("expected the newest tag per container, got %v", store.tags)
+	}
+}
+
+func TestEnsureRollbackImagePrefersLocal(t *testing.T) {
+	_, mockClient, _ := setupContainerServiceTest(t)
+	ctx := context.Background()
+	local := map[string]bool{"nginx@sha256:old": true, "sha256:old": true, "nginx:1.26": true}
+	mockClient.ImageInspectWithRawFunc = func(ctx context.Context, ref string) (image.InspectResponse, []byte, error) {
+		if local[ref] {
+			return image.InspectResponse{ID: "sha256:old"}, nil, nil
+		}
+		return image.InspectResponse{}, nil, errors.New("no such image")
+	}
+	var pulls []string
+	mockClient.ImagePullFunc = func(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error) {
+		pulls = append(pulls, ref)
+		return nil, errors.New("registry unreachable")
+	}
+
+	for _, ref := range []string{"nginx@sha256:old", "sha256:old", "nginx:1.26"} {
+		if err := ensureRollbackImage(ctx, mockClient, ref); err != nil {
+			t.Fatalf("expected %s to roll back from the local image, got %v", ref, err)
+		}
+	}
+	if len(pulls) != 1 || pulls[0] != "nginx:1.26" {
+		t.Fatalf("expected only the tag to be pulled, got %v", pulls)
+	}
+	if err := ensureRollbackImage(ctx, mockClient, "sha256:gone"); err == nil || !strings.Contains(err.Error(), "no longer on the host") {
+		t.Fatalf("expected a missing image ID to fail, got %v", err)
+	}
+	if err := ensureRollbackImage(ctx, mockClient, "nginx:1.25"); err == nil {
+		t.Fatalf("expected a missing tag to fail while the registry is down")
+	}
+}
@@ -16,20 +16,25 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
 	"updockly/backend/internal/domain"
+	"updockly/backend/internal/tracing"
 )
 
 type ContainerService struct {
 	db                  *gorm.DB
 	dockerClientFactory func() (client.APIClient, error)
+	// retainImages is how many replaced images are kept per container for rollback.
+	retainImages int
 }
 
-func NewContainerService(db *gorm.DB) *ContainerService {
+func NewContainerService(db *gorm.DB, retainImages int) *ContainerService {
 	return &ContainerService{
-		db: db,
+		db:           db,
+		retainImages: retainImages,
 		dockerClientFactory: func() (client.APIClient, error) {
 			return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 		},
@@ -266,6 +271,41 @@ func (s *ContainerService) ToggleAutoUpdate(ctx context.Context, id string, enab
 	return silentDB.Save(&cfg).Error
 }
 
+// Labels returns the labels of a local container.
+func (s *ContainerService) Labels(ctx context.Context, id string) (map[string]string, error) {
+	cli, err := s.getDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if info.Config == nil {
+		return nil, nil
+	}
+	return info.Config.Labels, nil
+}
+
+// Describe returns the name, image reference and labels of a local container.
+func (s *ContainerService) Describe(ctx context.Context, id string) (string, string, map[string]string, error) {
+	cli, err := s.getDockerClient()
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer cli.Close()
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", "", nil, err
+	}
+	name := strings.TrimPrefix(info.Name, "/")
+	if info.Config == nil {
+		return name, "", nil, nil
+	}
+	return name, info.Config.Image, info.Config.Labels, nil
+}
+
 func (s *ContainerService) StartContainer(ctx context.Context, id string) error {
 	cli, err := s.getDockerClient()
 	if err != nil {
@@ -357,17 +397,33 @@ func (e *UpdateError) Unwrap() error {
 	return e.Err
 }
 
-func (s *ContainerService) UpdateContainer(ctx context.Context, id string, progress UpdateProgressCallback) (string, string, string, string, error) {
+// UpdateContainer pulls the image of a container and recreates it, restoring the old
+// container if that fails. It returns the new container ID, its name and image, and the
+// provenance of the update. Each step is traced as a child of a container.update span.
+func (s *ContainerService) UpdateContainer(ctx context.Context, id string, progress UpdateProgressCallback) (string, string, string, Provenance, error) {
+	ctx, span := tracing.Start(ctx, "container.update", attribute.String("container.id", id))
+	steps := tracing.NewSteps(ctx)
+	newID, name, imageRef, prov, err := s.updateContainer(ctx, id, progress, steps)
+	steps.End(err)
+	span.SetAttributes(attribute.String("container.name", name), attribute.String("container.image", imageRef))
+	tracing.End(span, err)
+	return newID, name, imageRef, prov, err
+}
+
+func (s *ContainerService) updateContainer(ctx context.Context, id string, progress UpdateProgressCallback, steps *tracing.Steps) (string, string, string, Provenance, error) {
+	var prov Provenance
 	cli, err := s.getDockerClient()
 	if err != nil {
-		return "", "", "", "", err
+		return "", "", "", prov, err
 	}
 	defer cli.Close()
 
 	info, err := cli.ContainerInspect(ctx, id)
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("failed to inspect container: %w", err)
+		return "", "", "", prov, fmt.Errorf("failed to inspect container: %w", err)
 	}
+	prov.PreviousImageID, prov.PreviousDigest = imageProvenance(ctx, cli, info.Image, info.Config.Image)
+	prov.Config = SnapshotConfig(info)
 
 	sendProgress := func(status string) {
 		if progress != nil {
@@ -376,11 +432,12 @@ func (s *ContainerService) UpdateContainer(ctx context.Context, id string, progr
 	}
 
 	sendProgress("Pulling image " + info.Config.Image)
+	ctx = steps.Next("container.update.pull")
 
 	targetRef := info.Config.Image
 	out, err := cli.ImagePull(ctx, targetRef, image.PullOptions{})
 	if err != nil {
-		return "", "", "", "", fmt.Errorf("image pull failed: %w", err)
+		return "", "", "", prov, fmt.Errorf("image pull failed: %w", err)
 	}
 	defer out.Close()
 
@@ -397,37 +454,41 @@ func (s *ContainerService) UpdateContainer(ctx context.Context, id string, progr
 		}
 	}
 
-	digest := resolveImageDigest(ctx, cli, targetRef)
+	prov.NewImageID, prov.NewDigest = imageProvenance(ctx, cli, targetRef, targetRef)
 
 	sendProgress("Stopping container")
+	ctx = steps.Next("container.update.stop")
 	if err := cli.ContainerStop(ctx, id, container.StopOptions{}); err != nil {
-		return "", "", "", "", fmt.Errorf("failed to stop container: %w", err)
+		return "", "", "", prov, fmt.Errorf("failed to stop container: %w", err)
 	}
 
 	name := strings.TrimPrefix(info.Name, "/")
 	backupName := fmt.Sprintf("%s-updockly-backup-%d", name, time.Now().Unix())
 	sendProgress("Backing up container before recreate")
+	ctx = steps.Next("container.update.backup")
 	if err := cli.ContainerRename(ctx, id, backupName); err != nil {
 		_ = cli.ContainerStart(ctx, id, container.StartOptions{})
-		return "", "", "", "", fmt.Errorf("failed to backup container: %w", err)
+		return "", "", "", prov, fmt.Errorf("failed to backup container: %w", err)
 	}
 	backupID := id
 
-	restoreOriginal := func(reason error) (string, string, string, string, error) {
+	restoreOriginal := func(reason error) (string, string, string, Provenance, error) {
 		sendProgress("Rolling back to previous container")
+		steps.End(reason)
+		ctx = steps.Next("container.update.restore")
 		if err := cli.ContainerRename(ctx, backupID, name); err != nil {
 			// Best effort start even if rename fails to avoid downtime
 			_ = cli.ContainerStart(ctx, backupID, container.StartOptions{})
-			return backupID, name, info.Config.Image, "", &UpdateError{
+			return backupID, name, info.Config.Image, prov, &UpdateError{
 				Err: fmt.Errorf("failed to recreate container (%v) and could not restore original name: %w", reason, err),
 			}
 		}
 		if err := cli.ContainerStart(ctx, backupID, container.StartOptions{}); err != nil {
-			return backupID, name, info.Config.Image, "", &UpdateError{
+			return backupID, name, info.Config.Image, prov, &UpdateError{
 				Err: fmt.Errorf("failed to recreate container (%v) and restart the original one: %w", reason, err),
 			}
 		}
-		return backupID, name, info.Config.Image, "", &UpdateError{
+		return backupID, name, info.Config.Image, prov, &UpdateError{
 			Err:             reason,
 			RolledBack:      true,
 			RollbackMessage: "restored previous container",
@@ -435,6 +496,7 @@ func (s *ContainerService) UpdateContainer(ctx context.Context, id string, progr
 	}
 
 	sendProgress("Recreating container")
+	ctx = steps.Next("container.update.recreate")
 	networkingConfig := &network.NetworkingConfig{EndpointsConfig: make(map[string]*network.EndpointSettings)}
 	for netName, endpoint := range info.NetworkSettings.Networks {
 		networkingConfig.EndpointsConfig[netName] = endpoint
@@ -454,16 +516,21 @@ func (s *ContainerService) UpdateContainer(ctx context.Context, id string, progr
 	}
 
 	sendProgress("Starting new container")
+	ctx = steps.Next("container.update.start")
 	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		_ = cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{RemoveVolumes: true, Force: true})
 		return restoreOriginal(fmt.Errorf("failed to start container: %w", err))
 	}
 
 	sendProgress("Cleaning up old container")
+	ctx = steps.Next("container.update.cleanup")
 	_ = cli.ContainerRemove(ctx, backupID, container.RemoveOptions{RemoveVolumes: true, Force: true})
+	prov.NewConfig = newConfig(ctx, cli, resp.ID)
+	if prov.PreviousImageID != prov.NewImageID {
+		_ = s.retainImage(ctx, cli, name, prov.PreviousImageID)
+	}
 
 	// Sync DB
-	newDigest := digest
 	if s.db != nil {
 		silentDB := s.db.Session(&gorm.Session{Logger: logger.Discard})
 		_ = silentDB.Model(&domain.ContainerSettings{}).Where("id = ?", id).Updates(map[string]interface{}{
@@ -474,56 +541,110 @@ func (s *ContainerService) UpdateContainer(ctx context.Context, id string, progr
 		}).Error
 	}
 
-	return resp.ID, name, info.Config.Image, newDigest, nil
+	return resp.ID, name, info.Config.Image, prov, nil
+}
+
+// RollbackContainer recreates a container from targetImage, with the config of snapshot
+// when one is given (see SnapshotConfig) and its current config otherwise. It returns the
+// container name, the new container ID and the provenance of the rollback.
+func (s *ContainerService) RollbackContainer(ctx context.Context, id, targetImage string, snapshot []byte) (string, string, Provenance, error) {
+	ctx, span := tracing.Start(ctx, "container.rollback",
+		attribute.String("container.id", id), attribute.String("container.image", targetImage))
+	name, newID, prov, err := s.rollbackContainer(ctx, id, targetImage, snapshot)
+	span.SetAttributes(attribute.String("container.name", name))
+	tracing.End(span, err)
+	return name, newID, prov, err
 }
 
-func (s *ContainerService) RollbackContainer(ctx context.Context, id, targetImage string) (string, string, error) {
+func (s *ContainerService) rollbackContainer(ctx context.Context, id, targetImage string, snapshot []byte) (string, string, Provenance, error) {
+	var prov Provenance
 	cli, err := s.getDockerClient()
 	if err != nil {
-		return "", "", err
+		return "", "", prov, err
 	}
 	defer cli.Close()
 
 	info, err := cli.ContainerInspect(ctx, id)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to inspect container: %w", err)
+		return "", "", prov, fmt.Errorf("failed to inspect container: %w", err)
 	}
 	name := strings.TrimPrefix(info.Name, "/")
+	prov.PreviousImageID, prov.PreviousDigest = imageProvenance(ctx, cli, info.Image, info.Config.Image)
+	prov.Config = SnapshotConfig(info)
+
+	config, hostConfig := info.Config, info.HostConfig
+	networks := info.NetworkSettings.Networks
+	if len(snapshot) > 0 {
+		snap, err := ParseConfigSnapshot(snapshot)
+		if err != nil {
+			return name, "", prov, fmt.Errorf("invalid config snapshot: %w", err)
+		}
+		config, hostConfig, networks = snap.Config, snap.HostConfig, snap.Networks
+	}
 
-	pullResp, err := cli.ImagePull(ctx, targetImage, image.PullOptions{})
-	if err != nil {
-		return name, "", fmt.Errorf("failed to pull image: %w", err)
+	if err := ensureRollbackImage(ctx, cli, targetImage); err != nil {
+		return name, "", prov, err
 	}
-	defer pullResp.Close()
-	_, _ = io.Copy(io.Discard, pullResp)
+	prov.NewImageID, prov.NewDigest = imageProvenance(ctx, cli, targetImage, config.Image)
 
 	if err := cli.ContainerStop(ctx, info.ID, container.StopOptions{}); err != nil {
-		// Log but continue? Original code logged but continued.
+		return name, "", prov, fmt.Errorf("failed to stop container: %w", err)
 	}
 
-	if err := cli.ContainerRemove(ctx, info.ID, container.RemoveOptions{RemoveVolumes: true, Force: true}); err != nil {
-		return name, "", fmt.Errorf("failed to remove container: %w", err)
+	// Keep the current container until its replacement runs, as updateContainer does.
+	backupID := info.ID
+	backupName := fmt.Sprintf("%s-updockly-backup-%d", name, time.Now().Unix())
+	if err := cli.ContainerRename(ctx, backupID, backupName); err != nil {
+		_ = cli.ContainerStart(ctx, backupID, container.StartOptions{})
+		return name, "", prov, fmt.Errorf("failed to backup container: %w", err)
+	}
+
+	restoreOriginal := func(reason error) (string, string, Provenance, error) {
+		if err := cli.ContainerRename(ctx, backupID, name); err != nil {
+			// Best effort start even if rename fails to avoid downtime
+			_ = cli.ContainerStart(ctx, backupID, container.StartOptions{})
+			return name, "", prov, &UpdateError{
+				Err: fmt.Errorf("%v and could not restore original name: %w", reason, err),
+			}
+		}
+		if err := cli.ContainerStart(ctx, backupID, container.StartOptions{}); err != nil {
+			return name, "", prov, &UpdateError{
+				Err: fmt.Errorf("%v and could not restart the original container: %w", reason, err),
+			}
+		}
+		return name, "", prov, &UpdateError{
+			Err:             reason,
+			RolledBack:      true,
+			RollbackMessage: "restored previous container",
+		}
 	}
 
 	networkingConfig := &network.NetworkingConfig{EndpointsConfig: make(map[string]*network.EndpointSettings)}
-	for netName, endpoint := range info.NetworkSettings.Networks {
+	for netName, endpoint := range networks {
 		networkingConfig.EndpointsConfig[netName] = endpoint
 	}
 
-	info.Config.Image = targetImage
+	configCopy := *config
+	configCopy.Image = targetImage
 
-	if info.HostConfig.NetworkMode.IsHost() || strings.HasPrefix(string(info.HostConfig.NetworkMode), "container:") {
-		info.Config.Hostname = ""
-		info.Config.Domainname = ""
+	if hostConfig.NetworkMode.IsHost() || strings.HasPrefix(string(hostConfig.NetworkMode), "container:") {
+		configCopy.Hostname = ""
+		configCopy.Domainname = ""
 	}
 
-	resp, err := cli.ContainerCreate(ctx, info.Config, info.HostConfig, networkingConfig, nil, name)
+	resp, err := cli.ContainerCreate(ctx, &configCopy, hostConfig, networkingConfig, nil, name)
 	if err != nil {
-		return name, "", fmt.Errorf("failed to recreate container: %w", err)
+		return restoreOriginal(fmt.Errorf("failed to recreate container: %w", err))
 	}
 
 	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return name, "", fmt.Errorf("failed to start container: %w", err)
+		_ = cli.ContainerRemove(ctx, resp.ID, container.RemoveOptions{RemoveVolumes: true, Force: true})
+		return restoreOriginal(fmt.Errorf("failed to start container: %w", err))
+	}
+	_ = cli.ContainerRemove(ctx, backupID, container.RemoveOptions{RemoveVolumes: true, Force: true})
+	prov.NewConfig = newConfig(ctx, cli, resp.ID)
+	if prov.PreviousImageID != prov.NewImageID {
+		_ = s.retainImage(ctx, cli, name, prov.PreviousImageID)
 	}
 
 	if s.db != nil {
@@ -536,7 +657,7 @@ func (s *ContainerService) RollbackContainer(ctx context.Context, id, targetImag
 		}).Error
 	}
 
-	return name, resp.ID, nil
+	return name, resp.ID, prov, nil
 }
 
 // Helper function moved from updater.go (or duplicated/adapted)
@@ -566,17 +687,3 @@ func IsUpdateAvailableWithClient(ctx context.Context, cli client.APIClient, cont
 
 	return true, nil
 }
-
-func resolveImageDigest(ctx context.Context, cli client.APIClient, ref string) string {
-	if strings.TrimSpace(ref) == "" {
-		return ""
-	}
-	inspect, _, err := cli.ImageInspectWithRaw(ctx, ref)
-	if err != nil {
-		return ""
-	}
-	if len(inspect.RepoDigests) > 0 && inspect.RepoDigests[0] != "" {
-		return inspect.RepoDigests[0]
-	}
-	return inspect.ID
-}
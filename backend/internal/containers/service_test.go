@@ -35,8 +35,12 @@ type MockDockerClient struct {
 	ContainerLogsFunc       func(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error)
 	ImagePullFunc           func(ctx context.Context, ref string, options image.PullOptions) (io.ReadCloser, error)
 	ContainerRemoveFunc     func(ctx context.Context, containerID string, options container.RemoveOptions) error
+	ContainerRenameFunc     func(ctx context.Context, containerID, newName string) error
 	ContainerCreateFunc     func(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.CreateResponse, error)
 	ImageInspectWithRawFunc func(ctx context.Context, imageID string) (image.InspectResponse, []byte, error)
+	ImageListFunc           func(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	ImageTagFunc            func(ctx context.Context, source, target string) error
+	ImageRemoveFunc         func(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error)
 	PingFunc                func(ctx context.Context) (types.Ping, error)
 	InfoFunc                func(ctx context.Context) (system.Info, error)
 }
@@ -120,6 +124,13 @@ func (m *MockDockerClient) ContainerRemove(ctx context.Context, containerID stri
 	return nil
 }
 
+func (m *MockDockerClient) ContainerRename(ctx context.Context, containerID, newName string) error {
+	if m.ContainerRenameFunc != nil {
+		return m.ContainerRenameFunc(ctx, containerID, newName)
+	}
+	return nil
+}
+
 func (m *MockDockerClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *specs.Platform, containerName string) (container.CreateResponse, error) {
 	if m.ContainerCreateFunc != nil {
 		return m.ContainerCreateFunc(ctx, config, hostConfig, networkingConfig, platform, containerName)
@@ -127,6 +138,27 @@ func (m *MockDockerClient) ContainerCreate(ctx context.Context, config *containe
 	return container.CreateResponse{}, nil
 }
 
+func (m *MockDockerClient) ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error) {
+	if m.ImageListFunc != nil {
+		return m.ImageListFunc(ctx, options)
+	}
+	return nil, nil
+}
+
+func (m *MockDockerClient) ImageTag(ctx context.Context, source, target string) error {
+	if m.ImageTagFunc != nil {
+		return m.ImageTagFunc(ctx, source, target)
+	}
+	return nil
+}
+
+func (m *MockDockerClient) ImageRemove(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+	if m.ImageRemoveFunc != nil {
+		return m.ImageRemoveFunc(ctx, imageID, options)
+	}
+	return nil, nil
+}
+
 func (m *MockDockerClient) Ping(ctx context.Context) (types.Ping, error) {
 	if m.PingFunc != nil {
 		return m.PingFunc(ctx)
@@ -156,7 +188,7 @@ func setupContainerServiceTest(t *testing.T) (*ContainerService, *MockDockerClie
 	}
 
 	mockClient := &MockDockerClient{}
-	svc := NewContainerService(db)
+	svc := NewContainerService(db, 2)
 	svc.dockerClientFactory = func() (client.APIClient, error) {
 		return mockClient, nil
 	}
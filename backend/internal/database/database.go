@@ -11,12 +11,24 @@ import (
 	"gorm.io/gorm/logger"
 
 	"updockly/backend/internal/config"
-	"updockly/backend/internal/domain"
-	"updockly/backend/internal/settings"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/tracing"
 )
 
-// Connect opens a GORM database connection and runs migrations.
+// Connect opens a GORM database connection and applies pending migrations.
 func Connect(cfg config.Config) (*gorm.DB, error) {
+	db, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := Migrate(db); err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	return db, nil
+}
+
+// Open opens a GORM database connection without migrating it.
+func Open(cfg config.Config) (*gorm.DB, error) {
 	var dial gorm.Dialector
 	lower := strings.ToLower(cfg.DatabaseURL)
 	switch {
@@ -29,10 +41,13 @@ func Connect(cfg config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("DATABASE_URL is not set or has an invalid scheme")
 	}
 
-	db, err := gorm.Open(dial, &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)})
+	db, err := gorm.Open(dial, &gorm.Config{Logger: logging.Gorm(logger.Warn)})
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("register tracing: %w", err)
+	}
 
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -42,19 +57,5 @@ func Connect(cfg config.Config) (*gorm.DB, error) {
 	sqlDB.SetMaxOpenConns(15)
 	sqlDB.SetConnMaxLifetime(30 * time.Minute)
 
-	if err := db.AutoMigrate(
-		&domain.Account{},
-		&domain.ContainerSettings{},
-		&domain.Schedule{},
-		&domain.Agent{},
-		&domain.AgentCommand{},
-		&domain.UpdateHistory{},
-		&domain.RunningSnapshot{},
-		&domain.AuditLog{},
-		&settings.Record{},
-	); err != nil {
-		return nil, fmt.Errorf("migrate: %w", err)
-	}
-
 	return db, nil
 }
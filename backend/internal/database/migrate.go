@@ -0,0 +1,183 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrSchemaTooNew is returned when the database has migrations applied that this build
+// does not know, as after downgrading Updockly. Running against it could lose data.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version of Updockly")
+
+// ErrIrreversible is returned when rolling back a migration without a Down step.
+var ErrIrreversible = errors.New("migration cannot be rolled back")
+
+// migrationLock is the Postgres advisory lock held while migrating, so replicas
+// starting together do not apply the same migration twice.
+const migrationLock = 0x75706d67
+
+// Migration is one versioned change to the schema. Up and Down run in a transaction
+// with the change to the schema version table, so a failed step leaves no trace.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	// Down undoes Up; nil when it cannot be undone.
+	Down func(tx *gorm.DB) error
+}
+
+// MigrationStatus is a known or applied migration. AppliedAt is nil while pending;
+// Known is false for migrations recorded by a newer build.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	Known     bool
+}
+
+// schemaMigration is a row of the schema version table, one per applied migration.
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// LatestVersion is the schema version this build migrates to.
+func LatestVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate applies the pending migrations in order. It fails with ErrSchemaTooNew
+// without changing anything when the database is ahead of this build.
+func Migrate(db *gorm.DB) error {
+	return migrateTx(db, func(tx *gorm.DB, applied map[int]schemaMigration) error {
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			if err := m.Up(tx); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+			}
+			row := schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}
+			if err := tx.Create(&row).Error; err != nil {
+				return fmt.Errorf("record migration %d: %w", m.Version, err)
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown rolls back the last steps applied migrations, newest first.
+func MigrateDown(db *gorm.DB, steps int) error {
+	if steps < 1 {
+		return errors.New("steps must be at least 1")
+	}
+	return migrateTx(db, func(tx *gorm.DB, applied map[int]schemaMigration) error {
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == nil {
+				return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, ErrIrreversible)
+			}
+			if err := m.Down(tx); err != nil {
+				return fmt.Errorf("roll back migration %d (%s): %w", m.Version, m.Name, err)
+			}
+			if err := tx.Delete(&schemaMigration{}, m.Version).Error; err != nil {
+				return fmt.Errorf("unrecord migration %d: %w", m.Version, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status lists the known migrations and any applied by a newer build, by version.
+func Status(db *gorm.DB) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name, Known: true}
+		if row, ok := applied[m.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.AppliedAt = &appliedAt
+			delete(applied, m.Version)
+		}
+		out = append(out, status)
+	}
+	for _, row := range applied {
+		appliedAt := row.AppliedAt
+		out = append(out, MigrationStatus{Version: row.Version, Name: row.Name, AppliedAt: &appliedAt})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// migrateTx runs fn in a transaction holding the migration lock, with the applied
+// migrations, once the schema is known not to be ahead of this build.
+func migrateTx(db *gorm.DB, fn func(tx *gorm.DB, applied map[int]schemaMigration) error) error {
+	if db == nil {
+		return errors.New("database not ready")
+	}
+	if err := db.Session(&gorm.Session{Logger: logger.Discard}).AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("create schema version table: %w", err)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error; err != nil {
+				return fmt.Errorf("lock migrations: %w", err)
+			}
+		}
+		applied, err := appliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(applied); err != nil {
+			return err
+		}
+		return fn(tx, applied)
+	})
+}
+
+func appliedMigrations(db *gorm.DB) (map[int]schemaMigration, error) {
+	if db == nil {
+		return nil, errors.New("database not ready")
+	}
+	applied := map[int]schemaMigration{}
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return applied, nil
+	}
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("load schema version: %w", err)
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func checkVersion(applied map[int]schemaMigration) error {
+	newest := 0
+	for version := range applied {
+		newest = max(newest, version)
+	}
+	if latest := LatestVersion(); newest > latest {
+		return fmt.Errorf("%w: the database is at version %d, this build knows up to %d", ErrSchemaTooNew, newest, latest)
+	}
+	return nil
+}
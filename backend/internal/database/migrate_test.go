@@ -0,0 +1,227 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/settings"
+)
+
+// models are the models the schema must hold at the latest version.
+var models = []interface{}{
+	&domain.Account{},
+	&domain.ContainerSettings{},
+	&domain.Schedule{},
+	&domain.Agent{},
+	&domain.AgentCommand{},
+	&domain.UpdateHistory{},
+	&domain.RunningSnapshot{},
+	&domain.AuditLog{},
+	&domain.AuditChainHead{},
+	&domain.WebAuthnCredential{},
+	&domain.WebAuthnSession{},
+	&domain.LoginThrottle{},
+	&domain.NotificationChannel{},
+	&domain.NotificationRule{},
+	&domain.NotificationTemplate{},
+	&domain.NotificationDelivery{},
+	&domain.NotificationAttempt{},
+	&domain.PendingUpdate{},
+	&domain.UpdateDigestState{},
+	&domain.RecapSchedule{},
+	&domain.ReleaseNotes{},
+	&domain.UpdateApproval{},
+	&domain.ContainerConfigSnapshot{},
+	&domain.ResourceSample{},
+	&domain.RunningSample{},
+	&domain.ContainerStateSpan{},
+	&settings.Record{},
+}
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := Open(config.Config{DatabaseURL: "sqlite://" + filepath.Join(t.TempDir(), "updockly.db")})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return db
+}
+
+func appliedVersions(t *testing.T, db *gorm.DB) []int {
+	t.Helper()
+	statuses, err := Status(db)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	var out []int
+	for _, st := range statuses {
+		if st.AppliedAt != nil {
+			out = append(out, st.Version)
+		}
+	}
+	return out
+}
+
+// TestMigrationsMatchModels fails when a model changes without a migration.
+func TestMigrationsMatchModels(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	migrator := db.Migrator()
+	for _, model := range models {
+		s, err := schema.Parse(model, &sync.Map{}, db.NamingStrategy)
+		if err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+		if !migrator.HasTable(s.Table) {
+			t.Errorf("%s: table %s is missing", s.Name, s.Table)
+			continue
+		}
+		for _, field := range s.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				t.Errorf("%s: column %s.%s is missing", s.Name, s.Table, field.DBName)
+			}
+		}
+		for _, idx := range s.ParseIndexes() {
+			if !migrator.HasIndex(model, idx.Name) {
+				t.Errorf("%s: index %s is missing", s.Name, idx.Name)
+			}
+		}
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	db := openTestDB(t)
+	for i := 0; i < 2; i++ {
+		if err := Migrate(db); err != nil {
+			t.Fatalf("migrate run %d: %v", i+1, err)
+		}
+	}
+	if got := appliedVersions(t, db); len(got) != LatestVersion() {
+		t.Fatalf("expected %d applied migrations, got %v", LatestVersion(), got)
+	}
+}
+
+func TestMigrateAdoptsAutoMigratedDatabase(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	if err := db.Create(&domain.Account{Username: "admin"}).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if got := appliedVersions(t, db); len(got) == 0 || got[0] != 1 {
+		t.Fatalf("expected the baseline to be recorded, got %v", got)
+	}
+	var count int64
+	db.Model(&domain.Account{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected existing rows to be kept, got %d accounts", count)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	future := schemaMigration{Version: LatestVersion() + 1, Name: "from the future"}
+	if err := db.Create(&future).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	if err := Migrate(db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+	statuses, err := Status(db)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	last := statuses[len(statuses)-1]
+	if last.Version != future.Version || last.Known {
+		t.Fatalf("expected the unknown migration to be listed last, got %+v", last)
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	type Widget struct {
+		ID   uint `gorm:"primaryKey"`
+		Name string
+	}
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = append(append([]Migration(nil), saved...), Migration{
+		Version: LatestVersion() + 1,
+		Name:    "widgets",
+		Up:      func(tx *gorm.DB) error { return tx.Migrator().CreateTable(&Widget{}) },
+		Down:    func(tx *gorm.DB) error { return tx.Migrator().DropTable(&Widget{}) },
+	})
+
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if !db.Migrator().HasTable(&Widget{}) {
+		t.Fatal("expected widgets table after migrating up")
+	}
+
+	if err := MigrateDown(db, 1); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	if db.Migrator().HasTable(&Widget{}) {
+		t.Fatal("expected widgets table to be dropped")
+	}
+	if got := appliedVersions(t, db); len(got) != len(saved) {
+		t.Fatalf("expected only the shipped migrations to stay applied, got %v", got)
+	}
+
+	if err := MigrateDown(db, len(saved)); !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("expected the baseline to be irreversible, got %v", err)
+	}
+	if err := MigrateDown(db, 0); err == nil {
+		t.Fatal("expected an error for zero steps")
+	}
+}
+
+func TestMigrateRenumbersDuplicateSnapshotVersions(t *testing.T) {
+	db := openTestDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := MigrateDown(db, LatestVersion()-4); err != nil {
+		t.Fatalf("migrate down: %v", err)
+	}
+	now := time.Now()
+	for i, version := range []int{1, 2, 2, 3} {
+		row := domain.ContainerConfigSnapshot{ContainerName: "web", Version: version, CreatedAt: now.Add(time.Duration(i) * time.Second)}
+		if err := db.Create(&row).Error; err != nil {
+			t.Fatalf("seed %d: %v", i, err)
+		}
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var versions []int
+	db.Model(&domain.ContainerConfigSnapshot{}).Order("created_at ASC").Pluck("version", &versions)
+	if len(versions) != 4 || versions[0] != 1 || versions[1] != 2 || versions[2] != 3 || versions[3] != 4 {
+		t.Fatalf("expected the versions to be numbered again, got %v", versions)
+	}
+	if err := db.Create(&domain.ContainerConfigSnapshot{ContainerName: "web", Version: 4}).Error; err == nil {
+		t.Fatal("expected a duplicate version to be refused")
+	}
+}
@@ -0,0 +1,505 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrations is the schema history, in version order. Append new migrations with the
+// next version and never edit one that has shipped. Migrations must not use the domain
+// models, which follow the latest schema: declare the columns they touch locally, or
+// use SQL, checking tx.Dialector.Name() where Postgres and SQLite differ.
+var migrations = []Migration{
+	{Version: 1, Name: "baseline", Up: baseline},
+	{Version: 2, Name: "update_digest_state", Up: updateDigestStateUp, Down: updateDigestStateDown},
+	{Version: 3, Name: "update_approval_digest", Up: updateApprovalDigestUp, Down: updateApprovalDigestDown},
+	{Version: 4, Name: "audit_chain_head", Up: auditChainHeadUp, Down: auditChainHeadDown},
+	{Version: 5, Name: "config_snapshot_version_unique", Up: configSnapshotVersionUp, Down: configSnapshotVersionDown},
+	{Version: 6, Name: "notification_delivery_claim", Up: deliveryClaimUp, Down: deliveryClaimDown},
+}
+
+// baseline creates the schema as AutoMigrate built it before versioned migrations.
+// Databases created back then already have it, so on them it only fills gaps and they
+// are adopted at version 1. The models are a copy frozen at that schema.
+func baseline(tx *gorm.DB) error {
+	type Account struct {
+		ID                 string `gorm:"primaryKey"`
+		Name               string
+		Username           string `gorm:"uniqueIndex"`
+		Email              string
+		PasswordHash       string
+		ResetToken         string
+		ResetTokenHash     string
+		ResetTokenExpiry   *time.Time
+		RefreshTokenHash   string
+		RefreshTokenExpiry *time.Time
+		Role               string
+		TwoFactorSecret    string
+		TwoFactorEnabled   bool
+		RecoveryCodes      string `gorm:"type:jsonb"`
+		PasswordHistory    string `gorm:"type:jsonb"`
+		PasswordChangedAt  *time.Time
+		AuthSource         string
+		CreatedAt          time.Time
+		UpdatedAt          time.Time
+	}
+	type ContainerSettings struct {
+		ID              string `gorm:"primaryKey"`
+		Name            string
+		Image           string
+		AutoUpdate      bool
+		UpdateAvailable bool
+		CreatedAt       time.Time
+		UpdatedAt       time.Time
+	}
+	type Schedule struct {
+		ID             string `gorm:"primaryKey"`
+		Name           string
+		CronExpression string
+		CreatedAt      time.Time
+		UpdatedAt      time.Time
+	}
+	type Agent struct {
+		ID              string `gorm:"primaryKey"`
+		Name            string
+		Hostname        string
+		AgentVersion    string
+		DockerVersion   string
+		Platform        string
+		Notes           string
+		Token           string
+		TokenHash       string
+		TokenVersion    int
+		TokenExpiresAt  *time.Time
+		TokenBinding    string
+		LastSeen        *time.Time
+		Containers      string `gorm:"type:jsonb"`
+		TLSEnabled      bool
+		CPU             float64
+		Memory          float64
+		CreatedAt       time.Time
+		UpdatedAt       time.Time
+		RequireApproval bool
+	}
+	type AgentCommand struct {
+		ID          string `gorm:"primaryKey"`
+		AgentID     string `gorm:"index"`
+		Type        string
+		Status      string
+		Payload     string `gorm:"type:jsonb"`
+		Result      string `gorm:"type:jsonb"`
+		Error       string
+		StartedAt   *time.Time
+		CompletedAt *time.Time
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+		TraceParent string
+	}
+	type UpdateHistory struct {
+		ID              string `gorm:"primaryKey"`
+		ContainerID     string
+		ContainerName   string
+		Image           string
+		ImageDigest     string
+		AgentID         string
+		AgentName       string
+		Source          string
+		Status          string
+		Message         string
+		CreatedAt       time.Time
+		UpdatedAt       time.Time
+		PreviousImageID string
+		PreviousDigest  string
+		NewImageID      string
+		ConfigSnapshot  string `gorm:"type:text"`
+	}
+	type RunningSnapshot struct {
+		ID        string    `gorm:"primaryKey"`
+		Date      time.Time `gorm:"index"`
+		Running   int
+		Total     int
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	type AuditLog struct {
+		ID         uint   `gorm:"primaryKey"`
+		UserID     string `gorm:"index"`
+		UserName   string
+		Action     string `gorm:"index"`
+		TargetType string `gorm:"index:idx_audit_logs_target"`
+		TargetID   string `gorm:"index:idx_audit_logs_target"`
+		Details    string
+		Before     string `gorm:"type:text"`
+		After      string `gorm:"type:text"`
+		IPAddress  string
+		PrevHash   string    `gorm:"size:64"`
+		Hash       string    `gorm:"size:64"`
+		CreatedAt  time.Time `gorm:"index"`
+	}
+	type WebAuthnCredential struct {
+		ID              string `gorm:"primaryKey"`
+		AccountID       string `gorm:"index"`
+		Name            string
+		CredentialID    string `gorm:"uniqueIndex"`
+		PublicKey       []byte
+		AttestationType string
+		Transports      string `gorm:"type:jsonb"`
+		AAGUID          []byte
+		SignCount       uint32
+		UserPresent     bool
+		UserVerified    bool
+		BackupEligible  bool
+		BackupState     bool
+		LastUsedAt      *time.Time
+		LastUsedIP      string
+		CreatedAt       time.Time
+		UpdatedAt       time.Time
+	}
+	type WebAuthnSession struct {
+		ID        string `gorm:"primaryKey"`
+		AccountID string `gorm:"index"`
+		Purpose   string
+		Data      string
+		ExpiresAt time.Time `gorm:"index"`
+		CreatedAt time.Time
+	}
+	type LoginThrottle struct {
+		Key           string `gorm:"primaryKey"`
+		Failures      int
+		Lockouts      int
+		LastFailureAt time.Time
+		BlockedUntil  *time.Time `gorm:"index"`
+		UpdatedAt     time.Time
+	}
+	type NotificationChannel struct {
+		ID        string `gorm:"primaryKey"`
+		Name      string
+		Type      string `gorm:"index"`
+		Enabled   bool
+		Events    string `gorm:"type:jsonb"`
+		Config    string `gorm:"type:jsonb"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	type NotificationRule struct {
+		ID          string `gorm:"primaryKey"`
+		Name        string
+		Priority    int `gorm:"index"`
+		Enabled     bool
+		Events      string `gorm:"type:jsonb"`
+		MinSeverity string
+		Agents      string `gorm:"type:jsonb"`
+		Containers  string `gorm:"type:jsonb"`
+		Images      string `gorm:"type:jsonb"`
+		Labels      string `gorm:"type:jsonb"`
+		Channels    string `gorm:"type:jsonb"`
+		Stop        bool
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+	}
+	type NotificationTemplate struct {
+		ID        string `gorm:"primaryKey"`
+		Target    string `gorm:"uniqueIndex:idx_notification_templates_target_event"`
+		Event     string `gorm:"uniqueIndex:idx_notification_templates_target_event"`
+		Title     string `gorm:"type:text"`
+		Body      string `gorm:"type:text"`
+		HTML      string `gorm:"type:text"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+	type NotificationDelivery struct {
+		ID            uint   `gorm:"primaryKey"`
+		Target        string `gorm:"index"`
+		TargetName    string
+		TargetType    string
+		Event         string `gorm:"index"`
+		Title         string
+		Message       string `gorm:"type:text"`
+		Status        string `gorm:"index"`
+		Attempts      int
+		NextAttemptAt time.Time `gorm:"index"`
+		LastError     string    `gorm:"type:text"`
+		DeliveredAt   *time.Time
+		CreatedAt     time.Time `gorm:"index"`
+		UpdatedAt     time.Time
+	}
+	type NotificationAttempt struct {
+		ID         uint `gorm:"primaryKey"`
+		DeliveryID uint `gorm:"index"`
+		Attempt    int
+		StatusCode int
+		Response   string `gorm:"type:text"`
+		Error      string `gorm:"type:text"`
+		DurationMs int64
+		CreatedAt  time.Time
+	}
+	type PendingUpdate struct {
+		ID            string `gorm:"primaryKey"`
+		AgentID       string `gorm:"uniqueIndex:idx_pending_updates_container"`
+		ContainerName string `gorm:"uniqueIndex:idx_pending_updates_container"`
+		ContainerID   string
+		Image         string
+		FirstSeenAt   time.Time
+		NotifiedAt    *time.Time
+		CreatedAt     time.Time
+		UpdatedAt     time.Time
+	}
+	type RecapSchedule struct {
+		ID             string `gorm:"primaryKey"`
+		Name           string
+		CronExpression string
+		Enabled        bool
+		Sections       string `gorm:"type:jsonb"`
+		Channels       string `gorm:"type:jsonb"`
+		LastSentAt     *time.Time
+		CreatedAt      time.Time
+		UpdatedAt      time.Time
+	}
+	type ReleaseNotes struct {
+		ID              string `gorm:"primaryKey"`
+		AgentID         string `gorm:"uniqueIndex:idx_release_notes_container"`
+		ContainerName   string `gorm:"uniqueIndex:idx_release_notes_container"`
+		Image           string
+		CurrentVersion  string
+		CurrentRevision string
+		Version         string
+		Revision        string
+		Source          string
+		URL             string
+		Releases        string `gorm:"type:jsonb"`
+		Error           string
+		CheckedAt       time.Time
+		CreatedAt       time.Time
+		UpdatedAt       time.Time
+	}
+	type UpdateApproval struct {
+		ID            string `gorm:"primaryKey"`
+		AgentID       string `gorm:"index"`
+		AgentName     string
+		ContainerID   string `gorm:"index"`
+		ContainerName string
+		Image         string
+		Status        string `gorm:"index"`
+		DecidedBy     string
+		DecidedAt     *time.Time
+		Note          string
+		CommandID     string `gorm:"index"`
+		Message       string
+		ClosedAt      *time.Time
+		CreatedAt     time.Time
+		UpdatedAt     time.Time
+	}
+	type ContainerConfigSnapshot struct {
+		ID            string `gorm:"primaryKey"`
+		AgentID       string `gorm:"index:idx_config_snapshot_container"`
+		ContainerName string `gorm:"index:idx_config_snapshot_container"`
+		ContainerID   string
+		Version       int
+		Image         string
+		Reason        string
+		HistoryID     string
+		Config        string `gorm:"type:text"`
+		CreatedAt     time.Time
+	}
+	type ResourceSample struct {
+		ID              uint      `gorm:"primaryKey"`
+		AgentID         string    `gorm:"uniqueIndex:idx_resource_sample_bucket"`
+		ContainerName   string    `gorm:"uniqueIndex:idx_resource_sample_bucket"`
+		Resolution      int       `gorm:"uniqueIndex:idx_resource_sample_bucket"`
+		BucketStart     time.Time `gorm:"uniqueIndex:idx_resource_sample_bucket;index"`
+		ContainerID     string
+		Samples         int
+		CPUSum          float64
+		MemorySum       float64
+		MemoryPctSum    float64
+		MemoryLimit     int64
+		NetRxBytes      int64
+		NetTxBytes      int64
+		BlockReadBytes  int64
+		BlockWriteBytes int64
+	}
+	type RunningSample struct {
+		ID        uint      `gorm:"primaryKey"`
+		SampledAt time.Time `gorm:"index"`
+		AgentID   string    `gorm:"index"`
+		Host      string
+		Running   int
+		Total     int
+	}
+	type ContainerStateSpan struct {
+		ID            uint   `gorm:"primaryKey"`
+		AgentID       string `gorm:"index:idx_state_span_container"`
+		ContainerName string `gorm:"index:idx_state_span_container"`
+		Running       bool
+		StartedAt     time.Time
+		EndedAt       time.Time `gorm:"index"`
+	}
+	// settings.Record; its table name comes from the type name.
+	type Record struct {
+		ID        uint   `gorm:"primaryKey"`
+		Data      string `gorm:"type:jsonb"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+
+	return tx.AutoMigrate(
+		&Account{},
+		&ContainerSettings{},
+		&Schedule{},
+		&Agent{},
+		&AgentCommand{},
+		&UpdateHistory{},
+		&RunningSnapshot{},
+		&AuditLog{},
+		&WebAuthnCredential{},
+		&WebAuthnSession{},
+		&LoginThrottle{},
+		&NotificationChannel{},
+		&NotificationRule{},
+		&NotificationTemplate{},
+		&NotificationDelivery{},
+		&NotificationAttempt{},
+		&PendingUpdate{},
+		&RecapSchedule{},
+		&ReleaseNotes{},
+		&UpdateApproval{},
+		&ContainerConfigSnapshot{},
+		&ResourceSample{},
+		&RunningSample{},
+		&ContainerStateSpan{},
+		&Record{},
+	)
+}
+
+// updateDigestState is the table recording when the update digest was last sent.
+type updateDigestState struct {
+	ID         uint `gorm:"primaryKey"`
+	LastSentAt time.Time
+	UpdatedAt  time.Time
+}
+
+func (updateDigestState) TableName() string { return "update_digest_states" }
+
+func updateDigestStateUp(tx *gorm.DB) error {
+	return tx.AutoMigrate(&updateDigestState{})
+}
+
+func updateDigestStateDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&updateDigestState{})
+}
+
+// updateApprovalDigest is the column migration 3 adds to update requests.
+type updateApprovalDigest struct {
+	Digest string
+}
+
+func (updateApprovalDigest) TableName() string { return "update_approvals" }
+
+func updateApprovalDigestUp(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&updateApprovalDigest{}, "Digest") {
+		return nil
+	}
+	return tx.Migrator().AddColumn(&updateApprovalDigest{}, "Digest")
+}
+
+func updateApprovalDigestDown(tx *gorm.DB) error {
+	return tx.Migrator().DropColumn(&updateApprovalDigest{}, "Digest")
+}
+
+// auditChainHead is the table migration 4 adds for the signed head of the audit chain.
+type auditChainHead struct {
+	ID        uint `gorm:"primaryKey"`
+	LastID    uint
+	Hash      string `gorm:"size:64"`
+	Count     int64
+	MAC       string `gorm:"size:64"`
+	UpdatedAt time.Time
+}
+
+func (auditChainHead) TableName() string { return "audit_chain_heads" }
+
+func auditChainHeadUp(tx *gorm.DB) error {
+	return tx.AutoMigrate(&auditChainHead{})
+}
+
+func auditChainHeadDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&auditChainHead{})
+}
+
+// configSnapshotVersion is the part of container_config_snapshots migration 5 indexes, so
+// that two snapshots of a container cannot share a version.
+type configSnapshotVersion struct {
+	ID            string `gorm:"primaryKey"`
+	AgentID       string `gorm:"index:idx_config_snapshot_container;uniqueIndex:idx_config_snapshot_version"`
+	ContainerName string `gorm:"index:idx_config_snapshot_container;uniqueIndex:idx_config_snapshot_version"`
+	Version       int    `gorm:"uniqueIndex:idx_config_snapshot_version"`
+	CreatedAt     time.Time
+}
+
+func (configSnapshotVersion) TableName() string { return "container_config_snapshots" }
+
+func configSnapshotVersionUp(tx *gorm.DB) error {
+	// Concurrent recordings could store the same version twice; number such containers
+	// again, oldest first, before the index rules it out.
+	type group struct{ AgentID, ContainerName string }
+	var dupes []group
+	if err := tx.Model(&configSnapshotVersion{}).Select("agent_id, container_name").
+		Group("agent_id, container_name").Having("COUNT(*) > COUNT(DISTINCT version)").
+		Find(&dupes).Error; err != nil {
+		return err
+	}
+	for _, g := range dupes {
+		var rows []configSnapshotVersion
+		if err := tx.Where("agent_id = ? AND container_name = ?", g.AgentID, g.ContainerName).
+			Order("version ASC").Order("created_at ASC").Find(&rows).Error; err != nil {
+			return err
+		}
+		for i, row := range rows {
+			if err := tx.Model(&row).Update("version", i+1).Error; err != nil {
+				return err
+			}
+		}
+	}
+	m := tx.Migrator()
+	if !m.HasIndex(&configSnapshotVersion{}, "idx_config_snapshot_version") {
+		if err := m.CreateIndex(&configSnapshotVersion{}, "idx_config_snapshot_version"); err != nil {
+			return err
+		}
+	}
+	if m.HasIndex(&configSnapshotVersion{}, "idx_config_snapshot_container") {
+		return m.DropIndex(&configSnapshotVersion{}, "idx_config_snapshot_container")
+	}
+	return nil
+}
+
+func configSnapshotVersionDown(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if !m.HasIndex(&configSnapshotVersion{}, "idx_config_snapshot_container") {
+		if err := m.CreateIndex(&configSnapshotVersion{}, "idx_config_snapshot_container"); err != nil {
+			return err
+		}
+	}
+	if m.HasIndex(&configSnapshotVersion{}, "idx_config_snapshot_version") {
+		return m.DropIndex(&configSnapshotVersion{}, "idx_config_snapshot_version")
+	}
+	return nil
+}
+
+// deliveryClaim is the column migration 6 adds to notification deliveries.
+type deliveryClaim struct {
+	ClaimedAt *time.Time
+}
+
+func (deliveryClaim) TableName() string { return "notification_deliveries" }
+
+func deliveryClaimUp(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&deliveryClaim{}, "ClaimedAt") {
+		return nil
+	}
+	return tx.Migrator().AddColumn(&deliveryClaim{}, "ClaimedAt")
+}
+
+func deliveryClaimDown(tx *gorm.DB) error {
+	return tx.Migrator().DropColumn(&deliveryClaim{}, "ClaimedAt")
+}
@@ -73,6 +73,9 @@ type ContainerSnapshot struct {
 	CheckedAt       *time.Time `json:"checkedAt,omitempty"`
 	Ports           []string   `json:"ports,omitempty"`
 	Labels          []string   `json:"labels,omitempty"`
+	// AvailableDigest is the image the registry has for the container's tag, as a digest
+	// reference, when an agent reported one with an available update.
+	AvailableDigest string `json:"availableDigest,omitempty"`
 }
 
 // JSONMap persists arbitrary JSON documents.
@@ -101,6 +104,72 @@ func (m *JSONMap) Scan(value interface{}) error {
 	}
 }
 
+// StringMap stores string key/value pairs as JSON in the database.
+type StringMap map[string]string
+
+func (m StringMap) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+func (m *StringMap) Scan(value interface{}) error {
+	if value == nil {
+		*m = StringMap{}
+		return nil
+	}
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return errors.New("unsupported type for StringMap")
+	}
+}
+
+// RawJSON keeps a JSON document byte-for-byte so it can be hashed after a round trip.
+type RawJSON []byte
+
+func (r RawJSON) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+	return string(r), nil
+}
+
+func (r *RawJSON) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*r = nil
+	case []byte:
+		*r = append(RawJSON(nil), v...)
+	case string:
+		*r = RawJSON(v)
+	default:
+		return errors.New("unsupported type for RawJSON")
+	}
+	return nil
+}
+
+func (r RawJSON) MarshalJSON() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+func (r *RawJSON) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*r = nil
+		return nil
+	}
+	*r = append(RawJSON(nil), data...)
+	return nil
+}
+
 type Account struct {
 	ID                 string `gorm:"primaryKey"`
 	Name               string
@@ -116,6 +185,9 @@ type Account struct {
 	TwoFactorSecret    string
 	TwoFactorEnabled   bool
 	RecoveryCodes      StringList `gorm:"type:jsonb"`
+	PasswordHistory    StringList `gorm:"type:jsonb"`
+	PasswordChangedAt  *time.Time
+	AuthSource         string // empty for local accounts, "ldap" for directory users
 	CreatedAt          time.Time
 	UpdatedAt          time.Time
 }
@@ -157,6 +229,24 @@ type UpdateHistory struct {
 	Message       string    `json:"message"`
 	CreatedAt     time.Time `json:"createdAt"`
 	UpdatedAt     time.Time `json:"updatedAt"`
+
+	// PreviousImageID and PreviousDigest identify the image the container ran before the
+	// update, NewImageID the one it runs after. ConfigSnapshot is the container config
+	// before the update; it holds the environment, so it is never sent to clients.
+	PreviousImageID string  `json:"previousImageId,omitempty"`
+	PreviousDigest  string  `json:"previousDigest,omitempty"`
+	NewImageID      string  `json:"newImageId,omitempty"`
+	ConfigSnapshot  RawJSON `gorm:"type:text" json:"-"`
+}
+
+// RollbackImage is the reference that runs the image the container had before this
+// update: its repo digest, pinned so it does not follow a moved tag, or the image ID for
+// images that were never pulled from a registry.
+func (h UpdateHistory) RollbackImage() string {
+	if h.PreviousDigest != "" {
+		return h.PreviousDigest
+	}
+	return h.PreviousImageID
 }
 
 func (h *UpdateHistory) BeforeCreate(*gorm.DB) error {
@@ -217,6 +307,9 @@ type Agent struct {
 	Memory         float64               `json:"memory"`
 	CreatedAt      time.Time             `json:"createdAt"`
 	UpdatedAt      time.Time             `json:"updatedAt"`
+	// RequireApproval holds auto-updates of the agent's containers until an
+	// UpdateApproval is approved.
+	RequireApproval bool `json:"requireApproval"`
 }
 
 func (a *Agent) BeforeCreate(*gorm.DB) error {
@@ -238,6 +331,9 @@ type AgentCommand struct {
 	CompletedAt *time.Time `json:"completedAt,omitempty"`
 	CreatedAt   time.Time  `json:"createdAt"`
 	UpdatedAt   time.Time  `json:"updatedAt"`
+	// TraceParent is the W3C traceparent of the span that queued the command, so the
+	// agent's spans join the same trace. Empty when tracing is off.
+	TraceParent string `json:"traceParent,omitempty"`
 }
 
 func (c *AgentCommand) BeforeCreate(*gorm.DB) error {
@@ -250,12 +346,413 @@ func (c *AgentCommand) BeforeCreate(*gorm.DB) error {
 	return nil
 }
 
+// AuditLog is one entry in the audit trail. Entries are hash chained: Hash covers the
+// entry's fields and PrevHash, so edits or deletions break the chain.
 type AuditLog struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    string    `json:"userId"`
-	UserName  string    `json:"username"`
-	Action    string    `json:"action"`
-	Details   string    `json:"details"`
-	IPAddress string    `json:"ipAddress"`
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     string    `gorm:"index" json:"userId"`
+	UserName   string    `json:"username"`
+	Action     string    `gorm:"index" json:"action"`
+	TargetType string    `gorm:"index:idx_audit_logs_target" json:"targetType,omitempty"`
+	TargetID   string    `gorm:"index:idx_audit_logs_target" json:"targetId,omitempty"`
+	Details    string    `json:"details"`
+	Before     RawJSON   `gorm:"type:text" json:"before,omitempty"`
+	After      RawJSON   `gorm:"type:text" json:"after,omitempty"`
+	IPAddress  string    `json:"ipAddress"`
+	PrevHash   string    `gorm:"size:64" json:"prevHash,omitempty"`
+	Hash       string    `gorm:"size:64" json:"hash,omitempty"`
+	CreatedAt  time.Time `gorm:"index" json:"createdAt"`
+}
+
+// AuditChainHead is the last entry of the audit chain and how many entries it has, kept
+// outside the audit table and signed so that removing entries from the end of the chain
+// is detected. There is a single row.
+type AuditChainHead struct {
+	ID        uint      `gorm:"primaryKey"`
+	LastID    uint      `json:"lastId"`
+	Hash      string    `gorm:"size:64" json:"hash"`
+	Count     int64     `json:"count"`
+	MAC       string    `gorm:"size:64" json:"-"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// WebAuthnCredential is a security key or passkey registered by an account.
+type WebAuthnCredential struct {
+	ID              string     `gorm:"primaryKey" json:"id"`
+	AccountID       string     `gorm:"index" json:"-"`
+	Name            string     `json:"name"`
+	CredentialID    string     `gorm:"uniqueIndex" json:"credentialId"`
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"attestationType"`
+	Transports      StringList `gorm:"type:jsonb" json:"transports"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"-"`
+	UserPresent     bool       `json:"-"`
+	UserVerified    bool       `json:"-"`
+	BackupEligible  bool       `json:"backupEligible"`
+	BackupState     bool       `json:"backupState"`
+	LastUsedAt      *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIP      string     `json:"lastUsedIp,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+func (w *WebAuthnCredential) BeforeCreate(*gorm.DB) error {
+	if w.ID == "" {
+		w.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// WebAuthnSession holds ceremony state between the begin and finish calls.
+type WebAuthnSession struct {
+	ID        string `gorm:"primaryKey"`
+	AccountID string `gorm:"index"`
+	Purpose   string
+	Data      string
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (w *WebAuthnSession) BeforeCreate(*gorm.DB) error {
+	if w.ID == "" {
+		w.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// LoginThrottle tracks failed authentication attempts for a throttle key
+// (scope|subject|ip) so lockouts survive restarts and are shared across replicas.
+type LoginThrottle struct {
+	Key           string     `gorm:"primaryKey" json:"key"`
+	Failures      int        `json:"failures"`
+	Lockouts      int        `json:"lockouts"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	BlockedUntil  *time.Time `gorm:"index" json:"blockedUntil,omitempty"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// NotificationChannel is a configured notification destination. Secret config values
+// are vault-encrypted; Events limits which events are delivered (empty means all).
+type NotificationChannel struct {
+	ID        string     `gorm:"primaryKey" json:"id"`
+	Name      string     `json:"name"`
+	Type      string     `gorm:"index" json:"type"`
+	Enabled   bool       `json:"enabled"`
+	Events    StringList `gorm:"type:jsonb" json:"events"`
+	Config    StringMap  `gorm:"type:jsonb" json:"config"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+func (n *NotificationChannel) BeforeCreate(*gorm.DB) error {
+	if n.ID == "" {
+		n.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// NotificationRule routes matching events to specific channels. Rules are evaluated by
+// ascending Priority; empty match fields match anything. Channels holds channel IDs, or
+// "settings" for the Discord/webhook destinations from runtime settings; a matching rule
+// without channels drops the event.
+type NotificationRule struct {
+	ID          string     `gorm:"primaryKey" json:"id"`
+	Name        string     `json:"name"`
+	Priority    int        `gorm:"index" json:"priority"`
+	Enabled     bool       `json:"enabled"`
+	Events      StringList `gorm:"type:jsonb" json:"events"`
+	MinSeverity string     `json:"minSeverity"`
+	Agents      StringList `gorm:"type:jsonb" json:"agents"`
+	Containers  StringList `gorm:"type:jsonb" json:"containers"`
+	Images      StringList `gorm:"type:jsonb" json:"images"`
+	Labels      StringList `gorm:"type:jsonb" json:"labels"`
+	Channels    StringList `gorm:"type:jsonb" json:"channels"`
+	Stop        bool       `json:"stop"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+func (n *NotificationRule) BeforeCreate(*gorm.DB) error {
+	if n.ID == "" {
+		n.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// NotificationTemplate overrides how messages are rendered for one destination. Target
+// is a channel ID, "settings" or "email"; Event limits the template to one event kind
+// (empty applies to every event). Empty Title, Body or HTML keep the built-in text.
+type NotificationTemplate struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	Target    string    `gorm:"uniqueIndex:idx_notification_templates_target_event" json:"target"`
+	Event     string    `gorm:"uniqueIndex:idx_notification_templates_target_event" json:"event"`
+	Title     string    `gorm:"type:text" json:"title"`
+	Body      string    `gorm:"type:text" json:"body"`
+	HTML      string    `gorm:"type:text" json:"html"`
 	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (n *NotificationTemplate) BeforeCreate(*gorm.DB) error {
+	if n.ID == "" {
+		n.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// NotificationDelivery is a rendered message queued for one destination. Target is a
+// channel ID or "settings:discord" / "settings:webhook". Failed sends are retried with
+// backoff until the delivery is delivered or dead. ClaimedAt is when an outbox started
+// sending it; a sending delivery whose claim has expired is picked up again.
+type NotificationDelivery struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Target        string     `gorm:"index" json:"target"`
+	TargetName    string     `json:"targetName"`
+	TargetType    string     `json:"targetType"`
+	Event         string     `gorm:"index" json:"event"`
+	Title         string     `json:"title"`
+	Message       RawJSON    `gorm:"type:text" json:"message"`
+	Status        string     `gorm:"index" json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index" json:"nextAttemptAt"`
+	ClaimedAt     *time.Time `json:"claimedAt,omitempty"`
+	LastError     string     `gorm:"type:text" json:"lastError,omitempty"`
+	DeliveredAt   *time.Time `json:"deliveredAt,omitempty"`
+	CreatedAt     time.Time  `gorm:"index" json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// NotificationAttempt records one send of a delivery and the destination's response.
+type NotificationAttempt struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	DeliveryID uint      `gorm:"index" json:"deliveryId"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Response   string    `gorm:"type:text" json:"response,omitempty"`
+	Error      string    `gorm:"type:text" json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// PendingUpdate is an available update of a container without auto-update, tracked for
+// the update digest. Containers are keyed by name so a recreated container keeps its
+// entry; AgentID is empty for local containers.
+type PendingUpdate struct {
+	ID            string     `gorm:"primaryKey" json:"id"`
+	AgentID       string     `gorm:"uniqueIndex:idx_pending_updates_container" json:"agentId,omitempty"`
+	ContainerName string     `gorm:"uniqueIndex:idx_pending_updates_container" json:"containerName"`
+	ContainerID   string     `json:"containerId"`
+	Image         string     `json:"image"`
+	FirstSeenAt   time.Time  `json:"firstSeenAt"`
+	NotifiedAt    *time.Time `json:"notifiedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+func (p *PendingUpdate) BeforeCreate(*gorm.DB) error {
+	if p.ID == "" {
+		p.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// UpdateDigestState is the single row recording when the update digest was last sent,
+// so a restart neither skips nor repeats a digest.
+type UpdateDigestState struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	LastSentAt time.Time `json:"lastSentAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// RecapSchedule sends a recap report on a cron schedule. LastSentAt is the end of the
+// last reported period, so a restart neither skips nor repeats a recap. Empty Sections
+// means every section; empty Channels means the channels subscribed to recaps.
+type RecapSchedule struct {
+	ID             string     `gorm:"primaryKey" json:"id"`
+	Name           string     `json:"name"`
+	CronExpression string     `json:"cronExpression"`
+	Enabled        bool       `json:"enabled"`
+	Sections       StringList `gorm:"type:jsonb" json:"sections"`
+	Channels       StringList `gorm:"type:jsonb" json:"channels"`
+	LastSentAt     *time.Time `json:"lastSentAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+func (r *RecapSchedule) BeforeCreate(*gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// Release is one published release of an image's source repository.
+type Release struct {
+	Tag         string     `json:"tag"`
+	Name        string     `json:"name,omitempty"`
+	Body        string     `json:"body,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Prerelease  bool       `json:"prerelease,omitempty"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+}
+
+// ReleaseList stores releases as JSON in the database.
+type ReleaseList []Release
+
+func (r ReleaseList) Value() (driver.Value, error) {
+	if len(r) == 0 {
+		return "[]", nil
+	}
+	b, err := json.Marshal(r)
+	return string(b), err
+}
+
+func (r *ReleaseList) Scan(value interface{}) error {
+	if value == nil {
+		*r = []Release{}
+		return nil
+	}
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return errors.New("unsupported type for ReleaseList")
+	}
+}
+
+// ReleaseNotes describes the update available for a container (AgentID is empty for the
+// local host): the OCI version, revision and source of the running and remote image, and
+// the releases in between when the source is on GitHub. It is looked up when an update
+// is found; Error holds why the lookup was incomplete.
+type ReleaseNotes struct {
+	ID              string      `gorm:"primaryKey" json:"id"`
+	AgentID         string      `gorm:"uniqueIndex:idx_release_notes_container" json:"agentId,omitempty"`
+	ContainerName   string      `gorm:"uniqueIndex:idx_release_notes_container" json:"containerName"`
+	Image           string      `json:"image"`
+	CurrentVersion  string      `json:"currentVersion,omitempty"`
+	CurrentRevision string      `json:"currentRevision,omitempty"`
+	Version         string      `json:"version,omitempty"`
+	Revision        string      `json:"revision,omitempty"`
+	Source          string      `json:"source,omitempty"`
+	URL             string      `json:"url,omitempty"`
+	Releases        ReleaseList `gorm:"type:jsonb" json:"releases"`
+	Error           string      `json:"error,omitempty"`
+	CheckedAt       time.Time   `json:"checkedAt"`
+	CreatedAt       time.Time   `json:"createdAt"`
+	UpdatedAt       time.Time   `json:"updatedAt"`
+}
+
+func (r *ReleaseNotes) BeforeCreate(*gorm.DB) error {
+	if r.ID == "" {
+		r.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// UpdateApproval asks to apply the update available for a container on an agent that
+// requires approval. A request is open (ClosedAt nil) while its update is available:
+// pending until decided, approved until a schedule window queues the update, rejected
+// until the update is applied or goes away. Queued requests close when the update
+// command finishes. Digest is the image the request is for; when the tag moves to
+// another image the request is closed and a new one opened for it.
+type UpdateApproval struct {
+	ID            string     `gorm:"primaryKey" json:"id"`
+	AgentID       string     `gorm:"index" json:"agentId"`
+	AgentName     string     `json:"agentName"`
+	ContainerID   string     `gorm:"index" json:"containerId"`
+	ContainerName string     `json:"containerName"`
+	Image         string     `json:"image"`
+	Digest        string     `json:"digest,omitempty"`
+	Status        string     `gorm:"index" json:"status"`
+	DecidedBy     string     `json:"decidedBy,omitempty"`
+	DecidedAt     *time.Time `json:"decidedAt,omitempty"`
+	Note          string     `json:"note,omitempty"`
+	CommandID     string     `gorm:"index" json:"commandId,omitempty"`
+	Message       string     `json:"message,omitempty"`
+	ClosedAt      *time.Time `json:"closedAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+func (u *UpdateApproval) BeforeCreate(*gorm.DB) error {
+	if u.ID == "" {
+		u.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// ContainerConfigSnapshot is a version of a container's config: Config, HostConfig and
+// network endpoints, as a containers.ConfigSnapshot in JSON. Versions are recorded around
+// updates, rollbacks and restores, and count up per agent and container name (uniquely), since
+// containers get a new ID each time they are recreated. AgentID is empty for local
+// containers. The config holds the environment, so only admins can read it.
+type ContainerConfigSnapshot struct {
+	ID            string    `gorm:"primaryKey" json:"id"`
+	AgentID       string    `gorm:"uniqueIndex:idx_config_snapshot_version" json:"agentId,omitempty"`
+	ContainerName string    `gorm:"uniqueIndex:idx_config_snapshot_version" json:"containerName"`
+	ContainerID   string    `json:"containerId"`
+	Version       int       `gorm:"uniqueIndex:idx_config_snapshot_version" json:"version"`
+	Image         string    `json:"image"`
+	Reason        string    `json:"reason"`
+	HistoryID     string    `json:"historyId,omitempty"`
+	Config        RawJSON   `gorm:"type:text" json:"config,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+func (c *ContainerConfigSnapshot) BeforeCreate(*gorm.DB) error {
+	if c.ID == "" {
+		c.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// ResourceSample is a time bucket of resource usage for an agent's host, when
+// ContainerName is empty, or for one of its containers. Buckets are keyed by container
+// name so a series continues across updates. CPU, memory bytes and memory percent are
+// summed over Samples readings, to be averaged; hosts only report percentages. The IO
+// counters are the cumulative values at the last reading, so rates come from
+// consecutive buckets. Resolution is in seconds.
+type ResourceSample struct {
+	ID              uint      `gorm:"primaryKey" json:"-"`
+	AgentID         string    `gorm:"uniqueIndex:idx_resource_sample_bucket" json:"agentId"`
+	ContainerName   string    `gorm:"uniqueIndex:idx_resource_sample_bucket" json:"containerName"`
+	Resolution      int       `gorm:"uniqueIndex:idx_resource_sample_bucket" json:"resolution"`
+	BucketStart     time.Time `gorm:"uniqueIndex:idx_resource_sample_bucket;index" json:"time"`
+	ContainerID     string    `json:"containerId,omitempty"`
+	Samples         int       `json:"samples"`
+	CPUSum          float64   `json:"-"`
+	MemorySum       float64   `json:"-"`
+	MemoryPctSum    float64   `json:"-"`
+	MemoryLimit     int64     `json:"memoryLimit"`
+	NetRxBytes      int64     `json:"netRxBytes"`
+	NetTxBytes      int64     `json:"netTxBytes"`
+	BlockReadBytes  int64     `json:"blockReadBytes"`
+	BlockWriteBytes int64     `json:"blockWriteBytes"`
+}
+
+// RunningSample is how many containers one host had and how many were running when the
+// running history sampler last looked. AgentID is empty for the local Docker host.
+// Samples taken in the same sweep share SampledAt, which is stored in UTC.
+type RunningSample struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	SampledAt time.Time `gorm:"index" json:"sampledAt"`
+	AgentID   string    `gorm:"index" json:"agentId,omitempty"`
+	Host      string    `json:"host"`
+	Running   int       `json:"running"`
+	Total     int       `json:"total"`
+}
+
+// ContainerStateSpan is a stretch of time in which the sampler saw a container in the
+// same state. Consecutive samples extend the span; a gap longer than two sample
+// intervals, such as an agent going offline, starts a new one so the gap is not counted.
+type ContainerStateSpan struct {
+	ID            uint      `gorm:"primaryKey" json:"-"`
+	AgentID       string    `gorm:"index:idx_state_span_container" json:"agentId,omitempty"`
+	ContainerName string    `gorm:"index:idx_state_span_container" json:"containerName"`
+	Running       bool      `json:"running"`
+	StartedAt     time.Time `json:"startedAt"`
+	EndedAt       time.Time `gorm:"index" json:"endedAt"`
 }
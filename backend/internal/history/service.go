@@ -4,6 +4,7 @@ import (
 	"errors"
 	"strconv"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -11,6 +12,13 @@ import (
 	"updockly/backend/internal/domain"
 )
 
+const (
+	defaultLimit = 200
+	maxLimit     = 500
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 type Service struct {
 	db *gorm.DB
 }
@@ -19,23 +27,182 @@ func NewService(db *gorm.DB) *Service {
 	return &Service{db: db}
 }
 
-func (s *Service) List(limitParam string) ([]domain.UpdateHistory, error) {
-	if s.db == nil {
-		return nil, errors.New("database not ready")
-	}
+// Query filters history entries. Source and Status take comma-separated values. Each
+// word of Search must appear in the message, ignoring case. Cursor is the ID returned as
+// the next cursor by a previous page; entries are returned newest first.
+type Query struct {
+	Container string
+	Image     string
+	Agent     string
+	Source    string
+	Status    string
+	From      *time.Time
+	To        *time.Time
+	Search    string
+	Cursor    string
+	Limit     int
+}
 
-	limit := 200
+// Counts is the number of entries matching a query, in total and per status.
+type Counts struct {
+	Total    int64            `json:"total"`
+	ByStatus map[string]int64 `json:"byStatus"`
+}
+
+func (s *Service) List(limitParam string) ([]domain.UpdateHistory, error) {
+	limit := defaultLimit
 	if raw := strings.TrimSpace(limitParam); raw != "" {
-		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 && parsed <= 500 {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 && parsed <= maxLimit {
 			limit = parsed
 		}
 	}
+	rows, _, err := s.Search(Query{Limit: limit})
+	return rows, err
+}
 
+// Search returns a page of entries matching q and the cursor for the next page, which is
+// empty once there are no more entries.
+func (s *Service) Search(q Query) ([]domain.UpdateHistory, string, error) {
+	if s.db == nil {
+		return nil, "", errors.New("database not ready")
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultLimit
+	}
+	if q.Limit > maxLimit {
+		q.Limit = maxLimit
+	}
+
+	tx := applyFilters(s.db.Model(&domain.UpdateHistory{}), q)
+	if q.Cursor != "" {
+		// IDs are random, so the page boundary is the cursor entry's position in the
+		// (created_at, id) order.
+		var last domain.UpdateHistory
+		if err := s.db.Select("id", "created_at").First(&last, "id = ?", q.Cursor).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, "", ErrInvalidCursor
+			}
+			return nil, "", err
+		}
+		tx = tx.Where("created_at < ? OR (created_at = ? AND id < ?)", last.CreatedAt, last.CreatedAt, last.ID)
+	}
 	rows := []domain.UpdateHistory{}
-	if err := s.db.Order("created_at DESC").Limit(limit).Find(&rows).Error; err != nil {
-		return nil, err
+	if err := tx.Order("created_at DESC").Order("id DESC").Limit(q.Limit + 1).Find(&rows).Error; err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		next = rows[len(rows)-1].ID
+	}
+	return rows, next, nil
+}
+
+// Each walks every entry matching q, newest first, in pages. q.Limit sets the page size.
+func (s *Service) Each(q Query, fn func(domain.UpdateHistory) error) error {
+	for {
+		rows, next, err := s.Search(q)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := fn(row); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		q.Cursor = next
+	}
+}
+
+// Count returns how many entries match q's filters; the cursor and limit are ignored.
+func (s *Service) Count(q Query) (Counts, error) {
+	counts := Counts{ByStatus: map[string]int64{}}
+	if s.db == nil {
+		return counts, errors.New("database not ready")
 	}
-	return rows, nil
+	var rows []struct {
+		Status string
+		Total  int64
+	}
+	err := applyFilters(s.db.Model(&domain.UpdateHistory{}), q).
+		Select("status, COUNT(*) AS total").Group("status").Scan(&rows).Error
+	if err != nil {
+		return counts, err
+	}
+	for _, row := range rows {
+		counts.ByStatus[row.Status] = row.Total
+		counts.Total += row.Total
+	}
+	return counts, nil
+}
+
+// Prune removes entries created before cutoff.
+func (s *Service) Prune(cutoff time.Time) (int64, error) {
+	if s.db == nil {
+		return 0, errors.New("database not ready")
+	}
+	res := s.db.Session(&gorm.Session{Logger: logger.Discard}).
+		Where("created_at < ?", cutoff.Local()).Delete(&domain.UpdateHistory{})
+	return res.RowsAffected, res.Error
+}
+
+func applyFilters(tx *gorm.DB, q Query) *gorm.DB {
+	if v := strings.TrimSpace(q.Container); v != "" {
+		tx = tx.Where("container_name = ? OR container_id = ?", v, v)
+	}
+	if v := strings.TrimSpace(q.Image); v != "" {
+		tx = tx.Where("LOWER(image) LIKE ? ESCAPE '\\'", likePattern(v))
+	}
+	if v := strings.TrimSpace(q.Agent); v != "" {
+		tx = tx.Where("agent_id = ? OR agent_name = ?", v, v)
+	}
+	if values := splitList(q.Source); len(values) > 0 {
+		tx = tx.Where("source IN ?", values)
+	}
+	if values := splitList(q.Status); len(values) > 0 {
+		tx = tx.Where("status IN ?", values)
+	}
+	// Entries are stamped in local time; SQLite compares timestamps as text, so the
+	// bounds must use the same offset.
+	if q.From != nil {
+		tx = tx.Where("created_at >= ?", q.From.Local())
+	}
+	if q.To != nil {
+		tx = tx.Where("created_at <= ?", q.To.Local())
+	}
+	for _, word := range strings.Fields(q.Search) {
+		tx = tx.Where("LOWER(message) LIKE ? ESCAPE '\\'", likePattern(word))
+	}
+	return tx
+}
+
+// likePattern matches value anywhere, with LIKE wildcards in value taken literally.
+func likePattern(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(value))
+	return "%" + escaped + "%"
+}
+
+// splitList splits a comma-separated filter; values are stored lower case.
+func splitList(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(strings.ToLower(part)); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+func (s *Service) Get(id string) (domain.UpdateHistory, error) {
+	var entry domain.UpdateHistory
+	if s.db == nil {
+		return entry, errors.New("database not ready")
+	}
+	err := s.db.First(&entry, "id = ?", strings.TrimSpace(id)).Error
+	return entry, err
 }
 
 func (s *Service) Delete(id string) error {
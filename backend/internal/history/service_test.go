@@ -1,6 +1,7 @@
 package history
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -112,3 +113,105 @@ func TestListLimitsToDefault(t *testing.T) {
 		t.Fatalf("expected default limit 200, got %d", len(list))
 	}
 }
+
+func TestSearchFiltersAndCursor(t *testing.T) {
+	db := setupHistoryDB(t)
+	svc := NewService(db)
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	entries := []domain.UpdateHistory{
+		{ContainerID: "c1", ContainerName: "web", Image: "nginx:1.27", Source: "auto", Status: "success", Message: "Update completed"},
+		{ContainerID: "c1", ContainerName: "web", Image: "nginx:1.28", Source: "auto", Status: "error", Message: "Pull failed: 50% done"},
+		{ContainerID: "c2", ContainerName: "db", Image: "postgres:16", AgentID: "a1", AgentName: "prod-1", Source: "agent", Status: "success", Message: "Update completed"},
+		{ContainerID: "c1", ContainerName: "web", Image: "nginx:1.28", Source: "manual", Status: "warning", Message: "Update failed, rolled back"},
+	}
+	for i, entry := range entries {
+		entry.CreatedAt = base.Add(time.Duration(i) * time.Hour)
+		if _, err := svc.Record(entry); err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+	}
+	// Two entries in the same instant are ordered by ID, so paging does not skip either.
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Record(domain.UpdateHistory{ContainerName: "cache", Status: "success", CreatedAt: base.Add(-time.Hour)}); err != nil {
+			t.Fatalf("record tie %d: %v", i, err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		q    Query
+		want int
+	}{
+		{"container name", Query{Container: "web"}, 3},
+		{"container id", Query{Container: "c2"}, 1},
+		{"image substring", Query{Image: "NGINX:1.28"}, 2},
+		{"agent name", Query{Agent: "prod-1"}, 1},
+		{"sources", Query{Source: "auto, manual"}, 3},
+		{"status", Query{Status: "error,warning"}, 2},
+		{"date range", Query{From: ptr(base.Add(30 * time.Minute)), To: ptr(base.Add(2 * time.Hour))}, 2},
+		{"search words", Query{Search: "update COMPLETED"}, 2},
+		{"search literal percent", Query{Search: "50%"}, 1},
+		{"search wildcard", Query{Search: "pull_failed"}, 0},
+	}
+	for _, tc := range cases {
+		rows, _, err := svc.Search(tc.q)
+		if err != nil || len(rows) != tc.want {
+			t.Fatalf("%s: expected %d entries, got %d (%v)", tc.name, tc.want, len(rows), err)
+		}
+	}
+
+	seen := map[string]bool{}
+	q := Query{Limit: 2}
+	for pages := 0; ; pages++ {
+		rows, next, err := svc.Search(q)
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		for _, row := range rows {
+			if seen[row.ID] {
+				t.Fatalf("entry %s returned twice", row.ID)
+			}
+			seen[row.ID] = true
+		}
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+	if len(seen) != 6 {
+		t.Fatalf("expected paging to return all 6 entries, got %d", len(seen))
+	}
+	if _, _, err := svc.Search(Query{Cursor: "missing"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestCountAndPrune(t *testing.T) {
+	db := setupHistoryDB(t)
+	svc := NewService(db)
+
+	now := time.Now()
+	for i, status := range []string{"success", "success", "error"} {
+		if _, err := svc.Record(domain.UpdateHistory{ContainerName: "web", Status: status, CreatedAt: now.AddDate(0, 0, -10*i)}); err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+	}
+
+	counts, err := svc.Count(Query{Container: "web"})
+	if err != nil || counts.Total != 3 || counts.ByStatus["success"] != 2 || counts.ByStatus["error"] != 1 {
+		t.Fatalf("unexpected counts %+v (%v)", counts, err)
+	}
+
+	removed, err := svc.Prune(now.AddDate(0, 0, -15))
+	if err != nil || removed != 1 {
+		t.Fatalf("expected one entry pruned, got %d (%v)", removed, err)
+	}
+	if counts, _ := svc.Count(Query{}); counts.Total != 2 || counts.ByStatus["error"] != 0 {
+		t.Fatalf("unexpected counts after prune %+v", counts)
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,144 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"updockly/backend/internal/history"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/stats"
+)
+
+const (
+	statsPruneInterval = time.Hour
+	defaultStatsRange  = 24 * time.Hour
+)
+
+// agentStatsReading is one container's usage as sent with a heartbeat. The IO fields are
+// cumulative byte counters.
+type agentStatsReading struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	CPU         float64 `json:"cpu"`
+	MemoryBytes int64   `json:"memoryBytes"`
+	MemoryLimit int64   `json:"memoryLimit"`
+	NetRxBytes  int64   `json:"netRxBytes"`
+	NetTxBytes  int64   `json:"netTxBytes"`
+	BlockRead   int64   `json:"blockReadBytes"`
+	BlockWrite  int64   `json:"blockWriteBytes"`
+}
+
+// recordAgentStats stores the host and container usage of a heartbeat.
+func (s *Server) recordAgentStats(agent *Agent, at time.Time, payload agentHeartbeatPayload) {
+	if s.statsService == nil || s.cfg.StatsRetentionDays < 1 {
+		return
+	}
+	readings := make([]stats.Reading, 0, len(payload.Stats)+1)
+	if payload.CPU > 0 || payload.Memory > 0 {
+		readings = append(readings, stats.Reading{CPU: payload.CPU, MemoryPercent: payload.Memory})
+	}
+	for _, st := range payload.Stats {
+		if st.Name == "" {
+			continue
+		}
+		readings = append(readings, stats.Reading{
+			ContainerID:     st.ID,
+			ContainerName:   st.Name,
+			CPU:             st.CPU,
+			MemoryBytes:     st.MemoryBytes,
+			MemoryLimit:     st.MemoryLimit,
+			NetRxBytes:      st.NetRxBytes,
+			NetTxBytes:      st.NetTxBytes,
+			BlockReadBytes:  st.BlockRead,
+			BlockWriteBytes: st.BlockWrite,
+		})
+	}
+	if err := s.statsService.Record(agent.ID, at, readings); err != nil {
+		s.log.Warn("failed to record agent stats", logging.KeyAgentID, agent.ID, "error", err)
+	}
+}
+
+// agentStatsHandler returns the usage of an agent's host, or of the container named by
+// container, between from and to. Updates of the container in that range are included
+// so changes in usage can be matched to them.
+func (s *Server) agentStatsHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	var agent Agent
+	if err := s.db.First(&agent, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+
+	now := time.Now()
+	from, err := parseAuditTime(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid from: %v", err)})
+		return
+	}
+	to, err := parseAuditTime(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid to: %v", err)})
+		return
+	}
+	if to == nil {
+		to = &now
+	}
+	if from == nil {
+		start := to.Add(-defaultStatsRange)
+		from = &start
+	}
+	if !from.Before(*to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	res, err := stats.ParseResolution(c.Query("resolution"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if res == 0 {
+		res = stats.Pick(*from, now, time.Duration(s.cfg.StatsFineHours)*time.Hour)
+	}
+
+	container := c.Query("container")
+	points, err := s.statsService.Range(agent.ID, container, *from, *to, res)
+	if err != nil {
+		respondInternal(c, "failed to load stats", wrapErr("load agent stats", err))
+		return
+	}
+	updates := []UpdateHistory{}
+	if container != "" {
+		updates, _, err = s.historyService.Search(history.Query{Agent: agent.ID, Container: container, From: from, To: to})
+		if err != nil {
+			respondInternal(c, "failed to load stats", wrapErr("load container updates", err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agentId":    agent.ID,
+		"container":  container,
+		"resolution": int(res.Seconds()),
+		"points":     points,
+		"updates":    updates,
+	})
+}
+
+// maybePruneStats applies the stats retention at most once per interval.
+func (s *Server) maybePruneStats() {
+	if s.statsService == nil || s.cfg.StatsRetentionDays < 1 || time.Since(s.lastStatsPrune) < statsPruneInterval {
+		return
+	}
+	s.lastStatsPrune = time.Now()
+	fine := time.Duration(s.cfg.StatsFineHours) * time.Hour
+	coarse := time.Duration(s.cfg.StatsRetentionDays) * 24 * time.Hour
+	if _, err := s.statsService.Prune(time.Now(), fine, coarse); err != nil {
+		s.log.Warn("stats prune failed", "error", err)
+	}
+}
@@ -0,0 +1,85 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/history"
+	"updockly/backend/internal/stats"
+)
+
+func TestAgentStatsRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.UpdateHistory{}, &domain.ResourceSample{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := &Server{db: db, historyService: history.NewService(db), statsService: stats.NewService(db),
+		cfg: config.Config{StatsRetentionDays: 30, StatsFineHours: 48}}
+	agent := Agent{ID: "a1", Name: "prod-1"}
+	if err := db.Create(&agent).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+
+	now := time.Now()
+	before := now.Add(-20 * time.Minute)
+	srv.recordAgentStats(&agent, before, agentHeartbeatPayload{CPU: 12, Memory: 40, Stats: []agentStatsReading{
+		{ID: "c1", Name: "web", CPU: 5, MemoryBytes: 100 << 20, MemoryLimit: 1 << 30},
+	}})
+	srv.recordAgentStats(&agent, now, agentHeartbeatPayload{Stats: []agentStatsReading{
+		{ID: "c2", Name: "web", CPU: 25, MemoryBytes: 300 << 20, MemoryLimit: 1 << 30},
+	}})
+	if _, err := srv.historyService.Record(UpdateHistory{ContainerID: "c2", ContainerName: "web", AgentID: "a1", Source: "agent",
+		Status: "success", CreatedAt: now.Add(-10 * time.Minute)}); err != nil {
+		t.Fatalf("record history: %v", err)
+	}
+
+	router := gin.New()
+	router.GET("/agents/:id/stats", srv.agentStatsHandler)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/agents/a1/stats?container=web")
+	var body struct {
+		Resolution int             `json:"resolution"`
+		Points     []stats.Point   `json:"points"`
+		Updates    []UpdateHistory `json:"updates"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+	if body.Resolution != 300 || len(body.Points) != 2 || len(body.Updates) != 1 {
+		t.Fatalf("expected 5-minute points around the update, got %s", rec.Body.String())
+	}
+	if last := body.Points[1]; last.ContainerID != "c2" || last.CPUPercent != 25 {
+		t.Fatalf("expected the series to continue after the container was recreated, got %+v", last)
+	}
+
+	if rec := get("/agents/a1/stats?resolution=1h"); rec.Code != http.StatusOK {
+		t.Fatalf("expected host stats, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := get("/agents/a1/stats?resolution=10s"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown resolution to be refused, got %d", rec.Code)
+	}
+	if rec := get("/agents/missing/stats"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing agent to return 404, got %d", rec.Code)
+	}
+}
@@ -1,21 +1,157 @@
 package httpapi
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/domain"
 )
 
+const auditExportPageSize = 500
+
+// auditQuery reads the shared filters of the list and export endpoints.
+func auditQuery(c *gin.Context) (audit.Query, error) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	q := audit.Query{
+		User:       c.Query("user"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		TargetID:   c.Query("targetId"),
+		Cursor:     c.Query("cursor"),
+		Limit:      limit,
+	}
+	from, err := parseAuditTime(c.Query("from"), false)
+	if err != nil {
+		return q, fmt.Errorf("invalid from: %w", err)
+	}
+	to, err := parseAuditTime(c.Query("to"), true)
+	if err != nil {
+		return q, fmt.Errorf("invalid to: %w", err)
+	}
+	q.From, q.To = from, to
+	return q, nil
+}
+
+// parseAuditTime accepts RFC 3339 timestamps or plain dates. A plain date used as an
+// upper bound covers the whole day.
+func parseAuditTime(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, errors.New("expected RFC 3339 timestamp or YYYY-MM-DD")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
+
 func (s *Server) listAuditLogs(c *gin.Context) {
-	limitParam := c.DefaultQuery("limit", "100")
-	limit, _ := strconv.Atoi(limitParam)
+	q, err := auditQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	logs, err := s.auditService.List(limit)
+	logs, next, err := s.auditService.Search(q)
 	if err != nil {
+		if errors.Is(err, audit.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit logs"})
 		return
 	}
 
+	// The body stays a plain array; the cursor for the next page travels in a header.
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+	}
 	c.JSON(http.StatusOK, logs)
 }
+
+func (s *Server) exportAuditLogs(c *gin.Context) {
+	q, err := auditQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q.Limit = auditExportPageSize
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-log-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		_ = w.Write([]string{"id", "createdAt", "userId", "username", "action", "targetType", "targetId", "details", "before", "after", "ipAddress", "prevHash", "hash"})
+		err = s.auditService.Each(q, func(log domain.AuditLog) error {
+			return w.Write(csvRow(
+				strconv.FormatUint(uint64(log.ID), 10),
+				log.CreatedAt.UTC().Format(time.RFC3339Nano),
+				log.UserID, log.UserName, log.Action, log.TargetType, log.TargetID, log.Details,
+				string(log.Before), string(log.After), log.IPAddress, log.PrevHash, log.Hash,
+			))
+		})
+		w.Flush()
+	} else {
+		c.Header("Content-Type", "application/json")
+		enc := json.NewEncoder(c.Writer)
+		first := true
+		_, _ = c.Writer.WriteString("[")
+		err = s.auditService.Each(q, func(log domain.AuditLog) error {
+			if !first {
+				if _, err := c.Writer.WriteString(","); err != nil {
+					return err
+				}
+			}
+			first = false
+			return enc.Encode(log)
+		})
+		_, _ = c.Writer.WriteString("]")
+	}
+	if err != nil {
+		// Headers are already sent; the truncated body is all we can signal.
+		s.log.Error("audit export failed", "error", err)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "export-audit-log",
+			TargetType: "audit-log",
+			Details:    fmt.Sprintf("Exported audit log as %s", format),
+			IPAddress:  c.ClientIP(),
+		})
+	}
+}
+
+func (s *Server) verifyAuditLogs(c *gin.Context) {
+	result, err := s.auditService.Verify()
+	if err != nil {
+		respondInternal(c, "failed to verify audit log", wrapErr("verify audit chain", err))
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/domain"
+)
+
+func newAuditTestServer(t *testing.T) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.AuditLog{}, &domain.AuditChainHead{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := &Server{db: db, auditService: audit.NewService(db)}
+	for _, target := range []string{"c1", "c2", "c3"} {
+		_ = srv.auditService.RecordEvent(audit.Event{ActorID: "alice", Action: "start-container", TargetType: "container", TargetID: target})
+	}
+	_ = srv.auditService.RecordEvent(audit.Event{ActorID: "bob", Action: "create-agent", TargetType: "agent", TargetID: "a1"})
+	return srv
+}
+
+func TestListAuditLogsFiltersAndCursor(t *testing.T) {
+	srv := newAuditTestServer(t)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/audit-logs?targetType=container&limit=2", nil)
+	srv.listAuditLogs(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var logs []domain.AuditLog
+	if err := json.Unmarshal(w.Body.Bytes(), &logs); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	cursor := w.Header().Get("X-Next-Cursor")
+	if len(logs) != 2 || logs[0].TargetID != "c3" || cursor == "" {
+		t.Fatalf("unexpected first page: %+v cursor %q", logs, cursor)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/audit-logs?targetType=container&limit=2&cursor="+cursor, nil)
+	srv.listAuditLogs(c)
+	logs = nil
+	_ = json.Unmarshal(w.Body.Bytes(), &logs)
+	if len(logs) != 1 || logs[0].TargetID != "c1" || w.Header().Get("X-Next-Cursor") != "" {
+		t.Fatalf("unexpected last page: %+v", logs)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/audit-logs?from=yesterday", nil)
+	srv.listAuditLogs(c)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid date, got %d", w.Code)
+	}
+}
+
+func TestExportAuditLogsCSV(t *testing.T) {
+	srv := newAuditTestServer(t)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/audit-logs/export?format=csv&user=alice", nil)
+	srv.exportAuditLogs(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(rows) != 4 || rows[0][0] != "id" || rows[1][6] != "c3" || rows[1][12] == "" {
+		t.Fatalf("unexpected export: %v", rows)
+	}
+
+	// Cells a spreadsheet would run as a formula are exported as text.
+	_ = srv.auditService.RecordEvent(audit.Event{ActorID: "alice", Action: "rename-container", TargetType: "container",
+		TargetID: "c4", Details: `=HYPERLINK("http://evil.example","x")`})
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/audit-logs/export?format=csv&targetId=c4", nil)
+	srv.exportAuditLogs(c)
+	rows, _ = csv.NewReader(w.Body).ReadAll()
+	if len(rows) != 2 || rows[1][7] != `'=HYPERLINK("http://evil.example","x")` {
+		t.Fatalf("expected the formula to be escaped, got %v", rows)
+	}
+}
@@ -6,7 +6,26 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func (s *Server) authMiddleware() gin.HandlerFunc {
+// A restricted session is an access token whose type limits it to the routes that
+// clear the restriction, such as changing an expired password. Full sessions have no type.
+const (
+	sessionPasswordChange = "password-change"
+	sessionKeyEnrollment  = "webauthn-enrollment"
+)
+
+// sessionType is the type of access token issued to the account at login or refresh.
+func (s *Server) sessionType(account *Account) string {
+	switch {
+	case s.authService.PasswordExpired(account):
+		return sessionPasswordChange
+	case s.keyEnrollmentRequired(account):
+		return sessionKeyEnrollment
+	}
+	return ""
+}
+
+// authMiddleware accepts full sessions, and restricted sessions of the listed types.
+func (s *Server) authMiddleware(restricted ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		header := c.GetHeader("Authorization")
 		token := ""
@@ -30,6 +49,17 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 			c.AbortWithStatusJSON(401, gin.H{"error": "invalid token"})
 			return
 		}
+		if claims.Type != "" && !containsMethod(restricted, claims.Type) {
+			switch claims.Type {
+			case sessionPasswordChange:
+				c.AbortWithStatusJSON(403, gin.H{"error": "password expired; change it to continue", "passwordExpired": true})
+			case sessionKeyEnrollment:
+				c.AbortWithStatusJSON(403, gin.H{"error": "register a security key to continue", "webauthnEnrollmentRequired": true})
+			default:
+				c.AbortWithStatusJSON(401, gin.H{"error": "invalid token type"})
+			}
+			return
+		}
 		c.Set("claims", claims)
 		c.Next()
 	}
@@ -43,3 +73,15 @@ func getClaims(c *gin.Context) *TokenClaims {
 	claims, _ := value.(*TokenClaims)
 	return claims
 }
+
+// requireAdmin must run after authMiddleware; it rejects non-admin accounts.
+func (s *Server) requireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := getClaims(c)
+		if claims == nil || claims.Role != "admin" {
+			c.AbortWithStatusJSON(403, gin.H{"error": "admin privileges required"})
+			return
+		}
+		c.Next()
+	}
+}
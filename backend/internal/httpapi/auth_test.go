@@ -0,0 +1,168 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/auth"
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/history"
+)
+
+// newSessionTestServer serves the real routes with an account "alice" whose password is
+// password1A!.
+func newSessionTestServer(t *testing.T, policy config.PasswordPolicySettings) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&Account{}, &UpdateHistory{}, &domain.WebAuthnCredential{}, &domain.WebAuthnSession{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := &Server{db: db, router: gin.New(), authService: auth.NewAuthService(db, nil, "test-secret"), historyService: history.NewService(db)}
+	srv.authService.SetPasswordPolicy(policy)
+	if _, err := srv.authService.CreateAdmin("alice", "alice@example.com", "password1A!", "Alice", ""); err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	srv.registerRoutes()
+	return srv
+}
+
+// login issues a session the way the login handlers do and returns its access token.
+func login(t *testing.T, srv *Server, username string) string {
+	t.Helper()
+	account, err := srv.authService.GetAccount(username)
+	if err != nil {
+		t.Fatalf("load account: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+	if err := srv.issueSession(c, account); err != nil {
+		t.Fatalf("issue session: %v", err)
+	}
+	return accessCookie(t, rec)
+}
+
+func accessCookie(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "access_token" {
+			return cookie.Value
+		}
+	}
+	t.Fatal("expected an access token cookie")
+	return ""
+}
+
+func serveAs(srv *Server, token, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	srv.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestExpiredPasswordOnlyAllowsChangingIt(t *testing.T) {
+	srv := newSessionTestServer(t, config.PasswordPolicySettings{MaxAgeDays: 30})
+	old := time.Now().AddDate(0, 0, -31)
+	if err := srv.db.Model(&Account{}).Where("username = ?", "alice").Update("password_changed_at", old).Error; err != nil {
+		t.Fatalf("backdate password: %v", err)
+	}
+
+	token := login(t, srv, "alice")
+	if rec := serveAs(srv, token, http.MethodGet, "/api/history/counts", ""); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "passwordExpired") {
+		t.Fatalf("expected an expired password to block the API, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(srv, token, http.MethodGet, "/api/auth/me", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the profile to stay reachable, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec := serveAs(srv, token, http.MethodPut, "/api/auth/me", `{"name":"Alice","currentPassword":"password1A!","newPassword":"password2B!"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("change password: %d %s", rec.Code, rec.Body)
+	}
+	token = accessCookie(t, rec)
+	if rec := serveAs(srv, token, http.MethodGet, "/api/history/counts", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected a full session after the change, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestTemporaryTokensAreNotSessions(t *testing.T) {
+	srv := newSessionTestServer(t, config.PasswordPolicySettings{})
+	account, err := srv.authService.GetAccount("alice")
+	if err != nil {
+		t.Fatalf("load account: %v", err)
+	}
+	temp, err := srv.authService.IssueToken(*account, "pre-2fa", time.Minute)
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+	if rec := serveAs(srv, temp, http.MethodGet, "/api/auth/me", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a pre-2fa token to be rejected, got %d", rec.Code)
+	}
+	if rec := serveAs(srv, login(t, srv, "alice"), http.MethodGet, "/api/history/counts", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected a full session, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAdminsWithoutKeyMustEnrolOne(t *testing.T) {
+	srv := newSessionTestServer(t, config.PasswordPolicySettings{})
+	svc, err := auth.NewWebAuthnService(srv.db, config.WebAuthnSettings{Enabled: true, RequireForAdmins: true}, "https://updockly.example")
+	if err != nil {
+		t.Fatalf("webauthn service: %v", err)
+	}
+	srv.webauthnService = svc
+
+	token := login(t, srv, "alice")
+	rec := serveAs(srv, token, http.MethodGet, "/api/history/counts", "")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "webauthnEnrollmentRequired") {
+		t.Fatalf("expected an admin without a key to be blocked, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(srv, token, http.MethodGet, "/api/auth/me", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"webauthnEnrollmentRequired":true`) {
+		t.Fatalf("expected the profile to ask for a key, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(srv, token, http.MethodGet, "/api/2fa/webauthn/credentials", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the keys to be listable, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(srv, token, http.MethodPost, "/api/2fa/webauthn/register/begin", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected registration to be allowed, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(srv, token, http.MethodPut, "/api/auth/me", `{"name":"Mallory"}`); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected profile changes to wait for a key, got %d", rec.Code)
+	}
+
+	// A synced passkey is not a hardware key.
+	account, _ := srv.authService.GetAccount("alice")
+	if err := srv.db.Create(&domain.WebAuthnCredential{ID: "p1", AccountID: account.ID, Name: "Phone", CredentialID: "cred-0", BackupEligible: true}).Error; err != nil {
+		t.Fatalf("seed passkey: %v", err)
+	}
+	if rec := serveAs(srv, login(t, srv, "alice"), http.MethodGet, "/api/history/counts", ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a synced passkey not to lift the requirement, got %d", rec.Code)
+	}
+
+	if err := srv.db.Create(&domain.WebAuthnCredential{ID: "k1", AccountID: account.ID, Name: "YubiKey", CredentialID: "cred-1"}).Error; err != nil {
+		t.Fatalf("seed key: %v", err)
+	}
+	token = login(t, srv, "alice")
+	if rec := serveAs(srv, token, http.MethodGet, "/api/history/counts", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected a full session once a key is registered, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := serveAs(srv, token, http.MethodDelete, "/api/2fa/webauthn/credentials/k1", `{"password":"password1A!"}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected the last hardware key to be kept, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -12,10 +11,14 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
 	"updockly/backend/internal/containers"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/snapshots"
+	"updockly/backend/internal/tracing"
 )
 
 // startAutoUpdateScheduler periodically checks cron schedules and triggers
@@ -57,7 +60,7 @@ func (s *Server) runAutoUpdateSchedules(ctx context.Context, lastRun map[string]
 
 	var schedules []Schedule
 	if err := s.db.Find(&schedules).Error; err != nil {
-		log.Printf("auto-update: failed to load schedules: %v", err)
+		s.log.Warn("auto-update: failed to load schedules", "error", err)
 		return
 	}
 
@@ -91,11 +94,11 @@ func (s *Server) triggerAutoUpdateCycle(schedule Schedule, runAt time.Time) {
 	go func() {
 		defer s.autoUpdateRun.Store(false)
 
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+		ctx, cancel := context.WithTimeout(logging.NewContext(context.Background(), s.log), 15*time.Minute)
 		defer cancel()
 
 		if err := s.executeAutoUpdateCycle(ctx, schedule, runAt); err != nil {
-			log.Printf("auto-update: schedule %s failed: %v", schedule.Name, err)
+			s.log.Error("auto-update: schedule failed", logging.KeyScheduleID, schedule.ID, "schedule", schedule.Name, "error", err)
 		}
 	}()
 }
@@ -110,32 +113,63 @@ func (s *Server) executeAutoUpdateCycle(ctx context.Context, schedule Schedule,
 		runAt = runAt.In(s.timezone)
 	}
 
-	log.Printf("auto-update: executing schedule %s at %s", schedule.Name, runAt.Format(time.RFC3339))
+	ctx, span := tracing.Start(ctx, "auto-update.cycle",
+		attribute.String("schedule.id", schedule.ID), attribute.String("schedule.name", schedule.Name))
+	defer span.End()
+
+	log := logging.Ctx(ctx).With(logging.KeyScheduleID, schedule.ID, "schedule", schedule.Name)
+	if sc := span.SpanContext(); sc.IsValid() {
+		log = log.With(logging.KeyTraceID, sc.TraceID().String())
+	}
+	ctx = logging.NewContext(ctx, log)
+	log.Info("auto-update: executing schedule", "run_at", runAt.Format(time.RFC3339))
 
 	stats := &UpdateCycleStats{}
 
-	if err := s.updateLocalAutoUpdateContainers(ctx, stats); err != nil {
-		log.Printf("auto-update: local update pass failed: %v", err)
+	// phase runs one step of the cycle in its own span.
+	phase := func(name string, fn func(context.Context) error) error {
+		phaseCtx, phaseSpan := tracing.Start(ctx, name)
+		err := fn(phaseCtx)
+		tracing.End(phaseSpan, err)
+		return err
+	}
+
+	if err := phase("auto-update.local", func(ctx context.Context) error {
+		return s.updateLocalAutoUpdateContainers(ctx, stats)
+	}); err != nil {
+		log.Warn("auto-update: local update pass failed", "error", err)
 	}
 
-	agentCmdIDs, err := s.enqueueAgentAutoUpdates(ctx, stats)
-	if err != nil {
-		log.Printf("auto-update: agent command enqueue failed: %v", err)
+	var agentCmdIDs []string
+	if err := phase("auto-update.agents", func(ctx context.Context) (err error) {
+		agentCmdIDs, err = s.enqueueAgentAutoUpdates(ctx, stats)
+		return err
+	}); err != nil {
+		log.Warn("auto-update: agent command enqueue failed", "error", err)
 	}
 
 	if s.cfg.AutoPruneImages {
-		if err := s.pruneUnusedImages(ctx); err != nil {
-			log.Printf("auto-update: image prune failed: %v", err)
+		if err := phase("auto-update.prune", s.pruneUnusedImages); err != nil {
+			log.Warn("auto-update: image prune failed", "error", err)
 		}
 	}
 
 	// Wait for agent update commands to finish so the recap and notifications land after actual installs.
 	if len(agentCmdIDs) > 0 {
-		if err := s.waitForAgentCommands(ctx, agentCmdIDs, 12*time.Minute); err != nil {
-			log.Printf("auto-update: waiting for agent commands: %v", err)
+		if err := phase("auto-update.wait-agents", func(ctx context.Context) error {
+			return s.waitForAgentCommands(ctx, agentCmdIDs, 12*time.Minute)
+		}); err != nil {
+			log.Warn("auto-update: waiting for agent commands", "error", err)
 		}
 	}
 
+	span.SetAttributes(
+		attribute.Int("local.checked", stats.LocalChecked),
+		attribute.Int("local.updated", stats.LocalUpdated),
+		attribute.Int("local.failed", stats.LocalFailed),
+		attribute.Int("agents.checked", stats.AgentChecked),
+		attribute.Int("agents.queued", stats.AgentQueued),
+	)
 	s.sendScheduleRecap(schedule.Name, stats)
 
 	return nil
@@ -163,7 +197,8 @@ func (s *Server) updateLocalAutoUpdateContainers(ctx context.Context, stats *Upd
 		return nil
 	}
 
-	silentDB := s.db.Session(&gorm.Session{Logger: logger.Discard})
+	log := logging.Ctx(ctx)
+	silentDB := s.db.Session(&gorm.Session{Logger: logger.Discard, Context: ctx})
 
 	var settings []ContainerSettings
 	if err := silentDB.Where("auto_update = ?", true).Find(&settings).Error; err != nil {
@@ -196,7 +231,7 @@ func (s *Server) updateLocalAutoUpdateContainers(ctx context.Context, stats *Upd
 				var count int64
 				silentDB.Model(&ContainerSettings{}).Where("id = ?", newID).Count(&count)
 				if count > 0 {
-					log.Printf("auto-update: cleaning up stale record for %s (old: %s, new: %s)", cfg.Name, origID, newID)
+					log.Info("auto-update: cleaning up stale record", "container", cfg.Name, logging.KeyContainerID, origID, "new_container_id", newID)
 					silentDB.Delete(&ContainerSettings{}, "id = ?", origID)
 					continue
 				}
@@ -222,7 +257,7 @@ func (s *Server) updateLocalAutoUpdateContainers(ctx context.Context, stats *Upd
 				_ = silentDB.Model(&ContainerSettings{}).Where("id = ?", cfg.ID).
 					Updates(map[string]interface{}{"auto_update": false, "update_available": false}).Error
 			} else {
-				log.Printf("auto-update: check failed for %s (%s): %v", cfg.Name, cfg.ID, err)
+				log.Warn("auto-update: check failed", "container", cfg.Name, logging.KeyContainerID, cfg.ID, "error", err)
 				_ = silentDB.Model(&ContainerSettings{}).Where("id = ?", cfg.ID).
 					Update("update_available", false).Error
 			}
@@ -236,7 +271,8 @@ func (s *Server) updateLocalAutoUpdateContainers(ctx context.Context, stats *Upd
 			continue
 		}
 
-		if _, name, image, digest, err := s.containerService.UpdateContainer(ctx, cfg.ID, func(m map[string]interface{}) {}); err != nil {
+		start := time.Now()
+		if _, name, image, prov, err := s.containerService.UpdateContainer(ctx, cfg.ID, func(m map[string]interface{}) {}); err != nil {
 			if stats != nil {
 				stats.LocalFailed++
 			}
@@ -244,18 +280,20 @@ func (s *Server) updateLocalAutoUpdateContainers(ctx context.Context, stats *Upd
 			if ue := new(UpdateError); errors.As(err, &ue) && ue.RolledBack {
 				status = "warning"
 			}
-			s.recordUpdateHistory(UpdateHistory{
+			log.Warn("auto-update: update failed", "container", cfg.Name, logging.KeyContainerID, cfg.ID, "status", status, "error", err)
+			s.recordProvenanceEvent(UpdateHistory{
 				ContainerID:   cfg.ID,
 				ContainerName: cfg.Name,
 				Image:         cfg.Image,
 				Source:        "local",
 				Status:        status,
 				Message:       fmt.Sprintf("Auto-update failed: %v", err),
-			})
+			}, prov, "", snapshots.ReasonUpdate, time.Since(start))
 		} else {
 			if stats != nil {
 				stats.LocalUpdated++
 			}
+			log.Info("auto-update: updated container", "container", name, logging.KeyContainerID, cfg.ID)
 			// Success case needs history too?
 			// The original code:
 			// if err := s.updateContainerNoStream(ctx, cli, cfg.ID); err != nil { ... error history ... }
@@ -263,15 +301,14 @@ func (s *Server) updateLocalAutoUpdateContainers(ctx context.Context, stats *Upd
 			// My new ContainerService.UpdateContainer DOES record DB changes but DOES NOT record history (I added DB sync but left history to caller).
 			// So I need to record success history here.
 
-			s.recordUpdateHistory(UpdateHistory{
+			s.recordProvenanceEvent(UpdateHistory{
 				ContainerID:   cfg.ID,
 				ContainerName: name,
 				Image:         image,
-				ImageDigest:   digest,
 				Source:        "local",
 				Status:        "success",
 				Message:       fmt.Sprintf("Auto-updated container %s", name),
-			})
+			}, prov, "", snapshots.ReasonUpdate, time.Since(start))
 		}
 	}
 
@@ -285,6 +322,14 @@ func (s *Server) pruneUnusedImages(ctx context.Context) error {
 	}
 	defer cli.Close()
 
+	// Images kept for rollback are tagged, so the prune below leaves them alone; only
+	// the ones past the retention count are released first.
+	if s.containerService != nil {
+		if err := s.containerService.EnforceImageRetention(ctx); err != nil {
+			logging.Ctx(ctx).Warn("auto-update: failed to apply image retention", "error", err)
+		}
+	}
+
 	report, err := cli.ImagesPrune(ctx, filters.Args{})
 	if err != nil {
 		return err
@@ -292,7 +337,7 @@ func (s *Server) pruneUnusedImages(ctx context.Context) error {
 
 	deleted := len(report.ImagesDeleted)
 	reclaimedMB := float64(report.SpaceReclaimed) / 1_000_000
-	log.Printf("auto-update: pruned %d images, reclaimed ~%.2f MB", deleted, reclaimedMB)
+	logging.Ctx(ctx).Info("auto-update: pruned images", "deleted", deleted, "reclaimed_mb", fmt.Sprintf("%.2f", reclaimedMB))
 	return nil
 }
 
@@ -301,10 +346,11 @@ func (s *Server) enqueueAgentAutoUpdates(ctx context.Context, stats *UpdateCycle
 		return nil, nil
 	}
 
+	log := logging.Ctx(ctx)
 	createdCmds := make([]string, 0)
 
 	var agents []Agent
-	if err := s.db.Find(&agents).Error; err != nil {
+	if err := s.db.WithContext(ctx).Find(&agents).Error; err != nil {
 		return nil, err
 	}
 
@@ -319,7 +365,7 @@ func (s *Server) enqueueAgentAutoUpdates(ctx context.Context, stats *UpdateCycle
 			continue
 		}
 
-		silent := s.db.Session(&gorm.Session{Logger: logger.Discard})
+		silent := s.db.Session(&gorm.Session{Logger: logger.Discard, Context: ctx})
 		var pending []AgentCommand
 		_ = silent.Where("agent_id = ? AND status IN ?", ag.ID, []string{"pending", "running"}).Find(&pending).Error
 
@@ -339,10 +385,35 @@ func (s *Server) enqueueAgentAutoUpdates(ctx context.Context, stats *UpdateCycle
 				if s.hasAgentCommandForContainer(pending, cont.ID, "update-container") {
 					continue
 				}
-				cmd, err := s.createAgentCommandInternal(ag.ID, "update-container", JSONMap{"containerId": cont.ID})
+				// Agents that require approval only run updates approved since the last window.
+				var approval *UpdateApproval
+				if ag.RequireApproval && s.approvalService != nil {
+					var err error
+					if approval, err = s.approvalService.Approved(ag.ID, cont.ID); err != nil {
+						log.Warn("auto-update: load approval failed", logging.KeyAgentID, ag.ID, "agent", ag.Name, logging.KeyContainerID, cont.ID, "error", err)
+						continue
+					}
+					// An approval for an image the tag no longer points at is superseded by a
+					// request for the new one.
+					if approval == nil || (cont.AvailableDigest != "" && approval.Digest != cont.AvailableDigest) {
+						s.requestUpdateApproval(ag, cont)
+						continue
+					}
+				}
+				payload := JSONMap{"containerId": cont.ID}
+				// The update is pinned to the approved image, not whatever the tag points at now.
+				if approval != nil && approval.Digest != "" {
+					payload["digest"] = approval.Digest
+				}
+				cmd, err := s.createAgentCommandInternal(ctx, ag.ID, "update-container", payload)
 				if err != nil {
-					log.Printf("auto-update: queue update for agent %s/%s failed: %v", ag.Name, cont.ID, err)
+					log.Warn("auto-update: queue update failed", logging.KeyAgentID, ag.ID, "agent", ag.Name, logging.KeyContainerID, cont.ID, "error", err)
 				} else {
+					if approval != nil {
+						if err := s.approvalService.MarkQueued(approval.ID, cmd.ID); err != nil {
+							log.Warn("auto-update: mark approval queued failed", "approval_id", approval.ID, logging.KeyCommandID, cmd.ID, "error", err)
+						}
+					}
 					if stats != nil {
 						stats.AgentQueued++
 						stats.AgentCmdIDs = append(stats.AgentCmdIDs, cmd.ID)
@@ -355,8 +426,8 @@ func (s *Server) enqueueAgentAutoUpdates(ctx context.Context, stats *UpdateCycle
 			if s.hasAgentCommandForContainer(pending, cont.ID, "check-update") {
 				continue
 			}
-			if _, err := s.createAgentCommandInternal(ag.ID, "check-update", JSONMap{"containerId": cont.ID}); err != nil {
-				log.Printf("auto-update: queue check for agent %s/%s failed: %v", ag.Name, cont.ID, err)
+			if _, err := s.createAgentCommandInternal(ctx, ag.ID, "check-update", JSONMap{"containerId": cont.ID}); err != nil {
+				log.Warn("auto-update: queue check failed", logging.KeyAgentID, ag.ID, "agent", ag.Name, logging.KeyContainerID, cont.ID, "error", err)
 			}
 		}
 	}
@@ -435,9 +506,7 @@ func cronMatches(expr string, t time.Time) bool {
 
 	minute := t.Minute()
 	hour := t.Hour()
-	day := t.Day()
 	month := int(t.Month())
-	weekday := int(t.Weekday()) // Sunday = 0
 
 	matchers := []struct {
 		field string
@@ -447,9 +516,7 @@ func cronMatches(expr string, t time.Time) bool {
 	}{
 		{parts[0], minute, 0, 59},
 		{parts[1], hour, 0, 23},
-		{parts[2], day, 1, 31},
 		{parts[3], month, 1, 12},
-		{parts[4], weekday, 0, 6},
 	}
 
 	for _, m := range matchers {
@@ -457,7 +524,20 @@ func cronMatches(expr string, t time.Time) bool {
 			return false
 		}
 	}
-	return true
+	return cronDayMatches(parts[2], parts[4], t)
+}
+
+// cronDayMatches matches the day-of-month and day-of-week fields like cron does: when
+// both are restricted, a day matching either one runs; otherwise both must match.
+func cronDayMatches(dom, dow string, t time.Time) bool {
+	domMatches := cronFieldMatches(dom, t.Day(), 1, 31)
+	weekday := int(t.Weekday()) // Sunday = 0
+	// Sunday is 0 or 7, also as the end of a range such as 5-7.
+	dowMatches := cronFieldMatches(dow, weekday, 0, 7) || (weekday == 0 && cronFieldMatches(dow, 7, 0, 7))
+	if !strings.HasPrefix(strings.TrimSpace(dom), "*") && !strings.HasPrefix(strings.TrimSpace(dow), "*") {
+		return domMatches || dowMatches
+	}
+	return domMatches && dowMatches
 }
 
 func cronFieldMatches(field string, value, min, max int) bool {
@@ -517,9 +597,6 @@ func cronTokenMatches(token string, value, min, max int) bool {
 		if err != nil {
 			return false
 		}
-		if v == 7 && max == 6 {
-			v = 0 // allow 0 or 7 for Sunday
-		}
 		return v == value
 	}
 
@@ -540,6 +617,73 @@ func cronTokenMatches(token string, value, min, max int) bool {
 	return (value-start)%step == 0
 }
 
+// cronValid reports whether expr is a five-field cron expression that cronMatches
+// understands.
+func cronValid(expr string) bool {
+	parts := strings.Fields(strings.TrimSpace(expr))
+	if len(parts) != 5 {
+		return false
+	}
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	for i, field := range parts {
+		for _, token := range strings.Split(field, ",") {
+			if !cronTokenValid(token, bounds[i][0], bounds[i][1]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func cronTokenValid(token string, min, max int) bool {
+	if base, step, ok := strings.Cut(token, "/"); ok {
+		if n, err := strconv.Atoi(step); err != nil || n <= 0 {
+			return false
+		}
+		token = base
+	}
+	if token == "*" {
+		return true
+	}
+	from, to, isRange := strings.Cut(token, "-")
+	start, err := strconv.Atoi(from)
+	if err != nil || start < min || start > max {
+		return false
+	}
+	if !isRange {
+		return true
+	}
+	end, err := strconv.Atoi(to)
+	return err == nil && end >= start && end <= max
+}
+
+// nextCronTime returns the first minute after after that matches expr, looking up to a
+// year ahead.
+func nextCronTime(expr string, after time.Time) (time.Time, bool) {
+	parts := strings.Fields(strings.TrimSpace(expr))
+	if len(parts) != 5 {
+		return time.Time{}, false
+	}
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(1, 0, 1)
+	for t.Before(end) {
+		switch {
+		case !cronFieldMatches(parts[3], int(t.Month()), 1, 12):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !cronDayMatches(parts[2], parts[4], t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !cronFieldMatches(parts[1], t.Hour(), 0, 23):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !cronFieldMatches(parts[0], t.Minute(), 0, 59):
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
 func (s *Server) lookupContainerByNameOrImage(ctx context.Context, cli *client.Client, cfg ContainerSettings) (id, name, image string) {
 	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
@@ -20,3 +20,60 @@ func TestCronMatchesStepAndList(t *testing.T) {
 		t.Fatalf("did not expect cron to match wrong weekday")
 	}
 }
+
+func TestCronMatchesDayFields(t *testing.T) {
+	// With both day fields restricted, either one matches.
+	if !cronMatches("0 0 1 * 1", mustTime("2024-01-08T00:00:00Z")) || !cronMatches("0 0 1 * 1", mustTime("2024-02-01T00:00:00Z")) {
+		t.Fatalf("expected the 1st or a Monday to match")
+	}
+	if cronMatches("0 0 1 * 1", mustTime("2024-01-09T00:00:00Z")) {
+		t.Fatalf("did not expect a Tuesday other than the 1st to match")
+	}
+	// With one unrestricted, only the other one counts.
+	if cronMatches("0 0 1 * *", mustTime("2024-01-08T00:00:00Z")) || cronMatches("0 0 */2 * 1", mustTime("2024-01-08T00:00:00Z")) {
+		t.Fatalf("did not expect the unrestricted field to widen the match")
+	}
+	if !cronMatches("0 0 * * 7", mustTime("2024-01-07T00:00:00Z")) || !cronMatches("0 0 * * 6-7", mustTime("2024-01-07T00:00:00Z")) {
+		t.Fatalf("expected 7 to match Sunday")
+	}
+}
+
+func TestCronValid(t *testing.T) {
+	for _, expr := range []string{"0 7 * * *", "*/15 9-17 * * 1-5", "30 6 1 * *", "0 0 * * 7", "5,35 * * 1,7 0"} {
+		if !cronValid(expr) {
+			t.Fatalf("expected %q to be valid", expr)
+		}
+	}
+	for _, expr := range []string{"", "0 7 * *", "0 7 * * * *", "60 * * * *", "0 24 * * *", "0 0 0 * *", "*/0 * * * *", "5-1 * * * *", "x * * * *"} {
+		if cronValid(expr) {
+			t.Fatalf("expected %q to be invalid", expr)
+		}
+	}
+}
+
+func TestNextCronTime(t *testing.T) {
+	cases := []struct {
+		expr, after, want string
+	}{
+		{"0 7 * * *", "2024-01-01T06:59:30Z", "2024-01-01T07:00:00Z"},
+		{"0 7 * * *", "2024-01-01T07:00:00Z", "2024-01-02T07:00:00Z"},
+		{"0 7 * * 1", "2024-01-02T08:00:00Z", "2024-01-08T07:00:00Z"},
+		{"30 6 1 * *", "2024-01-15T00:00:00Z", "2024-02-01T06:30:00Z"},
+		{"0 0 29 2 *", "2024-03-01T00:00:00Z", ""},                      // no 29 February within a year
+		{"0 0 * * 7", "2024-01-01T00:00:00Z", "2024-01-07T00:00:00Z"},   // 7 is Sunday
+		{"0 0 * * 5-7", "2024-01-06T01:00:00Z", "2024-01-07T00:00:00Z"}, // and ends a range
+		{"0 0 13 * 5", "2024-01-01T00:00:00Z", "2024-01-05T00:00:00Z"},  // the 13th or a Friday
+	}
+	for _, tc := range cases {
+		got, ok := nextCronTime(tc.expr, mustTime(tc.after))
+		if tc.want == "" {
+			if ok {
+				t.Fatalf("%s after %s: expected no match, got %s", tc.expr, tc.after, got)
+			}
+			continue
+		}
+		if !ok || !got.Equal(mustTime(tc.want)) {
+			t.Fatalf("%s after %s: expected %s, got %s (%v)", tc.expr, tc.after, tc.want, got, ok)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/containers"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/metrics"
+	"updockly/backend/internal/notify"
+	"updockly/backend/internal/snapshots"
+)
+
+// recordConfigSnapshots records the config a container ran before a change, when no
+// version matches it yet, and the config it runs after, as reason.
+func (s *Server) recordConfigSnapshots(entry UpdateHistory, historyID string, prov containers.Provenance, reason string) {
+	if s.snapshotService == nil {
+		return
+	}
+	record := func(raw []byte, reason string) {
+		if len(raw) == 0 {
+			return
+		}
+		_, _, err := s.snapshotService.Record(ConfigSnapshot{
+			AgentID:       entry.AgentID,
+			ContainerName: entry.ContainerName,
+			ContainerID:   entry.ContainerID,
+			Reason:        reason,
+			HistoryID:     historyID,
+			Config:        raw,
+		})
+		if err != nil && s.log != nil {
+			s.log.Warn("config snapshot: failed to record", logging.KeyAgentID, entry.AgentID, logging.KeyContainerID, entry.ContainerID, "container", entry.ContainerName, "reason", reason, "error", err)
+		}
+	}
+	record(prov.Config, snapshots.ReasonObserved)
+	record(prov.NewConfig, reason)
+}
+
+// configSnapshotSummary leaves out the config, which only the single snapshot returns.
+func configSnapshotSummary(snap ConfigSnapshot) ConfigSnapshot {
+	snap.Config = nil
+	return snap
+}
+
+func respondConfigSnapshotError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "config snapshot not found"})
+		return
+	}
+	respondInternal(c, "failed to load config snapshot", wrapErr("config snapshot", err))
+}
+
+func (s *Server) listConfigSnapshotsHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	rows, err := s.snapshotService.List(c.Query("agentId"), c.Query("container"), limit)
+	if err != nil {
+		respondInternal(c, "failed to load config snapshots", wrapErr("list config snapshots", err))
+		return
+	}
+	out := make([]ConfigSnapshot, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, configSnapshotSummary(row))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) getConfigSnapshotHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	snap, err := s.snapshotService.Get(c.Param("id"))
+	if err != nil {
+		respondConfigSnapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, snap)
+}
+
+func (s *Server) diffConfigSnapshotsHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	fromID, toID := strings.TrimSpace(c.Query("from")), strings.TrimSpace(c.Query("to"))
+	if fromID == "" || toID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are required"})
+		return
+	}
+	from, err := s.snapshotService.Get(fromID)
+	if err != nil {
+		respondConfigSnapshotError(c, err)
+		return
+	}
+	to, err := s.snapshotService.Get(toID)
+	if err != nil {
+		respondConfigSnapshotError(c, err)
+		return
+	}
+	diff, err := s.snapshotService.Diff(from.ID, to.ID)
+	if err != nil {
+		respondInternal(c, "failed to compare config snapshots", wrapErr("diff config snapshots", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":    configSnapshotSummary(from),
+		"to":      configSnapshotSummary(to),
+		"changed": !diff.Empty(),
+		"diff":    diff,
+	})
+}
+
+// captureConfigSnapshotHandler records the current config of a local container, for
+// changes made outside Updockly.
+func (s *Server) captureConfigSnapshotHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	var payload struct {
+		ContainerID string `json:"containerId"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil || strings.TrimSpace(payload.ContainerID) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "containerId is required"})
+		return
+	}
+	name, id, image, raw, err := s.containerService.CurrentConfig(c.Request.Context(), strings.TrimSpace(payload.ContainerID))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	snap, created, err := s.snapshotService.Record(ConfigSnapshot{
+		ContainerName: name,
+		ContainerID:   id,
+		Image:         image,
+		Reason:        snapshots.ReasonManual,
+		Config:        raw,
+	})
+	if err != nil {
+		respondInternal(c, "failed to record config snapshot", wrapErr("capture config snapshot", err))
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, configSnapshotSummary(snap))
+}
+
+// restoreConfigSnapshotHandler recreates a container with the config and image of a
+// snapshot. Agent containers are restored through a rollback command.
+func (s *Server) restoreConfigSnapshotHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	snap, err := s.snapshotService.Get(c.Param("id"))
+	if err != nil {
+		respondConfigSnapshotError(c, err)
+		return
+	}
+	parsed, err := containers.ParseConfigSnapshot(snap.Config)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	targetImage := parsed.Config.Image
+	message := fmt.Sprintf("Restored config version %d", snap.Version)
+
+	if snap.AgentID != "" {
+		agent, err := s.agentService.Get(snap.AgentID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+			return
+		}
+		containerID := snap.ContainerID
+		for _, cont := range agent.Containers {
+			if cont.Name == snap.ContainerName {
+				containerID = cont.ID
+				break
+			}
+		}
+		var cfg map[string]interface{}
+		if err := json.Unmarshal(snap.Config, &cfg); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		cmd, err := s.createAgentCommandInternal(c.Request.Context(), agent.ID, "rollback-container", JSONMap{
+			"containerId": containerID,
+			"name":        snap.ContainerName,
+			"image":       targetImage,
+			"config":      cfg,
+			"snapshotId":  snap.ID,
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		s.auditConfigRestore(c, snap, message)
+		c.JSON(http.StatusAccepted, gin.H{"message": "restore requested", "commandId": cmd.ID})
+		return
+	}
+
+	start := time.Now()
+	name, newID, prov, err := s.containerService.RollbackContainer(c.Request.Context(), snap.ContainerName, targetImage, snap.Config)
+	if err != nil {
+		metrics.ObserveUpdate("manual", snapshots.ReasonRestore, metrics.OutcomeFailed, time.Since(start))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	s.recordProvenanceEvent(UpdateHistory{
+		ContainerID:   newID,
+		ContainerName: name,
+		Image:         targetImage,
+		Source:        "manual",
+		Status:        "success",
+		Message:       message,
+	}, prov, notify.EventUpdateRollback, snapshots.ReasonRestore, time.Since(start))
+	s.auditConfigRestore(c, snap, message)
+	c.JSON(http.StatusOK, gin.H{"message": message, "newId": newID})
+}
+
+func (s *Server) auditConfigRestore(c *gin.Context, snap ConfigSnapshot, details string) {
+	claims := getClaims(c)
+	if claims == nil {
+		return
+	}
+	_ = s.auditService.RecordEvent(audit.Event{
+		ActorID:    claims.Subject,
+		ActorName:  claims.Name,
+		Action:     "restore-config-snapshot",
+		TargetType: "config-snapshot",
+		TargetID:   snap.ID,
+		Details:    fmt.Sprintf("%s of %s", details, snap.ContainerName),
+		After:      configSnapshotSummary(snap),
+		IPAddress:  c.ClientIP(),
+	})
+}
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/agents"
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/snapshots"
+)
+
+func TestAgentConfigSnapshotsDiffAndRestore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.AgentCommand{}, &domain.ContainerConfigSnapshot{}, &domain.AuditLog{}, &domain.AuditChainHead{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := &Server{db: db, agentService: agents.NewAgentService(db, false), snapshotService: snapshots.NewService(db),
+		auditService: audit.NewService(db)}
+	now := time.Now()
+	if err := db.Create(&Agent{ID: "a1", Name: "prod-1", LastSeen: &now, Containers: ContainerSnapshotList{
+		{ID: "c2", Name: "web", Image: "nginx:1.27"},
+	}}).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+
+	// An agent update reports the config before and after.
+	config := func(mode string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":       "web",
+			"config":     map[string]interface{}{"Image": "nginx:1.27", "Env": []interface{}{"MODE=" + mode}},
+			"hostConfig": map[string]interface{}{"RestartPolicy": map[string]interface{}{"Name": "always"}},
+		}
+	}
+	prov := provenanceFromResult(JSONMap{"config": config("old"), "newConfig": config("new")})
+	srv.recordConfigSnapshots(UpdateHistory{ContainerID: "c1", ContainerName: "web", AgentID: "a1"}, "h1", prov, snapshots.ReasonUpdate)
+
+	serve := func(method, path, route string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Handle(method, route, handler)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/config-snapshots?agentId=a1&container=web", "/config-snapshots", srv.listConfigSnapshotsHandler)
+	var versions []ConfigSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &versions); err != nil || len(versions) != 2 {
+		t.Fatalf("expected two versions, got %s (%v)", rec.Body.String(), err)
+	}
+	observed, updated := versions[1], versions[0]
+	if observed.Reason != snapshots.ReasonObserved || updated.Reason != snapshots.ReasonUpdate || updated.Version != 2 || updated.Config != nil {
+		t.Fatalf("unexpected versions %+v", versions)
+	}
+
+	rec = serve(http.MethodGet, "/config-snapshots/diff?from="+observed.ID+"&to="+updated.ID, "/config-snapshots/diff", srv.diffConfigSnapshotsHandler)
+	var diff struct {
+		Changed bool           `json:"changed"`
+		Diff    snapshots.Diff `json:"diff"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &diff); err != nil || !diff.Changed || len(diff.Diff.Env) != 1 || diff.Diff.Env[0].After != "new" {
+		t.Fatalf("unexpected diff %s (%v)", rec.Body.String(), err)
+	}
+
+	// Restoring the old version sends its config to the agent's current container.
+	rec = serve(http.MethodPost, "/config-snapshots/"+observed.ID+"/restore", "/config-snapshots/:id/restore", srv.restoreConfigSnapshotHandler)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected the restore to be queued, got %d %s", rec.Code, rec.Body.String())
+	}
+	var cmd AgentCommand
+	if err := db.Where("type = ?", "rollback-container").First(&cmd).Error; err != nil {
+		t.Fatalf("load command: %v", err)
+	}
+	if cmd.Payload["containerId"] != "c2" || cmd.Payload["name"] != "web" || cmd.Payload["image"] != "nginx:1.27" || cmd.Payload["snapshotId"] != observed.ID {
+		t.Fatalf("unexpected restore command %+v", cmd.Payload)
+	}
+	if cfg, ok := cmd.Payload["config"].(map[string]interface{}); !ok || cfg["hostConfig"] == nil {
+		t.Fatalf("expected the snapshot config in the command, got %v", cmd.Payload["config"])
+	}
+
+	if rec := serve(http.MethodGet, "/config-snapshots/missing", "/config-snapshots/:id", srv.getConfigSnapshotHandler); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected a missing snapshot to return 404, got %d", rec.Code)
+	}
+}
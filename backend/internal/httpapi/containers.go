@@ -4,11 +4,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/metrics"
+	"updockly/backend/internal/notify"
+	"updockly/backend/internal/snapshots"
 )
 
 type containerResponse struct {
@@ -26,7 +34,7 @@ func (s *Server) listContainers(c *gin.Context) {
 	ctx := c.Request.Context()
 	containers, err := s.containerService.ListContainers(ctx)
 	if err != nil {
-		log.Printf("listContainers: failed to list containers: %v", err)
+		logging.FromContext(c).Error("failed to list containers", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to list containers: %v", err)})
 		return
 	}
@@ -59,11 +67,22 @@ func (s *Server) localHostInfo(c *gin.Context) {
 
 func (s *Server) checkContainerUpdateHandler(c *gin.Context) {
 	id := c.Param("id")
+	var before ContainerSettings
+	if s.db != nil {
+		_ = s.db.Session(&gorm.Session{Logger: logger.Discard}).First(&before, "id = ?", id).Error
+	}
 	ok, err := s.containerService.CheckUpdate(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if ok && !before.UpdateAvailable {
+		var after ContainerSettings
+		if s.db != nil {
+			_ = s.db.Session(&gorm.Session{Logger: logger.Discard}).First(&after, "id = ?", id).Error
+		}
+		go s.notifyUpdateAvailable(nil, id, after.Name, after.Image)
+	}
 	c.JSON(http.StatusOK, gin.H{"updateAvailable": ok})
 }
 
@@ -87,7 +106,17 @@ func (s *Server) toggleAutoUpdateHandler(c *gin.Context) {
 		if !payload.Enabled {
 			action = "disable-auto-update"
 		}
-		_ = s.auditService.Record(claims.Subject, claims.Name, action, fmt.Sprintf("Toggled auto-update for container: %s", id), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     action,
+			TargetType: "container",
+			TargetID:   id,
+			Details:    fmt.Sprintf("Toggled auto-update for container: %s", id),
+			Before:     gin.H{"autoUpdate": !payload.Enabled},
+			After:      gin.H{"autoUpdate": payload.Enabled},
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "auto-update preference updated"})
@@ -101,7 +130,15 @@ func (s *Server) startContainerHandler(c *gin.Context) {
 	}
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "start-container", fmt.Sprintf("Started container: %s", id), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "start-container",
+			TargetType: "container",
+			TargetID:   id,
+			Details:    fmt.Sprintf("Started container: %s", id),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Container started"})
@@ -115,7 +152,15 @@ func (s *Server) stopContainerHandler(c *gin.Context) {
 	}
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "stop-container", fmt.Sprintf("Stopped container: %s", id), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "stop-container",
+			TargetType: "container",
+			TargetID:   id,
+			Details:    fmt.Sprintf("Stopped container: %s", id),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Container stopped"})
@@ -129,7 +174,15 @@ func (s *Server) restartContainerHandler(c *gin.Context) {
 	}
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "restart-container", fmt.Sprintf("Restarted container: %s", id), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "restart-container",
+			TargetType: "container",
+			TargetID:   id,
+			Details:    fmt.Sprintf("Restarted container: %s", id),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Container restarted"})
@@ -170,7 +223,8 @@ func (s *Server) updateContainerHandler(c *gin.Context) {
 		flusher.Flush()
 	}
 
-	newID, name, image, digest, err := s.containerService.UpdateContainer(c.Request.Context(), id, send)
+	start := time.Now()
+	newID, name, image, prov, err := s.containerService.UpdateContainer(c.Request.Context(), id, send)
 	if err != nil {
 		rolledBack := false
 		status := "error"
@@ -183,15 +237,14 @@ func (s *Server) updateContainerHandler(c *gin.Context) {
 			}
 		}
 		msg := err.Error()
-		s.recordUpdateHistory(UpdateHistory{
+		s.recordProvenanceEvent(UpdateHistory{
 			ContainerID:   id,
 			ContainerName: name,
 			Image:         image,
-			ImageDigest:   digest,
 			Source:        "manual",
 			Status:        status,
 			Message:       msg,
-		})
+		}, prov, "", snapshots.ReasonUpdate, time.Since(start))
 		payload := map[string]interface{}{
 			"error":      msg,
 			"rolledBack": rolledBack,
@@ -207,18 +260,27 @@ func (s *Server) updateContainerHandler(c *gin.Context) {
 		return
 	}
 
-	s.recordUpdateHistory(UpdateHistory{
+	s.recordProvenanceEvent(UpdateHistory{
 		ContainerID:   newID,
 		ContainerName: name,
 		Image:         image,
-		ImageDigest:   digest,
 		Source:        "manual",
 		Status:        "success",
 		Message:       "Update completed",
-	})
+	}, prov, "", snapshots.ReasonUpdate, time.Since(start))
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "update-container", fmt.Sprintf("Updated container: %s (%s)", name, image), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "update-container",
+			TargetType: "container",
+			TargetID:   newID,
+			Details:    fmt.Sprintf("Updated container: %s (%s)", name, image),
+			Before:     gin.H{"id": id},
+			After:      gin.H{"id": newID, "image": image, "imageDigest": prov.NewDigest, "previousDigest": prov.PreviousDigest},
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	send(map[string]interface{}{
@@ -233,20 +295,54 @@ func (s *Server) rollbackContainerHandler(c *gin.Context) {
 		Image     string `json:"image"`
 		HistoryID string `json:"historyId,omitempty"`
 	}
-	if err := c.ShouldBindJSON(&payload); err != nil || strings.TrimSpace(payload.Image) == "" {
+	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 		return
 	}
-	targetImage := strings.TrimSpace(payload.Image)
+	refs := []string{id}
+	if strings.TrimSpace(payload.HistoryID) != "" {
+		if name, _, _, err := s.containerService.Describe(c.Request.Context(), id); err == nil {
+			refs = append(refs, name)
+		}
+	}
+	targetImage, snapshot, err := s.rollbackTarget("", refs, payload.Image, payload.HistoryID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if targetImage == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image or a history entry with a previous image is required"})
+		return
+	}
 
-	name, newID, err := s.containerService.RollbackContainer(c.Request.Context(), id, targetImage)
+	start := time.Now()
+	name, newID, prov, err := s.containerService.RollbackContainer(c.Request.Context(), id, targetImage, snapshot)
 	if err != nil {
+		metrics.ObserveUpdate("manual", snapshots.ReasonRollback, metrics.OutcomeFailed, time.Since(start))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	s.recordProvenanceEvent(UpdateHistory{
+		ContainerID:   newID,
+		ContainerName: name,
+		Image:         targetImage,
+		Source:        "manual",
+		Status:        "success",
+		Message:       "Rollback completed",
+	}, prov, notify.EventUpdateRollback, snapshots.ReasonRollback, time.Since(start))
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "rollback-container", fmt.Sprintf("Rolled back container: %s to %s", name, targetImage), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "rollback-container",
+			TargetType: "container",
+			TargetID:   newID,
+			Details:    fmt.Sprintf("Rolled back container: %s to %s", name, targetImage),
+			Before:     gin.H{"id": id},
+			After:      gin.H{"id": newID, "image": targetImage},
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
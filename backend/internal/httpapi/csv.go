@@ -0,0 +1,15 @@
+package httpapi
+
+import "strings"
+
+// csvRow neutralises cells that a spreadsheet would evaluate as a formula by prefixing
+// them with a quote. Exports carry user-controlled text such as container names and
+// audit details, so every CSV export writes its rows through this.
+func csvRow(cells ...string) []string {
+	for i, cell := range cells {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cells[i] = "'" + cell
+		}
+	}
+	return cells
+}
@@ -2,6 +2,7 @@ package httpapi
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -23,8 +24,13 @@ import (
 	"gorm.io/gorm/logger"
 
 	"updockly/backend/internal/agents"
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/auth"
 	"updockly/backend/internal/config"
+	"updockly/backend/internal/database"
 	"updockly/backend/internal/logging"
+	"updockly/backend/internal/notify"
+	"updockly/backend/internal/snapshots"
 	"updockly/backend/internal/util"
 )
 
@@ -87,6 +93,13 @@ func (s *Server) publicConfigHandler(c *gin.Context) {
 			"enabled":  s.cfg.SSO.Enabled,
 			"provider": s.cfg.SSO.Provider,
 		},
+		"ldap": gin.H{
+			"enabled": s.cfg.LDAP.Enabled,
+		},
+		"webauthn": gin.H{
+			"enabled":      s.webauthnService.Enabled(),
+			"passwordless": s.webauthnService.PasswordlessEnabled(),
+		},
 	})
 }
 
@@ -103,25 +116,20 @@ func (s *Server) loginHandler(c *gin.Context) {
 	}
 
 	key := s.loginKey(req.Username, c.ClientIP())
-	if retryAfter, blocked := s.isLoginBlocked(key); blocked {
-		logging.FromContext(c).Warn("login blocked", "key", key, "retry_after", retryAfter.String())
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"error":      "too many failed attempts, try again later",
-			"retryAfter": retryAfter.String(),
-		})
+	if s.rejectIfThrottled(c, key) {
 		return
 	}
 
 	account, err := s.authService.Authenticate(req.Username, req.Password)
 	if err != nil {
-		s.recordLoginFailure(key)
+		s.recordLoginFailure(c, key, req.Username)
 		respondError(c, http.StatusUnauthorized, "invalid credentials", wrapErr("authenticate user", err))
 		return
 	}
 
 	s.clearLoginFailures(key)
 
-	if account.TwoFactorEnabled {
+	if methods := s.secondFactorMethods(account); len(methods) > 0 {
 		tempToken, err := s.authService.IssueToken(*account, "pre-2fa", 5*time.Minute)
 		if err != nil {
 			respondInternal(c, "unable to issue temporary token", wrapErr("issue pre-2fa token", err))
@@ -130,6 +138,7 @@ func (s *Server) loginHandler(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"twoFactorRequired": true,
 			"tempToken":         tempToken,
+			"methods":           methods,
 		})
 		return
 	}
@@ -138,14 +147,7 @@ func (s *Server) loginHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to issue session"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"user": gin.H{
-			"username":         account.Username,
-			"name":             account.Name,
-			"role":             account.Role,
-			"twoFactorEnabled": account.TwoFactorEnabled,
-		},
-	})
+	c.JSON(http.StatusOK, gin.H{"user": s.sessionUserPayload(account)})
 }
 
 func (s *Server) profileHandler(c *gin.Context) {
@@ -160,11 +162,14 @@ func (s *Server) profileHandler(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"username":         account.Username,
-		"name":             account.Name,
-		"email":            account.Email,
-		"role":             account.Role,
-		"twoFactorEnabled": account.TwoFactorEnabled,
+		"username":                   account.Username,
+		"name":                       account.Name,
+		"email":                      account.Email,
+		"role":                       account.Role,
+		"twoFactorEnabled":           account.TwoFactorEnabled,
+		"webauthnEnabled":            s.webauthnService.HasCredentials(account.ID),
+		"passwordExpired":            s.authService.PasswordExpired(account),
+		"webauthnEnrollmentRequired": s.keyEnrollmentRequired(account),
 	})
 }
 
@@ -195,6 +200,9 @@ func (s *Server) updateProfileHandler(c *gin.Context) {
 
 	updated, err := s.authService.UpdateAccount(claims.Subject, payload.Name, payload.Email, payload.CurrentPassword, payload.NewPassword)
 	if err != nil {
+		if respondPasswordPolicy(c, err) {
+			return
+		}
 		status := http.StatusInternalServerError
 		if err.Error() == "invalid current password" || strings.Contains(err.Error(), "current password required") {
 			status = http.StatusBadRequest
@@ -202,6 +210,13 @@ func (s *Server) updateProfileHandler(c *gin.Context) {
 		respondError(c, status, err.Error(), wrapErr("update account", err))
 		return
 	}
+	// A restricted session becomes a full one once the password has been changed.
+	if claims.Type != "" && payload.NewPassword != "" {
+		if err := s.issueSession(c, updated); err != nil {
+			respondInternal(c, "unable to issue session", wrapErr("issue session after password change", err))
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"username":         updated.Username,
@@ -316,17 +331,24 @@ func (s *Server) reset2FAInitHandler(c *gin.Context) {
 		return
 	}
 
+	key := throttleKey(throttleScope2FAReset, payload.Username, c.ClientIP())
+	if s.rejectIfThrottled(c, key) {
+		return
+	}
+
 	secret, qrCode, token, err := s.authService.InitiateReset2FA(payload.Username, payload.Code, payload.Password)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if err.Error() == "invalid password" || err.Error() == "invalid recovery code" {
 			status = http.StatusUnauthorized
+			s.recordLoginFailure(c, key, payload.Username)
 		} else if err.Error() == "2fa not enabled" {
 			status = http.StatusBadRequest
 		}
 		respondError(c, status, err.Error(), wrapErr("initiate reset 2fa", err))
 		return
 	}
+	s.clearLoginFailures(key)
 
 	c.JSON(http.StatusOK, gin.H{
 		"secret":    secret,
@@ -347,15 +369,26 @@ func (s *Server) reset2FAFinalizeHandler(c *gin.Context) {
 		return
 	}
 
+	subject := ""
+	if claims, err := s.authService.VerifyToken(payload.TempToken); err == nil {
+		subject = claims.Subject
+	}
+	key := throttleKey(throttleScope2FAReset, subject, c.ClientIP())
+	if s.rejectIfThrottled(c, key) {
+		return
+	}
+
 	recoveryCodes, err := s.authService.FinalizeReset2FA(payload.TempToken, payload.Code)
 	if err != nil {
 		status := http.StatusInternalServerError
 		if err.Error() == "invalid 2fa code" || err.Error() == "invalid token type" {
 			status = http.StatusUnauthorized
+			s.recordLoginFailure(c, key, subject)
 		}
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
+	s.clearLoginFailures(key)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":       "2fa reset complete",
@@ -365,7 +398,11 @@ func (s *Server) reset2FAFinalizeHandler(c *gin.Context) {
 
 type verify2FAPayload struct {
 	TempToken string `json:"tempToken"`
+	Method    string `json:"method"`
 	Code      string `json:"code"`
+	// WebAuthn assertion fields, used when Method is "webauthn".
+	SessionID  string          `json:"sessionId"`
+	Credential json.RawMessage `json:"credential"`
 }
 
 func (s *Server) generate2FAHandler(c *gin.Context) {
@@ -455,45 +492,58 @@ func (s *Server) verify2FAHandler(c *gin.Context) {
 		return
 	}
 
-	claims, err := s.authService.VerifyToken(payload.TempToken)
+	account, err := s.preTwoFactorAccount(payload.TempToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid temporary token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
-	if claims.Type != "pre-2fa" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token type"})
+
+	key := throttleKey(throttleScope2FAVerify, account.Username, c.ClientIP())
+	if s.rejectIfThrottled(c, key) {
 		return
 	}
 
-	valid, err := s.authService.Validate2FA(claims.Subject, payload.Code)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	method := strings.ToLower(strings.TrimSpace(payload.Method))
+	if method == "" {
+		method = secondFactorTOTP
 	}
-	if !valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid 2fa code"})
+	if !containsMethod(s.secondFactorMethods(account), method) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "2fa method not allowed"})
 		return
 	}
 
-	account, err := s.authService.GetAccount(claims.Subject)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
-		return
+	switch method {
+	case secondFactorWebAuthn:
+		if !s.verifyWebAuthnSecondFactor(c, account, payload) {
+			s.recordLoginFailure(c, key, account.Username)
+			return
+		}
+	default:
+		valid, err := s.authService.Validate2FA(account.Username, payload.Code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !valid {
+			s.recordLoginFailure(c, key, account.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid 2fa code"})
+			return
+		}
+		// Validate2FA may consume a recovery code; reload to return fresh state.
+		if account, err = s.authService.GetAccount(account.Username); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
+			return
+		}
 	}
 
+	s.clearLoginFailures(key)
+
 	if err := s.issueSession(c, account); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to issue session"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"user": gin.H{
-			"username":         account.Username,
-			"name":             account.Name,
-			"role":             account.Role,
-			"twoFactorEnabled": account.TwoFactorEnabled,
-		},
-	})
+	c.JSON(http.StatusOK, gin.H{"user": s.sessionUserPayload(account)})
 }
 
 type resetPasswordPayload struct {
@@ -515,6 +565,9 @@ func (s *Server) resetPasswordHandler(c *gin.Context) {
 	}
 
 	if err := s.authService.ResetPasswordWithRecoveryCode(payload.Username, payload.RecoveryCode, payload.NewPassword); err != nil {
+		if respondPasswordPolicy(c, err) {
+			return
+		}
 		// Don't reveal if user exists vs code invalid for security (generic message)
 		// But here invalid recovery code is specific enough.
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or recovery code"})
@@ -540,6 +593,13 @@ func (s *Server) forgotPasswordHandler(c *gin.Context) {
 		return
 	}
 
+	// Every request counts: reset emails are throttled per address and client.
+	key := throttleKey(throttleScopeForgotPassword, payload.Email, c.ClientIP())
+	if s.rejectIfLimited(c, s.resetLimiter, key) {
+		return
+	}
+	s.countResetRequest(key)
+
 	token, account, err := s.authService.GeneratePasswordResetToken(payload.Email)
 	if err != nil {
 		// For security, do not reveal if email exists
@@ -620,6 +680,9 @@ func (s *Server) resetPasswordWithTokenHandler(c *gin.Context) {
 	}
 
 	if err := s.authService.ResetPasswordWithToken(payload.Token, payload.NewPassword); err != nil {
+		if respondPasswordPolicy(c, err) {
+			return
+		}
 		respondError(c, http.StatusUnauthorized, "invalid or expired token", wrapErr("reset password with token", err))
 		return
 	}
@@ -751,27 +814,20 @@ func (s *Server) setupCreateHandler(c *gin.Context) {
 	}
 
 	if s.db == nil {
-		var dial gorm.Dialector
 		lower := strings.ToLower(s.cfg.DatabaseURL)
-		switch {
-		case strings.HasPrefix(lower, "postgres://") || strings.HasPrefix(lower, "postgresql://"):
-			dial = postgres.Open(s.cfg.DatabaseURL)
-		case strings.HasPrefix(lower, "sqlite://"):
-			dsn := strings.TrimPrefix(s.cfg.DatabaseURL, "sqlite://")
-			dial = sqlite.Open(dsn)
-		default:
+		if !strings.HasPrefix(lower, "postgres://") && !strings.HasPrefix(lower, "postgresql://") && !strings.HasPrefix(lower, "sqlite://") {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid database URL scheme"})
 			return
 		}
 
-		db, err := gorm.Open(dial, &gorm.Config{Logger: logger.Default.LogMode(logger.Warn)})
+		db, err := database.Open(s.cfg)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to connect to database"})
 			return
 		}
 
-		if err := db.AutoMigrate(&Account{}, &Agent{}); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to run migrations"})
+		if err := database.Migrate(db); err != nil {
+			respondError(c, http.StatusInternalServerError, "failed to run migrations", wrapErr("migrate", err))
 			return
 		}
 		s.db = db
@@ -780,6 +836,9 @@ func (s *Server) setupCreateHandler(c *gin.Context) {
 
 	codes, err := s.authService.CreateAdmin(payload.Username, payload.Email, payload.Password, payload.Name, payload.TOTPSecret)
 	if err != nil {
+		if respondPasswordPolicy(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create admin account"})
 		return
 	}
@@ -816,6 +875,32 @@ func (s *Server) updateSettings(c *gin.Context) {
 		}
 	}
 
+	if err := logging.ValidateLevel(payload.LogLevel); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err := validateDigestSettings(payload.Notifications.UpdateDigest); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if expr := strings.TrimSpace(payload.Notifications.NotificationCron); expr != "" && !cronValid(expr) {
+		respondError(c, http.StatusBadRequest, "recap cron needs five fields: minute hour day month weekday", nil)
+		return
+	}
+	if path := strings.TrimSpace(payload.PasswordPolicy.BreachedListPath); path != "" {
+		if err := auth.ValidateBreachedList(path); err != nil {
+			respondError(c, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+	}
+	payload.Notifications.SMTP.Security = strings.ToLower(strings.TrimSpace(payload.Notifications.SMTP.Security))
+	smtpCfg := payload.Notifications.SMTP
+	if err := (notify.SMTP{Host: smtpCfg.Host, Security: smtpCfg.Security, User: smtpCfg.User, Password: smtpCfg.Password}).Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	before := s.currentRuntimeSettings()
 	updated, err := s.saveRuntimeSettings(payload)
 	if err != nil {
 		status := http.StatusInternalServerError
@@ -829,7 +914,17 @@ func (s *Server) updateSettings(c *gin.Context) {
 	s.applyRuntimeSettings(updated)
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "update-settings", "Updated runtime settings", c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "update-settings",
+			TargetType: "settings",
+			TargetID:   "runtime",
+			Details:    "Updated runtime settings",
+			Before:     before,
+			After:      updated,
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, updated)
@@ -998,6 +1093,8 @@ type agentPayload struct {
 	Hostname   string `json:"hostname"`
 	Notes      string `json:"notes"`
 	TLSEnabled bool   `json:"tlsEnabled"`
+	// RequireApproval is left unchanged when omitted.
+	RequireApproval *bool `json:"requireApproval"`
 }
 
 type agentResponse struct {
@@ -1018,6 +1115,8 @@ type agentResponse struct {
 	TokenBound    bool                `json:"tokenBound"`
 	CreatedAt     time.Time           `json:"createdAt"`
 	UpdatedAt     time.Time           `json:"updatedAt"`
+
+	RequireApproval bool `json:"requireApproval"`
 }
 
 func decodeContainers(agent Agent) []ContainerSnapshot {
@@ -1046,6 +1145,8 @@ func toAgentResponse(agent Agent, includeToken bool) agentResponse {
 		TokenBound:    agent.TokenBinding != "",
 		CreatedAt:     agent.CreatedAt,
 		UpdatedAt:     agent.UpdatedAt,
+
+		RequireApproval: agent.RequireApproval,
 	}
 	if includeToken {
 		resp.Token = agent.Token
@@ -1078,9 +1179,25 @@ func (s *Server) createAgentHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create agent"})
 		return
 	}
+	if payload.RequireApproval != nil && *payload.RequireApproval {
+		if err := s.agentService.SetRequireApproval(agent.ID, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create agent"})
+			return
+		}
+		agent.RequireApproval = true
+	}
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "create-agent", fmt.Sprintf("Created agent: %s", agent.Name), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "create-agent",
+			TargetType: "agent",
+			TargetID:   agent.ID,
+			Details:    fmt.Sprintf("Created agent: %s", agent.Name),
+			After:      toAgentResponse(*agent, false),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusCreated, toAgentResponse(*agent, true))
@@ -1112,6 +1229,10 @@ func (s *Server) updateAgentHandler(c *gin.Context) {
 		return
 	}
 
+	var before interface{}
+	if existing, err := s.agentService.Get(id); err == nil && existing != nil {
+		before = toAgentResponse(*existing, false)
+	}
 	agent, err := s.agentService.Update(id, payload.Name, payload.Hostname, payload.Notes, payload.TLSEnabled)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -1121,9 +1242,26 @@ func (s *Server) updateAgentHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update agent"})
 		return
 	}
+	if payload.RequireApproval != nil && *payload.RequireApproval != agent.RequireApproval {
+		if err := s.agentService.SetRequireApproval(agent.ID, *payload.RequireApproval); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update agent"})
+			return
+		}
+		agent.RequireApproval = *payload.RequireApproval
+	}
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "update-agent", fmt.Sprintf("Updated agent: %s", agent.Name), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "update-agent",
+			TargetType: "agent",
+			TargetID:   agent.ID,
+			Details:    fmt.Sprintf("Updated agent: %s", agent.Name),
+			Before:     before,
+			After:      toAgentResponse(*agent, false),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, toAgentResponse(*agent, false))
@@ -1165,7 +1303,15 @@ func (s *Server) deleteAgentHandler(c *gin.Context) {
 		if agent != nil {
 			name = agent.Name
 		}
-		_ = s.auditService.Record(claims.Subject, claims.Name, "delete-agent", fmt.Sprintf("Deleted agent: %s", name), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "delete-agent",
+			TargetType: "agent",
+			TargetID:   id,
+			Details:    fmt.Sprintf("Deleted agent: %s", name),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.Status(http.StatusNoContent)
@@ -1174,13 +1320,21 @@ func (s *Server) deleteAgentHandler(c *gin.Context) {
 func (s *Server) startAgentContainerHandler(c *gin.Context) {
 	agentID := c.Param("id")
 	containerID := c.Param("containerId")
-	if _, err := s.createAgentCommandInternal(agentID, "start-container", JSONMap{"containerId": containerID}); err != nil {
+	if _, err := s.createAgentCommandInternal(c.Request.Context(), agentID, "start-container", JSONMap{"containerId": containerID}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "start-agent-container", fmt.Sprintf("Requested start for agent container: %s (agent: %s)", containerID, agentID), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "start-agent-container",
+			TargetType: "agent-container",
+			TargetID:   agentID + "/" + containerID,
+			Details:    fmt.Sprintf("Requested start for agent container: %s (agent: %s)", containerID, agentID),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "start requested"})
@@ -1189,13 +1343,21 @@ func (s *Server) startAgentContainerHandler(c *gin.Context) {
 func (s *Server) stopAgentContainerHandler(c *gin.Context) {
 	agentID := c.Param("id")
 	containerID := c.Param("containerId")
-	if _, err := s.createAgentCommandInternal(agentID, "stop-container", JSONMap{"containerId": containerID}); err != nil {
+	if _, err := s.createAgentCommandInternal(c.Request.Context(), agentID, "stop-container", JSONMap{"containerId": containerID}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "stop-agent-container", fmt.Sprintf("Requested stop for agent container: %s (agent: %s)", containerID, agentID), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "stop-agent-container",
+			TargetType: "agent-container",
+			TargetID:   agentID + "/" + containerID,
+			Details:    fmt.Sprintf("Requested stop for agent container: %s (agent: %s)", containerID, agentID),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "stop requested"})
@@ -1204,13 +1366,21 @@ func (s *Server) stopAgentContainerHandler(c *gin.Context) {
 func (s *Server) restartAgentContainerHandler(c *gin.Context) {
 	agentID := c.Param("id")
 	containerID := c.Param("containerId")
-	if _, err := s.createAgentCommandInternal(agentID, "restart-container", JSONMap{"containerId": containerID}); err != nil {
+	if _, err := s.createAgentCommandInternal(c.Request.Context(), agentID, "restart-container", JSONMap{"containerId": containerID}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "restart-agent-container", fmt.Sprintf("Requested restart for agent container: %s (agent: %s)", containerID, agentID), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "restart-agent-container",
+			TargetType: "agent-container",
+			TargetID:   agentID + "/" + containerID,
+			Details:    fmt.Sprintf("Requested restart for agent container: %s (agent: %s)", containerID, agentID),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "restart requested"})
@@ -1223,26 +1393,55 @@ func (s *Server) rollbackAgentContainerHandler(c *gin.Context) {
 		Image     string `json:"image"`
 		HistoryID string `json:"historyId,omitempty"`
 	}
-	if err := c.ShouldBindJSON(&payload); err != nil || strings.TrimSpace(payload.Image) == "" {
+	if err := c.ShouldBindJSON(&payload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 		return
 	}
+	targetImage, snapshot, err := s.rollbackTarget(agentID, []string{containerID}, payload.Image, payload.HistoryID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if targetImage == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image or a history entry with a previous image is required"})
+		return
+	}
 
 	cmdPayload := JSONMap{
 		"containerId": containerID,
-		"image":       strings.TrimSpace(payload.Image),
+		"image":       targetImage,
 	}
 	if strings.TrimSpace(payload.HistoryID) != "" {
 		cmdPayload["historyId"] = strings.TrimSpace(payload.HistoryID)
 	}
+	// The agent recreates the container from the config it had before the update and
+	// finds it by name when the ID recorded in history has since been replaced.
+	if len(snapshot) > 0 {
+		var cfg map[string]interface{}
+		if err := json.Unmarshal(snapshot, &cfg); err == nil {
+			cmdPayload["config"] = cfg
+			if name, _ := cfg["name"].(string); name != "" {
+				cmdPayload["name"] = name
+			}
+		}
+	}
 
-	if _, err := s.createAgentCommandInternal(agentID, "rollback-container", cmdPayload); err != nil {
+	if _, err := s.createAgentCommandInternal(c.Request.Context(), agentID, "rollback-container", cmdPayload); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	if claims := getClaims(c); claims != nil {
-		_ = s.auditService.Record(claims.Subject, claims.Name, "rollback-agent-container", fmt.Sprintf("Requested rollback for agent container: %s (agent: %s)", containerID, agentID), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "rollback-agent-container",
+			TargetType: "agent-container",
+			TargetID:   agentID + "/" + containerID,
+			Details:    fmt.Sprintf("Requested rollback for agent container: %s (agent: %s)", containerID, agentID),
+			After:      gin.H{"image": cmdPayload["image"]},
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "rollback requested"})
@@ -1266,7 +1465,7 @@ func (s *Server) agentContainerLogsHandler(c *gin.Context) {
 		return
 	}
 
-	if _, err := s.createAgentCommandInternal(agentID, "fetch-logs", JSONMap{"containerId": containerID, "tail": tail}); err != nil {
+	if _, err := s.createAgentCommandInternal(c.Request.Context(), agentID, "fetch-logs", JSONMap{"containerId": containerID, "tail": tail}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -1292,8 +1491,8 @@ func (s *Server) agentContainerLogsHandler(c *gin.Context) {
 	})
 }
 
-func (s *Server) createAgentCommandInternal(agentID, cmdType string, payload JSONMap) (*AgentCommand, error) {
-	return s.agentService.CreateCommand(agentID, cmdType, payload)
+func (s *Server) createAgentCommandInternal(ctx context.Context, agentID, cmdType string, payload JSONMap) (*AgentCommand, error) {
+	return s.agentService.CreateCommandWithContext(ctx, agentID, cmdType, payload)
 }
 
 func (s *Server) latestAgentLogs(agentID, containerID string) (string, error) {
@@ -1326,6 +1525,7 @@ type agentHeartbeatPayload struct {
 	Containers    []ContainerSnapshot `json:"containers"`
 	CPU           float64             `json:"cpu"`
 	Memory        float64             `json:"memory"`
+	Stats         []agentStatsReading `json:"stats"`
 }
 
 func (s *Server) agentHeartbeatHandler(c *gin.Context) {
@@ -1369,7 +1569,9 @@ func (s *Server) agentHeartbeatHandler(c *gin.Context) {
 
 	now := time.Now()
 	agent.LastSeen = &now
-	s.clearAgentOfflineNotified(agent.ID)
+	if s.clearAgentOfflineNotified(agent.ID) {
+		go s.notifyAgentOnline(*agent)
+	}
 	silentDB := s.db.Session(&gorm.Session{Logger: logger.Discard})
 	updates := map[string]interface{}{
 		"last_seen": now,
@@ -1404,6 +1606,7 @@ func (s *Server) agentHeartbeatHandler(c *gin.Context) {
 			if !c.UpdateAvailable {
 				if prev, ok := existingByID[c.ID]; ok && prev.UpdateAvailable {
 					c.UpdateAvailable = true
+					c.AvailableDigest = prev.AvailableDigest
 				}
 			}
 			if c.CheckedAt == nil {
@@ -1426,6 +1629,7 @@ func (s *Server) agentHeartbeatHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update agent"})
 		return
 	}
+	s.recordAgentStats(agent, now, payload)
 
 	c.JSON(http.StatusOK, gin.H{"message": "heartbeat received"})
 }
@@ -1487,7 +1691,7 @@ func (s *Server) createAgentCommandHandler(c *gin.Context) {
 		cmdPayload["image"] = strings.TrimSpace(payload.Image)
 	}
 
-	cmd, err := s.createAgentCommandInternal(agentID, payload.Type, cmdPayload)
+	cmd, err := s.createAgentCommandInternal(c.Request.Context(), agentID, payload.Type, cmdPayload)
 	if err != nil {
 		status := http.StatusBadRequest
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -1501,7 +1705,15 @@ func (s *Server) createAgentCommandHandler(c *gin.Context) {
 
 	if payload.Type == "update-container" {
 		if claims := getClaims(c); claims != nil {
-			_ = s.auditService.Record(claims.Subject, claims.Name, "update-agent-container", fmt.Sprintf("Requested update for agent container: %s (agent: %s)", payload.ContainerID, agentID), c.ClientIP())
+			_ = s.auditService.RecordEvent(audit.Event{
+				ActorID:    claims.Subject,
+				ActorName:  claims.Name,
+				Action:     "update-agent-container",
+				TargetType: "agent-container",
+				TargetID:   agentID + "/" + payload.ContainerID,
+				Details:    fmt.Sprintf("Requested update for agent container: %s (agent: %s)", payload.ContainerID, agentID),
+				IPAddress:  c.ClientIP(),
+			})
 		}
 	}
 
@@ -1591,6 +1803,16 @@ func (s *Server) agentCommandReportHandler(c *gin.Context) {
 	cmd.Error = payload.Error
 	cmd.CompletedAt = &now
 
+	log := logging.FromContext(c).With(logging.KeyAgentID, agent.ID, logging.KeyCommandID, cmd.ID, "command", cmd.Type)
+	if containerID, _ := cmd.Payload["containerId"].(string); containerID != "" {
+		log = log.With(logging.KeyContainerID, containerID)
+	}
+	if payload.Status == "error" {
+		log.Warn("agent command failed", "error", payload.Error)
+	} else {
+		log.Debug("agent command completed")
+	}
+
 	if payload.Status == "error" && cmd.Type == "check-update" {
 		containerID := ""
 		if v, ok := cmd.Payload["containerId"].(string); ok {
@@ -1624,7 +1846,18 @@ func (s *Server) agentCommandReportHandler(c *gin.Context) {
 					}
 				}
 			}
-			s.recordUpdateHistory(UpdateHistory{
+			event := ""
+			if cmd.Type == "rollback-container" && status == "success" {
+				event = notify.EventUpdateRollback
+			}
+			reason := snapshots.ReasonUpdate
+			if cmd.Type == "rollback-container" {
+				reason = snapshots.ReasonRollback
+				if _, ok := cmd.Payload["snapshotId"]; ok {
+					reason = snapshots.ReasonRestore
+				}
+			}
+			s.recordProvenanceEvent(UpdateHistory{
 				ContainerID:   containerID,
 				ContainerName: name,
 				Image:         image,
@@ -1633,7 +1866,16 @@ func (s *Server) agentCommandReportHandler(c *gin.Context) {
 				Source:        "agent",
 				Status:        status,
 				Message:       message,
-			})
+			}, provenanceFromResult(payload.Result), event, reason, commandDuration(*cmd))
+		}
+	}
+	if cmd.Type == "update-container" && s.approvalService != nil {
+		message := payload.Error
+		if payload.Status == "completed" && message == "" {
+			message = "Update completed"
+		}
+		if _, _, err := s.approvalService.Finish(cmd.ID, payload.Status == "completed", message); err != nil {
+			log.Warn("update approval: failed to close request", "error", err)
 		}
 	}
 
@@ -1677,7 +1919,15 @@ func (s *Server) toggleAgentContainerAutoUpdate(c *gin.Context) {
 		if !payload.Enabled {
 			action = "disable-agent-container-auto-update"
 		}
-		_ = s.auditService.Record(claims.Subject, claims.Name, action, fmt.Sprintf("Toggled auto-update for agent container: %s (agent: %s)", containerID, agentID), c.ClientIP())
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     action,
+			TargetType: "agent-container",
+			TargetID:   agentID + "/" + containerID,
+			Details:    fmt.Sprintf("Toggled auto-update for agent container: %s (agent: %s)", containerID, agentID),
+			IPAddress:  c.ClientIP(),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "auto-update preference saved"})
@@ -1686,6 +1936,7 @@ func (s *Server) toggleAgentContainerAutoUpdate(c *gin.Context) {
 func (s *Server) applyCommandResult(agent *Agent, cmd AgentCommand, res JSONMap) error {
 	silentDB := s.db.Session(&gorm.Session{Logger: logger.Discard})
 	updated := false
+	var newlyAvailable *ContainerSnapshot
 
 	switch cmd.Type {
 	case "check-update":
@@ -1694,10 +1945,18 @@ func (s *Server) applyCommandResult(agent *Agent, cmd AgentCommand, res JSONMap)
 			return errors.New("missing containerId in result")
 		}
 		updateAvailable, _ := res["updateAvailable"].(bool)
+		availableDigest := ""
+		if updateAvailable {
+			availableDigest, _ = res["availableDigest"].(string)
+		}
 		now := time.Now()
 		for i, cont := range agent.Containers {
 			if cont.ID == containerID {
+				if updateAvailable && !cont.UpdateAvailable {
+					newlyAvailable = &agent.Containers[i]
+				}
 				agent.Containers[i].UpdateAvailable = updateAvailable
+				agent.Containers[i].AvailableDigest = availableDigest
 				agent.Containers[i].CheckedAt = &now
 				updated = true
 				break
@@ -1707,6 +1966,7 @@ func (s *Server) applyCommandResult(agent *Agent, cmd AgentCommand, res JSONMap)
 			agent.Containers = append(agent.Containers, ContainerSnapshot{
 				ID:              containerID,
 				UpdateAvailable: updateAvailable,
+				AvailableDigest: availableDigest,
 				CheckedAt:       &now,
 			})
 		}
@@ -1725,6 +1985,15 @@ func (s *Server) applyCommandResult(agent *Agent, cmd AgentCommand, res JSONMap)
 			return fmt.Errorf("failed to update agent containers: %w", err)
 		}
 	}
+	if newlyAvailable != nil && cmd.Payload["source"] != digestCheckSource {
+		ag, cont := *agent, *newlyAvailable
+		go s.notifyUpdateAvailable(&ag, cont.ID, cont.Name, cont.Image)
+	}
+	if cmd.Type == "check-update" {
+		containerID, _ := res["containerId"].(string)
+		updateAvailable, _ := res["updateAvailable"].(bool)
+		s.applyApprovalCheck(*agent, containerID, updateAvailable)
+	}
 	return nil
 }
 
@@ -1745,6 +2014,7 @@ func (s *Server) applyContainerSnapshotResult(agent *Agent, res JSONMap, payload
 			if cont.ID == containerID {
 				copy := cont
 				copy.UpdateAvailable = false
+				copy.AvailableDigest = ""
 				copy.CheckedAt = &now
 				snapshot = &copy
 				break
@@ -1774,6 +2044,7 @@ func (s *Server) applyContainerSnapshotResult(agent *Agent, res JSONMap, payload
 				agent.Containers[i] = *snapshot
 			} else {
 				agent.Containers[i].UpdateAvailable = false
+				agent.Containers[i].AvailableDigest = ""
 				agent.Containers[i].CheckedAt = &now
 			}
 			replaced = true
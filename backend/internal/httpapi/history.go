@@ -1,23 +1,205 @@
 package httpapi
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/containers"
+	"updockly/backend/internal/history"
+	"updockly/backend/internal/metrics"
+)
+
+const (
+	historyExportPageSize = 500
+	historyPruneInterval  = time.Hour
 )
 
+// historyQuery reads the shared filters of the list, counts and export endpoints.
+func historyQuery(c *gin.Context) (history.Query, error) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	q := history.Query{
+		Container: c.Query("container"),
+		Image:     c.Query("image"),
+		Agent:     c.Query("agent"),
+		Source:    c.Query("source"),
+		Status:    c.Query("status"),
+		Search:    c.Query("q"),
+		Cursor:    c.Query("cursor"),
+		Limit:     limit,
+	}
+	from, err := parseAuditTime(c.Query("from"), false)
+	if err != nil {
+		return q, fmt.Errorf("invalid from: %w", err)
+	}
+	to, err := parseAuditTime(c.Query("to"), true)
+	if err != nil {
+		return q, fmt.Errorf("invalid to: %w", err)
+	}
+	q.From, q.To = from, to
+	return q, nil
+}
+
+func respondHistoryError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, history.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err.Error() == "database not ready":
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+	default:
+		respondInternal(c, msg, wrapErr(msg, err))
+	}
+}
+
 func (s *Server) listUpdateHistory(c *gin.Context) {
-	rows, err := s.historyService.List(c.Query("limit"))
+	q, err := historyQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, next, err := s.historyService.Search(q)
+	if err != nil {
+		respondHistoryError(c, "failed to load history", err)
+		return
+	}
+	// Like the audit log, the body stays a plain array and the next page cursor is sent
+	// in X-Next-Cursor.
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+func (s *Server) countUpdateHistory(c *gin.Context) {
+	q, err := historyQuery(c)
 	if err != nil {
-		if err.Error() == "database not ready" {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	counts, err := s.historyService.Count(q)
+	if err != nil {
+		respondHistoryError(c, "failed to count history", err)
+		return
+	}
+	c.JSON(http.StatusOK, counts)
+}
+
+func (s *Server) exportUpdateHistory(c *gin.Context) {
+	q, err := historyQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q.Limit = historyExportPageSize
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+	// Check the cursor before the headers are sent.
+	if _, _, err := s.historyService.Search(history.Query{Cursor: q.Cursor, Limit: 1}); err != nil {
+		respondHistoryError(c, "failed to export history", err)
+		return
+	}
+
+	filename := fmt.Sprintf("update-history-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		_ = w.Write([]string{"id", "createdAt", "containerId", "containerName", "image", "imageDigest", "previousDigest", "agentId", "agentName", "source", "status", "message"})
+		err = s.historyService.Each(q, func(entry UpdateHistory) error {
+			return w.Write(csvRow(
+				entry.ID,
+				entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+				entry.ContainerID, entry.ContainerName, entry.Image, entry.ImageDigest, entry.PreviousDigest,
+				entry.AgentID, entry.AgentName, entry.Source, entry.Status, entry.Message,
+			))
+		})
+		w.Flush()
+	} else {
+		c.Header("Content-Type", "application/json")
+		enc := json.NewEncoder(c.Writer)
+		first := true
+		_, _ = c.Writer.WriteString("[")
+		err = s.historyService.Each(q, func(entry UpdateHistory) error {
+			if !first {
+				if _, err := c.Writer.WriteString(","); err != nil {
+					return err
+				}
+			}
+			first = false
+			return enc.Encode(entry)
+		})
+		_, _ = c.Writer.WriteString("]")
+	}
+	if err != nil {
+		// Headers are already sent; the truncated body is all we can signal.
+		s.log.Error("history export failed", "error", err)
+	}
+}
+
+// pruneUpdateHistory removes entries older than olderThanDays, or older than the
+// configured retention when it is left out.
+func (s *Server) pruneUpdateHistory(c *gin.Context) {
+	days := s.cfg.HistoryRetentionDays
+	if raw := c.Query("olderThanDays"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "olderThanDays must be a positive number"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load history"})
+		days = parsed
+	}
+	if days < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "olderThanDays is required when no history retention is configured"})
 		return
 	}
-	c.JSON(http.StatusOK, rows)
+
+	removed, err := s.historyService.Prune(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		respondHistoryError(c, "failed to prune history", err)
+		return
+	}
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "prune-history",
+			TargetType: "history",
+			Details:    fmt.Sprintf("Removed %d history entries older than %d days", removed, days),
+			IPAddress:  c.ClientIP(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
+
+// maybePruneHistory applies the history retention at most once per interval.
+func (s *Server) maybePruneHistory() {
+	days := s.cfg.HistoryRetentionDays
+	if days < 1 || time.Since(s.lastHistoryPrune) < historyPruneInterval {
+		return
+	}
+	s.lastHistoryPrune = time.Now()
+	removed, err := s.historyService.Prune(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		s.log.Warn("history prune failed", "error", err)
+		return
+	}
+	if removed > 0 {
+		s.log.Info("pruned update history", "removed", removed, "retentionDays", days)
+	}
 }
 
 func (s *Server) deleteUpdateHistory(c *gin.Context) {
@@ -41,9 +223,137 @@ func (s *Server) deleteUpdateHistory(c *gin.Context) {
 }
 
 func (s *Server) recordUpdateHistory(entry UpdateHistory) {
+	s.recordUpdateHistoryEvent(entry, "")
+}
+
+// recordUpdateHistoryEvent records entry and notifies about it as event, or as the
+// event derived from its status when event is empty. It returns the recorded entry,
+// which has no ID when recording failed.
+func (s *Server) recordUpdateHistoryEvent(entry UpdateHistory, event string) UpdateHistory {
 	recorded, err := s.historyService.Record(entry)
 	if err != nil {
-		return
+		return UpdateHistory{}
+	}
+	go s.sendImmediateNotification(recorded, event)
+	return recorded
+}
+
+// recordProvenanceEvent records an update, rollback or restore with what it replaced,
+// and counts it in the metrics; took is zero when the duration is not known. On
+// success, the config before and after are recorded as config snapshots too.
+func (s *Server) recordProvenanceEvent(entry UpdateHistory, prov containers.Provenance, event, reason string, took time.Duration) {
+	recorded := s.recordUpdateHistoryEvent(withProvenance(entry, prov), event)
+	metrics.ObserveUpdate(entry.Source, reason, updateOutcome(entry.Status), took)
+	if entry.Status == "success" {
+		s.recordConfigSnapshots(entry, recorded.ID, prov, reason)
+	}
+}
+
+// updateOutcome maps a history status to a metrics outcome. Failed updates that
+// restored the previous container are recorded as warnings.
+func updateOutcome(status string) string {
+	switch status {
+	case "success":
+		return metrics.OutcomeSuccess
+	case "warning":
+		return metrics.OutcomeRolledBack
+	default:
+		return metrics.OutcomeFailed
+	}
+}
+
+// withProvenance adds the images and config snapshot of an update to its history entry.
+// ImageDigest keeps the image ID for images without a repo digest.
+func withProvenance(entry UpdateHistory, prov containers.Provenance) UpdateHistory {
+	entry.ImageDigest = prov.NewDigest
+	if entry.ImageDigest == "" {
+		entry.ImageDigest = prov.NewImageID
+	}
+	entry.PreviousImageID = prov.PreviousImageID
+	entry.PreviousDigest = prov.PreviousDigest
+	entry.NewImageID = prov.NewImageID
+	entry.ConfigSnapshot = prov.Config
+	return entry
+}
+
+// provenanceFromResult reads the provenance an agent reports with an update or rollback.
+func provenanceFromResult(res JSONMap) containers.Provenance {
+	var prov containers.Provenance
+	if res == nil {
+		return prov
+	}
+	str := func(key string) string {
+		v, _ := res[key].(string)
+		return strings.TrimSpace(v)
+	}
+	prov.PreviousImageID = str("previousImageId")
+	prov.PreviousDigest = str("previousDigest")
+	prov.NewImageID = str("newImageId")
+	prov.NewDigest = str("newDigest")
+	config := func(key string) []byte {
+		if cfg, ok := res[key].(map[string]interface{}); ok {
+			if raw, err := json.Marshal(cfg); err == nil {
+				return raw
+			}
+		}
+		return nil
+	}
+	prov.Config = config("config")
+	prov.NewConfig = config("newConfig")
+	return prov
+}
+
+// errRollbackEntryMismatch rejects a rollback with a history entry of another container,
+// whose config snapshot holds that container's environment.
+var errRollbackEntryMismatch = errors.New("history entry does not belong to this container")
+
+// rollbackTarget resolves the image and config snapshot of a rollback. The history entry
+// must be one of the container being rolled back: agentID is empty for local containers
+// and refs are the IDs or names the container is known by. With an entry that recorded
+// provenance, an empty image or the entry's own rollback image rolls back to the pinned
+// previous image with the config from before the update.
+func (s *Server) rollbackTarget(agentID string, refs []string, image, historyID string) (string, []byte, error) {
+	image = strings.TrimSpace(image)
+	historyID = strings.TrimSpace(historyID)
+	if historyID == "" || s.historyService == nil {
+		return image, nil, nil
+	}
+	entry, err := s.historyService.Get(historyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, errors.New("history entry not found")
+		}
+		return "", nil, err
+	}
+	if !historyMatchesContainer(entry, agentID, refs) {
+		return "", nil, errRollbackEntryMismatch
+	}
+	pinned := entry.RollbackImage()
+	if pinned == "" || (image != "" && image != pinned) {
+		return image, nil, nil
+	}
+	return pinned, entry.ConfigSnapshot, nil
+}
+
+// historyMatchesContainer reports whether entry was recorded for the container on agentID
+// that is known by one of refs. IDs match by prefix so short IDs are accepted.
+func historyMatchesContainer(entry UpdateHistory, agentID string, refs []string) bool {
+	if entry.AgentID != agentID {
+		return false
+	}
+	name := strings.TrimPrefix(entry.ContainerName, "/")
+	for _, ref := range refs {
+		ref = strings.TrimPrefix(strings.TrimSpace(ref), "/")
+		if ref == "" {
+			continue
+		}
+		if ref == name || ref == entry.ContainerID {
+			return true
+		}
+		if len(ref) >= 12 && entry.ContainerID != "" && len(entry.ContainerID) >= 12 &&
+			(strings.HasPrefix(entry.ContainerID, ref) || strings.HasPrefix(ref, entry.ContainerID)) {
+			return true
+		}
 	}
-	go s.sendImmediateNotification(recorded)
+	return false
 }
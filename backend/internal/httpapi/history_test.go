@@ -0,0 +1,185 @@
+package httpapi
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/agents"
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/history"
+)
+
+func TestAgentRollbackPinsPreviousImage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.AgentCommand{}, &domain.UpdateHistory{}, &domain.AuditLog{}, &domain.AuditChainHead{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := &Server{db: db, agentService: agents.NewAgentService(db, false), historyService: history.NewService(db),
+		auditService: audit.NewService(db)}
+	now := time.Now()
+	if err := db.Create(&Agent{ID: "a1", Name: "prod-1", LastSeen: &now}).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+
+	// The agent reports what the update replaced.
+	prov := provenanceFromResult(JSONMap{
+		"previousImageId": "sha256:old",
+		"previousDigest":  "nginx@sha256:old",
+		"newImageId":      "sha256:new",
+		"newDigest":       "nginx@sha256:new",
+		"config": map[string]interface{}{
+			"name":       "web",
+			"config":     map[string]interface{}{"Image": "nginx:1.27", "Env": []interface{}{"MODE=old"}},
+			"hostConfig": map[string]interface{}{"RestartPolicy": map[string]interface{}{"Name": "always"}},
+		},
+	})
+	entry, err := srv.historyService.Record(withProvenance(UpdateHistory{
+		ContainerID: "c1", ContainerName: "web", Image: "nginx:1.27", AgentID: "a1", Source: "agent", Status: "success",
+	}, prov))
+	if err != nil {
+		t.Fatalf("record history: %v", err)
+	}
+	if entry.ImageDigest != "nginx@sha256:new" || entry.RollbackImage() != "nginx@sha256:old" {
+		t.Fatalf("unexpected history entry %+v", entry)
+	}
+
+	rollbackOn := func(agentID, containerID, body string) (*httptest.ResponseRecorder, JSONMap) {
+		rec := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rec)
+		c.Params = gin.Params{{Key: "id", Value: agentID}, {Key: "containerId", Value: containerID}}
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		srv.rollbackAgentContainerHandler(c)
+		var cmd AgentCommand
+		db.Order("created_at DESC").First(&cmd)
+		db.Delete(&cmd)
+		return rec, cmd.Payload
+	}
+	rollback := func(body string) (*httptest.ResponseRecorder, JSONMap) {
+		return rollbackOn("a1", "c1", body)
+	}
+
+	// Without an image the rollback is pinned to the previous digest and config.
+	rec, payload := rollback(`{"historyId":"` + entry.ID + `"}`)
+	if rec.Code != http.StatusOK || payload["image"] != "nginx@sha256:old" || payload["name"] != "web" {
+		t.Fatalf("expected a pinned rollback, got %d %v", rec.Code, payload)
+	}
+	if cfg, ok := payload["config"].(map[string]interface{}); !ok || cfg["hostConfig"] == nil {
+		t.Fatalf("expected the config snapshot in the command, got %v", payload["config"])
+	}
+
+	// Another image rolls back with the current config.
+	rec, payload = rollback(`{"image":"nginx:1.26","historyId":"` + entry.ID + `"}`)
+	if rec.Code != http.StatusOK || payload["image"] != "nginx:1.26" || payload["config"] != nil {
+		t.Fatalf("expected a rollback to the given image, got %d %v", rec.Code, payload)
+	}
+
+	if rec, _ := rollback(`{}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a rollback without image or history to be refused, got %d", rec.Code)
+	}
+
+	// The entry's config must not be applied to another container or sent to another agent.
+	if err := db.Create(&Agent{ID: "a2", Name: "prod-2", LastSeen: &now}).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+	for _, target := range [][2]string{{"a1", "db"}, {"a2", "c1"}, {"a2", "web"}} {
+		rec, payload := rollbackOn(target[0], target[1], `{"historyId":"`+entry.ID+`"}`)
+		if rec.Code != http.StatusBadRequest || payload != nil {
+			t.Fatalf("expected a rollback of %s/%s with another container's entry to be refused, got %d %v", target[0], target[1], rec.Code, payload)
+		}
+	}
+	// The entry still applies to the container by name once its ID has been replaced.
+	if rec, payload := rollbackOn("a1", "web", `{"historyId":"`+entry.ID+`"}`); rec.Code != http.StatusOK || payload["image"] != "nginx@sha256:old" {
+		t.Fatalf("expected a rollback by name, got %d %v", rec.Code, payload)
+	}
+}
+
+func TestHistoryFiltersCountsAndExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.UpdateHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := &Server{db: db, historyService: history.NewService(db)}
+	now := time.Now()
+	for i, status := range []string{"success", "error", "success"} {
+		if _, err := srv.historyService.Record(UpdateHistory{ContainerName: "web", Image: "nginx:1.28", Source: "auto", Status: status,
+			Message: "Update " + status, CreatedAt: now.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+	}
+
+	router := gin.New()
+	router.GET("/history", srv.listUpdateHistory)
+	router.GET("/history/counts", srv.countUpdateHistory)
+	router.GET("/history/export", srv.exportUpdateHistory)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/history?container=web&status=success&limit=1")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Next-Cursor") == "" {
+		t.Fatalf("expected a first page with a cursor, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = get("/history?container=web&status=success&limit=1&cursor=" + rec.Header().Get("X-Next-Cursor"))
+	if rec.Header().Get("X-Next-Cursor") != "" || !strings.Contains(rec.Body.String(), "Update success") {
+		t.Fatalf("expected the last page, got %s", rec.Body.String())
+	}
+	if rec := get("/history?cursor=missing"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown cursor to be refused, got %d", rec.Code)
+	}
+	if rec := get("/history?from=yesterday"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid date to be refused, got %d", rec.Code)
+	}
+
+	rec = get("/history/counts?q=update")
+	if !strings.Contains(rec.Body.String(), `"total":3`) || !strings.Contains(rec.Body.String(), `"error":1`) {
+		t.Fatalf("unexpected counts %s", rec.Body.String())
+	}
+
+	rec = get("/history/export?format=csv&status=error")
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" || len(lines) != 2 || !strings.Contains(lines[1], "Update error") {
+		t.Fatalf("unexpected csv export %q", rec.Body.String())
+	}
+	rec = get("/history/export")
+	if !strings.HasPrefix(rec.Body.String(), "[") || strings.Count(rec.Body.String(), `"containerName":"web"`) != 3 {
+		t.Fatalf("unexpected json export %s", rec.Body.String())
+	}
+
+	// Cells a spreadsheet would run as a formula are exported as text.
+	if _, err := srv.historyService.Record(UpdateHistory{ContainerName: "job", Image: "+cmd|' /C calc'!A0", Source: "auto", Status: "error",
+		Message: "@SUM(1+1)", CreatedAt: now}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	rows, err := csv.NewReader(get("/history/export?format=csv&container=job").Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(rows) != 2 || rows[1][4] != "'+cmd|' /C calc'!A0" || rows[1][11] != "'@SUM(1+1)" {
+		t.Fatalf("expected the formulas to be escaped, got %v", rows)
+	}
+}
@@ -3,18 +3,19 @@ package httpapi
 import (
 	"log/slog"
 	"testing"
-	"time"
+
+	"updockly/backend/internal/throttle"
 )
 
 func TestLoginThrottleBlocksAfterFailures(t *testing.T) {
 	s := &Server{
-		loginAttempts: make(map[string]loginAttempt),
-		log:           slog.Default(),
+		loginLimiter: throttle.NewMemoryLimiter(throttle.DefaultPolicy()),
+		log:          slog.Default(),
 	}
 
-	key := "user|ip"
+	key := s.loginKey("user", "ip")
 	for i := 0; i < 5; i++ {
-		s.recordLoginFailure(key)
+		s.recordLoginFailure(nil, key, "user")
 	}
 	delay, blocked := s.isLoginBlocked(key)
 	if !blocked {
@@ -25,19 +26,46 @@ func TestLoginThrottleBlocksAfterFailures(t *testing.T) {
 	}
 }
 
-func TestLoginThrottleResetsAfterIdle(t *testing.T) {
+func TestLoginThrottleScopesAreIndependent(t *testing.T) {
 	s := &Server{
-		loginAttempts: make(map[string]loginAttempt),
-		log:           slog.Default(),
+		loginLimiter: throttle.NewMemoryLimiter(throttle.DefaultPolicy()),
+		resetLimiter: throttle.NewMemoryLimiter(throttle.RequestPolicy()),
+		log:          slog.Default(),
+	}
+
+	for i := 0; i < 5; i++ {
+		s.countResetRequest(throttleKey(throttleScopeForgotPassword, "User@example.com", "ip"))
+	}
+	retryAfter, blocked := s.isBlocked(s.resetLimiter, throttleKey(throttleScopeForgotPassword, "user@example.com", "ip"))
+	if !blocked {
+		t.Fatal("expected forgot-password key to be blocked regardless of case")
+	}
+	if _, blocked := s.isLoginBlocked(s.loginKey("user@example.com", "ip")); blocked {
+		t.Fatal("expected login scope to be unaffected")
+	}
+	if states, _ := s.loginLimiter.List(); len(states) != 0 {
+		t.Fatalf("expected reset requests not to count as login failures, got %+v", states)
 	}
-	key := "user|ip"
-	past := time.Now().Add(-31 * time.Minute)
-	s.loginAttempts[key] = loginAttempt{count: 4, lastAttempt: past}
 
-	if delay, blocked := s.isLoginBlocked(key); blocked {
-		t.Fatalf("expected not blocked, got delay %v", delay)
+	// Reset requests are rate-limited, not punished: the wait does not grow.
+	if retryAfter > throttle.RequestPolicy().MaxLockout {
+		t.Fatalf("expected at most %v, got %v", throttle.RequestPolicy().MaxLockout, retryAfter)
+	}
+}
+
+func TestLoginThrottleUnlock(t *testing.T) {
+	s := &Server{
+		loginLimiter: throttle.NewMemoryLimiter(throttle.DefaultPolicy()),
+		log:          slog.Default(),
+	}
+	key := s.loginKey("user", "ip")
+	for i := 0; i < 5; i++ {
+		s.recordLoginFailure(nil, key, "user")
+	}
+	if err := s.loginLimiter.Unlock(key); err != nil {
+		t.Fatalf("unlock: %v", err)
 	}
-	if _, ok := s.loginAttempts[key]; ok {
-		t.Fatal("expected stale login attempt to be cleared")
+	if _, blocked := s.isLoginBlocked(key); blocked {
+		t.Fatal("expected key to be unlocked")
 	}
 }
@@ -1,9 +1,20 @@
 package httpapi
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"updockly/backend/internal/metrics"
+)
+
+const (
+	runningSampleTimeout = 20 * time.Second
+	defaultRunningRange  = 24 * time.Hour
 )
 
 func (s *Server) runningHistoryHandler(c *gin.Context) {
@@ -14,3 +25,97 @@ func (s *Server) runningHistoryHandler(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, rows)
 }
+
+// runningRange reads the from and to query values, defaulting to the last day.
+func runningRange(c *gin.Context) (time.Time, time.Time, error) {
+	from, err := parseAuditTime(c.Query("from"), false)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %w", err)
+	}
+	to, err := parseAuditTime(c.Query("to"), true)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %w", err)
+	}
+	if to == nil {
+		now := time.Now()
+		to = &now
+	}
+	if from == nil {
+		start := to.Add(-defaultRunningRange)
+		from = &start
+	}
+	if !from.Before(*to) {
+		return time.Time{}, time.Time{}, errors.New("from must be before to")
+	}
+	return *from, *to, nil
+}
+
+// runningSeriesHandler returns running container counts between from and to rolled
+// up by hour, day or week, for all hosts together or per host with byHost.
+func (s *Server) runningSeriesHandler(c *gin.Context) {
+	from, to, err := runningRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rollup, err := metrics.ParseRollup(c.Query("rollup"), from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	points, err := s.metricsService.RunningSeries(metrics.SeriesQuery{
+		From:   from,
+		To:     to,
+		Rollup: rollup,
+		Host:   c.Query("host"),
+		ByHost: c.Query("byHost") == "true",
+	})
+	if err != nil {
+		respondInternal(c, "failed to load running history", wrapErr("load running series", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rollup": rollup, "points": points})
+}
+
+// containerUptimeHandler returns the availability of containers between from and to.
+func (s *Server) containerUptimeHandler(c *gin.Context) {
+	from, to, err := runningRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := s.metricsService.Uptime(metrics.UptimeQuery{
+		From:      from,
+		To:        to,
+		Host:      c.Query("host"),
+		Container: c.Query("container"),
+	})
+	if err != nil {
+		respondInternal(c, "failed to load uptime", wrapErr("load container uptime", err))
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// maybeSampleRunning takes a running history sample at most once per interval and
+// applies its retention.
+func (s *Server) maybeSampleRunning() {
+	if s.metricsService == nil || s.db == nil || time.Since(s.lastRunningSample) < metrics.SampleInterval {
+		return
+	}
+	now := time.Now()
+	s.lastRunningSample = now
+	ctx, cancel := context.WithTimeout(context.Background(), runningSampleTimeout)
+	defer cancel()
+	if err := s.metricsService.Sample(ctx, now); err != nil {
+		s.log.Warn("running history sample failed", "error", err)
+		return
+	}
+	if s.cfg.RunningHistoryDays < 1 {
+		return
+	}
+	cutoff := now.AddDate(0, 0, -s.cfg.RunningHistoryDays)
+	if _, err := s.metricsService.PruneRunning(cutoff); err != nil {
+		s.log.Warn("running history prune failed", "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/metrics"
+)
+
+func TestRunningSamplerAndUptime(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.RunningSnapshot{}, &domain.RunningSample{}, &domain.ContainerStateSpan{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := &Server{db: db, metricsService: metrics.NewService(db, time.UTC), cfg: config.Config{RunningHistoryDays: 90}}
+	seen := time.Now()
+	if err := db.Create(&Agent{ID: "a1", Name: "edge", LastSeen: &seen, Containers: domain.ContainerSnapshotList{
+		{ID: "c1", Name: "web", State: "running"},
+		{ID: "c2", Name: "db", State: "exited"},
+	}}).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+
+	srv.maybeSampleRunning()
+	srv.maybeSampleRunning()
+
+	router := gin.New()
+	router.GET("/metrics/running", srv.runningSeriesHandler)
+	router.GET("/metrics/uptime", srv.containerUptimeHandler)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/metrics/running?host=a1&byHost=true&rollup=day")
+	var series struct {
+		Rollup string                `json:"rollup"`
+		Points []metrics.RollupPoint `json:"points"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &series); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+	if series.Rollup != "day" || len(series.Points) != 1 {
+		t.Fatalf("expected one daily point for the agent, got %s", rec.Body.String())
+	}
+	if p := series.Points[0]; p.Host != "edge" || p.Running != 1 || p.Total != 2 || p.Samples != 1 {
+		t.Fatalf("expected a single sample from the sampler, got %+v", p)
+	}
+	var snapshots int64
+	db.Model(&domain.RunningSnapshot{}).Count(&snapshots)
+	if snapshots != 1 {
+		t.Fatalf("expected the sampler to keep the daily snapshot, got %d", snapshots)
+	}
+
+	if rec := get("/metrics/running?rollup=minute"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown rollup to be refused, got %d", rec.Code)
+	}
+
+	start := time.Now().Add(-2 * time.Hour).UTC()
+	if err := db.Create(&[]domain.ContainerStateSpan{
+		{AgentID: "a1", ContainerName: "api", Running: true, StartedAt: start, EndedAt: start.Add(45 * time.Minute)},
+		{AgentID: "a1", ContainerName: "api", Running: false, StartedAt: start.Add(45 * time.Minute), EndedAt: start.Add(time.Hour)},
+	}).Error; err != nil {
+		t.Fatalf("seed spans: %v", err)
+	}
+	rec = get("/metrics/uptime?container=api&from=" + start.Format(time.RFC3339))
+	var uptime []metrics.ContainerUptime
+	if err := json.Unmarshal(rec.Body.Bytes(), &uptime); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+	if len(uptime) != 1 || uptime[0].Host != "edge" || uptime[0].Availability != 75 {
+		t.Fatalf("expected 75%% availability, got %s", rec.Body.String())
+	}
+}
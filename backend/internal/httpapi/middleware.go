@@ -21,6 +21,11 @@ func (s *Server) csrfMiddleware() gin.HandlerFunc {
 			c.Next()
 			return
 		}
+		// Signed approval links authenticate the decision themselves
+		if isApprovalDecisionPath(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
 
 		// 1. Ensure CSRF cookie exists
 		token, err := c.Cookie(csrfCookieName)
@@ -42,6 +47,10 @@ func (s *Server) csrfMiddleware() gin.HandlerFunc {
 	}
 }
 
+func isApprovalDecisionPath(path string) bool {
+	return strings.HasPrefix(path, "/api/update-approvals/") && strings.HasSuffix(path, "/decision")
+}
+
 func setCsrfCookie(c *gin.Context, token, clientOrigin string) {
 	secure := false
 	if origin := strings.Split(strings.TrimSpace(clientOrigin), ",")[0]; strings.HasPrefix(strings.ToLower(origin), "https://") {
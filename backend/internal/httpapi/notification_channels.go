@@ -0,0 +1,187 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/notify"
+)
+
+type notificationChannelPayload struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Enabled *bool             `json:"enabled"`
+	Events  []string          `json:"events"`
+	Config  map[string]string `json:"config"`
+}
+
+func (p notificationChannelPayload) channel() domain.NotificationChannel {
+	enabled := true
+	if p.Enabled != nil {
+		enabled = *p.Enabled
+	}
+	return domain.NotificationChannel{
+		Name:    p.Name,
+		Type:    p.Type,
+		Enabled: enabled,
+		Events:  domain.StringList(p.Events),
+		Config:  domain.StringMap(p.Config),
+	}
+}
+
+// respondChannelError maps notify service errors to HTTP statuses.
+func respondChannelError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, notify.ErrInvalidChannel):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification channel not found"})
+	case err.Error() == "database not ready":
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+	default:
+		respondInternal(c, "failed to "+action+" notification channel", wrapErr(action+" notification channel", err))
+	}
+}
+
+func (s *Server) listNotificationChannelTypesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"types": notify.Types(), "events": notify.Events})
+}
+
+func (s *Server) listNotificationChannelsHandler(c *gin.Context) {
+	channels, err := s.notifyService.List()
+	if err != nil {
+		respondChannelError(c, "list", err)
+		return
+	}
+	out := make([]domain.NotificationChannel, 0, len(channels))
+	for _, ch := range channels {
+		out = append(out, notify.Redact(ch))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (s *Server) createNotificationChannelHandler(c *gin.Context) {
+	var payload notificationChannelPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	ch, err := s.notifyService.Create(payload.channel())
+	if err != nil {
+		respondChannelError(c, "create", err)
+		return
+	}
+	redacted := notify.Redact(*ch)
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "create-notification-channel",
+			TargetType: "notification-channel",
+			TargetID:   ch.ID,
+			Details:    fmt.Sprintf("Created %s notification channel: %s", ch.Type, ch.Name),
+			After:      redacted,
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, redacted)
+}
+
+func (s *Server) updateNotificationChannelHandler(c *gin.Context) {
+	var payload notificationChannelPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	existing, err := s.notifyService.Get(c.Param("id"))
+	if err != nil {
+		respondChannelError(c, "update", err)
+		return
+	}
+	ch, err := s.notifyService.Update(existing.ID, payload.channel())
+	if err != nil {
+		respondChannelError(c, "update", err)
+		return
+	}
+	redacted := notify.Redact(*ch)
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "update-notification-channel",
+			TargetType: "notification-channel",
+			TargetID:   ch.ID,
+			Details:    fmt.Sprintf("Updated notification channel: %s", ch.Name),
+			Before:     notify.Redact(*existing),
+			After:      redacted,
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.JSON(http.StatusOK, redacted)
+}
+
+func (s *Server) deleteNotificationChannelHandler(c *gin.Context) {
+	id := c.Param("id")
+	existing, err := s.notifyService.Get(id)
+	if err != nil {
+		respondChannelError(c, "delete", err)
+		return
+	}
+	if err := s.notifyService.Delete(id); err != nil {
+		respondChannelError(c, "delete", err)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "delete-notification-channel",
+			TargetType: "notification-channel",
+			TargetID:   id,
+			Details:    fmt.Sprintf("Deleted notification channel: %s", existing.Name),
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) testNotificationChannelHandler(c *gin.Context) {
+	ch, err := s.notifyService.Get(c.Param("id"))
+	if err != nil {
+		respondChannelError(c, "test", err)
+		return
+	}
+	n, err := s.notifyService.Notifier(*ch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+	err = n.Send(ctx, notify.Message{
+		Event: notify.EventTest,
+		Title: "Updockly test notification",
+		Body:  fmt.Sprintf("Channel %q is configured correctly.", ch.Name),
+		Time:  time.Now(),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "test notification sent"})
+}
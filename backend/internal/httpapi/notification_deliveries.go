@@ -0,0 +1,99 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/notify"
+)
+
+func respondDeliveryError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, notify.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, notify.ErrNotResendable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification delivery not found"})
+	case err.Error() == "database not ready":
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+	default:
+		respondInternal(c, "failed to "+action+" notification delivery", wrapErr(action+" notification delivery", err))
+	}
+}
+
+func deliveryID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid delivery id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// listNotificationDeliveriesHandler returns the delivery log, newest first. Like the
+// audit log, the next page cursor is sent in X-Next-Cursor.
+func (s *Server) listNotificationDeliveriesHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	deliveries, next, err := s.notifyService.Deliveries(notify.DeliveryQuery{
+		Status: c.Query("status"),
+		Event:  c.Query("event"),
+		Target: c.Query("target"),
+		Cursor: c.Query("cursor"),
+		Limit:  limit,
+	})
+	if err != nil {
+		respondDeliveryError(c, "list", err)
+		return
+	}
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+func (s *Server) getNotificationDeliveryHandler(c *gin.Context) {
+	id, ok := deliveryID(c)
+	if !ok {
+		return
+	}
+	delivery, attempts, err := s.notifyService.Delivery(id)
+	if err != nil {
+		respondDeliveryError(c, "load", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delivery": delivery, "attempts": attempts})
+}
+
+func (s *Server) resendNotificationDeliveryHandler(c *gin.Context) {
+	id, ok := deliveryID(c)
+	if !ok {
+		return
+	}
+	delivery, err := s.notifyService.Resend(id)
+	if err != nil {
+		respondDeliveryError(c, "resend", err)
+		return
+	}
+	s.outbox.Wake()
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "resend-notification",
+			TargetType: "notification-delivery",
+			TargetID:   strconv.FormatUint(uint64(delivery.ID), 10),
+			Details:    fmt.Sprintf("Re-sent %s notification to %s", delivery.Event, delivery.TargetName),
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.JSON(http.StatusOK, delivery)
+}
@@ -0,0 +1,200 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/notify"
+)
+
+type notificationRulePayload struct {
+	Name        string   `json:"name"`
+	Priority    int      `json:"priority"`
+	Enabled     *bool    `json:"enabled"`
+	Events      []string `json:"events"`
+	MinSeverity string   `json:"minSeverity"`
+	Agents      []string `json:"agents"`
+	Containers  []string `json:"containers"`
+	Images      []string `json:"images"`
+	Labels      []string `json:"labels"`
+	Channels    []string `json:"channels"`
+	Stop        bool     `json:"stop"`
+}
+
+func (p notificationRulePayload) rule() domain.NotificationRule {
+	enabled := true
+	if p.Enabled != nil {
+		enabled = *p.Enabled
+	}
+	return domain.NotificationRule{
+		Name:        p.Name,
+		Priority:    p.Priority,
+		Enabled:     enabled,
+		Events:      domain.StringList(p.Events),
+		MinSeverity: p.MinSeverity,
+		Agents:      domain.StringList(p.Agents),
+		Containers:  domain.StringList(p.Containers),
+		Images:      domain.StringList(p.Images),
+		Labels:      domain.StringList(p.Labels),
+		Channels:    domain.StringList(p.Channels),
+		Stop:        p.Stop,
+	}
+}
+
+// notificationRuleSample is a hypothetical event for dry-running the rules.
+type notificationRuleSample struct {
+	Event     string            `json:"event"`
+	Severity  string            `json:"severity"`
+	Agent     string            `json:"agent"`
+	Container string            `json:"container"`
+	Image     string            `json:"image"`
+	Labels    map[string]string `json:"labels"`
+}
+
+func (p notificationRuleSample) message() notify.Message {
+	msg := notify.Message{Event: p.Event, Severity: p.Severity}
+	if p.Severity == "" {
+		msg.Severity = notify.DefaultSeverity(p.Event)
+	}
+	if p.Agent != "" && p.Agent != notify.LocalAgent {
+		msg.Agent = &notify.AgentInfo{ID: p.Agent, Name: p.Agent}
+	}
+	if p.Container != "" || p.Image != "" || len(p.Labels) > 0 {
+		msg.Container = &notify.ContainerInfo{Name: p.Container, Image: p.Image, Labels: p.Labels}
+	}
+	return msg
+}
+
+func respondRuleError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, notify.ErrInvalidRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification rule not found"})
+	case err.Error() == "database not ready":
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+	default:
+		respondInternal(c, "failed to "+action+" notification rule", wrapErr(action+" notification rule", err))
+	}
+}
+
+func (s *Server) listNotificationRulesHandler(c *gin.Context) {
+	rules, err := s.notifyService.ListRules()
+	if err != nil {
+		respondRuleError(c, "list", err)
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+func (s *Server) createNotificationRuleHandler(c *gin.Context) {
+	var payload notificationRulePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	rule, err := s.notifyService.CreateRule(payload.rule())
+	if err != nil {
+		respondRuleError(c, "create", err)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "create-notification-rule",
+			TargetType: "notification-rule",
+			TargetID:   rule.ID,
+			Details:    fmt.Sprintf("Created notification rule: %s", rule.Name),
+			After:      rule,
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (s *Server) updateNotificationRuleHandler(c *gin.Context) {
+	var payload notificationRulePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	existing, err := s.notifyService.GetRule(c.Param("id"))
+	if err != nil {
+		respondRuleError(c, "update", err)
+		return
+	}
+	rule, err := s.notifyService.UpdateRule(existing.ID, payload.rule())
+	if err != nil {
+		respondRuleError(c, "update", err)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "update-notification-rule",
+			TargetType: "notification-rule",
+			TargetID:   rule.ID,
+			Details:    fmt.Sprintf("Updated notification rule: %s", rule.Name),
+			Before:     existing,
+			After:      rule,
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (s *Server) deleteNotificationRuleHandler(c *gin.Context) {
+	id := c.Param("id")
+	existing, err := s.notifyService.GetRule(id)
+	if err != nil {
+		respondRuleError(c, "delete", err)
+		return
+	}
+	if err := s.notifyService.DeleteRule(id); err != nil {
+		respondRuleError(c, "delete", err)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "delete-notification-rule",
+			TargetType: "notification-rule",
+			TargetID:   id,
+			Details:    fmt.Sprintf("Deleted notification rule: %s", existing.Name),
+			Before:     existing,
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// evaluateNotificationRulesHandler reports where a sample event would be delivered
+// without sending anything.
+func (s *Server) evaluateNotificationRulesHandler(c *gin.Context) {
+	var payload notificationRuleSample
+	if err := c.ShouldBindJSON(&payload); err != nil || !notify.Subscribed(notify.Events, payload.Event) || payload.Event == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a known event is required"})
+		return
+	}
+	route, err := s.notifyService.Route(payload.message())
+	if err != nil {
+		respondRuleError(c, "evaluate", err)
+		return
+	}
+	c.JSON(http.StatusOK, route)
+}
@@ -0,0 +1,163 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/notify"
+)
+
+type notificationTemplatePayload struct {
+	Target string `json:"target"`
+	Event  string `json:"event"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	HTML   string `json:"html"`
+}
+
+func (p notificationTemplatePayload) template() domain.NotificationTemplate {
+	return domain.NotificationTemplate{Target: p.Target, Event: p.Event, Title: p.Title, Body: p.Body, HTML: p.HTML}
+}
+
+// notificationTemplatePreview renders a template against a history entry, or against
+// sample data for Event when HistoryID is empty.
+type notificationTemplatePreview struct {
+	notificationTemplatePayload
+	HistoryID string `json:"historyId"`
+}
+
+func respondTemplateError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, notify.ErrInvalidTemplate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "notification template not found"})
+	case err.Error() == "database not ready":
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+	default:
+		respondInternal(c, "failed to "+action+" notification template", wrapErr(action+" notification template", err))
+	}
+}
+
+func (s *Server) listNotificationTemplatesHandler(c *gin.Context) {
+	templates, err := s.notifyService.ListTemplates()
+	if err != nil {
+		respondTemplateError(c, "list", err)
+		return
+	}
+	c.JSON(http.StatusOK, templates)
+}
+
+func (s *Server) saveNotificationTemplateHandler(c *gin.Context) {
+	var payload notificationTemplatePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	tpl, err := s.notifyService.SaveTemplate(payload.template())
+	if err != nil {
+		respondTemplateError(c, "save", err)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		event := tpl.Event
+		if event == "" {
+			event = "all events"
+		}
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "save-notification-template",
+			TargetType: "notification-template",
+			TargetID:   tpl.ID,
+			Details:    fmt.Sprintf("Saved notification template for %s (%s)", tpl.Target, event),
+			After:      tpl,
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.JSON(http.StatusOK, tpl)
+}
+
+func (s *Server) deleteNotificationTemplateHandler(c *gin.Context) {
+	id := c.Param("id")
+	if err := s.notifyService.DeleteTemplate(id); err != nil {
+		respondTemplateError(c, "delete", err)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "delete-notification-template",
+			TargetType: "notification-template",
+			TargetID:   id,
+			Details:    "Deleted notification template",
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Server) previewNotificationTemplateHandler(c *gin.Context) {
+	var payload notificationTemplatePreview
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if payload.Event != "" && !notify.Subscribed(notify.Events, payload.Event) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event"})
+		return
+	}
+
+	var msg notify.Message
+	if id := strings.TrimSpace(payload.HistoryID); id != "" {
+		if s.db == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+			return
+		}
+		var entry UpdateHistory
+		if err := s.db.First(&entry, "id = ?", id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "history entry not found"})
+				return
+			}
+			respondInternal(c, "failed to load history entry", wrapErr("load history entry", err))
+			return
+		}
+		event := payload.Event
+		if event == "" {
+			// Entries without an event of their own preview as a success.
+			if event = historyEvent(entry); event == "" {
+				event = notify.EventUpdateSuccess
+			}
+		}
+		msg, _ = s.historyMessage(entry, event)
+		msg.Severity = notify.DefaultSeverity(event)
+	} else {
+		msg = notify.Sample(payload.Event)
+		msg.Links = s.notifyLinks("agent-1", "3f9c2a1b7d4e")
+	}
+
+	rendered, err := notify.Render(payload.template(), msg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"title": rendered.Title,
+		"body":  rendered.Body,
+		"html":  rendered.HTML,
+		"text":  rendered.Text(),
+	})
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+)
+
+func TestPreviewNotificationTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.UpdateHistory{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	entry := UpdateHistory{ContainerID: "c1", ContainerName: "api", Image: "ghcr.io/acme/api:2", ImageDigest: "sha256:abcdef0123456789", Source: "manual", Status: "error", Message: "pull failed"}
+	if err := db.Create(&entry).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	srv := &Server{db: db, cfg: config.Config{ClientOrigin: "https://updockly.example"}}
+
+	preview := func(body map[string]string) (int, map[string]string) {
+		t.Helper()
+		raw, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/notifications/templates/preview", bytes.NewReader(raw))
+		c.Request.Header.Set("Content-Type", "application/json")
+		srv.previewNotificationTemplateHandler(c)
+		var out map[string]string
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+
+	code, out := preview(map[string]string{
+		"historyId": entry.ID,
+		"title":     "{{.Event}}",
+		"body":      "{{.Container.Name}}@{{shortDigest .Container.NewDigest}}: {{.Details}} {{.Links.Container}}",
+	})
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %v", code, out)
+	}
+	if out["title"] != "update-failure" || out["body"] != "api@abcdef012345: pull failed https://updockly.example/?panel=containers&container=c1" {
+		t.Fatalf("unexpected preview %v", out)
+	}
+
+	code, out = preview(map[string]string{"event": "recap", "body": "{{.Recap.Total}}"})
+	if code != http.StatusOK || out["body"] != "2" {
+		t.Fatalf("unexpected sample preview %d %v", code, out)
+	}
+
+	if code, _ = preview(map[string]string{"event": "recap", "body": "{{.Container.Name}}"}); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a template that fails on the event, got %d", code)
+	}
+	if code, _ = preview(map[string]string{"historyId": "missing", "body": "x"}); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown history entry, got %d", code)
+	}
+}
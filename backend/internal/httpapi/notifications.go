@@ -1,25 +1,22 @@
 package httpapi
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"net/mail"
-	"net/smtp"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/notify"
 )
 
-type discordMessage struct {
-	Content string `json:"content"`
-}
+type discordMessage = notify.ContentMessage
 
 func (s *Server) testNotificationHandler(c *gin.Context) {
 	token := strings.TrimSpace(s.cfg.Notifications.DiscordToken)
@@ -75,91 +72,32 @@ func (s *Server) testEmailHandler(c *gin.Context) {
 }
 
 func (s *Server) sendEmail(to []string, subject, body string) error {
-	cfg := s.cfg.Notifications.SMTP
-	if cfg.Host == "" {
-		return errors.New("SMTP not configured")
-	}
-
-	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-
-	envelopeFrom := strings.TrimSpace(cfg.From)
-	headerFrom := envelopeFrom
-	if parsed, err := mail.ParseAddress(cfg.From); err == nil {
-		envelopeFrom = parsed.Address
-		headerFrom = parsed.String()
-	}
+	return s.sendEmailHTML(to, subject, body, "")
+}
 
-	// Setup authentication
-	var auth smtp.Auth
-	if cfg.User != "" && cfg.Password != "" {
-		auth = smtp.PlainAuth("", cfg.User, cfg.Password, cfg.Host)
-	}
+// sendEmailHTML sends a multipart/alternative email when htmlBody is set.
+func (s *Server) sendEmailHTML(to []string, subject, body, htmlBody string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return s.smtpServer().Send(ctx, notify.Mail{To: to, Subject: subject, Text: body, HTML: htmlBody})
+}
 
-	headerTo := make([]string, 0, len(to))
-	rcptList := make([]string, 0, len(to))
-	for _, r := range to {
-		r = strings.TrimSpace(r)
-		if parsed, err := mail.ParseAddress(r); err == nil {
-			headerTo = append(headerTo, parsed.String())
-			rcptList = append(rcptList, parsed.Address)
-		} else if r != "" {
-			headerTo = append(headerTo, r)
-			rcptList = append(rcptList, r)
-		}
+// smtpServer is the mail server from the SMTP settings; the legacy TLS flag means
+// implicit TLS.
+func (s *Server) smtpServer() notify.SMTP {
+	cfg := s.cfg.Notifications.SMTP
+	security := cfg.Security
+	if security == notify.SMTPAuto && cfg.TLS {
+		security = notify.SMTPTLS
 	}
-	if len(rcptList) == 0 {
-		return fmt.Errorf("no valid recipients")
+	return notify.SMTP{
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		Security: security,
+		User:     cfg.User,
+		Password: cfg.Password,
+		From:     cfg.From,
 	}
-
-	var msg bytes.Buffer
-	fmt.Fprintf(&msg, "From: %s\r\n", headerFrom)
-	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(headerTo, ","))
-	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
-	fmt.Fprintf(&msg, "\r\n%s\r\n", body)
-
-	// If TLS is requested, establish a secure connection manually.
-	if cfg.TLS {
-		tlsConfig := &tls.Config{
-			ServerName: cfg.Host,
-		}
-		conn, err := tls.Dial("tcp", addr, tlsConfig)
-		if err != nil {
-			return fmt.Errorf("tls dial: %w", err)
-		}
-		client, err := smtp.NewClient(conn, cfg.Host)
-		if err != nil {
-			return fmt.Errorf("create smtp client: %w", err)
-		}
-		defer client.Close()
-
-		if auth != nil {
-			if err := client.Auth(auth); err != nil {
-				return fmt.Errorf("smtp auth: %w", err)
-			}
-		}
-		if err := client.Mail(envelopeFrom); err != nil {
-			return fmt.Errorf("smtp mail: %w", err)
-		}
-		for _, recipient := range rcptList {
-			if err := client.Rcpt(recipient); err != nil {
-				return fmt.Errorf("smtp rcpt: %w", err)
-			}
-		}
-		writer, err := client.Data()
-		if err != nil {
-			return fmt.Errorf("smtp data: %w", err)
-		}
-		if _, err := writer.Write(msg.Bytes()); err != nil {
-			return fmt.Errorf("smtp write: %w", err)
-		}
-		if err := writer.Close(); err != nil {
-			return fmt.Errorf("smtp close: %w", err)
-		}
-		return client.Quit()
-	}
-
-	// Plain or STARTTLS-less connection
-	return smtp.SendMail(addr, auth, envelopeFrom, rcptList, msg.Bytes())
 }
 
 var errDiscordBadRequest = fmt.Errorf("discord request invalid")
@@ -170,124 +108,341 @@ func (s *Server) sendDiscordMessage(ctx context.Context, content string) error {
 	if token == "" || channel == "" {
 		return fmt.Errorf("%w: discord token or channel missing", errDiscordBadRequest)
 	}
+	return (&notify.Discord{Token: token, ChannelID: channel}).Send(ctx, notify.Message{Body: content})
+}
 
-	url := fmt.Sprintf("https://discord.com/api/v10/channels/%s/messages", channel)
-	body, err := json.Marshal(discordMessage{Content: content})
-	if err != nil {
-		return fmt.Errorf("encode discord payload: %w", err)
+func (s *Server) sendWebhookMessage(ctx context.Context, content string) error {
+	url := strings.TrimSpace(s.cfg.Notifications.WebhookURL)
+	if url == "" {
+		return nil
 	}
+	return (&notify.Webhook{URL: url}).Send(ctx, notify.Message{Body: content})
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
-	if err != nil {
-		return fmt.Errorf("build discord request: %w", err)
+// Outbox targets for the destinations configured in runtime settings.
+const (
+	settingsDiscordTarget = notify.SettingsChannel + ":discord"
+	settingsWebhookTarget = notify.SettingsChannel + ":webhook"
+)
+
+// settingsTargets returns the Discord and webhook destinations configured in runtime
+// settings. They predate channel instances and are delivered alongside them: when a
+// routing rule matched they are used only if it routes to notify.SettingsChannel,
+// otherwise the success/failure toggles apply and newer event kinds are skipped.
+func (s *Server) settingsTargets(event string, route notify.Route) []notify.Target {
+	if route.Matched {
+		if !route.Includes(notify.SettingsChannel) {
+			return nil
+		}
+	} else {
+		switch event {
+		case notify.EventUpdateSuccess:
+			if !s.cfg.Notifications.OnSuccess {
+				return nil
+			}
+		case notify.EventUpdateFailure, notify.EventAgentOffline:
+			if !s.cfg.Notifications.OnFailure {
+				return nil
+			}
+		case notify.EventUpdateApproval, notify.EventRecap, notify.EventUpdateDigest, notify.EventTest:
+		default:
+			return nil
+		}
+	}
+	var out []notify.Target
+	if n, _ := s.settingsNotifier(settingsDiscordTarget); n != nil {
+		out = append(out, notify.Target{ID: settingsDiscordTarget, Name: "Discord (settings)", Type: "discord"})
 	}
+	if n, _ := s.settingsNotifier(settingsWebhookTarget); n != nil {
+		out = append(out, notify.Target{ID: settingsWebhookTarget, Name: "Webhook (settings)", Type: "webhook"})
+	}
+	return out
+}
 
-	req.Header.Set("Authorization", "Bot "+token)
-	req.Header.Set("Content-Type", "application/json")
+// settingsNotifier resolves a settings outbox target from the current runtime settings.
+// It returns nil, nil for targets that are not settings destinations.
+func (s *Server) settingsNotifier(target string) (notify.Notifier, error) {
+	switch target {
+	case settingsDiscordTarget:
+		token := strings.TrimSpace(s.cfg.Notifications.DiscordToken)
+		channel := strings.TrimSpace(s.cfg.Notifications.DiscordChannel)
+		if token == "" || channel == "" {
+			return nil, fmt.Errorf("discord: %w", notify.ErrTargetUnconfigured)
+		}
+		return &notify.Discord{Token: token, ChannelID: channel}, nil
+	case settingsWebhookTarget:
+		webhookURL := strings.TrimSpace(s.cfg.Notifications.WebhookURL)
+		if webhookURL == "" {
+			return nil, fmt.Errorf("webhook: %w", notify.ErrTargetUnconfigured)
+		}
+		return &notify.Webhook{URL: webhookURL}, nil
+	}
+	return nil, nil
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+// notify routes msg through the notification rules and queues it for the selected
+// settings destinations and channel instances. The outbox delivers it.
+func (s *Server) notify(ctx context.Context, msg notify.Message) error {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	if msg.Severity == "" {
+		msg.Severity = notify.DefaultSeverity(msg.Event)
+	}
+	route, err := s.notifyService.Route(msg)
 	if err != nil {
-		return fmt.Errorf("discord request failed: %w", err)
+		// Without rules, fall back to subscriptions rather than dropping the event.
+		s.log.Warn("notification routing failed", "event", msg.Event, "error", err)
+		route = notify.Route{}
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 300 {
-		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		msg := strings.TrimSpace(string(respBody))
-		if msg == "" {
-			msg = resp.Status
+	targets := s.settingsTargets(msg.Event, route)
+	if s.db == nil {
+		// Nothing to queue into before setup; send to the settings destinations directly.
+		var errs []error
+		for _, t := range targets {
+			if n, err := s.settingsNotifier(t.ID); err == nil {
+				errs = append(errs, n.Send(ctx, msg))
+			}
 		}
-		return fmt.Errorf("discord API error (%d): %s", resp.StatusCode, msg)
+		return errors.Join(errs...)
+	}
+	err = s.notifyService.Enqueue(msg, route, targets)
+	s.outbox.Wake()
+	if err != nil {
+		s.log.Warn("notification queueing failed", "event", msg.Event, "error", err)
+		return err
 	}
 	return nil
 }
 
-func (s *Server) sendWebhookMessage(ctx context.Context, content string) error {
-	url := strings.TrimSpace(s.cfg.Notifications.WebhookURL)
-	if url == "" {
-		return nil
+// notifyChannels queues msg for the given channels only, bypassing the routing rules.
+// notify.SettingsChannel selects the settings destinations.
+func (s *Server) notifyChannels(msg notify.Message, channels []string) error {
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
 	}
-	body, err := json.Marshal(discordMessage{Content: content})
-	if err != nil {
-		return fmt.Errorf("encode webhook payload: %w", err)
+	if msg.Severity == "" {
+		msg.Severity = notify.DefaultSeverity(msg.Event)
 	}
+	route := notify.Route{Matched: true, Channels: channels}
+	err := s.notifyService.Enqueue(msg, route, s.settingsTargets(msg.Event, route))
+	s.outbox.Wake()
+	return err
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
-	if err != nil {
-		return fmt.Errorf("build webhook request: %w", err)
+// sendImmediateNotification notifies about a recorded history entry. event may be empty
+// to derive it from the entry status.
+func (s *Server) sendImmediateNotification(entry UpdateHistory, event string) {
+	msg, ok := s.historyMessage(entry, event)
+	if !ok {
+		return
 	}
-	req.Header.Set("Content-Type", "application/json")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = s.notify(ctx, msg)
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("webhook request failed: %w", err)
+// historyEvent derives the notification event of a history entry, if it has one.
+func historyEvent(entry UpdateHistory) string {
+	switch entry.Status {
+	case "success":
+		return notify.EventUpdateSuccess
+	case "error":
+		return notify.EventUpdateFailure
+	case "warning":
+		// The update failed and the previous container was restored.
+		return notify.EventUpdateRollback
 	}
-	defer resp.Body.Close()
+	return ""
+}
 
-	if resp.StatusCode >= 300 {
-		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		msg := strings.TrimSpace(string(respBody))
-		if msg == "" {
-			msg = resp.Status
+// historyMessage builds the notification for a history entry. event may be empty to
+// derive it from the entry status; ok is false when the entry does not notify.
+func (s *Server) historyMessage(entry UpdateHistory, event string) (notify.Message, bool) {
+	if event == "" {
+		if event = historyEvent(entry); event == "" {
+			return notify.Message{}, false
 		}
-		return fmt.Errorf("webhook error (%d): %s", resp.StatusCode, msg)
 	}
-	return nil
-}
 
-func (s *Server) sendImmediateNotification(entry UpdateHistory) {
-	if s.cfg.Notifications.OnSuccess && entry.Status == "success" ||
-		s.cfg.Notifications.OnFailure && entry.Status == "error" {
-		loc := s.timezone
-		if loc == nil {
-			loc = time.Local
-		}
-		when := entry.CreatedAt.In(loc).Format("2006-01-02 15:04:05")
-		name := entry.ContainerName
-		if name == "" {
-			name = entry.ContainerID
-		}
-		image := entry.Image
-		if image == "" {
-			image = "unknown image"
-		}
-		source := entry.Source
-		if source != "" {
-			// Best-effort capitalization without relying on deprecated strings.Title
-			source = strings.ToUpper(source[:1]) + source[1:]
-		}
-		if entry.AgentName != "" {
-			source = fmt.Sprintf("%s (%s)", source, entry.AgentName)
-		}
-		icon := "✅"
-		if entry.Status != "success" {
-			icon = "⚠️"
-		}
-		content := fmt.Sprintf(
-			"%s Update %s\nContainer: %s\nImage: %s\nSource: %s\nStatus: %s\nWhen: %s\nMessage: %s",
-			icon,
-			entry.Status,
+	loc := s.timezone
+	if loc == nil {
+		loc = time.Local
+	}
+	when := entry.CreatedAt.In(loc).Format("2006-01-02 15:04:05")
+	name := entry.ContainerName
+	if name == "" {
+		name = entry.ContainerID
+	}
+	image := entry.Image
+	if image == "" {
+		image = "unknown image"
+	}
+	source := entry.Source
+	if source != "" {
+		// Best-effort capitalization without relying on deprecated strings.Title
+		source = strings.ToUpper(source[:1]) + source[1:]
+	}
+	if entry.AgentName != "" {
+		source = fmt.Sprintf("%s (%s)", source, entry.AgentName)
+	}
+	icon := "✅"
+	if entry.Status != "success" {
+		icon = "⚠️"
+	}
+	title := fmt.Sprintf("%s Update %s", icon, entry.Status)
+	if event == notify.EventUpdateRollback {
+		title = fmt.Sprintf("%s Rollback", icon)
+	}
+
+	msg := notify.Message{
+		Event: event,
+		Title: title,
+		Body: fmt.Sprintf(
+			"Container: %s\nImage: %s\nSource: %s\nStatus: %s\nWhen: %s\nMessage: %s",
 			name,
 			image,
 			source,
 			entry.Status,
 			when,
 			entry.Message,
-		)
+		),
+		Time:      entry.CreatedAt,
+		Status:    entry.Status,
+		Source:    entry.Source,
+		Details:   entry.Message,
+		Container: s.notifyContainer(entry.AgentID, entry.ContainerID, entry.ContainerName, entry.Image),
+		Links:     s.notifyLinks(entry.AgentID, entry.ContainerID),
+	}
+	msg.Container.OldDigest = entry.PreviousDigest
+	msg.Container.NewDigest = entry.ImageDigest
+	if event == notify.EventUpdateSuccess {
+		if msg.Container.Release = releaseInfo(s.storedReleaseNotes(entry.AgentID, entry.ContainerName, entry.Image)); msg.Container.Release != nil {
+			msg.Body += releaseText(msg.Container.Release)
+		}
+	}
+	if entry.AgentID != "" || entry.AgentName != "" {
+		msg.Agent = &notify.AgentInfo{ID: entry.AgentID, Name: entry.AgentName}
+	}
+	return msg, true
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		_ = s.sendDiscordMessage(ctx, content)
-		_ = s.sendWebhookMessage(ctx, content)
+// notifyLinks builds links into the web UI for an event about the given agent and
+// container; either may be empty.
+func (s *Server) notifyLinks(agentID, containerID string) notify.Links {
+	links := notify.Links{
+		Dashboard: s.absoluteClientURL("/"),
+		History:   s.absoluteClientURL("/?panel=history"),
 	}
+	if agentID != "" {
+		links.Agent = s.absoluteClientURL("/?panel=agents&agent=" + url.QueryEscape(agentID))
+	}
+	if containerID != "" {
+		if agentID != "" {
+			links.Container = links.Agent + "&container=" + url.QueryEscape(containerID)
+		} else {
+			links.Container = s.absoluteClientURL("/?panel=containers&container=" + url.QueryEscape(containerID))
+		}
+	}
+	return links
 }
 
-func (s *Server) notifyAgentOffline(agent Agent) {
-	if !s.cfg.Notifications.OnFailure {
-		return
+// notifyContainer describes a container for routing, including its labels: inspected
+// for local containers, taken from the last snapshot for agent containers.
+func (s *Server) notifyContainer(agentID, id, name, image string) *notify.ContainerInfo {
+	info := &notify.ContainerInfo{ID: id, Name: name, Image: image}
+	if agentID == "" {
+		if s.containerService != nil && id != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if labels, err := s.containerService.Labels(ctx, id); err == nil {
+				info.Labels = labels
+			}
+		}
+		return info
+	}
+	if s.db == nil {
+		return info
 	}
+	var agent Agent
+	if err := s.db.Session(&gorm.Session{Logger: logger.Discard}).First(&agent, "id = ?", agentID).Error; err != nil {
+		return info
+	}
+	for _, cont := range agent.Containers {
+		if (id != "" && cont.ID == id) || (name != "" && cont.Name == name) {
+			info.Labels = snapshotLabels(cont)
+			break
+		}
+	}
+	return info
+}
+
+// snapshotLabels parses the key=value labels reported by an agent.
+func snapshotLabels(cont ContainerSnapshot) map[string]string {
+	labels := make(map[string]string, len(cont.Labels))
+	for _, kv := range cont.Labels {
+		key, value, _ := strings.Cut(kv, "=")
+		labels[key] = value
+	}
+	return labels
+}
+
+func (s *Server) notifyUpdateAvailable(agent *Agent, id, name, image string) {
+	if name == "" {
+		name = id
+	}
+	host := "local"
+	agentID := ""
+	if agent != nil {
+		host = agent.Name
+		agentID = agent.ID
+	}
+	msg := notify.Message{
+		Event:     notify.EventUpdateAvailable,
+		Title:     "⬆️ Update available",
+		Body:      fmt.Sprintf("Container: %s\nImage: %s\nHost: %s", name, image, host),
+		Container: s.notifyContainer(agentID, id, name, image),
+		Links:     s.notifyLinks(agentID, id),
+	}
+	if agent != nil {
+		msg.Agent = &notify.AgentInfo{ID: agent.ID, Name: agent.Name, Hostname: agent.Hostname}
+	}
+	lookupCtx, cancelLookup := context.WithTimeout(context.Background(), releaseLookupTimeout)
+	notes, err := s.lookupReleaseNotes(lookupCtx, agentID, name, image, msg.Container.Labels)
+	cancelLookup()
+	if err != nil {
+		s.log.Warn("release notes: failed to store", "container", name, "error", err)
+	}
+	if msg.Container.Release = releaseInfo(notes); msg.Container.Release != nil {
+		msg.Body += releaseText(msg.Container.Release)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = s.notify(ctx, msg)
+}
+
+func (s *Server) notifyAgentOnline(agent Agent) {
+	name := agent.Name
+	if name == "" {
+		name = agent.ID
+	}
+	host := agent.Hostname
+	if host == "" {
+		host = "unknown host"
+	}
+	msg := notify.Message{
+		Event: notify.EventAgentOnline,
+		Title: "✅ Agent online",
+		Body:  fmt.Sprintf("Name: %s\nHost: %s\nStatus: online", name, host),
+		Agent: &notify.AgentInfo{ID: agent.ID, Name: agent.Name, Hostname: agent.Hostname},
+		Links: s.notifyLinks(agent.ID, ""),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = s.notify(ctx, msg)
+}
+
+func (s *Server) notifyAgentOffline(agent Agent) {
 	loc := s.timezone
 	if loc == nil {
 		loc = time.Local
@@ -304,16 +459,21 @@ func (s *Server) notifyAgentOffline(agent Agent) {
 	if name == "" {
 		name = agent.ID
 	}
-	content := fmt.Sprintf(
-		"⚠️ Agent offline\nName: %s\nHost: %s\nLast seen: %s\nStatus: offline",
-		name,
-		host,
-		last,
-	)
+	msg := notify.Message{
+		Event: notify.EventAgentOffline,
+		Title: "⚠️ Agent offline",
+		Body: fmt.Sprintf(
+			"Name: %s\nHost: %s\nLast seen: %s\nStatus: offline",
+			name,
+			host,
+			last,
+		),
+		Agent: &notify.AgentInfo{ID: agent.ID, Name: agent.Name, Hostname: agent.Hostname},
+		Links: s.notifyLinks(agent.ID, ""),
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	_ = s.sendDiscordMessage(ctx, content)
-	_ = s.sendWebhookMessage(ctx, content)
+	_ = s.notify(ctx, msg)
 }
 
 func (s *Server) SendPasswordResetEmail(to, token, origin string) error {
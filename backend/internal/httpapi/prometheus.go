@@ -0,0 +1,171 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/metrics"
+)
+
+const metricsDockerTimeout = 5 * time.Second
+
+var (
+	containersDesc = prometheus.NewDesc("updockly_containers",
+		"Containers by host and state. Agent containers are counted from the agent's last report.",
+		[]string{"agent_id", "host", "state"}, nil)
+	updatesAvailableDesc = prometheus.NewDesc("updockly_updates_available",
+		"Containers with an image update available, by host.",
+		[]string{"agent_id", "host"}, nil)
+	agentLastSeenDesc = prometheus.NewDesc("updockly_agent_last_seen_age_seconds",
+		"Seconds since the agent last sent a heartbeat.",
+		[]string{"agent_id", "agent"}, nil)
+	agentCommandsDesc = prometheus.NewDesc("updockly_agent_commands",
+		"Agent commands by status; pending commands are waiting to be picked up.",
+		[]string{"status"}, nil)
+	notificationDeliveriesDesc = prometheus.NewDesc("updockly_notification_deliveries",
+		"Notification deliveries in the outbox by status.",
+		[]string{"status"}, nil)
+	scrapeErrorDesc = prometheus.NewDesc("updockly_scrape_error",
+		"1 when a source could not be read during this scrape.",
+		[]string{"source"}, nil)
+)
+
+// stateCollector reads current state from the database and Docker when /metrics is
+// scraped. Counters that follow events live in metrics.Registry.
+type stateCollector struct {
+	ctx context.Context
+	s   *Server
+}
+
+func (sc stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{containersDesc, updatesAvailableDesc, agentLastSeenDesc, agentCommandsDesc, notificationDeliveriesDesc, scrapeErrorDesc} {
+		ch <- desc
+	}
+}
+
+func (sc stateCollector) Collect(ch chan<- prometheus.Metric) {
+	scrapeError := func(source string, err error) {
+		value := 0.0
+		if err != nil {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(scrapeErrorDesc, prometheus.GaugeValue, value, source)
+	}
+
+	if sc.s.containerService != nil {
+		ctx, cancel := context.WithTimeout(sc.ctx, metricsDockerTimeout)
+		local, err := sc.s.containerService.ListContainers(ctx)
+		cancel()
+		scrapeError("docker", err)
+		if err == nil {
+			states := map[string]int{}
+			available := 0
+			for _, cont := range local {
+				states[cont.State]++
+				if cont.UpdateAvailable {
+					available++
+				}
+			}
+			sc.collectHost(ch, "", "local", states, available)
+		}
+	}
+
+	if sc.s.db == nil {
+		scrapeError("database", errors.New("database not ready"))
+		return
+	}
+	db := sc.s.db.Session(&gorm.Session{Logger: logger.Discard}).WithContext(sc.ctx)
+	var agents []Agent
+	err := db.Find(&agents).Error
+	if err == nil {
+		err = collectGrouped(db, &AgentCommand{}, agentCommandsDesc, ch)
+	}
+	if err == nil {
+		err = collectGrouped(db, &domain.NotificationDelivery{}, notificationDeliveriesDesc, ch)
+	}
+	scrapeError("database", err)
+
+	now := time.Now()
+	for _, agent := range agents {
+		if agent.LastSeen != nil {
+			ch <- prometheus.MustNewConstMetric(agentLastSeenDesc, prometheus.GaugeValue,
+				now.Sub(*agent.LastSeen).Seconds(), agent.ID, agent.Name)
+		}
+		states := map[string]int{}
+		available := 0
+		for _, cont := range agent.Containers {
+			states[cont.State]++
+			if cont.UpdateAvailable {
+				available++
+			}
+		}
+		sc.collectHost(ch, agent.ID, agent.Name, states, available)
+	}
+}
+
+// collectHost reports the containers of one host; agentID is empty for local containers.
+func (sc stateCollector) collectHost(ch chan<- prometheus.Metric, agentID, host string, states map[string]int, available int) {
+	for state, count := range states {
+		if state == "" {
+			state = "unknown"
+		}
+		ch <- prometheus.MustNewConstMetric(containersDesc, prometheus.GaugeValue, float64(count), agentID, host, state)
+	}
+	ch <- prometheus.MustNewConstMetric(updatesAvailableDesc, prometheus.GaugeValue, float64(available), agentID, host)
+}
+
+// collectGrouped reports the number of rows of model per status.
+func collectGrouped(db *gorm.DB, model interface{}, desc *prometheus.Desc, ch chan<- prometheus.Metric) error {
+	var rows []struct {
+		Status string
+		Total  int64
+	}
+	if err := db.Model(model).Select("status, COUNT(*) AS total").Group("status").Scan(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(row.Total), row.Status)
+	}
+	return nil
+}
+
+// metricsHandler serves Prometheus metrics. When METRICS_TOKEN is set, scrapers must
+// send it as a bearer token.
+func (s *Server) metricsHandler(c *gin.Context) {
+	if token := s.cfg.MetricsToken; token != "" {
+		sent, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(sent)), []byte(token)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid metrics token"})
+			return
+		}
+	}
+
+	state := prometheus.NewRegistry()
+	state.MustRegister(stateCollector{ctx: c.Request.Context(), s: s})
+	promhttp.HandlerFor(prometheus.Gatherers{metrics.Registry, state}, promhttp.HandlerOpts{}).
+		ServeHTTP(c.Writer, c.Request)
+}
+
+// commandDuration is how long an agent took to run cmd, from when it picked it up.
+func commandDuration(cmd AgentCommand) time.Duration {
+	started := cmd.CreatedAt
+	if cmd.StartedAt != nil {
+		started = *cmd.StartedAt
+	}
+	if started.IsZero() {
+		return 0
+	}
+	return time.Since(started)
+}
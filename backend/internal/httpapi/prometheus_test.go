@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/metrics"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.AgentCommand{}, &domain.NotificationDelivery{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	seen := time.Now().Add(-90 * time.Second)
+	if err := db.Create(&Agent{ID: "a1", Name: "prod-1", LastSeen: &seen, Containers: ContainerSnapshotList{
+		{ID: "c1", Name: "web", State: "running", UpdateAvailable: true},
+		{ID: "c2", Name: "db", State: "running"},
+		{ID: "c3", Name: "job", State: "exited"},
+	}}).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+	for _, status := range []string{"pending", "pending", "completed"} {
+		if err := db.Create(&AgentCommand{AgentID: "a1", Type: "update-container", Status: status}).Error; err != nil {
+			t.Fatalf("seed command: %v", err)
+		}
+	}
+	metrics.ObserveUpdate("agent", "update", metrics.OutcomeRolledBack, 42*time.Second)
+
+	srv := &Server{db: db, cfg: config.Config{MetricsToken: "scrape-me"}}
+	router := gin.New()
+	router.GET("/metrics", srv.metricsHandler)
+	scrape := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := scrape("wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong token to be refused, got %d", rec.Code)
+	}
+	rec := scrape("scrape-me")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected metrics, got %d %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`updockly_containers{agent_id="a1",host="prod-1",state="running"} 2`,
+		`updockly_containers{agent_id="a1",host="prod-1",state="exited"} 1`,
+		`updockly_updates_available{agent_id="a1",host="prod-1"} 1`,
+		`updockly_agent_commands{status="pending"} 2`,
+		`updockly_agent_last_seen_age_seconds{agent="prod-1",agent_id="a1"} 9`,
+		`updockly_update_attempts_total{kind="update",outcome="rolled_back",source="agent"} 1`,
+		`updockly_update_duration_seconds_bucket{kind="update",outcome="rolled_back",source="agent",le="60"} 1`,
+		`updockly_scrape_error{source="database"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in metrics:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,640 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/notify"
+)
+
+// settingsRecapID is the recap schedule mirrored from the recap time in the notification
+// settings.
+const settingsRecapID = "settings"
+
+// recapEntryLimit caps each list of history entries in a recap.
+const recapEntryLimit = 20
+
+var (
+	errInvalidRecapSchedule = errors.New("invalid recap schedule")
+	errRecapScheduleManaged = errors.New("the settings recap is configured in the notification settings")
+)
+
+type recapSchedulePayload struct {
+	Name           string   `json:"name"`
+	CronExpression string   `json:"cronExpression"`
+	Enabled        *bool    `json:"enabled"`
+	Sections       []string `json:"sections"`
+	Channels       []string `json:"channels"`
+}
+
+func (p recapSchedulePayload) apply(r *RecapSchedule) {
+	r.Name = strings.TrimSpace(p.Name)
+	r.CronExpression = strings.Join(strings.Fields(p.CronExpression), " ")
+	r.Enabled = p.Enabled == nil || *p.Enabled
+	r.Sections = domain.StringList(p.Sections)
+	r.Channels = domain.StringList(p.Channels)
+}
+
+func (s *Server) validateRecapSchedule(r *RecapSchedule) error {
+	if r.Name == "" {
+		return fmt.Errorf("%w: name is required", errInvalidRecapSchedule)
+	}
+	if !cronValid(r.CronExpression) {
+		return fmt.Errorf("%w: cron expression needs five fields: minute hour day month weekday", errInvalidRecapSchedule)
+	}
+	for _, section := range r.Sections {
+		if !notify.Subscribed(notify.RecapSections, section) {
+			return fmt.Errorf("%w: unknown section %q", errInvalidRecapSchedule, section)
+		}
+	}
+	for _, id := range r.Channels {
+		if id == notify.SettingsChannel {
+			continue
+		}
+		var count int64
+		if err := s.db.Model(&domain.NotificationChannel{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: unknown channel %q", errInvalidRecapSchedule, id)
+		}
+	}
+	return nil
+}
+
+func respondRecapScheduleError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, errInvalidRecapSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errRecapScheduleManaged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "recap schedule not found"})
+	default:
+		respondInternal(c, "failed to "+action+" recap schedule", wrapErr(action+" recap schedule", err))
+	}
+}
+
+func (s *Server) listRecapSchedulesHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	s.syncSettingsRecap()
+	var schedules []RecapSchedule
+	if err := s.db.Order("created_at ASC").Find(&schedules).Error; err != nil {
+		respondRecapScheduleError(c, "list", err)
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+func (s *Server) createRecapScheduleHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	var payload recapSchedulePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	var schedule RecapSchedule
+	payload.apply(&schedule)
+	if err := s.validateRecapSchedule(&schedule); err != nil {
+		respondRecapScheduleError(c, "create", err)
+		return
+	}
+	if err := s.db.Create(&schedule).Error; err != nil {
+		respondRecapScheduleError(c, "create", err)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "create-recap-schedule",
+			TargetType: "recap-schedule",
+			TargetID:   schedule.ID,
+			Details:    fmt.Sprintf("Created recap schedule %s (%s)", schedule.Name, schedule.CronExpression),
+			After:      schedule,
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func (s *Server) updateRecapScheduleHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	var payload recapSchedulePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	var schedule RecapSchedule
+	if err := s.db.First(&schedule, "id = ?", c.Param("id")).Error; err != nil {
+		respondRecapScheduleError(c, "update", err)
+		return
+	}
+	before := schedule
+	if schedule.ID == settingsRecapID {
+		// The cadence comes from the settings; only the content and channels are editable.
+		payload.Name, payload.CronExpression, payload.Enabled = schedule.Name, schedule.CronExpression, &schedule.Enabled
+	}
+	payload.apply(&schedule)
+	if err := s.validateRecapSchedule(&schedule); err != nil {
+		respondRecapScheduleError(c, "update", err)
+		return
+	}
+	if err := s.db.Save(&schedule).Error; err != nil {
+		respondRecapScheduleError(c, "update", err)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "update-recap-schedule",
+			TargetType: "recap-schedule",
+			TargetID:   schedule.ID,
+			Details:    fmt.Sprintf("Updated recap schedule %s", schedule.Name),
+			Before:     before,
+			After:      schedule,
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.JSON(http.StatusOK, schedule)
+}
+
+func (s *Server) deleteRecapScheduleHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	id := c.Param("id")
+	if id == settingsRecapID {
+		respondRecapScheduleError(c, "delete", errRecapScheduleManaged)
+		return
+	}
+	res := s.db.Delete(&RecapSchedule{}, "id = ?", id)
+	if res.Error != nil {
+		respondRecapScheduleError(c, "delete", res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		respondRecapScheduleError(c, "delete", gorm.ErrRecordNotFound)
+		return
+	}
+
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "delete-recap-schedule",
+			TargetType: "recap-schedule",
+			TargetID:   id,
+			Details:    "Deleted recap schedule",
+			IPAddress:  c.ClientIP(),
+		})
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// previewRecapScheduleHandler builds the recap the schedule would send now, without
+// sending it or moving its last-sent time.
+func (s *Server) previewRecapScheduleHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	var schedule RecapSchedule
+	if err := s.db.First(&schedule, "id = ?", c.Param("id")).Error; err != nil {
+		respondRecapScheduleError(c, "preview", err)
+		return
+	}
+	msg, err := s.recapMessage(schedule, recapSince(schedule), time.Now())
+	if err != nil {
+		respondRecapScheduleError(c, "preview", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"title": msg.Title,
+		"body":  msg.Body,
+		"recap": notify.NewEventPayload(msg).Recap,
+	})
+}
+
+// settingsRecapCron is the cron expression of the settings recap: the cron override when
+// set, otherwise daily at the recap time. It is empty when neither is set.
+func settingsRecapCron(settings config.NotificationSettings) string {
+	if expr := strings.Join(strings.Fields(settings.NotificationCron), " "); expr != "" && cronValid(expr) {
+		return expr
+	}
+	if hour, min, ok := parseClockTime(strings.TrimSpace(settings.RecapTime)); ok {
+		return fmt.Sprintf("%d %d * * *", min, hour)
+	}
+	return ""
+}
+
+// syncSettingsRecap mirrors the recap time from the notification settings into the
+// settings recap schedule, so its last-sent time is persisted like any other.
+func (s *Server) syncSettingsRecap() {
+	if s.db == nil {
+		return
+	}
+	expr := settingsRecapCron(s.cfg.Notifications)
+	var row RecapSchedule
+	err := s.db.First(&row, "id = ?", settingsRecapID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if expr == "" {
+			return
+		}
+		row = RecapSchedule{ID: settingsRecapID, Name: "Updockly recap", CronExpression: expr, Enabled: true}
+		// A recap time already passed today waits until tomorrow rather than firing
+		// straight away.
+		now := time.Now().In(s.location())
+		if prev, ok := nextCronTime(expr, now.Add(-24*time.Hour)); ok && !prev.After(now) {
+			row.LastSentAt = &prev
+		}
+		if err := s.db.Create(&row).Error; err != nil {
+			s.log.Warn("failed to create the settings recap schedule", "error", err)
+		}
+	case err != nil:
+		s.log.Warn("failed to load the settings recap schedule", "error", err)
+	case row.Enabled != (expr != "") || (expr != "" && row.CronExpression != expr):
+		updates := map[string]interface{}{"enabled": expr != ""}
+		if expr != "" {
+			updates["cron_expression"] = expr
+		}
+		if err := s.db.Model(&row).Updates(updates).Error; err != nil {
+			s.log.Warn("failed to update the settings recap schedule", "error", err)
+		}
+	}
+}
+
+// maybeSendRecaps sends every recap that is due. A recap missed while the server was down
+// is sent once on the next tick and covers the whole time since the previous one.
+func (s *Server) maybeSendRecaps() {
+	if s.db == nil || !s.notificationsConfigured() {
+		return
+	}
+	s.syncSettingsRecap()
+
+	var schedules []RecapSchedule
+	if err := s.db.Where("enabled = ?", true).Find(&schedules).Error; err != nil {
+		s.log.Warn("failed to load recap schedules", "error", err)
+		return
+	}
+	now := time.Now().In(s.location())
+	for _, schedule := range schedules {
+		next, ok := nextCronTime(schedule.CronExpression, recapSince(schedule).In(now.Location()))
+		if !ok || now.Before(next) {
+			continue
+		}
+		if err := s.sendRecap(schedule, now); err != nil {
+			s.log.Warn("failed to send recap", logging.KeyScheduleID, schedule.ID, "schedule", schedule.Name, "error", err)
+		}
+	}
+}
+
+// recapSince is the start of the schedule's next recap period.
+func recapSince(schedule RecapSchedule) time.Time {
+	if schedule.LastSentAt != nil {
+		return *schedule.LastSentAt
+	}
+	return schedule.CreatedAt
+}
+
+// sendRecap sends the schedule's recap up to until. The last-sent time is stored once
+// the recap is queued, so a recap that could not be queued is tried again on the next
+// tick.
+func (s *Server) sendRecap(schedule RecapSchedule, until time.Time) error {
+	msg, err := s.recapMessage(schedule, recapSince(schedule), until)
+	if err != nil {
+		return err
+	}
+
+	if len(schedule.Channels) > 0 {
+		err = s.notifyChannels(msg, schedule.Channels)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		err = s.notify(ctx, msg)
+		cancel()
+		if notify.Queued(err) {
+			email := msg
+			email.Body = msg.Text()
+			s.emailAdmins(email)
+		}
+	}
+	if !notify.Queued(err) {
+		return err
+	}
+	if serr := s.db.Model(&RecapSchedule{}).Where("id = ?", schedule.ID).Update("last_sent_at", until).Error; serr != nil {
+		return fmt.Errorf("store recap state: %w", serr)
+	}
+	// Template errors still queued the built-in text.
+	return err
+}
+
+func (s *Server) location() *time.Location {
+	if s.timezone == nil {
+		return time.Local
+	}
+	return s.timezone
+}
+
+func (s *Server) recapMessage(schedule RecapSchedule, since, until time.Time) (notify.Message, error) {
+	recap, err := s.buildRecap(schedule, since, until)
+	if err != nil {
+		return notify.Message{}, err
+	}
+	loc := s.location()
+	title := fmt.Sprintf("📦 %s — %s (%s)", schedule.Name, until.In(loc).Format("2006-01-02 15:04"), loc.String())
+	return notify.Message{
+		Event: notify.EventRecap,
+		Title: title,
+		Body:  recapText(recap, loc),
+		Time:  until,
+		Links: s.notifyLinks("", ""),
+		Recap: recap,
+	}, nil
+}
+
+// buildRecap collects the schedule's sections for the period.
+func (s *Server) buildRecap(schedule RecapSchedule, since, until time.Time) (*notify.Recap, error) {
+	loc := s.location()
+	sections := []string(schedule.Sections)
+	if len(sections) == 0 {
+		sections = notify.RecapSections
+	}
+	recap := &notify.Recap{Name: schedule.Name, Since: since, Until: until, Sections: sections}
+
+	var rows []UpdateHistory
+	if err := s.db.Where("created_at BETWEEN ? AND ?", since, until).Order("created_at DESC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("load update history: %w", err)
+	}
+	recap.Total = len(rows)
+	hosts := map[string]*notify.RecapHost{}
+	for _, row := range rows {
+		entry := notify.RecapEntry{
+			Time:      row.CreatedAt.In(loc),
+			Container: row.ContainerName,
+			Image:     row.Image,
+			Source:    row.Source,
+			Agent:     row.AgentName,
+			Status:    row.Status,
+			Message:   row.Message,
+		}
+		if entry.Container == "" {
+			entry.Container = row.ContainerID
+		}
+		switch row.Status {
+		case "success":
+			recap.Success++
+		case "error":
+			recap.Failed++
+			if recap.Has(notify.RecapFailures) && len(recap.Failures) < recapEntryLimit {
+				recap.Failures = append(recap.Failures, entry)
+			}
+		case "warning":
+			if recap.Has(notify.RecapRollbacks) && len(recap.Rollbacks) < recapEntryLimit {
+				recap.Rollbacks = append(recap.Rollbacks, entry)
+			}
+		}
+		if !recap.Has(notify.RecapUpdates) {
+			continue
+		}
+		if len(recap.Entries) < recapEntryLimit {
+			recap.Entries = append(recap.Entries, entry)
+		} else {
+			recap.More++
+		}
+		if row.Status != "success" && row.Status != "error" && row.Status != "warning" {
+			continue
+		}
+		host, ok := hosts[row.AgentID]
+		if !ok {
+			host = &notify.RecapHost{Name: "local", AgentID: row.AgentID}
+			if row.AgentID != "" {
+				host.Name = row.AgentName
+			}
+			hosts[row.AgentID] = host
+		}
+		host.Total++
+		switch row.Status {
+		case "success":
+			host.Success++
+		case "error":
+			host.Failed++
+		case "warning":
+			host.Rollbacks++
+		}
+	}
+	for _, host := range hosts {
+		recap.Hosts = append(recap.Hosts, *host)
+	}
+	sort.Slice(recap.Hosts, func(i, j int) bool {
+		a, b := recap.Hosts[i], recap.Hosts[j]
+		if (a.AgentID == "") != (b.AgentID == "") {
+			return a.AgentID == ""
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+
+	var agents []Agent
+	if recap.Has(notify.RecapPending) || recap.Has(notify.RecapOffline) {
+		if err := s.db.Order("name ASC").Find(&agents).Error; err != nil {
+			return nil, fmt.Errorf("load agents: %w", err)
+		}
+	}
+	if recap.Has(notify.RecapPending) {
+		pending, err := s.recapPending(agents)
+		if err != nil {
+			return nil, err
+		}
+		recap.Pending = pending
+	}
+	if recap.Has(notify.RecapOffline) {
+		cutoff := until.Add(-5 * time.Minute)
+		for _, ag := range agents {
+			if ag.LastSeen != nil && ag.LastSeen.Before(cutoff) {
+				recap.Offline = append(recap.Offline, notify.RecapAgent{Name: ag.Name, AgentID: ag.ID, LastSeen: ag.LastSeen.In(loc)})
+			}
+		}
+	}
+	if recap.Has(notify.RecapUptime) {
+		uptime, err := s.recapUptime(since, until)
+		if err != nil {
+			return nil, err
+		}
+		recap.Uptime = uptime
+	}
+	return recap, nil
+}
+
+// recapPending lists the containers with an update available: local ones from their
+// cached check result, agent ones from the last report.
+func (s *Server) recapPending(agents []Agent) ([]notify.RecapPendingUpdate, error) {
+	var tracked []PendingUpdate
+	if err := s.db.Find(&tracked).Error; err != nil {
+		return nil, fmt.Errorf("load pending updates: %w", err)
+	}
+	firstSeen := make(map[string]time.Time, len(tracked))
+	for _, p := range tracked {
+		firstSeen[p.AgentID+"/"+p.ContainerName] = p.FirstSeenAt
+	}
+
+	var out []notify.RecapPendingUpdate
+	var local []ContainerSettings
+	if err := s.db.Where("update_available = ?", true).Order("name ASC").Find(&local).Error; err != nil {
+		return nil, fmt.Errorf("load container settings: %w", err)
+	}
+	for _, c := range local {
+		name := c.Name
+		if name == "" {
+			name = c.ID
+		}
+		out = append(out, notify.RecapPendingUpdate{Host: "local", Container: name, Image: c.Image, FirstSeen: firstSeen["/"+c.Name]})
+	}
+	for _, ag := range agents {
+		containers := append(ContainerSnapshotList(nil), ag.Containers...)
+		sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+		for _, c := range containers {
+			if c.UpdateAvailable {
+				out = append(out, notify.RecapPendingUpdate{Host: ag.Name, Container: c.Name, Image: c.Image, FirstSeen: firstSeen[ag.ID+"/"+c.Name]})
+			}
+		}
+	}
+	return out, nil
+}
+
+// recapUptime averages the daily running snapshots of the days in the period.
+func (s *Server) recapUptime(since, until time.Time) (*notify.RecapUptimeStats, error) {
+	loc := s.location()
+	from := since.In(loc)
+	dayStart := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	var snapshots []RunningSnapshot
+	if err := s.db.Where("date >= ? AND date <= ?", dayStart, until).Order("date ASC").Find(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("load running snapshots: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+	stats := &notify.RecapUptimeStats{}
+	running, total := 0, 0
+	for _, snap := range snapshots {
+		stats.Days = append(stats.Days, notify.RecapUptimeDay{Date: snap.Date.In(loc), Running: snap.Running, Total: snap.Total})
+		running += snap.Running
+		total += snap.Total
+	}
+	if total > 0 {
+		stats.Percent = math.Round(float64(running)/float64(total)*1000) / 10
+	}
+	return stats, nil
+}
+
+// recapText is the built-in plain-text body of a recap.
+func recapText(recap *notify.Recap, loc *time.Location) string {
+	var b strings.Builder
+	if recap.Total == 0 {
+		b.WriteString("No update activity in this period.\n")
+	} else {
+		fmt.Fprintf(&b, "Success: %d | Failed: %d | Total Entries: %d\n", recap.Success, recap.Failed, recap.Total)
+	}
+
+	if len(recap.Hosts) > 0 {
+		b.WriteString("\n🖥️ Updates per host\n")
+		for _, host := range recap.Hosts {
+			fmt.Fprintf(&b, "%s: %d updated, %d failed, %d rolled back\n", host.Name, host.Success, host.Failed, host.Rollbacks)
+		}
+	}
+	if len(recap.Entries) > 0 {
+		b.WriteString("\n")
+	}
+	for _, entry := range recap.Entries {
+		when := entry.Time.Format("01-02 15:04")
+
+		if entry.Source == "schedule" && entry.Status == "info" {
+			fmt.Fprintf(&b, "📅 %s @ %s\n   %s\n", "Schedule Run", when, entry.Message)
+			continue
+		}
+
+		source := entry.Source
+		if source != "" {
+			source = strings.ToUpper(source[:1]) + source[1:]
+		}
+		if entry.Agent != "" {
+			source = fmt.Sprintf("%s (%s)", source, entry.Agent)
+		}
+		image := entry.Image
+		if image == "" {
+			image = "unknown image"
+		}
+		icon := "✅"
+		if entry.Status != "success" {
+			icon = "⚠️"
+		}
+		fmt.Fprintf(&b, "%s %s — %s via %s @ %s [%s]\n", icon, entry.Container, image, source, when, entry.Status)
+	}
+	if recap.More > 0 {
+		fmt.Fprintf(&b, "…and %d more\n", recap.More)
+	}
+
+	for _, list := range []struct {
+		heading string
+		entries []notify.RecapEntry
+	}{
+		{"❌ Failures", recap.Failures},
+		{"↩️ Rollbacks", recap.Rollbacks},
+	} {
+		if len(list.entries) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s\n", list.heading)
+		for _, entry := range list.entries {
+			host := entry.Agent
+			if host == "" {
+				host = "local"
+			}
+			fmt.Fprintf(&b, "%s on %s @ %s: %s\n", entry.Container, host, entry.Time.Format("01-02 15:04"), entry.Message)
+		}
+	}
+	if len(recap.Pending) > 0 {
+		b.WriteString("\n⬆️ Pending updates\n")
+		for _, p := range recap.Pending {
+			fmt.Fprintf(&b, "%s on %s — %s\n", p.Container, p.Host, p.Image)
+		}
+	}
+	if len(recap.Offline) > 0 {
+		b.WriteString("\n🔌 Offline agents\n")
+		for _, ag := range recap.Offline {
+			fmt.Fprintf(&b, "%s, last seen %s\n", ag.Name, ag.LastSeen.In(loc).Format("2006-01-02 15:04"))
+		}
+	}
+	if recap.Uptime != nil {
+		fmt.Fprintf(&b, "\n📈 Uptime: %.1f%% of containers running\n", recap.Uptime.Percent)
+	}
+	return b.String()
+}
@@ -0,0 +1,269 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/notify"
+)
+
+func setupRecapServer(t *testing.T) (*Server, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.UpdateHistory{}, &domain.ContainerSettings{}, &domain.PendingUpdate{},
+		&domain.RunningSnapshot{}, &domain.RecapSchedule{}, &domain.NotificationChannel{}, &domain.NotificationRule{},
+		&domain.NotificationTemplate{}, &domain.NotificationDelivery{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	notifyService := notify.NewService(db, nil)
+	srv := &Server{db: db, cfg: config.Config{ClientOrigin: "https://updockly.example"}, log: slog.Default(), timezone: time.UTC, notifyService: notifyService}
+	return srv, db
+}
+
+func recapDeliveries(t *testing.T, db *gorm.DB) []domain.NotificationDelivery {
+	t.Helper()
+	var rows []domain.NotificationDelivery
+	if err := db.Where("event = ?", notify.EventRecap).Order("id ASC").Find(&rows).Error; err != nil {
+		t.Fatalf("load deliveries: %v", err)
+	}
+	return rows
+}
+
+func TestBuildRecapSections(t *testing.T) {
+	srv, db := setupRecapServer(t)
+	now := time.Now().UTC()
+	since := now.Add(-24 * time.Hour)
+
+	stale := now.Add(-time.Hour)
+	fresh := now
+	agents := []Agent{
+		{ID: "a1", Name: "edge-1", LastSeen: &fresh, Containers: ContainerSnapshotList{
+			{ID: "c1", Name: "db", Image: "postgres:16", UpdateAvailable: true},
+			{ID: "c2", Name: "cache", Image: "redis:7"},
+		}},
+		{ID: "a2", Name: "edge-2", LastSeen: &stale},
+	}
+	for i := range agents {
+		if err := db.Create(&agents[i]).Error; err != nil {
+			t.Fatalf("seed agent: %v", err)
+		}
+	}
+	history := []UpdateHistory{
+		{ContainerName: "web", Image: "nginx:1.27", Source: "schedule", Status: "success", CreatedAt: now.Add(-3 * time.Hour)},
+		{ContainerName: "db", Image: "postgres:16", AgentID: "a1", AgentName: "edge-1", Source: "agent", Status: "error", Message: "pull access denied", CreatedAt: now.Add(-2 * time.Hour)},
+		{ContainerName: "cache", Image: "redis:7", AgentID: "a1", AgentName: "edge-1", Source: "agent", Status: "warning", Message: "restored", CreatedAt: now.Add(-time.Hour)},
+		{Source: "schedule", Status: "info", Message: "Executed schedule nightly.", CreatedAt: now.Add(-3 * time.Hour)},
+		{ContainerName: "old", Status: "success", CreatedAt: now.Add(-48 * time.Hour)},
+	}
+	for i := range history {
+		if err := db.Create(&history[i]).Error; err != nil {
+			t.Fatalf("seed history: %v", err)
+		}
+	}
+	if err := db.Create(&ContainerSettings{ID: "l1", Name: "web", Image: "nginx:1.27", UpdateAvailable: true}).Error; err != nil {
+		t.Fatalf("seed container settings: %v", err)
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for _, snap := range []RunningSnapshot{
+		{Date: today.AddDate(0, 0, -1), Running: 9, Total: 10},
+		{Date: today, Running: 10, Total: 10},
+		{Date: today.AddDate(0, 0, -5), Running: 0, Total: 10},
+	} {
+		if err := db.Create(&snap).Error; err != nil {
+			t.Fatalf("seed snapshot: %v", err)
+		}
+	}
+
+	recap, err := srv.buildRecap(RecapSchedule{Name: "Daily"}, since, now)
+	if err != nil {
+		t.Fatalf("build recap: %v", err)
+	}
+	if recap.Total != 4 || recap.Success != 1 || recap.Failed != 1 {
+		t.Fatalf("unexpected counts %+v", recap)
+	}
+	if len(recap.Hosts) != 2 || recap.Hosts[0].Name != "local" || recap.Hosts[0].Success != 1 ||
+		recap.Hosts[1].Name != "edge-1" || recap.Hosts[1].Failed != 1 || recap.Hosts[1].Rollbacks != 1 || recap.Hosts[1].Total != 2 {
+		t.Fatalf("unexpected per-host breakdown %+v", recap.Hosts)
+	}
+	if len(recap.Failures) != 1 || recap.Failures[0].Container != "db" || len(recap.Rollbacks) != 1 || recap.Rollbacks[0].Container != "cache" {
+		t.Fatalf("unexpected failures %+v and rollbacks %+v", recap.Failures, recap.Rollbacks)
+	}
+	if len(recap.Pending) != 2 || recap.Pending[0].Host != "local" || recap.Pending[1].Container != "db" {
+		t.Fatalf("unexpected pending updates %+v", recap.Pending)
+	}
+	if len(recap.Offline) != 1 || recap.Offline[0].Name != "edge-2" {
+		t.Fatalf("unexpected offline agents %+v", recap.Offline)
+	}
+	if recap.Uptime == nil || len(recap.Uptime.Days) != 2 || recap.Uptime.Percent != 95 {
+		t.Fatalf("unexpected uptime %+v", recap.Uptime)
+	}
+	text := recapText(recap, time.UTC)
+	for _, want := range []string{"edge-1: 0 updated, 1 failed, 1 rolled back", "❌ Failures", "db on edge-1", "⬆️ Pending updates", "🔌 Offline agents", "Uptime: 95.0%"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected %q in the recap text:\n%s", want, text)
+		}
+	}
+
+	recap, err = srv.buildRecap(RecapSchedule{Name: "Failures", Sections: StringList{notify.RecapFailures}}, since, now)
+	if err != nil {
+		t.Fatalf("build recap: %v", err)
+	}
+	if len(recap.Failures) != 1 || recap.Hosts != nil || recap.Entries != nil || recap.Pending != nil || recap.Offline != nil || recap.Uptime != nil {
+		t.Fatalf("expected only the failures section, got %+v", recap)
+	}
+}
+
+func TestMaybeSendRecapsPersistsState(t *testing.T) {
+	srv, db := setupRecapServer(t)
+	ops, err := srv.notifyService.Create(domain.NotificationChannel{
+		Name: "ops", Type: "webhook", Enabled: true, Events: StringList{notify.EventRecap}, Config: domain.StringMap{"url": "http://127.0.0.1:1"},
+	})
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	weekly, err := srv.notifyService.Create(domain.NotificationChannel{
+		Name: "team", Type: "webhook", Enabled: true, Events: StringList{notify.EventUpdateFailure}, Config: domain.StringMap{"url": "http://127.0.0.1:2"},
+	})
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+
+	// A weekly recap that was due while the server was down, routed to a channel that is
+	// not subscribed to recaps.
+	lastSent := time.Now().Add(-8 * 24 * time.Hour)
+	schedule := RecapSchedule{Name: "Weekly", CronExpression: "0 9 * * 1", Enabled: true, Channels: StringList{weekly.ID}, LastSentAt: &lastSent}
+	if err := db.Create(&schedule).Error; err != nil {
+		t.Fatalf("create schedule: %v", err)
+	}
+	// Not due until the next minute matching the cron.
+	future := RecapSchedule{Name: "Later", CronExpression: "0 9 * * 1", Enabled: true}
+	if err := db.Create(&future).Error; err != nil {
+		t.Fatalf("create schedule: %v", err)
+	}
+
+	srv.maybeSendRecaps()
+	rows := recapDeliveries(t, db)
+	if len(rows) != 1 || rows[0].Target != weekly.ID {
+		t.Fatalf("expected the missed weekly recap to go to its channel only, got %+v", rows)
+	}
+	var msg notify.Message
+	if err := json.Unmarshal(rows[0].Message, &msg); err != nil {
+		t.Fatalf("decode delivery: %v", err)
+	}
+	if msg.Recap == nil || msg.Recap.Name != "Weekly" || !msg.Recap.Since.Equal(lastSent) {
+		t.Fatalf("expected the recap to cover the time since the last one, got %+v", msg.Recap)
+	}
+
+	var stored RecapSchedule
+	if err := db.First(&stored, "id = ?", schedule.ID).Error; err != nil {
+		t.Fatalf("load schedule: %v", err)
+	}
+	if stored.LastSentAt == nil || !stored.LastSentAt.After(lastSent) {
+		t.Fatalf("expected the last-sent time to be stored, got %v", stored.LastSentAt)
+	}
+
+	// A restart keeps the state: nothing is repeated.
+	srv.maybeSendRecaps()
+	if n := len(recapDeliveries(t, db)); n != 1 {
+		t.Fatalf("expected no duplicate recap, got %d deliveries", n)
+	}
+
+	// The settings recap time becomes a persisted schedule for the subscribed channels.
+	srv.cfg.Notifications.RecapTime = "07:30"
+	srv.syncSettingsRecap()
+	var settingsRecap RecapSchedule
+	if err := db.First(&settingsRecap, "id = ?", settingsRecapID).Error; err != nil {
+		t.Fatalf("load settings recap: %v", err)
+	}
+	if settingsRecap.CronExpression != "30 7 * * *" || !settingsRecap.Enabled || settingsRecap.LastSentAt == nil {
+		t.Fatalf("unexpected settings recap %+v", settingsRecap)
+	}
+	srv.maybeSendRecaps()
+	if n := len(recapDeliveries(t, db)); n != 1 {
+		t.Fatalf("expected a recap time already passed today to wait, got %d deliveries", n)
+	}
+	yesterday := settingsRecap.LastSentAt.Add(-24 * time.Hour)
+	if err := db.Model(&settingsRecap).Update("last_sent_at", yesterday).Error; err != nil {
+		t.Fatalf("rewind settings recap: %v", err)
+	}
+	srv.maybeSendRecaps()
+	rows = recapDeliveries(t, db)
+	if len(rows) != 2 || rows[1].Target != ops.ID {
+		t.Fatalf("expected the settings recap to go to the subscribed channel, got %+v", rows)
+	}
+
+	srv.cfg.Notifications.RecapTime = ""
+	srv.cfg.Notifications.NotificationCron = "0 7 1 * *"
+	srv.syncSettingsRecap()
+	if err := db.First(&settingsRecap, "id = ?", settingsRecapID).Error; err != nil {
+		t.Fatalf("load settings recap: %v", err)
+	}
+	if settingsRecap.CronExpression != "0 7 1 * *" || !settingsRecap.Enabled {
+		t.Fatalf("expected the cron override to apply, got %+v", settingsRecap)
+	}
+	srv.cfg.Notifications.NotificationCron = ""
+	srv.syncSettingsRecap()
+	if err := db.First(&settingsRecap, "id = ?", settingsRecapID).Error; err != nil {
+		t.Fatalf("load settings recap: %v", err)
+	}
+	if settingsRecap.Enabled {
+		t.Fatalf("expected clearing the recap time to disable the settings recap")
+	}
+}
+
+func TestSendRecapStoresStateOnceQueued(t *testing.T) {
+	srv, db := setupRecapServer(t)
+	ch, err := srv.notifyService.Create(domain.NotificationChannel{
+		Name: "ops", Type: "webhook", Enabled: true, Config: domain.StringMap{"url": "http://127.0.0.1:1"},
+	})
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	lastSent := time.Now().Add(-2 * 24 * time.Hour)
+	schedule := RecapSchedule{Name: "Daily", CronExpression: "0 9 * * *", Enabled: true, Channels: StringList{ch.ID}, LastSentAt: &lastSent}
+	if err := db.Create(&schedule).Error; err != nil {
+		t.Fatalf("create schedule: %v", err)
+	}
+	stored := func() time.Time {
+		var row RecapSchedule
+		if err := db.First(&row, "id = ?", schedule.ID).Error; err != nil || row.LastSentAt == nil {
+			t.Fatalf("load schedule: %v", err)
+		}
+		return *row.LastSentAt
+	}
+
+	// The outbox cannot take the recap: it is tried again on the next tick.
+	if err := db.Exec("ALTER TABLE notification_deliveries RENAME TO deliveries_away").Error; err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if err := srv.sendRecap(schedule, time.Now()); err == nil {
+		t.Fatalf("expected the queueing failure to be reported")
+	}
+	if !stored().Equal(lastSent) {
+		t.Fatalf("expected the last-sent time to stay at %v, got %v", lastSent, stored())
+	}
+
+	if err := db.Exec("ALTER TABLE deliveries_away RENAME TO notification_deliveries").Error; err != nil {
+		t.Fatalf("rename back: %v", err)
+	}
+	if err := srv.sendRecap(schedule, time.Now()); err != nil {
+		t.Fatalf("send recap: %v", err)
+	}
+	if !stored().After(lastSent) || len(recapDeliveries(t, db)) != 1 {
+		t.Fatalf("expected the recap to be queued and recorded, got %v", stored())
+	}
+}
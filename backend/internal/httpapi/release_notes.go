@@ -0,0 +1,196 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/notify"
+	"updockly/backend/internal/releases"
+)
+
+// Release notes are looked up when an update is found and stored per container. The
+// container view reuses them for releaseNotesTTL before looking them up again.
+const (
+	releaseNotesTTL      = 6 * time.Hour
+	releaseLookupTimeout = 30 * time.Second
+	// releaseTextLimit caps the releases listed in the plain-text notification body.
+	releaseTextLimit = 5
+)
+
+// lookupReleaseNotes reads the remote image labels and release notes for a container and
+// stores them. A lookup that fails part way is stored with its error, so the view can
+// show why; only database errors are returned.
+func (s *Server) lookupReleaseNotes(ctx context.Context, agentID, name, image string, labels map[string]string) (*ReleaseNotes, error) {
+	if s.releaseLookup == nil || strings.TrimSpace(image) == "" {
+		return nil, nil
+	}
+	notes, err := s.releaseLookup.Lookup(ctx, image, labels)
+	row := ReleaseNotes{
+		AgentID:         agentID,
+		ContainerName:   name,
+		Image:           image,
+		CurrentVersion:  notes.CurrentVersion,
+		CurrentRevision: notes.CurrentRevision,
+		Version:         notes.Version,
+		Revision:        notes.Revision,
+		Source:          notes.Source,
+		URL:             releaseNotesURL(map[string]string{ociSourceLabel: notes.Source}),
+		Releases:        notes.Releases,
+		CheckedAt:       time.Now(),
+	}
+	if err != nil {
+		row.Error = err.Error()
+		s.log.Debug("release notes: lookup failed", "container", name, "image", image, "error", err)
+	}
+	if s.db == nil || name == "" {
+		return &row, nil
+	}
+	silent := s.db.Session(&gorm.Session{Logger: logger.Discard})
+	var existing ReleaseNotes
+	if err := silent.Where("agent_id = ? AND container_name = ?", agentID, name).First(&existing).Error; err == nil {
+		row.ID, row.CreatedAt = existing.ID, existing.CreatedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if err := silent.Save(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// storedReleaseNotes returns the release notes last looked up for a container, if they
+// are for image.
+func (s *Server) storedReleaseNotes(agentID, name, image string) *ReleaseNotes {
+	if s.db == nil || name == "" {
+		return nil
+	}
+	var row ReleaseNotes
+	err := s.db.Session(&gorm.Session{Logger: logger.Discard}).
+		Where("agent_id = ? AND container_name = ? AND image = ?", agentID, name, image).First(&row).Error
+	if err != nil {
+		return nil
+	}
+	return &row
+}
+
+// releaseInfo converts stored release notes for a notification; nil when nothing about
+// the new version is known.
+func releaseInfo(row *ReleaseNotes) *notify.ReleaseInfo {
+	if row == nil || (row.Version == "" && row.Source == "" && len(row.Releases) == 0) {
+		return nil
+	}
+	return &notify.ReleaseInfo{
+		CurrentVersion: row.CurrentVersion,
+		Version:        row.Version,
+		Revision:       row.Revision,
+		Source:         row.Source,
+		URL:            row.URL,
+		Releases:       row.Releases,
+	}
+}
+
+// releaseText is the plain-text summary appended to update notifications.
+func releaseText(info *notify.ReleaseInfo) string {
+	if info == nil {
+		return ""
+	}
+	var b strings.Builder
+	switch {
+	case info.Version != "" && info.CurrentVersion != "" && info.Version != info.CurrentVersion:
+		fmt.Fprintf(&b, "\nVersion: %s → %s", info.CurrentVersion, info.Version)
+	case info.Version != "":
+		fmt.Fprintf(&b, "\nVersion: %s", info.Version)
+	}
+	if info.URL != "" {
+		fmt.Fprintf(&b, "\nRelease notes: %s", info.URL)
+	}
+	for i, r := range info.Releases {
+		if i == releaseTextLimit {
+			fmt.Fprintf(&b, "\n  … and %d more", len(info.Releases)-i)
+			break
+		}
+		title := r.Tag
+		if r.Name != "" && r.Name != r.Tag {
+			title = fmt.Sprintf("%s (%s)", r.Tag, r.Name)
+		}
+		if r.URL != "" {
+			title += ": " + r.URL
+		}
+		fmt.Fprintf(&b, "\n  • %s", title)
+	}
+	return b.String()
+}
+
+// containerReleaseNotesHandler returns the release notes of a local container, looking
+// them up again when they are stale, for another image, or ?refresh=true is set.
+func (s *Server) containerReleaseNotesHandler(c *gin.Context) {
+	if s.containerService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "docker unavailable"})
+		return
+	}
+	name, image, labels, err := s.containerService.Describe(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("container not found: %v", err)})
+		return
+	}
+	s.respondReleaseNotes(c, "", name, image, labels)
+}
+
+// agentContainerReleaseNotesHandler does the same for an agent container, using the
+// labels of its last snapshot.
+func (s *Server) agentContainerReleaseNotesHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	var agent Agent
+	if err := s.db.First(&agent, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	containerID := c.Param("containerId")
+	for _, cont := range agent.Containers {
+		if cont.ID != containerID {
+			continue
+		}
+		s.respondReleaseNotes(c, agent.ID, cont.Name, cont.Image, snapshotLabels(cont))
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "container not found"})
+}
+
+func (s *Server) respondReleaseNotes(c *gin.Context, agentID, name, image string, labels map[string]string) {
+	row := s.storedReleaseNotes(agentID, name, image)
+	if row == nil || c.Query("refresh") == "true" || time.Since(row.CheckedAt) > releaseNotesTTL {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), releaseLookupTimeout)
+		defer cancel()
+		fresh, err := s.lookupReleaseNotes(ctx, agentID, name, image, labels)
+		if err != nil {
+			respondInternal(c, "failed to store release notes", wrapErr("store release notes", err))
+			return
+		}
+		row = fresh
+	}
+	if row == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "release notes unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, row)
+}
+
+// newReleaseLookup reads labels anonymously from registries and release notes from
+// GitHub, authenticated when GITHUB_TOKEN is set.
+func newReleaseLookup(token string) *releases.Lookup {
+	return &releases.Lookup{
+		Registry: &releases.Registry{},
+		GitHub:   &releases.GitHubClient{Token: token},
+	}
+}
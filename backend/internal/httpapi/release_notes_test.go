@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/notify"
+	"updockly/backend/internal/releases"
+)
+
+// startReleaseStubs serves acme/app:1.1 labelled version 1.1.0 and its GitHub releases,
+// counting registry requests.
+func startReleaseStubs(t *testing.T) (*releases.Lookup, string, *atomic.Int32) {
+	t.Helper()
+	configDigest := "sha256:" + strings.Repeat("c", 64)
+	var hits atomic.Int32
+	registry := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/v2/acme/app/manifests/1.1":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			_, _ = w.Write([]byte(`{"schemaVersion":2,"config":{"digest":"` + configDigest + `","size":1}}`))
+		case "/v2/acme/app/blobs/" + configDigest:
+			_, _ = w.Write([]byte(`{"config":{"Labels":{"org.opencontainers.image.version":"1.1.0","org.opencontainers.image.source":"https://github.com/acme/app"}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(registry.Close)
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"tag_name":"v1.1.0","name":"Export","html_url":"https://github.com/acme/app/releases/tag/v1.1.0","body":"Adds export."},{"tag_name":"v1.0.0"}]`))
+	}))
+	t.Cleanup(github.Close)
+	lookup := &releases.Lookup{
+		Registry: &releases.Registry{Client: registry.Client()},
+		GitHub:   &releases.GitHubClient{BaseURL: github.URL},
+	}
+	return lookup, strings.TrimPrefix(registry.URL, "https://") + "/acme/app:1.1", &hits
+}
+
+func TestUpdateNotificationsCarryReleaseNotes(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.ReleaseNotes{}, &domain.NotificationChannel{}, &domain.NotificationRule{},
+		&domain.NotificationTemplate{}, &domain.NotificationDelivery{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	lookup, image, hits := startReleaseStubs(t)
+	srv := &Server{db: db, cfg: config.Config{ClientOrigin: "https://updockly.example"}, log: slog.Default(), timezone: time.UTC,
+		notifyService: notify.NewService(db, nil), releaseLookup: lookup}
+	if _, err := srv.notifyService.Create(domain.NotificationChannel{
+		Name: "ops", Type: "webhook", Enabled: true, Events: StringList{notify.EventUpdateAvailable, notify.EventUpdateSuccess},
+		Config: domain.StringMap{"url": "http://127.0.0.1:1"},
+	}); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	agent := Agent{ID: "a1", Name: "edge-1", Containers: ContainerSnapshotList{
+		{ID: "c1", Name: "app", Image: image, UpdateAvailable: true, Labels: []string{releases.LabelVersion + "=1.0.0"}},
+	}}
+	if err := db.Create(&agent).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+
+	srv.notifyUpdateAvailable(&agent, "c1", "app", image)
+	var rows []domain.NotificationDelivery
+	if err := db.Order("id ASC").Find(&rows).Error; err != nil || len(rows) != 1 {
+		t.Fatalf("expected one delivery, got %d (%v)", len(rows), err)
+	}
+	var msg notify.Message
+	if err := json.Unmarshal(rows[0].Message, &msg); err != nil {
+		t.Fatalf("decode delivery: %v", err)
+	}
+	release := msg.Container.Release
+	if release == nil || release.CurrentVersion != "1.0.0" || release.Version != "1.1.0" || release.URL != "https://github.com/acme/app/releases" ||
+		len(release.Releases) != 1 || release.Releases[0].Body != "Adds export." {
+		t.Fatalf("unexpected release info %+v", release)
+	}
+	if !strings.Contains(msg.Body, "Version: 1.0.0 → 1.1.0") || !strings.Contains(msg.Body, "v1.1.0 (Export)") {
+		t.Fatalf("expected the version change in the body:\n%s", msg.Body)
+	}
+
+	// The success notification reuses the stored notes.
+	success, ok := srv.historyMessage(UpdateHistory{AgentID: "a1", AgentName: "edge-1", ContainerName: "app", Image: image, Status: "success", CreatedAt: time.Now()}, "")
+	if !ok || success.Container.Release == nil || success.Container.Release.Version != "1.1.0" {
+		t.Fatalf("expected the success message to carry the release notes, got %+v", success.Container)
+	}
+
+	// The container view serves the stored notes without another lookup.
+	before := hits.Load()
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/agents/a1/containers/c1/release-notes", nil)
+	c.Params = gin.Params{{Key: "id", Value: "a1"}, {Key: "containerId", Value: "c1"}}
+	srv.agentContainerReleaseNotesHandler(c)
+	var served ReleaseNotes
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &served) != nil || served.Version != "1.1.0" {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	if hits.Load() != before {
+		t.Fatalf("expected cached notes to be served")
+	}
+}
@@ -1,11 +1,13 @@
 package httpapi
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 
+	"updockly/backend/internal/auth"
 	"updockly/backend/internal/logging"
 )
 
@@ -34,3 +36,19 @@ func wrapErr(msg string, err error) error {
 func respondInternal(c *gin.Context, msg string, err error) {
 	respondError(c, http.StatusInternalServerError, msg, err)
 }
+
+// respondPasswordPolicy answers with the policy violations when err is a password policy error.
+func respondPasswordPolicy(c *gin.Context, err error) bool {
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+	if policyErr.Err != nil {
+		logging.FromContext(c).Warn("password policy check failed", "error", policyErr.Err, "path", c.FullPath())
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      policyErr.Error(),
+		"violations": policyErr.Violations,
+	})
+	return true
+}
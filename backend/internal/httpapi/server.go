@@ -17,21 +17,27 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
-	"gorm.io/driver/sqlite"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"gorm.io/gorm"
 
 	"updockly/backend/internal/agents"
+	"updockly/backend/internal/approvals"
 	"updockly/backend/internal/audit"
 	"updockly/backend/internal/auth"
 	"updockly/backend/internal/certs"
 	"updockly/backend/internal/config"
 	"updockly/backend/internal/containers"
-	"updockly/backend/internal/domain"
+	"updockly/backend/internal/database"
 	"updockly/backend/internal/history"
 	"updockly/backend/internal/logging"
 	"updockly/backend/internal/metrics"
+	"updockly/backend/internal/notify"
+	"updockly/backend/internal/releases"
 	"updockly/backend/internal/settings"
+	"updockly/backend/internal/snapshots"
+	"updockly/backend/internal/stats"
+	"updockly/backend/internal/throttle"
+	"updockly/backend/internal/tracing"
 	"updockly/backend/internal/vault"
 )
 
@@ -46,31 +52,35 @@ type Server struct {
 	timezone  *time.Location
 	startedAt time.Time
 
-	lastRecapDate   string
-	recapPrimed     bool
-	offlineNotified map[string]bool
-	offlineMu       sync.Mutex
-	autoUpdateRun   atomic.Bool
+	lastDigestCheck   time.Time
+	lastHistoryPrune  time.Time
+	lastStatsPrune    time.Time
+	lastRunningSample time.Time
+	digestCheckRun    atomic.Bool
+	offlineNotified   map[string]bool
+	offlineMu         sync.Mutex
+	autoUpdateRun     atomic.Bool
 
 	agentService     *agents.AgentService
+	approvalService  *approvals.Service
 	authService      *auth.AuthService
+	webauthnService  *auth.WebAuthnService
 	auditService     *audit.Service
 	containerService *containers.ContainerService
 	certManager      *certs.CertManager
 
 	historyService *history.Service
 	metricsService *metrics.Service
+	notifyService  *notify.Service
+	outbox         *notify.Outbox
+	releaseLookup  *releases.Lookup
 
-	loginAttempts map[string]loginAttempt
-	loginMu       sync.Mutex
+	loginLimiter throttle.Limiter
+	resetLimiter throttle.Limiter
 
-	settingsStore *settings.Store
-}
-
-type loginAttempt struct {
-	count        int
-	lastAttempt  time.Time
-	blockedUntil time.Time
+	settingsStore   *settings.Store
+	snapshotService *snapshots.Service
+	statsService    *stats.Service
 }
 
 const (
@@ -116,6 +126,7 @@ func New(cfg config.Config, db *gorm.DB) (*Server, error) {
 
 	router := gin.New()
 	router.Use(gin.Recovery())
+	router.Use(otelgin.Middleware(tracing.ServiceName, otelgin.WithFilter(tracedRequest)))
 	router.Use(logging.Middleware(logger))
 
 	srv := &Server{
@@ -127,18 +138,26 @@ func New(cfg config.Config, db *gorm.DB) (*Server, error) {
 		jwtSecret:        []byte(cfg.JWTSecret),
 		timezone:         loc,
 		startedAt:        time.Now(),
-		recapPrimed:      false,
 		offlineNotified:  make(map[string]bool),
 		agentService:     agents.NewAgentService(db, cfg.AgentRequireIPBinding),
+		approvalService:  approvals.NewService(db),
 		authService:      auth.NewAuthService(db, vaultSvc, cfg.JWTSecret, cfg.SecretKey, cfg.JWTSecretPrevious),
-		auditService:     audit.NewService(db),
-		containerService: containers.NewContainerService(db),
+		auditService:     audit.NewService(db, vaultSvc.MACKeys(audit.KeyPurpose)...),
+		containerService: containers.NewContainerService(db, cfg.RollbackImages),
 		certManager:      certManager,
-		loginAttempts:    make(map[string]loginAttempt),
+		loginLimiter:     newLoginLimiter(db),
+		resetLimiter:     newResetLimiter(db),
 		historyService:   history.NewService(db),
+		snapshotService:  snapshots.NewService(db),
+		statsService:     stats.NewService(db),
 		metricsService:   metrics.NewService(db, loc),
+		notifyService:    notify.NewService(db, vaultSvc),
+		releaseLookup:    newReleaseLookup(cfg.GitHubToken),
 							settingsStore:    settings.NewStore(db, vaultSvc),	}
 
+	srv.webauthnService = srv.newWebAuthnService(db)
+	srv.outbox = notify.NewOutbox(srv.settingsNotifier, srv.log)
+
 	srv.configureMiddleware()
 	srv.registerRoutes()
 
@@ -177,6 +196,7 @@ func (s *Server) configureMiddleware() {
 		AllowOrigins:     origins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Agent-Token"},
+		ExposeHeaders:    []string{"X-Next-Cursor", "Content-Disposition"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -194,21 +214,25 @@ func (s *Server) configureMiddleware() {
 func (s *Server) registerRoutes() {
 	s.router.GET("/health", s.healthHandler)
 	s.router.GET("/api/health", s.healthHandler)
+	s.router.GET("/metrics", s.metricsHandler)
 
 	auth := s.router.Group("/api/auth")
 	{
 		auth.GET("/config", s.publicConfigHandler)
 		auth.POST("/login", s.loginHandler)
 		auth.POST("/refresh", s.refreshHandler)
-		auth.POST("/logout", s.authMiddleware(), s.logoutHandler)
+		auth.POST("/logout", s.authMiddleware(sessionPasswordChange, sessionKeyEnrollment), s.logoutHandler)
 		auth.POST("/reset-password", s.resetPasswordHandler)
 		auth.POST("/forgot-password", s.forgotPasswordHandler)
 		auth.POST("/reset-password-token", s.resetPasswordWithTokenHandler)
 		auth.POST("/2fa/verify", s.verify2FAHandler)
+		auth.POST("/2fa/webauthn/begin", s.webauthnSecondFactorBeginHandler)
+		auth.POST("/webauthn/login/begin", s.webauthnLoginBeginHandler)
+		auth.POST("/webauthn/login/finish", s.webauthnLoginFinishHandler)
 		auth.POST("/2fa/reset/init", s.reset2FAInitHandler)
 		auth.POST("/2fa/reset/finalize", s.reset2FAFinalizeHandler)
-		auth.GET("/me", s.authMiddleware(), s.profileHandler)
-		auth.PUT("/me", s.authMiddleware(), s.updateProfileHandler)
+		auth.GET("/me", s.authMiddleware(sessionPasswordChange, sessionKeyEnrollment), s.profileHandler)
+		auth.PUT("/me", s.authMiddleware(sessionPasswordChange), s.updateProfileHandler)
 		auth.GET("/sso/login", s.ssoLoginHandler)
 		auth.GET("/sso/callback", s.ssoCallbackHandler)
 	}
@@ -227,6 +251,12 @@ func (s *Server) registerRoutes() {
 	api.GET("/agents/commands/next", s.agentNextCommandHandler)
 	api.POST("/agents/commands/:id/report", s.agentCommandReportHandler)
 	api.GET("/metrics/running-history", s.runningHistoryHandler)
+	api.GET("/update-approvals/:id/decision", s.updateApprovalLinkHandler)
+	api.POST("/update-approvals/:id/decision", s.updateApprovalDecisionHandler)
+	// Admins who must use a hardware key can register one before anything else.
+	api.POST("/2fa/webauthn/register/begin", s.authMiddleware(sessionKeyEnrollment), s.webauthnRegisterBeginHandler)
+	api.POST("/2fa/webauthn/register/finish", s.authMiddleware(sessionKeyEnrollment), s.webauthnRegisterFinishHandler)
+	api.GET("/2fa/webauthn/credentials", s.authMiddleware(sessionKeyEnrollment), s.listWebAuthnCredentialsHandler)
 	api.Use(s.authMiddleware())
 	{
 		api.GET("/dashboard", s.dashboardHandler)
@@ -240,20 +270,53 @@ func (s *Server) registerRoutes() {
 		api.POST("/containers/:id/stop", s.stopContainerHandler)
 		api.POST("/containers/:id/restart", s.restartContainerHandler)
 		api.GET("/containers/:id/logs", s.containerLogsHandler)
+		api.GET("/containers/:id/release-notes", s.containerReleaseNotesHandler)
 		api.GET("/containers/auto-update/count", s.countAutoUpdateContainers)
 		api.GET("/history", s.listUpdateHistory)
+		api.GET("/history/counts", s.countUpdateHistory)
+		api.GET("/history/export", s.exportUpdateHistory)
+		api.POST("/history/prune", s.requireAdmin(), s.pruneUpdateHistory)
 		api.DELETE("/history/:id", s.deleteUpdateHistory)
 
 		api.POST("/2fa/generate", s.generate2FAHandler)
 		api.POST("/2fa/enable", s.enable2FAHandler)
 		api.POST("/2fa/disable", s.disable2FAHandler)
 		api.POST("/2fa/regenerate", s.regenerateRecoveryCodesHandler)
+		api.PUT("/2fa/webauthn/credentials/:id", s.renameWebAuthnCredentialHandler)
+		api.DELETE("/2fa/webauthn/credentials/:id", s.deleteWebAuthnCredentialHandler)
 
 		api.GET("/settings", s.getSettings)
 		api.PUT("/settings", s.updateSettings)
 		api.GET("/audit-logs", s.listAuditLogs)
+		api.GET("/audit-logs/export", s.requireAdmin(), s.exportAuditLogs)
+		api.GET("/audit-logs/verify", s.requireAdmin(), s.verifyAuditLogs)
+		api.GET("/security/lockouts", s.requireAdmin(), s.listLockoutsHandler)
+		api.POST("/security/lockouts/unlock", s.requireAdmin(), s.unlockLockoutHandler)
 		api.POST("/notifications/test", s.testNotificationHandler)
 		api.POST("/notifications/test-email", s.testEmailHandler)
+		api.GET("/notifications/channel-types", s.requireAdmin(), s.listNotificationChannelTypesHandler)
+		api.GET("/notifications/channels", s.requireAdmin(), s.listNotificationChannelsHandler)
+		api.POST("/notifications/channels", s.requireAdmin(), s.createNotificationChannelHandler)
+		api.PUT("/notifications/channels/:id", s.requireAdmin(), s.updateNotificationChannelHandler)
+		api.DELETE("/notifications/channels/:id", s.requireAdmin(), s.deleteNotificationChannelHandler)
+		api.POST("/notifications/channels/:id/test", s.requireAdmin(), s.testNotificationChannelHandler)
+		api.GET("/notifications/rules", s.requireAdmin(), s.listNotificationRulesHandler)
+		api.POST("/notifications/rules", s.requireAdmin(), s.createNotificationRuleHandler)
+		api.POST("/notifications/rules/evaluate", s.requireAdmin(), s.evaluateNotificationRulesHandler)
+		api.PUT("/notifications/rules/:id", s.requireAdmin(), s.updateNotificationRuleHandler)
+		api.DELETE("/notifications/rules/:id", s.requireAdmin(), s.deleteNotificationRuleHandler)
+		api.GET("/notifications/templates", s.requireAdmin(), s.listNotificationTemplatesHandler)
+		api.PUT("/notifications/templates", s.requireAdmin(), s.saveNotificationTemplateHandler)
+		api.POST("/notifications/templates/preview", s.requireAdmin(), s.previewNotificationTemplateHandler)
+		api.DELETE("/notifications/templates/:id", s.requireAdmin(), s.deleteNotificationTemplateHandler)
+		api.GET("/notifications/recaps", s.requireAdmin(), s.listRecapSchedulesHandler)
+		api.POST("/notifications/recaps", s.requireAdmin(), s.createRecapScheduleHandler)
+		api.PUT("/notifications/recaps/:id", s.requireAdmin(), s.updateRecapScheduleHandler)
+		api.DELETE("/notifications/recaps/:id", s.requireAdmin(), s.deleteRecapScheduleHandler)
+		api.POST("/notifications/recaps/:id/preview", s.requireAdmin(), s.previewRecapScheduleHandler)
+		api.GET("/notifications/deliveries", s.requireAdmin(), s.listNotificationDeliveriesHandler)
+		api.GET("/notifications/deliveries/:id", s.requireAdmin(), s.getNotificationDeliveryHandler)
+		api.POST("/notifications/deliveries/:id/resend", s.requireAdmin(), s.resendNotificationDeliveryHandler)
 		api.GET("/agents", s.listAgentsHandler)
 		api.POST("/agents", s.createAgentHandler)
 		api.PUT("/agents/:id", s.updateAgentHandler)
@@ -264,7 +327,19 @@ func (s *Server) registerRoutes() {
 		api.POST("/agents/:id/containers/:containerId/restart", s.restartAgentContainerHandler)
 		api.POST("/agents/:id/containers/:containerId/rollback", s.rollbackAgentContainerHandler)
 		api.Any("/agents/:id/containers/:containerId/logs", s.agentContainerLogsHandler)
+		api.GET("/agents/:id/containers/:containerId/release-notes", s.agentContainerReleaseNotesHandler)
+		api.GET("/agents/:id/stats", s.agentStatsHandler)
+		api.GET("/metrics/running", s.runningSeriesHandler)
+		api.GET("/metrics/uptime", s.containerUptimeHandler)
 		api.POST("/agents/:id/commands", s.createAgentCommandHandler)
+		api.GET("/update-approvals", s.requireAdmin(), s.listUpdateApprovalsHandler)
+		api.POST("/update-approvals/:id/approve", s.requireAdmin(), s.approveUpdateHandler)
+		api.POST("/update-approvals/:id/reject", s.requireAdmin(), s.rejectUpdateHandler)
+		api.GET("/config-snapshots", s.requireAdmin(), s.listConfigSnapshotsHandler)
+		api.POST("/config-snapshots", s.requireAdmin(), s.captureConfigSnapshotHandler)
+		api.GET("/config-snapshots/diff", s.requireAdmin(), s.diffConfigSnapshotsHandler)
+		api.GET("/config-snapshots/:id", s.requireAdmin(), s.getConfigSnapshotHandler)
+		api.POST("/config-snapshots/:id/restore", s.requireAdmin(), s.restoreConfigSnapshotHandler)
 		api.DELETE("/agents/:id", s.deleteAgentHandler)
 		api.GET("/schedules", s.listSchedules)
 		api.POST("/schedules", s.createSchedule)
@@ -281,6 +356,7 @@ func (s *Server) Run(ctx context.Context) error {
 	}
 
 	go s.startNotificationScheduler(ctx)
+	go s.outbox.Run(ctx, func() *notify.Service { return s.notifyService })
 	go s.startAutoUpdateScheduler(ctx)
 
 	go func() {
@@ -303,14 +379,19 @@ func (s *Server) markAgentOfflineNotified(id string) bool {
 	return true
 }
 
-func (s *Server) clearAgentOfflineNotified(id string) {
+// clearAgentOfflineNotified reports whether the agent had been flagged offline.
+func (s *Server) clearAgentOfflineNotified(id string) bool {
 	s.offlineMu.Lock()
 	defer s.offlineMu.Unlock()
+	if !s.offlineNotified[id] {
+		return false
+	}
 	delete(s.offlineNotified, id)
+	return true
 }
 
 func (s *Server) issueSession(c *gin.Context, acc *Account) error {
-	access, err := s.authService.IssueToken(*acc, "", accessTokenTTL)
+	access, err := s.authService.IssueToken(*acc, s.sessionType(acc), accessTokenTTL)
 	if err != nil {
 		return err
 	}
@@ -385,54 +466,6 @@ func (s *Server) verifyState(stateParam, stateCookie string) bool {
 	return subtle.ConstantTimeCompare([]byte(sig), []byte(expected)) == 1
 }
 
-func (s *Server) loginKey(username, ip string) string {
-	user := strings.ToLower(strings.TrimSpace(username))
-	return fmt.Sprintf("%s|%s", user, ip)
-}
-
-func (s *Server) isLoginBlocked(key string) (time.Duration, bool) {
-	s.loginMu.Lock()
-	defer s.loginMu.Unlock()
-	state, ok := s.loginAttempts[key]
-	if !ok {
-		return 0, false
-	}
-	now := time.Now()
-	if state.blockedUntil.After(now) {
-		return time.Until(state.blockedUntil), true
-	}
-	// Reset stale counters after inactivity
-	if now.Sub(state.lastAttempt) > 30*time.Minute {
-		delete(s.loginAttempts, key)
-		return 0, false
-	}
-	return 0, false
-}
-
-func (s *Server) recordLoginFailure(key string) {
-	s.loginMu.Lock()
-	defer s.loginMu.Unlock()
-	state := s.loginAttempts[key]
-	now := time.Now()
-	state.lastAttempt = now
-	state.count++
-	if state.count >= 5 {
-		state.blockedUntil = now.Add(15 * time.Minute)
-		s.log.Warn("login throttle block",
-			"key", key,
-			"blocked_until", state.blockedUntil.Format(time.RFC3339),
-			"failures", state.count,
-		)
-	}
-	s.loginAttempts[key] = state
-}
-
-func (s *Server) clearLoginFailures(key string) {
-	s.loginMu.Lock()
-	defer s.loginMu.Unlock()
-	delete(s.loginAttempts, key)
-}
-
 // reencryptVaultSecrets migrates stored secrets to the primary vault key to complete rotation.
 func (s *Server) reencryptVaultSecrets() {
 	if s.db == nil || s.vault == nil {
@@ -449,7 +482,7 @@ func (s *Server) reencryptVaultSecrets() {
 		}
 		secret, usedPrimary, err := s.vault.DecryptWithInfo(acc.TwoFactorSecret)
 		if err != nil {
-			fmt.Printf("Warning: failed to decrypt 2FA secret for account %s: %v\n", acc.ID, err)
+			s.log.Warn("failed to decrypt 2FA secret", "account_id", acc.ID, "error", err)
 			continue
 		}
 		if usedPrimary {
@@ -457,11 +490,11 @@ func (s *Server) reencryptVaultSecrets() {
 		}
 		enc, err := s.vault.Encrypt(secret)
 		if err != nil {
-			fmt.Printf("Warning: failed to re-encrypt 2FA secret for account %s: %v\n", acc.ID, err)
+			s.log.Warn("failed to re-encrypt 2FA secret", "account_id", acc.ID, "error", err)
 			continue
 		}
 		if err := s.db.Model(&Account{}).Where("id = ?", acc.ID).Update("two_factor_secret", enc).Error; err != nil {
-			fmt.Printf("Warning: failed to update rotated 2FA secret for account %s: %v\n", acc.ID, err)
+			s.log.Warn("failed to update rotated 2FA secret", "account_id", acc.ID, "error", err)
 		}
 	}
 }
@@ -504,9 +537,21 @@ func (s *Server) applyRuntimeSettings(runtimeSettings config.RuntimeSettings) {
 	s.cfg.SecretKey = runtimeSettings.SecretKey
 	s.cfg.HideSupportButton = runtimeSettings.HideSupport
 	s.cfg.Timezone = runtimeSettings.Timezone
+	if runtimeSettings.LogLevel != "" && logging.SetLevel(runtimeSettings.LogLevel) == nil {
+		s.cfg.LogLevel = runtimeSettings.LogLevel
+	}
 	s.cfg.AutoPruneImages = runtimeSettings.AutoPrune
 	s.cfg.Notifications = runtimeSettings.Notifications
+	// Email channels without their own server use the SMTP settings, when enabled.
+	if s.cfg.Notifications.SMTP.Enabled {
+		notify.SetDefaultSMTP(s.smtpServer())
+	} else {
+		notify.SetDefaultSMTP(notify.SMTP{})
+	}
 	s.cfg.SSO = runtimeSettings.SSO
+	s.cfg.WebAuthn = runtimeSettings.WebAuthn
+	s.cfg.PasswordPolicy = runtimeSettings.PasswordPolicy
+	s.cfg.LDAP = runtimeSettings.LDAP
 
 	if s.cfg.SecretKey != "" {
 		// Preserve existing vault/jwt keys; do not overwrite them with legacy secret.
@@ -523,40 +568,24 @@ func (s *Server) applyRuntimeSettings(runtimeSettings config.RuntimeSettings) {
 
 	// If the database URL has changed or if s.db is nil (initial setup), attempt to connect.
 	if s.cfg.DatabaseURL != "" && (s.db == nil || s.cfg.DatabaseURL != oldDBURL) {
-		var dial gorm.Dialector
-		lower := strings.ToLower(s.cfg.DatabaseURL)
-		switch {
-		case strings.HasPrefix(lower, "postgres://") || strings.HasPrefix(lower, "postgresql://"):
-			dial = postgres.Open(s.cfg.DatabaseURL)
-		case strings.HasPrefix(lower, "sqlite://"):
-			dsn := strings.TrimPrefix(s.cfg.DatabaseURL, "sqlite://")
-			dial = sqlite.Open(dsn)
-		}
-
-		if dial != nil {
-			if db, err := gorm.Open(dial, &gorm.Config{}); err == nil {
-				if err := db.AutoMigrate(
-					&Account{},
-					&ContainerSettings{},
-					&Schedule{},
-					&Agent{},
-					&AgentCommand{},
-					&UpdateHistory{},
-					&RunningSnapshot{},
-					&domain.AuditLog{},
-					&settings.Record{},
-				); err == nil {
-					s.db = db
-					s.agentService = agents.NewAgentService(db, s.cfg.AgentRequireIPBinding)
-					s.authService = auth.NewAuthService(db, s.vault, s.cfg.JWTSecret, s.cfg.SecretKey, s.cfg.JWTSecretPrevious)
-					s.auditService = audit.NewService(db)
-					s.containerService = containers.NewContainerService(db)
-					s.historyService = history.NewService(db)
-					s.metricsService = metrics.NewService(db, s.timezone)
-					s.settingsStore = settings.NewStore(db, s.vault)
-					s.reencryptVaultSecrets()
-				}
-			}
+		db, err := database.Connect(s.cfg)
+		if err == nil {
+			s.db = db
+			s.agentService = agents.NewAgentService(db, s.cfg.AgentRequireIPBinding)
+			s.approvalService = approvals.NewService(db)
+			s.authService = auth.NewAuthService(db, s.vault, s.cfg.JWTSecret, s.cfg.SecretKey, s.cfg.JWTSecretPrevious)
+			s.auditService = audit.NewService(db, s.vault.MACKeys(audit.KeyPurpose)...)
+			s.containerService = containers.NewContainerService(db, s.cfg.RollbackImages)
+			s.historyService = history.NewService(db)
+			s.snapshotService = snapshots.NewService(db)
+			s.statsService = stats.NewService(db)
+			s.metricsService = metrics.NewService(db, s.timezone)
+			s.settingsStore = settings.NewStore(db, s.vault)
+			s.loginLimiter = newLoginLimiter(db)
+			s.resetLimiter = newResetLimiter(db)
+			s.reencryptVaultSecrets()
+		} else if s.log != nil {
+			s.log.Warn("failed to connect to the configured database", "error", err)
 		}
 	}
 
@@ -567,5 +596,10 @@ func (s *Server) applyRuntimeSettings(runtimeSettings config.RuntimeSettings) {
 		s.cfg.DBName = db
 	}
 
+	s.webauthnService = s.newWebAuthnService(s.db)
+	s.authService.SetPasswordPolicy(s.cfg.PasswordPolicy)
+	s.authService.SetLDAP(s.cfg.LDAP)
+	s.notifyService = notify.NewService(s.db, s.vault)
+
 	s.reencryptVaultSecrets()
 }
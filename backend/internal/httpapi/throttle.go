@@ -0,0 +1,168 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/throttle"
+)
+
+// Throttle scopes keep counters for different endpoints independent.
+const (
+	throttleScopeLogin          = "login"
+	throttleScopeForgotPassword = "forgot-password"
+	throttleScope2FAVerify      = "2fa-verify"
+	throttleScope2FAReset       = "2fa-reset"
+)
+
+func newLoginLimiter(db *gorm.DB) throttle.Limiter {
+	return newLimiter(db, throttle.DefaultPolicy())
+}
+
+// newResetLimiter rate-limits password reset emails. Requests are not failures, so the
+// limit neither escalates nor shows up as a lockout in the audit log.
+func newResetLimiter(db *gorm.DB) throttle.Limiter {
+	return newLimiter(db, throttle.RequestPolicy())
+}
+
+func newLimiter(db *gorm.DB, policy throttle.Policy) throttle.Limiter {
+	if db == nil {
+		return throttle.NewMemoryLimiter(policy)
+	}
+	return throttle.NewDBLimiter(db, policy)
+}
+
+func throttleKey(scope, subject, ip string) string {
+	return fmt.Sprintf("%s|%s|%s", scope, strings.ToLower(strings.TrimSpace(subject)), ip)
+}
+
+func (s *Server) loginKey(username, ip string) string {
+	return throttleKey(throttleScopeLogin, username, ip)
+}
+
+// isLoginBlocked fails open when the limiter backend is unavailable so a database
+// hiccup cannot lock everyone out.
+func (s *Server) isLoginBlocked(key string) (time.Duration, bool) {
+	return s.isBlocked(s.loginLimiter, key)
+}
+
+func (s *Server) isBlocked(limiter throttle.Limiter, key string) (time.Duration, bool) {
+	retryAfter, blocked, err := limiter.Check(key)
+	if err != nil {
+		s.log.Error("login throttle check failed", "key", key, "error", err)
+		return 0, false
+	}
+	return retryAfter, blocked
+}
+
+// rejectIfThrottled writes a 429 and returns true when the key is locked.
+func (s *Server) rejectIfThrottled(c *gin.Context, key string) bool {
+	return s.rejectIfLimited(c, s.loginLimiter, key)
+}
+
+func (s *Server) rejectIfLimited(c *gin.Context, limiter throttle.Limiter, key string) bool {
+	retryAfter, blocked := s.isBlocked(limiter, key)
+	if !blocked {
+		return false
+	}
+	logging.FromContext(c).Warn("request throttled", "key", key, "retry_after", retryAfter.String())
+	c.Header("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      "too many failed attempts, try again later",
+		"retryAfter": retryAfter.String(),
+	})
+	return true
+}
+
+func (s *Server) recordLoginFailure(c *gin.Context, key, subject string) {
+	res, err := s.loginLimiter.Fail(key)
+	if err != nil {
+		s.log.Error("login throttle update failed", "key", key, "error", err)
+		return
+	}
+	if !res.Locked || res.State.BlockedUntil == nil {
+		return
+	}
+	s.log.Warn("login throttle block",
+		"key", key,
+		"blocked_until", res.State.BlockedUntil.Format(time.RFC3339),
+		"lockouts", res.State.Lockouts,
+	)
+	if s.auditService == nil {
+		return
+	}
+	ip := ""
+	if c != nil {
+		ip = c.ClientIP()
+	}
+	_ = s.auditService.RecordEvent(audit.Event{
+		ActorName:  subject,
+		Action:     "throttle-lockout",
+		TargetType: "lockout",
+		TargetID:   key,
+		Details:    fmt.Sprintf("Locked %s until %s (lockout #%d)", key, res.State.BlockedUntil.Format(time.RFC3339), res.State.Lockouts),
+		IPAddress:  ip,
+	})
+}
+
+// countResetRequest counts a password reset request against its rate limit.
+func (s *Server) countResetRequest(key string) {
+	if _, err := s.resetLimiter.Fail(key); err != nil {
+		s.log.Error("reset request throttle update failed", "key", key, "error", err)
+	}
+}
+
+func (s *Server) clearLoginFailures(key string) {
+	if err := s.loginLimiter.Reset(key); err != nil {
+		s.log.Error("login throttle reset failed", "key", key, "error", err)
+	}
+}
+
+func (s *Server) listLockoutsHandler(c *gin.Context) {
+	states, err := s.loginLimiter.List()
+	if err != nil {
+		respondInternal(c, "failed to list lockouts", wrapErr("list throttle state", err))
+		return
+	}
+	c.JSON(http.StatusOK, states)
+}
+
+type unlockPayload struct {
+	Key string `json:"key"`
+}
+
+func (s *Server) unlockLockoutHandler(c *gin.Context) {
+	var payload unlockPayload
+	if err := c.ShouldBindJSON(&payload); err != nil || strings.TrimSpace(payload.Key) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key is required"})
+		return
+	}
+	if err := s.loginLimiter.Unlock(payload.Key); err != nil {
+		if errors.Is(err, throttle.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		respondInternal(c, "failed to unlock", wrapErr("unlock throttle key", err))
+		return
+	}
+	if claims := getClaims(c); claims != nil {
+		_ = s.auditService.RecordEvent(audit.Event{
+			ActorID:    claims.Subject,
+			ActorName:  claims.Name,
+			Action:     "throttle-unlock",
+			TargetType: "lockout",
+			TargetID:   payload.Key,
+			Details:    fmt.Sprintf("Unlocked %s", payload.Key),
+			IPAddress:  c.ClientIP(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "unlocked"})
+}
@@ -0,0 +1,18 @@
+package httpapi
+
+import "net/http"
+
+// untracedPaths are polled often enough that tracing them would bury the requests
+// worth looking at.
+var untracedPaths = map[string]bool{
+	"/health":                   true,
+	"/api/health":               true,
+	"/metrics":                  true,
+	"/api/agents/heartbeat":     true,
+	"/api/agents/commands/next": true,
+}
+
+// tracedRequest reports whether a request gets an HTTP server span.
+func tracedRequest(r *http.Request) bool {
+	return !untracedPaths[r.URL.Path]
+}
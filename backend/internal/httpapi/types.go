@@ -14,6 +14,12 @@ type (
 	ContainerSettings     = domain.ContainerSettings
 	UpdateHistory         = domain.UpdateHistory
 	RunningSnapshot       = domain.RunningSnapshot
+	PendingUpdate         = domain.PendingUpdate
+	UpdateDigestState     = domain.UpdateDigestState
+	RecapSchedule         = domain.RecapSchedule
+	ReleaseNotes          = domain.ReleaseNotes
+	UpdateApproval        = domain.UpdateApproval
+	ConfigSnapshot        = domain.ContainerConfigSnapshot
 	Schedule              = domain.Schedule
 	Agent                 = domain.Agent
 	AgentCommand          = domain.AgentCommand
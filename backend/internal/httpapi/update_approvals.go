@@ -0,0 +1,305 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/approvals"
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/notify"
+)
+
+// approvalLinkTTL is how long the signed approve/reject links of a notification work.
+const approvalLinkTTL = 7 * 24 * time.Hour
+
+// requestUpdateApproval opens an update request for a container of an agent that
+// requires approval and notifies approvers when it is new.
+func (s *Server) requestUpdateApproval(agent Agent, cont ContainerSnapshot) {
+	if s.approvalService == nil {
+		return
+	}
+	req, created, err := s.approvalService.Request(agent, cont)
+	if err != nil {
+		s.log.Warn("update approval: failed to open request", logging.KeyAgentID, agent.ID, logging.KeyContainerID, cont.ID, "agent", agent.Name, "container", cont.Name, "error", err)
+		return
+	}
+	if created {
+		s.notifyUpdateApproval(agent, req)
+	}
+}
+
+// applyApprovalCheck keeps the update requests of an agent container in line with a
+// check-update result: an available update needs a request, a missing one closes it.
+func (s *Server) applyApprovalCheck(agent Agent, containerID string, available bool) {
+	if !agent.RequireApproval || s.approvalService == nil {
+		return
+	}
+	if !available {
+		if err := s.approvalService.Close(agent.ID, containerID); err != nil {
+			s.log.Warn("update approval: failed to close requests", logging.KeyAgentID, agent.ID, logging.KeyContainerID, containerID, "agent", agent.Name, "error", err)
+		}
+		return
+	}
+	for _, cont := range agent.Containers {
+		if cont.ID == containerID && cont.AutoUpdate {
+			s.requestUpdateApproval(agent, cont)
+			return
+		}
+	}
+}
+
+func (s *Server) notifyUpdateApproval(agent Agent, req UpdateApproval) {
+	name := req.ContainerName
+	if name == "" {
+		name = req.ContainerID
+	}
+	image := req.Image
+	if req.Digest != "" {
+		image = fmt.Sprintf("%s (%s)", req.Image, req.Digest)
+	}
+	links := s.notifyLinks(agent.ID, req.ContainerID)
+	links.Approve = s.approvalLink(req.ID, "approve")
+	links.Reject = s.approvalLink(req.ID, "reject")
+	msg := notify.Message{
+		Event:  notify.EventUpdateApproval,
+		Title:  "🛂 Update awaiting approval",
+		Status: req.Status,
+		Body: fmt.Sprintf("Container: %s\nImage: %s\nHost: %s\n\nApproved updates run in the next schedule window.\nApprove: %s\nReject: %s",
+			name, image, agent.Name, links.Approve, links.Reject),
+		Container: s.notifyContainer(agent.ID, req.ContainerID, name, req.Image),
+		Agent:     &notify.AgentInfo{ID: agent.ID, Name: agent.Name, Hostname: agent.Hostname},
+		Links:     links,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = s.notify(ctx, msg)
+}
+
+// approvalSignature signs a decision on an update request with the JWT secret.
+func (s *Server) approvalSignature(id, action string, expires int64) string {
+	mac := hmac.New(sha256.New, s.jwtSecret)
+	fmt.Fprintf(mac, "%s|%s|%d", id, action, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// approvalLink is the signed link that applies action to an update request without
+// signing in.
+func (s *Server) approvalLink(id, action string) string {
+	expires := time.Now().Add(approvalLinkTTL).Unix()
+	q := url.Values{}
+	q.Set("action", action)
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", s.approvalSignature(id, action, expires))
+	return s.absoluteClientURL("/api/update-approvals/" + url.PathEscape(id) + "/decision?" + q.Encode())
+}
+
+// verifyApprovalLink checks the action, expiry and signature of a signed link.
+func (s *Server) verifyApprovalLink(c *gin.Context) (approve bool, err error) {
+	action := c.Query("action")
+	if action != "approve" && action != "reject" {
+		return false, errors.New("unknown action")
+	}
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		return false, errors.New("invalid link")
+	}
+	want := s.approvalSignature(c.Param("id"), action, expires)
+	if !hmac.Equal([]byte(want), []byte(c.Query("sig"))) {
+		return false, errors.New("invalid link")
+	}
+	if time.Now().Unix() > expires {
+		return false, errors.New("this link has expired")
+	}
+	return action == "approve", nil
+}
+
+func (s *Server) listUpdateApprovalsHandler(c *gin.Context) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	rows, err := s.approvalService.List(c.Query("status"), c.Query("open") == "true")
+	if err != nil {
+		respondInternal(c, "failed to load update requests", wrapErr("list update approvals", err))
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+type approvalDecisionPayload struct {
+	Note string `json:"note"`
+}
+
+func (s *Server) approveUpdateHandler(c *gin.Context) { s.decideUpdateHandler(c, true) }
+
+func (s *Server) rejectUpdateHandler(c *gin.Context) { s.decideUpdateHandler(c, false) }
+
+func (s *Server) decideUpdateHandler(c *gin.Context, approve bool) {
+	if s.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "database not ready"})
+		return
+	}
+	var payload approvalDecisionPayload
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+	}
+	claims := getClaims(c)
+	actorID, actorName := "", ""
+	if claims != nil {
+		actorID, actorName = claims.Subject, claims.Name
+	}
+	req, err := s.decideUpdate(c.Param("id"), approve, actorID, actorName, payload.Note, c.ClientIP())
+	if err != nil {
+		respondApprovalError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
+// decideUpdate records a decision and writes it to the audit log.
+func (s *Server) decideUpdate(id string, approve bool, actorID, actorName, note, ip string) (UpdateApproval, error) {
+	before, err := s.approvalService.Get(id)
+	if err != nil {
+		return before, err
+	}
+	req, err := s.approvalService.Decide(id, approve, actorName, note)
+	if err != nil {
+		return req, err
+	}
+	action, verb := "reject-update", "Rejected"
+	if approve {
+		action, verb = "approve-update", "Approved"
+	}
+	_ = s.auditService.RecordEvent(audit.Event{
+		ActorID:    actorID,
+		ActorName:  actorName,
+		Action:     action,
+		TargetType: "update-approval",
+		TargetID:   req.ID,
+		Details:    fmt.Sprintf("%s update of %s on %s", verb, req.ContainerName, req.AgentName),
+		Before:     before,
+		After:      req,
+		IPAddress:  ip,
+	})
+	return req, nil
+}
+
+func respondApprovalError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "update request not found"})
+	case errors.Is(err, approvals.ErrNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		respondInternal(c, "failed to decide update request", wrapErr("decide update approval", err))
+	}
+}
+
+// signedLinkActor is the audit actor of decisions made through notification links.
+const signedLinkActor = "signed link"
+
+var approvalPage = template.Must(template.New("approval").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width,initial-scale=1"><title>Updockly update request</title></head>
+<body style="font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;font-size:14px;color:#1f2937;max-width:32rem;margin:3rem auto;padding:0 1rem">
+<h2 style="font-size:18px">{{.Heading}}</h2>
+{{with .Request}}<p>Container: {{.ContainerName}}<br>Image: {{.Image}}<br>Host: {{.AgentName}}<br>Status: {{.Status}}{{with .DecidedBy}} by {{.}}{{end}}</p>{{end}}
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Action}}<form method="post" action="{{.Action}}">
+<p><label>Note (optional)<br><textarea name="note" rows="3" style="width:100%"></textarea></label></p>
+<p><button type="submit">{{.Button}}</button></p>
+</form>{{end}}
+</body></html>
+`))
+
+type approvalPageData struct {
+	Heading string
+	Request *UpdateApproval
+	Message string
+	Action  string
+	Button  string
+}
+
+func renderApprovalPage(c *gin.Context, status int, data approvalPageData) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	_ = approvalPage.Execute(c.Writer, data)
+}
+
+// updateApprovalLinkHandler shows the request a signed link decides, with a form that
+// confirms it. Links are not acted on by GET so mail scanners that follow them do not
+// decide requests.
+func (s *Server) updateApprovalLinkHandler(c *gin.Context) {
+	approve, err := s.verifyApprovalLink(c)
+	if err != nil {
+		renderApprovalPage(c, http.StatusForbidden, approvalPageData{Heading: "Link not valid", Message: err.Error()})
+		return
+	}
+	if s.approvalService == nil || s.db == nil {
+		renderApprovalPage(c, http.StatusServiceUnavailable, approvalPageData{Heading: "Unavailable", Message: "The database is not ready."})
+		return
+	}
+	req, err := s.approvalService.Get(c.Param("id"))
+	if err != nil {
+		renderApprovalPage(c, http.StatusNotFound, approvalPageData{Heading: "Update request not found"})
+		return
+	}
+	data := approvalPageData{Heading: "Update request", Request: &req}
+	if req.Status != approvals.StatusPending || req.ClosedAt != nil {
+		data.Message = "This request has already been decided or closed."
+	} else {
+		data.Action = c.Request.URL.RequestURI()
+		data.Button = "Reject update"
+		if approve {
+			data.Button = "Approve update"
+		}
+	}
+	renderApprovalPage(c, http.StatusOK, data)
+}
+
+// updateApprovalDecisionHandler applies the decision of a signed link.
+func (s *Server) updateApprovalDecisionHandler(c *gin.Context) {
+	approve, err := s.verifyApprovalLink(c)
+	if err != nil {
+		renderApprovalPage(c, http.StatusForbidden, approvalPageData{Heading: "Link not valid", Message: err.Error()})
+		return
+	}
+	if s.approvalService == nil || s.db == nil {
+		renderApprovalPage(c, http.StatusServiceUnavailable, approvalPageData{Heading: "Unavailable", Message: "The database is not ready."})
+		return
+	}
+	note := strings.TrimSpace(c.PostForm("note"))
+	req, err := s.decideUpdate(c.Param("id"), approve, "", signedLinkActor, note, c.ClientIP())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		renderApprovalPage(c, http.StatusNotFound, approvalPageData{Heading: "Update request not found"})
+	case errors.Is(err, approvals.ErrNotPending):
+		renderApprovalPage(c, http.StatusConflict, approvalPageData{Heading: "Update request", Request: &req,
+			Message: "This request has already been decided or closed."})
+	case err != nil:
+		s.log.Error("update approval: decision failed", "id", c.Param("id"), "error", err)
+		renderApprovalPage(c, http.StatusInternalServerError, approvalPageData{Heading: "Something went wrong", Message: "The decision was not saved."})
+	case approve:
+		renderApprovalPage(c, http.StatusOK, approvalPageData{Heading: "Update approved", Request: &req,
+			Message: "The update runs in the next schedule window."})
+	default:
+		renderApprovalPage(c, http.StatusOK, approvalPageData{Heading: "Update rejected", Request: &req})
+	}
+}
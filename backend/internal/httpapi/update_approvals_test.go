@@ -0,0 +1,162 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/agents"
+	"updockly/backend/internal/approvals"
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/notify"
+)
+
+// serveApprovalLink runs a signed link through the router the way a browser would.
+func serveApprovalLink(srv *Server, method, link string) *httptest.ResponseRecorder {
+	u, _ := url.Parse(link)
+	router := gin.New()
+	router.GET("/api/update-approvals/:id/decision", srv.updateApprovalLinkHandler)
+	router.POST("/api/update-approvals/:id/decision", srv.updateApprovalDecisionHandler)
+	req := httptest.NewRequest(method, u.RequestURI(), nil)
+	if method == http.MethodPost {
+		req = httptest.NewRequest(method, u.RequestURI(), strings.NewReader("note=looks+good"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestUpdateApprovalWorkflow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.AgentCommand{}, &domain.UpdateApproval{}, &domain.AuditLog{}, &domain.AuditChainHead{},
+		&domain.NotificationChannel{}, &domain.NotificationRule{}, &domain.NotificationTemplate{}, &domain.NotificationDelivery{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := &Server{db: db, cfg: config.Config{ClientOrigin: "https://updockly.example"}, log: slog.Default(), timezone: time.UTC,
+		jwtSecret: []byte("secret"), agentService: agents.NewAgentService(db, false), approvalService: approvals.NewService(db),
+		auditService: audit.NewService(db), notifyService: notify.NewService(db, nil)}
+	if _, err := srv.notifyService.Create(domain.NotificationChannel{
+		Name: "ops", Type: "webhook", Enabled: true, Events: StringList{notify.EventUpdateApproval},
+		Config: domain.StringMap{"url": "http://127.0.0.1:1"},
+	}); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	now := time.Now()
+	agent := Agent{ID: "a1", Name: "prod-1", LastSeen: &now, RequireApproval: true, Containers: ContainerSnapshotList{
+		{ID: "c1", Name: "web", Image: "nginx:1.27", AutoUpdate: true, UpdateAvailable: true, AvailableDigest: "nginx@sha256:aaa"},
+	}}
+	if err := db.Create(&agent).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+
+	// The check result opens a pending request and sends its signed links.
+	if err := srv.applyCommandResult(&agent, AgentCommand{Type: "check-update"}, JSONMap{"containerId": "c1", "updateAvailable": true, "availableDigest": "nginx@sha256:aaa"}); err != nil {
+		t.Fatalf("apply check result: %v", err)
+	}
+	var deliveries []domain.NotificationDelivery
+	if err := db.Find(&deliveries).Error; err != nil || len(deliveries) != 1 {
+		t.Fatalf("expected one approval notification, got %d (%v)", len(deliveries), err)
+	}
+	var msg notify.Message
+	if err := json.Unmarshal(deliveries[0].Message, &msg); err != nil {
+		t.Fatalf("decode delivery: %v", err)
+	}
+	if msg.Event != notify.EventUpdateApproval || !strings.HasPrefix(msg.Links.Approve, "https://updockly.example/api/update-approvals/") ||
+		!strings.Contains(msg.Body, msg.Links.Reject) {
+		t.Fatalf("unexpected approval message %+v", msg)
+	}
+
+	// Nothing is queued until the request is approved.
+	if _, err := srv.enqueueAgentAutoUpdates(context.Background(), nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	var count int64
+	db.Model(&AgentCommand{}).Where("type = ?", "update-container").Count(&count)
+	if count != 0 {
+		t.Fatalf("expected no update before approval, got %d", count)
+	}
+
+	tampered := strings.Replace(msg.Links.Reject, "action=reject", "action=approve", 1)
+	if rec := serveApprovalLink(srv, http.MethodPost, tampered); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a tampered link to be refused, got %d", rec.Code)
+	}
+	if rec := serveApprovalLink(srv, http.MethodGet, msg.Links.Approve); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Approve update") {
+		t.Fatalf("expected a confirmation page, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveApprovalLink(srv, http.MethodPost, msg.Links.Approve); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Update approved") {
+		t.Fatalf("expected the update to be approved, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serveApprovalLink(srv, http.MethodPost, msg.Links.Reject); rec.Code != http.StatusConflict {
+		t.Fatalf("expected a decided request to refuse another decision, got %d", rec.Code)
+	}
+	var entry domain.AuditLog
+	if err := db.Where("action = ?", "approve-update").First(&entry).Error; err != nil || entry.UserName != signedLinkActor {
+		t.Fatalf("expected the decision in the audit log, got %+v (%v)", entry, err)
+	}
+
+	// The next window queues the approved update, pinned to the approved image, and the
+	// report closes the request.
+	ids, err := srv.enqueueAgentAutoUpdates(context.Background(), nil)
+	if err != nil || len(ids) != 1 {
+		t.Fatalf("expected the approved update to be queued, got %v (%v)", ids, err)
+	}
+	var cmd AgentCommand
+	if err := db.First(&cmd, "id = ?", ids[0]).Error; err != nil || cmd.Payload["digest"] != "nginx@sha256:aaa" {
+		t.Fatalf("expected the update to be pinned to the approved image, got %v (%v)", cmd.Payload, err)
+	}
+	rows, _ := srv.approvalService.List("", false)
+	if len(rows) != 1 || rows[0].Status != approvals.StatusQueued || rows[0].CommandID != ids[0] || rows[0].Note != "looks good" {
+		t.Fatalf("unexpected request %+v", rows)
+	}
+	if _, ok, err := srv.approvalService.Finish(ids[0], true, "Update completed"); err != nil || !ok {
+		t.Fatalf("finish: ok=%v (%v)", ok, err)
+	}
+	if done, _ := srv.approvalService.Get(rows[0].ID); done.Status != approvals.StatusCompleted {
+		t.Fatalf("expected the request to complete, got %+v", done)
+	}
+
+	// An approval does not carry over to an image the tag moved to after it was given.
+	if err := db.Delete(&AgentCommand{}, "id = ?", ids[0]).Error; err != nil {
+		t.Fatalf("clear command: %v", err)
+	}
+	if err := srv.applyCommandResult(&agent, AgentCommand{Type: "check-update"}, JSONMap{"containerId": "c1", "updateAvailable": true, "availableDigest": "nginx@sha256:bbb"}); err != nil {
+		t.Fatalf("apply check result: %v", err)
+	}
+	pending, _ := srv.approvalService.List(approvals.StatusPending, true)
+	if len(pending) != 1 || pending[0].Digest != "nginx@sha256:bbb" {
+		t.Fatalf("expected a request for the new image, got %+v", pending)
+	}
+	if _, err := srv.approvalService.Decide(pending[0].ID, true, "alice", ""); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	agent.Containers[0].AvailableDigest = "nginx@sha256:ccc"
+	if err := db.Save(&agent).Error; err != nil {
+		t.Fatalf("save agent: %v", err)
+	}
+	if ids, err := srv.enqueueAgentAutoUpdates(context.Background(), nil); err != nil || len(ids) != 0 {
+		t.Fatalf("expected no update for an image that was not approved, got %v (%v)", ids, err)
+	}
+	if expired, _ := srv.approvalService.Get(pending[0].ID); expired.Status != approvals.StatusExpired {
+		t.Fatalf("expected the approval to expire when the tag moved, got %+v", expired)
+	}
+}
@@ -0,0 +1,446 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/logging"
+	"updockly/backend/internal/notify"
+)
+
+// The update digest reports containers with auto-update off that have an update
+// available. While it is enabled, those containers are checked every
+// digestCheckInterval; each digest lists the updates found since the previous one, so
+// an update is reported once until it is applied.
+const (
+	digestCheckInterval = 6 * time.Hour
+	defaultDigestTime   = "09:00"
+	ociSourceLabel      = "org.opencontainers.image.source"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+func validateDigestSettings(cfg config.DigestSettings) error {
+	switch cfg.Frequency {
+	case "", "daily", "weekly":
+	default:
+		return fmt.Errorf("update digest frequency must be daily or weekly")
+	}
+	if t := strings.TrimSpace(cfg.Time); t != "" {
+		if _, _, ok := parseClockTime(t); !ok {
+			return fmt.Errorf("update digest time must be HH:MM")
+		}
+	}
+	if d := strings.TrimSpace(cfg.Weekday); d != "" {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("unknown update digest weekday %q", d)
+		}
+	}
+	return nil
+}
+
+// digestCron is the cron expression of the digest schedule, empty when the digest is off
+// or its settings are invalid.
+func digestCron(cfg config.DigestSettings) string {
+	clock := strings.TrimSpace(cfg.Time)
+	if clock == "" {
+		clock = defaultDigestTime
+	}
+	hour, min, ok := parseClockTime(clock)
+	if !ok {
+		return ""
+	}
+	switch cfg.Frequency {
+	case "daily":
+		return fmt.Sprintf("%d %d * * *", min, hour)
+	case "weekly":
+		day, ok := weekdays[strings.ToLower(strings.TrimSpace(cfg.Weekday))]
+		if strings.TrimSpace(cfg.Weekday) == "" {
+			day, ok = time.Monday, true
+		}
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf("%d %d * * %d", min, hour, int(day))
+	}
+	return ""
+}
+
+// lastDigestTime is the most recent scheduled digest time at or before now.
+func lastDigestTime(expr string, now time.Time) (time.Time, bool) {
+	last, ok := time.Time{}, false
+	for t, more := nextCronTime(expr, now.AddDate(0, 0, -8)); more && !t.After(now); t, more = nextCronTime(expr, t) {
+		last, ok = t, true
+	}
+	return last, ok
+}
+
+func (s *Server) maybeSendDigest() {
+	cfg := s.cfg.Notifications.UpdateDigest
+	if s.db == nil || cfg.Frequency == "" || !s.notificationsConfigured() {
+		return
+	}
+
+	if time.Since(s.lastDigestCheck) >= digestCheckInterval && time.Since(s.startedAt) >= 2*time.Minute {
+		s.lastDigestCheck = time.Now()
+		if s.digestCheckRun.CompareAndSwap(false, true) {
+			go func() {
+				defer s.digestCheckRun.Store(false)
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+				defer cancel()
+				s.checkManualUpdates(ctx)
+			}()
+		}
+	}
+
+	expr := digestCron(cfg)
+	if expr == "" {
+		return
+	}
+	now := time.Now().In(s.location())
+	state, err := s.digestState(expr, now)
+	if err != nil {
+		s.log.Warn("update digest: failed to load its state", "error", err)
+		return
+	}
+	next, ok := nextCronTime(expr, state.LastSentAt.In(now.Location()))
+	if !ok || now.Before(next) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := s.sendUpdateDigest(ctx, state.LastSentAt); err != nil {
+		s.log.Warn("update digest: failed to send", "error", err)
+		return
+	}
+	if err := s.db.Model(&UpdateDigestState{}).Where("id = ?", state.ID).Update("last_sent_at", now).Error; err != nil {
+		s.log.Warn("update digest: failed to store its state", "error", err)
+	}
+}
+
+// digestState loads the digest state, creating it the first time the digest runs. Like
+// the recap, a scheduled time that already passed then waits for the next one rather
+// than sending straight away.
+func (s *Server) digestState(expr string, now time.Time) (UpdateDigestState, error) {
+	var state UpdateDigestState
+	err := s.db.First(&state).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return state, err
+	}
+	state.LastSentAt = now
+	if last, ok := lastDigestTime(expr, now); ok {
+		state.LastSentAt = last
+	}
+	return state, s.db.Create(&state).Error
+}
+
+// digestCheckSource marks the check-update commands queued for the digest, whose results
+// are reported by the digest rather than by an update-available notification each.
+const digestCheckSource = "update-digest"
+
+// checkManualUpdates checks containers with auto-update off: local ones directly, agent
+// ones by queueing check-update commands whose results arrive with the next poll. It only
+// records pending updates; the digest reports them.
+func (s *Server) checkManualUpdates(ctx context.Context) {
+	if s.containerService != nil {
+		if local, err := s.containerService.ListContainers(ctx); err != nil {
+			s.log.Debug("update digest: local containers unavailable", "error", err)
+		} else {
+			for _, cont := range local {
+				if cont.AutoUpdate || ctx.Err() != nil {
+					continue
+				}
+				if _, err := s.containerService.CheckUpdate(ctx, cont.ID); err != nil {
+					s.log.Debug("update digest: check failed", "container", cont.Name, "error", err)
+				}
+			}
+		}
+	}
+
+	if s.db == nil || s.agentService == nil {
+		return
+	}
+	var agents []Agent
+	if err := s.db.Find(&agents).Error; err != nil {
+		s.log.Warn("update digest: failed to load agents", "error", err)
+		return
+	}
+	silent := s.db.Session(&gorm.Session{Logger: logger.Discard})
+	cutoff := time.Now().Add(-5 * time.Minute)
+	for _, ag := range agents {
+		if ag.LastSeen == nil || ag.LastSeen.Before(cutoff) {
+			continue
+		}
+		var pending []AgentCommand
+		_ = silent.Where("agent_id = ? AND status IN ?", ag.ID, []string{"pending", "running"}).Find(&pending).Error
+		for _, cont := range decodeContainers(ag) {
+			if cont.AutoUpdate || strings.TrimSpace(cont.ID) == "" || s.hasAgentCommandForContainer(pending, cont.ID, "check-update") {
+				continue
+			}
+			if _, err := s.createAgentCommandInternal(ctx, ag.ID, "check-update", JSONMap{"containerId": cont.ID, "source": digestCheckSource}); err != nil {
+				s.log.Warn("update digest: queue check failed", logging.KeyAgentID, ag.ID, logging.KeyContainerID, cont.ID, "agent", ag.Name, "error", err)
+			}
+		}
+	}
+}
+
+// digestCandidate is a container with auto-update off and an update available.
+type digestCandidate struct {
+	agentID string
+	id      string
+	name    string
+	image   string
+	labels  map[string]string
+}
+
+func (c digestCandidate) key() string { return c.agentID + "/" + c.name }
+
+// digestCandidates collects pending updates from the last check results. local is false
+// when the local Docker host could not be listed, so its entries are left alone.
+func (s *Server) digestCandidates(ctx context.Context) (cands []digestCandidate, agentNames map[string]string, local bool, err error) {
+	if s.containerService != nil {
+		if containers, listErr := s.containerService.ListContainers(ctx); listErr == nil {
+			local = true
+			for _, cont := range containers {
+				if cont.AutoUpdate || !cont.UpdateAvailable {
+					continue
+				}
+				labels, _ := s.containerService.Labels(ctx, cont.ID)
+				cands = append(cands, digestCandidate{id: cont.ID, name: cont.Name, image: cont.Image, labels: labels})
+			}
+		}
+	}
+
+	var agents []Agent
+	if err := s.db.Find(&agents).Error; err != nil {
+		return nil, nil, false, fmt.Errorf("load agents: %w", err)
+	}
+	agentNames = make(map[string]string, len(agents))
+	for _, ag := range agents {
+		agentNames[ag.ID] = ag.Name
+		for _, cont := range decodeContainers(ag) {
+			if cont.AutoUpdate || !cont.UpdateAvailable {
+				continue
+			}
+			labels := make(map[string]string, len(cont.Labels))
+			for _, kv := range cont.Labels {
+				k, v, _ := strings.Cut(kv, "=")
+				labels[k] = v
+			}
+			name := cont.Name
+			if name == "" {
+				name = cont.ID
+			}
+			cands = append(cands, digestCandidate{agentID: ag.ID, id: cont.ID, name: name, image: cont.Image, labels: labels})
+		}
+	}
+	return cands, agentNames, local, nil
+}
+
+// syncPendingUpdates records new candidates and forgets updates that were applied (or
+// whose container or agent is gone). It returns every pending update.
+func (s *Server) syncPendingUpdates(cands []digestCandidate, local bool) ([]PendingUpdate, error) {
+	var rows []PendingUpdate
+	if err := s.db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("load pending updates: %w", err)
+	}
+	existing := make(map[string]PendingUpdate, len(rows))
+	for _, row := range rows {
+		existing[row.AgentID+"/"+row.ContainerName] = row
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(cands))
+	var out []PendingUpdate
+	for _, c := range cands {
+		if seen[c.key()] {
+			continue
+		}
+		seen[c.key()] = true
+		row, ok := existing[c.key()]
+		switch {
+		case !ok:
+			row = PendingUpdate{AgentID: c.agentID, ContainerName: c.name, ContainerID: c.id, Image: c.image, FirstSeenAt: now}
+			if err := s.db.Create(&row).Error; err != nil {
+				return nil, fmt.Errorf("record pending update: %w", err)
+			}
+		case row.Image != c.image:
+			// A different image is a different update; report it again.
+			row.ContainerID, row.Image, row.FirstSeenAt, row.NotifiedAt = c.id, c.image, now, nil
+			if err := s.db.Save(&row).Error; err != nil {
+				return nil, fmt.Errorf("update pending update: %w", err)
+			}
+		case row.ContainerID != c.id:
+			row.ContainerID = c.id
+			if err := s.db.Save(&row).Error; err != nil {
+				return nil, fmt.Errorf("update pending update: %w", err)
+			}
+		}
+		out = append(out, row)
+	}
+
+	var stale []string
+	for key, row := range existing {
+		if seen[key] {
+			continue
+		}
+		if row.AgentID == "" && !local {
+			// The local host could not be listed; keep its entries.
+			out = append(out, row)
+			continue
+		}
+		stale = append(stale, row.ID)
+	}
+	if len(stale) > 0 {
+		if err := s.db.Delete(&PendingUpdate{}, "id IN ?", stale).Error; err != nil {
+			return nil, fmt.Errorf("forget applied updates: %w", err)
+		}
+	}
+	return out, nil
+}
+
+// buildUpdateDigest groups the pending updates not sent before by host, local first.
+func (s *Server) buildUpdateDigest(since time.Time, rows []PendingUpdate, cands []digestCandidate, agentNames map[string]string) *notify.Digest {
+	labels := make(map[string]map[string]string, len(cands))
+	for _, c := range cands {
+		labels[c.key()] = c.labels
+	}
+	digest := &notify.Digest{Since: since}
+	hosts := map[string]*notify.DigestHost{}
+	for _, row := range rows {
+		if row.NotifiedAt != nil {
+			digest.Pending++
+			continue
+		}
+		host, ok := hosts[row.AgentID]
+		if !ok {
+			name := "local"
+			if row.AgentID != "" {
+				name = agentNames[row.AgentID]
+			}
+			host = &notify.DigestHost{Name: name, AgentID: row.AgentID}
+			hosts[row.AgentID] = host
+		}
+		host.Items = append(host.Items, notify.DigestItem{
+			Container:    row.ContainerName,
+			Image:        row.Image,
+			FirstSeen:    row.FirstSeenAt,
+			Link:         s.notifyLinks(row.AgentID, row.ContainerID).Container,
+			ReleaseNotes: releaseNotesURL(labels[row.AgentID+"/"+row.ContainerName]),
+		})
+		digest.New++
+	}
+	for _, host := range hosts {
+		sort.Slice(host.Items, func(i, j int) bool { return host.Items[i].Container < host.Items[j].Container })
+		digest.Hosts = append(digest.Hosts, *host)
+	}
+	sort.Slice(digest.Hosts, func(i, j int) bool {
+		a, b := digest.Hosts[i], digest.Hosts[j]
+		if (a.AgentID == "") != (b.AgentID == "") {
+			return a.AgentID == ""
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	return digest
+}
+
+// sendUpdateDigest sends the updates found since the last digest. Nothing is sent when
+// there is nothing new.
+func (s *Server) sendUpdateDigest(ctx context.Context, since time.Time) error {
+	cands, agentNames, local, err := s.digestCandidates(ctx)
+	if err != nil {
+		return err
+	}
+	rows, err := s.syncPendingUpdates(cands, local)
+	if err != nil {
+		return err
+	}
+	digest := s.buildUpdateDigest(since, rows, cands, agentNames)
+	if digest.New == 0 {
+		return nil
+	}
+
+	title := fmt.Sprintf("⬆️ %d update(s) available", digest.New)
+	msg := notify.Message{
+		Event:  notify.EventUpdateDigest,
+		Title:  title,
+		Body:   digestText(digest),
+		Time:   time.Now(),
+		Links:  s.notifyLinks("", ""),
+		Digest: digest,
+	}
+	if err := s.notify(ctx, msg); err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, row := range rows {
+		if row.NotifiedAt == nil {
+			ids = append(ids, row.ID)
+		}
+	}
+	return s.db.Model(&PendingUpdate{}).Where("id IN ?", ids).Update("notified_at", time.Now()).Error
+}
+
+// digestText is the built-in plain-text body of an update digest.
+func digestText(digest *notify.Digest) string {
+	var b strings.Builder
+	for _, host := range digest.Hosts {
+		icon := "🖥️"
+		if host.AgentID != "" {
+			icon = "🛰️"
+		}
+		fmt.Fprintf(&b, "%s %s (%d)\n", icon, host.Name, len(host.Items))
+		for _, item := range host.Items {
+			fmt.Fprintf(&b, "  • %s — %s\n", item.Container, item.Image)
+			if item.Link != "" {
+				fmt.Fprintf(&b, "    %s\n", item.Link)
+			}
+			if item.ReleaseNotes != "" {
+				fmt.Fprintf(&b, "    Release notes: %s\n", item.ReleaseNotes)
+			}
+		}
+	}
+	if digest.Pending > 0 {
+		fmt.Fprintf(&b, "%d update(s) from earlier digests still pending.\n", digest.Pending)
+	}
+	return b.String()
+}
+
+// releaseNotesURL derives a release notes link from an image's OCI source label: the
+// releases page for GitHub, GitLab and Codeberg repositories, the source itself
+// otherwise.
+func releaseNotesURL(labels map[string]string) string {
+	u, err := url.Parse(strings.TrimSpace(labels[ociSourceLabel]))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return ""
+	}
+	u.RawQuery, u.Fragment = "", ""
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	parts := strings.Split(path, "/")
+	switch strings.ToLower(u.Host) {
+	case "github.com", "codeberg.org":
+		if len(parts) >= 2 {
+			path = parts[0] + "/" + parts[1] + "/releases"
+		}
+	case "gitlab.com":
+		if len(parts) >= 2 {
+			path += "/-/releases"
+		}
+	}
+	u.Path = "/" + path
+	return u.String()
+}
@@ -0,0 +1,289 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/agents"
+	"updockly/backend/internal/config"
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/notify"
+)
+
+func TestDigestSchedule(t *testing.T) {
+	wed := time.Date(2026, 3, 4, 8, 0, 0, 0, time.UTC) // a Wednesday
+
+	last, ok := lastDigestTime(digestCron(config.DigestSettings{Frequency: "daily", Time: "07:30"}), wed)
+	if !ok || !last.Equal(time.Date(2026, 3, 4, 7, 30, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected daily schedule %s %v", last, ok)
+	}
+	last, _ = lastDigestTime(digestCron(config.DigestSettings{Frequency: "weekly"}), wed)
+	if !last.Equal(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected last Monday 09:00 by default, got %s", last)
+	}
+	next, _ := nextCronTime(digestCron(config.DigestSettings{Frequency: "weekly", Weekday: "Wednesday", Time: "18:00"}), wed)
+	if !next.Equal(time.Date(2026, 3, 4, 18, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected later today, got %s", next)
+	}
+	if expr := digestCron(config.DigestSettings{}); expr != "" {
+		t.Fatalf("expected a disabled digest to have no schedule, got %q", expr)
+	}
+
+	if err := validateDigestSettings(config.DigestSettings{Frequency: "hourly"}); err == nil {
+		t.Fatal("expected unknown frequencies to be rejected")
+	}
+	if err := validateDigestSettings(config.DigestSettings{Frequency: "weekly", Weekday: "someday"}); err == nil {
+		t.Fatal("expected unknown weekdays to be rejected")
+	}
+}
+
+func TestReleaseNotesURL(t *testing.T) {
+	cases := map[string]string{
+		"https://github.com/acme/api":                   "https://github.com/acme/api/releases",
+		"https://github.com/acme/api.git":               "https://github.com/acme/api/releases",
+		"https://github.com/acme/mono/tree/main/svc":    "https://github.com/acme/mono/releases",
+		"https://gitlab.com/group/sub/project":          "https://gitlab.com/group/sub/project/-/releases",
+		"https://git.example.com/acme/api?ref=main#top": "https://git.example.com/acme/api",
+		"git@github.com:acme/api.git":                   "",
+		"":                                              "",
+	}
+	for source, want := range cases {
+		if got := releaseNotesURL(map[string]string{ociSourceLabel: source}); got != want {
+			t.Fatalf("%q: expected %q, got %q", source, want, got)
+		}
+	}
+}
+
+func TestSendUpdateDigest(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.PendingUpdate{}, &domain.NotificationChannel{}, &domain.NotificationRule{},
+		&domain.NotificationTemplate{}, &domain.NotificationDelivery{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	notifyService := notify.NewService(db, nil)
+	if _, err := notifyService.Create(domain.NotificationChannel{
+		Name: "ops", Type: "webhook", Enabled: true, Config: domain.StringMap{"url": "http://127.0.0.1:1"},
+	}); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	srv := &Server{db: db, cfg: config.Config{ClientOrigin: "https://updockly.example"}, log: slog.Default(), notifyService: notifyService}
+
+	seen := time.Now()
+	agent := Agent{Name: "edge-1", LastSeen: &seen, Containers: ContainerSnapshotList{
+		{ID: "c1", Name: "db", Image: "postgres:16", UpdateAvailable: true, Labels: []string{ociSourceLabel + "=https://github.com/docker-library/postgres"}},
+		{ID: "c2", Name: "cache", Image: "redis:7", UpdateAvailable: true},
+		{ID: "c3", Name: "web", Image: "nginx:1.27", UpdateAvailable: true, AutoUpdate: true},
+		{ID: "c4", Name: "queue", Image: "rabbitmq:3"},
+	}}
+	if err := db.Create(&agent).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+
+	digests := func() []notify.Message {
+		t.Helper()
+		var rows []domain.NotificationDelivery
+		if err := db.Where("event = ?", notify.EventUpdateDigest).Order("id ASC").Find(&rows).Error; err != nil {
+			t.Fatalf("load deliveries: %v", err)
+		}
+		out := make([]notify.Message, len(rows))
+		for i, row := range rows {
+			if err := json.Unmarshal(row.Message, &out[i]); err != nil {
+				t.Fatalf("decode delivery: %v", err)
+			}
+		}
+		return out
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	if err := srv.sendUpdateDigest(t.Context(), since); err != nil {
+		t.Fatalf("send digest: %v", err)
+	}
+	sent := digests()
+	if len(sent) != 1 {
+		t.Fatalf("expected one digest, got %d", len(sent))
+	}
+	d := sent[0].Digest
+	if d == nil || d.New != 2 || len(d.Hosts) != 1 || d.Hosts[0].Name != "edge-1" || len(d.Hosts[0].Items) != 2 {
+		t.Fatalf("unexpected digest %+v", d)
+	}
+	cache, pg := d.Hosts[0].Items[0], d.Hosts[0].Items[1]
+	if cache.Container != "cache" || pg.Container != "db" {
+		t.Fatalf("expected items sorted by name, got %+v", d.Hosts[0].Items)
+	}
+	if pg.ReleaseNotes != "https://github.com/docker-library/postgres/releases" || cache.ReleaseNotes != "" {
+		t.Fatalf("unexpected release notes %q %q", pg.ReleaseNotes, cache.ReleaseNotes)
+	}
+	if !strings.HasPrefix(pg.Link, "https://updockly.example/?panel=agents&agent=") || !strings.HasSuffix(pg.Link, "&container=c1") {
+		t.Fatalf("unexpected container link %q", pg.Link)
+	}
+	if !strings.Contains(sent[0].Body, "Release notes: https://github.com/docker-library/postgres/releases") {
+		t.Fatalf("expected release notes in the body, got %q", sent[0].Body)
+	}
+
+	// Nothing new: no second digest.
+	if err := srv.sendUpdateDigest(t.Context(), since); err != nil {
+		t.Fatalf("send digest: %v", err)
+	}
+	if n := len(digests()); n != 1 {
+		t.Fatalf("expected already reported updates to be skipped, got %d digests", n)
+	}
+
+	// The cache update was applied and a new one appeared for queue.
+	agent.Containers[1].UpdateAvailable = false
+	agent.Containers[3].UpdateAvailable = true
+	if err := db.Save(&agent).Error; err != nil {
+		t.Fatalf("update agent: %v", err)
+	}
+	if err := srv.sendUpdateDigest(t.Context(), since); err != nil {
+		t.Fatalf("send digest: %v", err)
+	}
+	sent = digests()
+	if len(sent) != 2 {
+		t.Fatalf("expected a second digest, got %d", len(sent))
+	}
+	d = sent[1].Digest
+	if d.New != 1 || d.Pending != 1 || d.Hosts[0].Items[0].Container != "queue" {
+		t.Fatalf("expected only the new update plus a pending count, got %+v", d)
+	}
+	var remaining int64
+	db.Model(&domain.PendingUpdate{}).Count(&remaining)
+	if remaining != 2 {
+		t.Fatalf("expected the applied update to be forgotten, got %d pending", remaining)
+	}
+}
+
+func TestMaybeSendDigestKeepsScheduleAcrossRestarts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.PendingUpdate{}, &domain.UpdateDigestState{}, &domain.NotificationChannel{},
+		&domain.NotificationRule{}, &domain.NotificationTemplate{}, &domain.NotificationDelivery{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	notifyService := notify.NewService(db, nil)
+	if _, err := notifyService.Create(domain.NotificationChannel{
+		Name: "ops", Type: "webhook", Enabled: true, Config: domain.StringMap{"url": "http://127.0.0.1:1"},
+	}); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	seen := time.Now()
+	if err := db.Create(&Agent{Name: "edge-1", LastSeen: &seen, Containers: ContainerSnapshotList{
+		{ID: "c1", Name: "db", Image: "postgres:16", UpdateAvailable: true},
+	}}).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+	// Each call runs on a fresh server, as after a restart.
+	tick := func() {
+		cfg := config.Config{}
+		cfg.Notifications.UpdateDigest = config.DigestSettings{Frequency: "daily"}
+		srv := &Server{db: db, cfg: cfg, log: slog.Default(), notifyService: notifyService, lastDigestCheck: time.Now()}
+		srv.maybeSendDigest()
+	}
+	digests := func() []domain.NotificationDelivery {
+		t.Helper()
+		var rows []domain.NotificationDelivery
+		if err := db.Where("event = ?", notify.EventUpdateDigest).Find(&rows).Error; err != nil {
+			t.Fatalf("load deliveries: %v", err)
+		}
+		return rows
+	}
+	lastSent := func() time.Time {
+		t.Helper()
+		var state domain.UpdateDigestState
+		if err := db.First(&state).Error; err != nil {
+			t.Fatalf("load digest state: %v", err)
+		}
+		return state.LastSentAt
+	}
+
+	// The first run waits for the next scheduled time.
+	tick()
+	if n := len(digests()); n != 0 {
+		t.Fatalf("expected no digest on the first run, got %d", n)
+	}
+
+	// A digest missed while the server was down is sent on the next run and covers the
+	// whole time since the previous one.
+	missed := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := db.Model(&domain.UpdateDigestState{}).Where("1 = 1").Update("last_sent_at", missed).Error; err != nil {
+		t.Fatalf("backdate digest state: %v", err)
+	}
+	tick()
+	sent := digests()
+	if len(sent) != 1 {
+		t.Fatalf("expected the missed digest to be sent, got %d", len(sent))
+	}
+	var msg notify.Message
+	if err := json.Unmarshal(sent[0].Message, &msg); err != nil {
+		t.Fatalf("decode delivery: %v", err)
+	}
+	if msg.Digest == nil || !msg.Digest.Since.Equal(missed) {
+		t.Fatalf("expected the digest to cover the time since %s, got %+v", missed, msg.Digest)
+	}
+	if !lastSent().After(missed) {
+		t.Fatal("expected the last-sent time to be stored")
+	}
+
+	tick()
+	if n := len(digests()); n != 1 {
+		t.Fatalf("expected the digest not to repeat, got %d", n)
+	}
+}
+
+func TestCheckManualUpdatesOnlyRecords(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.Agent{}, &domain.AgentCommand{}, &domain.UpdateApproval{}, &domain.NotificationChannel{},
+		&domain.NotificationRule{}, &domain.NotificationTemplate{}, &domain.NotificationDelivery{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	srv := &Server{db: db, log: slog.Default(), agentService: agents.NewAgentService(db, false), notifyService: notify.NewService(db, nil)}
+	seen := time.Now()
+	agent := Agent{ID: "a1", Name: "edge-1", LastSeen: &seen, Containers: ContainerSnapshotList{{ID: "c1", Name: "db", Image: "postgres:16"}}}
+	if err := db.Create(&agent).Error; err != nil {
+		t.Fatalf("seed agent: %v", err)
+	}
+
+	srv.checkManualUpdates(context.Background())
+	var cmd AgentCommand
+	if err := db.First(&cmd, "agent_id = ? AND type = ?", agent.ID, "check-update").Error; err != nil {
+		t.Fatalf("expected a check to be queued: %v", err)
+	}
+	if cmd.Payload["source"] != digestCheckSource {
+		t.Fatalf("expected the check to be marked for the digest, got %v", cmd.Payload)
+	}
+
+	// The result is recorded for the digest instead of being announced on its own.
+	if err := srv.applyCommandResult(&agent, cmd, JSONMap{"containerId": "c1", "updateAvailable": true}); err != nil {
+		t.Fatalf("apply result: %v", err)
+	}
+	var stored Agent
+	if err := db.First(&stored, "id = ?", agent.ID).Error; err != nil || !stored.Containers[0].UpdateAvailable {
+		t.Fatalf("expected the pending update to be recorded, got %+v (%v)", stored.Containers, err)
+	}
+	var queued int64
+	db.Model(&domain.NotificationDelivery{}).Where("event = ?", notify.EventUpdateAvailable).Count(&queued)
+	if queued != 0 {
+		t.Fatalf("expected no update-available notification, got %d", queued)
+	}
+}
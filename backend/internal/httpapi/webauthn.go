@@ -0,0 +1,371 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/audit"
+	"updockly/backend/internal/auth"
+	"updockly/backend/internal/logging"
+)
+
+const (
+	secondFactorTOTP     = "totp"
+	secondFactorWebAuthn = "webauthn"
+)
+
+func (s *Server) newWebAuthnService(db *gorm.DB) *auth.WebAuthnService {
+	svc, err := auth.NewWebAuthnService(db, s.cfg.WebAuthn, s.cfg.ClientOrigin)
+	if err != nil {
+		s.log.Warn("webauthn disabled; invalid relying party configuration", "error", err)
+	}
+	return svc
+}
+
+// secondFactorMethods lists the methods an account may use to complete login.
+// Admins with a registered hardware key must use it when hardware keys are mandated;
+// their synced passkeys do not count.
+func (s *Server) secondFactorMethods(account *Account) []string {
+	methods := make([]string, 0, 2)
+	if s.webauthnService.HardwareKeyRequired(*account) {
+		if s.webauthnService.HasHardwareKey(account.ID) {
+			return []string{secondFactorWebAuthn}
+		}
+		if account.TwoFactorEnabled {
+			methods = append(methods, secondFactorTOTP)
+		}
+		return methods
+	}
+	hasKeys := s.webauthnService.Enabled() && s.webauthnService.HasCredentials(account.ID)
+	if account.TwoFactorEnabled {
+		methods = append(methods, secondFactorTOTP)
+	}
+	if hasKeys {
+		methods = append(methods, secondFactorWebAuthn)
+	}
+	return methods
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// keyEnrollmentRequired reports whether the account is an admin who must register a
+// hardware key before getting a full session.
+func (s *Server) keyEnrollmentRequired(account *Account) bool {
+	return s.webauthnService.HardwareKeyRequired(*account) && !s.webauthnService.HasHardwareKey(account.ID)
+}
+
+// sessionUserPayload is the user block returned once a session has been issued.
+func (s *Server) sessionUserPayload(account *Account) gin.H {
+	user := gin.H{
+		"username":         account.Username,
+		"name":             account.Name,
+		"role":             account.Role,
+		"twoFactorEnabled": account.TwoFactorEnabled,
+	}
+	if s.keyEnrollmentRequired(account) {
+		user["webauthnEnrollmentRequired"] = true
+	}
+	if s.authService.PasswordExpired(account) {
+		user["passwordExpired"] = true
+	}
+	return user
+}
+
+// preTwoFactorAccount resolves the account behind a temporary token issued by loginHandler.
+func (s *Server) preTwoFactorAccount(tempToken string) (*Account, error) {
+	claims, err := s.authService.VerifyToken(tempToken)
+	if err != nil {
+		return nil, errors.New("invalid temporary token")
+	}
+	if claims.Type != "pre-2fa" {
+		return nil, errors.New("invalid token type")
+	}
+	return s.authService.GetAccount(claims.Subject)
+}
+
+type webauthnBeginPayload struct {
+	TempToken string `json:"tempToken"`
+}
+
+func (s *Server) webauthnSecondFactorBeginHandler(c *gin.Context) {
+	var payload webauthnBeginPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	account, err := s.preTwoFactorAccount(payload.TempToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if !containsMethod(s.secondFactorMethods(account), secondFactorWebAuthn) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrWebAuthnNoCredentials.Error()})
+		return
+	}
+
+	assertion, sessionID, err := s.webauthnService.BeginLogin(*account)
+	if err != nil {
+		respondInternal(c, "unable to start security key verification", wrapErr("webauthn begin login", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessionId": sessionID, "options": assertion})
+}
+
+// verifyWebAuthnSecondFactor completes the assertion started by webauthnSecondFactorBeginHandler.
+func (s *Server) verifyWebAuthnSecondFactor(c *gin.Context, account *Account, payload verify2FAPayload) bool {
+	if len(payload.Credential) == 0 || payload.SessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sessionId and credential are required"})
+		return false
+	}
+	cred, err := s.webauthnService.FinishLogin(*account, payload.SessionID, payload.Credential, c.ClientIP())
+	if err != nil {
+		logging.FromContext(c).Warn("webauthn verification failed", "user", account.Username, "error", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "security key verification failed"})
+		return false
+	}
+	logging.FromContext(c).Info("webauthn second factor verified", "user", account.Username, "credential", cred.Name)
+	return true
+}
+
+func (s *Server) webauthnLoginBeginHandler(c *gin.Context) {
+	if !s.webauthnService.PasswordlessEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": auth.ErrWebAuthnPasswordless.Error()})
+		return
+	}
+	assertion, sessionID, err := s.webauthnService.BeginPasswordless()
+	if err != nil {
+		respondInternal(c, "unable to start passkey login", wrapErr("webauthn begin passwordless", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessionId": sessionID, "options": assertion})
+}
+
+type webauthnFinishPayload struct {
+	SessionID  string          `json:"sessionId"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+func (s *Server) webauthnLoginFinishHandler(c *gin.Context) {
+	if !s.webauthnService.PasswordlessEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": auth.ErrWebAuthnPasswordless.Error()})
+		return
+	}
+	var payload webauthnFinishPayload
+	if err := c.ShouldBindJSON(&payload); err != nil || len(payload.Credential) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	key := s.loginKey("", c.ClientIP())
+	if s.rejectIfThrottled(c, key) {
+		return
+	}
+
+	account, cred, err := s.webauthnService.FinishPasswordless(payload.SessionID, payload.Credential, c.ClientIP())
+	if err != nil {
+		s.recordLoginFailure(c, key, "")
+		respondError(c, http.StatusUnauthorized, "passkey verification failed", wrapErr("webauthn finish passwordless", err))
+		return
+	}
+	s.clearLoginFailures(key)
+
+	if err := s.issueSession(c, account); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to issue session"})
+		return
+	}
+	_ = s.auditService.RecordEvent(audit.Event{
+		ActorID:    account.Username,
+		ActorName:  account.Name,
+		Action:     "passkey-login",
+		TargetType: "security-key",
+		TargetID:   cred.ID,
+		Details:    fmt.Sprintf("Signed in with passkey: %s", cred.Name),
+		IPAddress:  c.ClientIP(),
+	})
+	c.JSON(http.StatusOK, gin.H{"user": s.sessionUserPayload(account)})
+}
+
+func (s *Server) webauthnRegisterBeginHandler(c *gin.Context) {
+	claims := getClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		return
+	}
+	if !s.webauthnService.Enabled() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrWebAuthnDisabled.Error()})
+		return
+	}
+	account, err := s.authService.GetAccount(claims.Subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
+		return
+	}
+
+	creation, sessionID, err := s.webauthnService.BeginRegistration(*account)
+	if err != nil {
+		respondInternal(c, "unable to start security key registration", wrapErr("webauthn begin registration", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessionId": sessionID, "options": creation})
+}
+
+func (s *Server) webauthnRegisterFinishHandler(c *gin.Context) {
+	claims := getClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		return
+	}
+	var payload webauthnFinishPayload
+	if err := c.ShouldBindJSON(&payload); err != nil || len(payload.Credential) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	account, err := s.authService.GetAccount(claims.Subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
+		return
+	}
+
+	cred, err := s.webauthnService.FinishRegistration(*account, payload.SessionID, payload.Name, payload.Credential)
+	if errors.Is(err, auth.ErrWebAuthnHardwareKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "security key registration failed", wrapErr("webauthn finish registration", err))
+		return
+	}
+	_ = s.auditService.RecordEvent(audit.Event{
+		ActorID:    claims.Subject,
+		ActorName:  claims.Name,
+		Action:     "register-security-key",
+		TargetType: "security-key",
+		TargetID:   cred.ID,
+		Details:    fmt.Sprintf("Registered security key: %s", cred.Name),
+		IPAddress:  c.ClientIP(),
+	})
+	// The first key of an admin who had to enrol one unlocks a full session.
+	if claims.Type == sessionKeyEnrollment {
+		if err := s.issueSession(c, account); err != nil {
+			respondInternal(c, "unable to issue session", wrapErr("issue session after key registration", err))
+			return
+		}
+	}
+	c.JSON(http.StatusCreated, cred)
+}
+
+func (s *Server) listWebAuthnCredentialsHandler(c *gin.Context) {
+	claims := getClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		return
+	}
+	account, err := s.authService.GetAccount(claims.Subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
+		return
+	}
+	creds, err := s.webauthnService.ListCredentials(account.ID)
+	if err != nil {
+		respondInternal(c, "failed to list security keys", wrapErr("list webauthn credentials", err))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":      s.webauthnService.Enabled(),
+		"passwordless": s.webauthnService.PasswordlessEnabled(),
+		"credentials":  creds,
+	})
+}
+
+type renameWebAuthnPayload struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) renameWebAuthnCredentialHandler(c *gin.Context) {
+	claims := getClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		return
+	}
+	var payload renameWebAuthnPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	account, err := s.authService.GetAccount(claims.Subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
+		return
+	}
+	if err := s.webauthnService.RenameCredential(account.ID, c.Param("id"), payload.Name); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		} else if err.Error() == "name is required" {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "security key renamed"})
+}
+
+type deleteWebAuthnPayload struct {
+	Password string `json:"password"`
+}
+
+func (s *Server) deleteWebAuthnCredentialHandler(c *gin.Context) {
+	claims := getClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		return
+	}
+	var payload deleteWebAuthnPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	if err := s.authService.VerifyPassword(claims.Subject, payload.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid password"})
+		return
+	}
+	account, err := s.authService.GetAccount(claims.Subject)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
+		return
+	}
+	if err := s.webauthnService.DeleteCredential(*account, c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status = http.StatusNotFound
+		} else if errors.Is(err, auth.ErrWebAuthnLastHardwareKey) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	_ = s.auditService.RecordEvent(audit.Event{
+		ActorID:    claims.Subject,
+		ActorName:  claims.Name,
+		Action:     "remove-security-key",
+		TargetType: "security-key",
+		TargetID:   c.Param("id"),
+		Details:    fmt.Sprintf("Removed security key: %s", c.Param("id")),
+		IPAddress:  c.ClientIP(),
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "security key removed"})
+}
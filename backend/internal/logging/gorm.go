@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// slowQuery matches the threshold of GORM's default logger.
+const slowQuery = 200 * time.Millisecond
+
+// gormLogger sends GORM messages to the logger of the statement context, so queries
+// run for a request or a schedule carry its fields.
+type gormLogger struct {
+	level logger.LogLevel
+}
+
+// Gorm returns a GORM logger writing through slog at the given GORM level.
+func Gorm(level logger.LogLevel) logger.Interface {
+	return gormLogger{level: level}
+}
+
+func (l gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return gormLogger{level: level}
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		Ctx(ctx).Info(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		Ctx(ctx).Warn(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		Ctx(ctx).Error(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		sql, rows := fc()
+		Ctx(ctx).Error("database query failed", "error", err, "elapsed_ms", elapsed.Milliseconds(), "rows", rows, "sql", sql)
+	case elapsed > slowQuery && l.level >= logger.Warn:
+		sql, rows := fc()
+		Ctx(ctx).Warn("slow database query", "elapsed_ms", elapsed.Milliseconds(), "rows", rows, "sql", sql)
+	case l.level >= logger.Info:
+		sql, rows := fc()
+		Ctx(ctx).Debug("database query", "elapsed_ms", elapsed.Milliseconds(), "rows", rows, "sql", sql)
+	}
+}
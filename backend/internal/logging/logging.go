@@ -1,6 +1,8 @@
 package logging
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
@@ -8,19 +10,56 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Field keys shared by every subsystem, so one entity can be followed across logs.
+const (
+	KeyRequestID   = "request_id"
+	KeyScheduleID  = "schedule_id"
+	KeyContainerID = "container_id"
+	KeyAgentID     = "agent_id"
+	KeyCommandID   = "command_id"
+	KeyTraceID     = "trace_id"
+)
+
+// level is shared by the loggers built with New so SetLevel changes them at runtime.
+var level = new(slog.LevelVar)
+
 // New builds a JSON slog logger with the provided level (info by default).
-func New(level string) *slog.Logger {
-	lvl := parseLevel(level)
+func New(lvl string) *slog.Logger {
+	level.Set(parseLevel(lvl))
 	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
-		Level:       lvl,
+		Level:       level,
 		AddSource:   false,
 		ReplaceAttr: nil,
 	})
 	return slog.New(handler)
 }
 
+// SetLevel changes the level of the loggers built with New.
+func SetLevel(lvl string) error {
+	if err := ValidateLevel(lvl); err != nil {
+		return err
+	}
+	level.Set(parseLevel(lvl))
+	return nil
+}
+
+// Level returns the current level name, in lower case.
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// ValidateLevel reports whether lvl names a level; empty means the default.
+func ValidateLevel(lvl string) error {
+	switch strings.ToLower(strings.TrimSpace(lvl)) {
+	case "", "debug", "info", "warn", "warning", "error":
+		return nil
+	}
+	return fmt.Errorf("unknown log level %q: use debug, info, warn or error", lvl)
+}
+
 func parseLevel(val string) slog.Level {
 	switch strings.ToLower(strings.TrimSpace(val)) {
 	case "debug":
@@ -36,6 +75,22 @@ func parseLevel(val string) slog.Level {
 
 type ctxKey struct{}
 
+// NewContext returns a copy of ctx carrying logger, for code that is not handed a
+// logger directly, such as services called from a request or a schedule run.
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// Ctx returns the logger carried by ctx or the default slog logger.
+func Ctx(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if lgr, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok && lgr != nil {
+			return lgr
+		}
+	}
+	return slog.Default()
+}
+
 // FromContext returns a logger embedded in the Gin context or the default slog logger.
 func FromContext(c *gin.Context) *slog.Logger {
 	if c == nil {
@@ -62,13 +117,17 @@ func Middleware(base *slog.Logger) gin.HandlerFunc {
 		}
 
 		reqLogger := base.With(
-			"req_id", reqID,
+			KeyRequestID, reqID,
 			"method", c.Request.Method,
 			"path", c.FullPath(),
 			"client_ip", c.ClientIP(),
 		)
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			reqLogger = reqLogger.With(KeyTraceID, span.TraceID().String())
+		}
 
 		c.Set(loggerKey(), reqLogger)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), reqLogger))
 		c.Header("X-Request-Id", reqID)
 
 		c.Next()
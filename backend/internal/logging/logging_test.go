@@ -2,6 +2,7 @@ package logging
 
 import (
 	"bytes"
+	"context"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -40,10 +41,44 @@ func TestMiddlewareInjectsLoggerAndRequestID(t *testing.T) {
 		t.Fatalf("expected status 200, got %d", w.Code)
 	}
 	logOut := output.String()
-	if !strings.Contains(logOut, `"req_id"`) {
+	if !strings.Contains(logOut, `"request_id"`) {
 		t.Fatalf("expected request id in logs, got %s", logOut)
 	}
 	if !strings.Contains(logOut, "handler hit") {
 		t.Fatalf("expected handler log in output, got %s", logOut)
 	}
 }
+
+func TestSetLevelChangesLoggersAtRuntime(t *testing.T) {
+	logger := New("info")
+	t.Cleanup(func() { _ = SetLevel("info") })
+
+	if logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("expected debug to be disabled at info level")
+	}
+	if err := SetLevel("debug"); err != nil {
+		t.Fatalf("set level: %v", err)
+	}
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Fatal("expected debug to be enabled after SetLevel")
+	}
+	if got := Level(); got != "debug" {
+		t.Fatalf("expected level debug, got %q", got)
+	}
+	if err := SetLevel("verbose"); err == nil {
+		t.Fatal("expected an error for an unknown level")
+	}
+	if got := Level(); got != "debug" {
+		t.Fatalf("expected level to be unchanged, got %q", got)
+	}
+}
+
+func TestCtxFallsBackToDefault(t *testing.T) {
+	if Ctx(context.Background()) != slog.Default() {
+		t.Fatal("expected default logger without one in context")
+	}
+	logger := slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil))
+	if Ctx(NewContext(context.Background(), logger)) != logger {
+		t.Fatal("expected logger stored in context")
+	}
+}
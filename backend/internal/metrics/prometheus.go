@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Registry holds the metrics counted as events happen. State read from the database
+// and Docker at scrape time is collected by the /metrics handler.
+var Registry = prometheus.NewRegistry()
+
+var (
+	updateAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "updockly_update_attempts_total",
+		Help: "Container updates, rollbacks and restores by source, kind and outcome.",
+	}, []string{"source", "kind", "outcome"})
+
+	updateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "updockly_update_duration_seconds",
+		Help:    "Time taken by container updates, rollbacks and restores.",
+		Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200},
+	}, []string{"source", "kind", "outcome"})
+
+	notificationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "updockly_notification_failures_total",
+		Help: "Failed notification sends by destination type; outcome is retry or dead.",
+	}, []string{"type", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		updateAttempts,
+		updateDuration,
+		notificationFailures,
+	)
+}
+
+// Update outcomes. A failed update that restored the previous container is rolled back.
+const (
+	OutcomeSuccess    = "success"
+	OutcomeFailed     = "failed"
+	OutcomeRolledBack = "rolled_back"
+)
+
+// ObserveUpdate counts an update, rollback or restore. took is left out of the
+// histogram when it is not known.
+func ObserveUpdate(source, kind, outcome string, took time.Duration) {
+	updateAttempts.WithLabelValues(source, kind, outcome).Inc()
+	if took > 0 {
+		updateDuration.WithLabelValues(source, kind, outcome).Observe(took.Seconds())
+	}
+}
+
+// NotificationFailed counts a failed send; dead sends will not be retried.
+func NotificationFailed(targetType string, dead bool) {
+	outcome := "retry"
+	if dead {
+		outcome = "dead"
+	}
+	notificationFailures.WithLabelValues(targetType, outcome).Inc()
+}
@@ -0,0 +1,417 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/domain"
+)
+
+// SampleInterval is how often the running history sampler looks at the hosts.
+const SampleInterval = 5 * time.Minute
+
+// LocalHost names the local Docker host in samples and queries.
+const LocalHost = "local"
+
+// agentOnlineWindow is how recent an agent's heartbeat must be for its containers to
+// be counted; containers of offline agents are unknown rather than stopped.
+const agentOnlineWindow = 5 * time.Minute
+
+// Rollups of the running history.
+const (
+	RollupHour = "hour"
+	RollupDay  = "day"
+	RollupWeek = "week"
+)
+
+var ErrInvalidRollup = errors.New("rollup must be hour, day or week")
+
+// hostState is what the sampler saw on one host. agentID is empty for the local host.
+type hostState struct {
+	agentID    string
+	name       string
+	containers []containerState
+}
+
+type containerState struct {
+	name    string
+	running bool
+}
+
+// SeriesQuery selects running history. Host is empty for all hosts, LocalHost for the
+// local host or an agent ID.
+type SeriesQuery struct {
+	From   time.Time
+	To     time.Time
+	Rollup string
+	Host   string
+	ByHost bool
+}
+
+// RollupPoint is the running history over one rollup period. Running and Total are
+// averages over the samples; without ByHost every sample sums all hosts seen in it.
+type RollupPoint struct {
+	Start      time.Time `json:"start"`
+	AgentID    string    `json:"agentId,omitempty"`
+	Host       string    `json:"host,omitempty"`
+	Running    float64   `json:"running"`
+	Total      float64   `json:"total"`
+	MinRunning int       `json:"minRunning"`
+	MaxRunning int       `json:"maxRunning"`
+	Samples    int       `json:"samples"`
+}
+
+// UptimeQuery selects containers for Uptime. Host is as in SeriesQuery; Container
+// is an exact name.
+type UptimeQuery struct {
+	From      time.Time
+	To        time.Time
+	Host      string
+	Container string
+}
+
+// ContainerUptime is how long a container was seen running out of how long it was
+// seen at all between the query bounds. Availability is a percentage of the observed
+// time, so periods the host was not reachable do not count against it.
+type ContainerUptime struct {
+	AgentID         string  `json:"agentId,omitempty"`
+	Host            string  `json:"host"`
+	ContainerName   string  `json:"containerName"`
+	RunningSeconds  float64 `json:"runningSeconds"`
+	ObservedSeconds float64 `json:"observedSeconds"`
+	Availability    float64 `json:"availability"`
+}
+
+// ParseRollup reads a rollup query value. Empty picks hours for ranges up to a week
+// and days beyond that.
+func ParseRollup(value string, from, to time.Time) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		if to.Sub(from) <= 7*24*time.Hour {
+			return RollupHour, nil
+		}
+		return RollupDay, nil
+	case RollupHour:
+		return RollupHour, nil
+	case RollupDay:
+		return RollupDay, nil
+	case RollupWeek:
+		return RollupWeek, nil
+	}
+	return "", ErrInvalidRollup
+}
+
+// Sample records the containers of the local host and of online agents at now, and
+// keeps today's daily snapshot current.
+func (s *Service) Sample(ctx context.Context, now time.Time) error {
+	if s.db == nil {
+		return errors.New("database not ready")
+	}
+	hosts := s.observe(ctx, now)
+	if err := s.record(now, hosts); err != nil {
+		return err
+	}
+	running, total := 0, 0
+	for _, host := range hosts {
+		for _, cont := range host.containers {
+			if cont.running {
+				running++
+			}
+			total++
+		}
+	}
+	s.ensureRunningSnapshot(running, total, now)
+	return nil
+}
+
+// observe lists the containers of the local Docker host, when it can be reached, and
+// those last reported by agents seen within agentOnlineWindow.
+func (s *Service) observe(ctx context.Context, now time.Time) []hostState {
+	var hosts []hostState
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err == nil {
+		defer cli.Close()
+		if containers, err := cli.ContainerList(ctx, container.ListOptions{All: true}); err == nil {
+			local := hostState{name: LocalHost}
+			for _, cont := range containers {
+				name := cont.ID
+				if len(cont.Names) > 0 {
+					name = strings.TrimPrefix(cont.Names[0], "/")
+				}
+				local.containers = append(local.containers, containerState{
+					name:    name,
+					running: strings.EqualFold(cont.State, "running"),
+				})
+			}
+			hosts = append(hosts, local)
+		}
+	}
+
+	var agents []domain.Agent
+	if err := s.db.Session(&gorm.Session{Logger: logger.Discard}).Find(&agents).Error; err == nil {
+		cutoff := now.Add(-agentOnlineWindow)
+		for _, ag := range agents {
+			if ag.LastSeen == nil || ag.LastSeen.Before(cutoff) {
+				continue
+			}
+			host := hostState{agentID: ag.ID, name: ag.Name}
+			for _, cont := range ag.Containers {
+				host.containers = append(host.containers, containerState{
+					name:    cont.Name,
+					running: strings.EqualFold(cont.State, "running"),
+				})
+			}
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// record stores one sample per host and extends or starts the state span of each
+// container.
+func (s *Service) record(at time.Time, hosts []hostState) error {
+	// Stored in UTC so comparisons match on SQLite, which compares text.
+	at = at.UTC()
+	return s.db.Session(&gorm.Session{Logger: logger.Discard}).Transaction(func(tx *gorm.DB) error {
+		var recent []domain.ContainerStateSpan
+		if err := tx.Where("ended_at >= ?", at.Add(-2*SampleInterval)).Order("ended_at ASC").Find(&recent).Error; err != nil {
+			return err
+		}
+		latest := make(map[[2]string]domain.ContainerStateSpan, len(recent))
+		for _, span := range recent {
+			latest[[2]string{span.AgentID, span.ContainerName}] = span
+		}
+
+		for _, host := range hosts {
+			sample := domain.RunningSample{SampledAt: at, AgentID: host.agentID, Host: host.name}
+			for _, cont := range host.containers {
+				sample.Total++
+				if cont.running {
+					sample.Running++
+				}
+				if cont.name == "" {
+					continue
+				}
+				span, ok := latest[[2]string{host.agentID, cont.name}]
+				switch {
+				case ok && span.Running == cont.running:
+					span.EndedAt = at
+					if err := tx.Save(&span).Error; err != nil {
+						return err
+					}
+				default:
+					// A state change is counted from the previous sample.
+					start := at
+					if ok {
+						start = span.EndedAt
+					}
+					next := domain.ContainerStateSpan{
+						AgentID:       host.agentID,
+						ContainerName: cont.name,
+						Running:       cont.running,
+						StartedAt:     start,
+						EndedAt:       at,
+					}
+					if err := tx.Create(&next).Error; err != nil {
+						return err
+					}
+				}
+			}
+			if err := tx.Create(&sample).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RunningSeries returns the running history between From and To rolled up by period,
+// oldest first.
+func (s *Service) RunningSeries(q SeriesQuery) ([]RollupPoint, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	tx := s.db.Where("sampled_at >= ? AND sampled_at <= ?", q.From.UTC(), q.To.UTC())
+	if q.Host != "" {
+		tx = tx.Where("agent_id = ?", hostAgentID(q.Host))
+	}
+	var rows []domain.RunningSample
+	if err := tx.Order("sampled_at ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	if !q.ByHost {
+		// Sum the hosts of each sweep so every sample counts all of them.
+		var summed []domain.RunningSample
+		for _, row := range rows {
+			if n := len(summed); n > 0 && summed[n-1].SampledAt.Equal(row.SampledAt) {
+				summed[n-1].Running += row.Running
+				summed[n-1].Total += row.Total
+				continue
+			}
+			summed = append(summed, domain.RunningSample{SampledAt: row.SampledAt, Running: row.Running, Total: row.Total})
+		}
+		rows = summed
+	}
+
+	type key struct {
+		start   time.Time
+		agentID string
+	}
+	buckets := map[key]*RollupPoint{}
+	var order []key
+	for _, row := range rows {
+		k := key{start: s.periodStart(row.SampledAt, q.Rollup), agentID: row.AgentID}
+		point, ok := buckets[k]
+		if !ok {
+			point = &RollupPoint{Start: k.start, AgentID: row.AgentID, Host: row.Host, MinRunning: row.Running}
+			buckets[k] = point
+			order = append(order, k)
+		}
+		point.Running += float64(row.Running)
+		point.Total += float64(row.Total)
+		point.MinRunning = min(point.MinRunning, row.Running)
+		point.MaxRunning = max(point.MaxRunning, row.Running)
+		point.Samples++
+	}
+
+	points := make([]RollupPoint, 0, len(order))
+	for _, k := range order {
+		point := buckets[k]
+		point.Running /= float64(point.Samples)
+		point.Total /= float64(point.Samples)
+		points = append(points, *point)
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		if !points[i].Start.Equal(points[j].Start) {
+			return points[i].Start.Before(points[j].Start)
+		}
+		return points[i].Host < points[j].Host
+	})
+	return points, nil
+}
+
+// periodStart truncates t to the start of its rollup period in the service timezone.
+// Weeks start on Monday.
+func (s *Service) periodStart(t time.Time, rollup string) time.Time {
+	t = t.In(s.location())
+	switch rollup {
+	case RollupDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case RollupWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+// Uptime returns the availability of each container seen between From and To, by
+// host and name.
+func (s *Service) Uptime(q UptimeQuery) ([]ContainerUptime, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	from, to := q.From.UTC(), q.To.UTC()
+	tx := s.db.Where("ended_at > ? AND started_at < ?", from, to)
+	if q.Host != "" {
+		tx = tx.Where("agent_id = ?", hostAgentID(q.Host))
+	}
+	if q.Container != "" {
+		tx = tx.Where("container_name = ?", q.Container)
+	}
+	var spans []domain.ContainerStateSpan
+	if err := tx.Find(&spans).Error; err != nil {
+		return nil, err
+	}
+
+	names := map[string]string{"": LocalHost}
+	var agents []domain.Agent
+	if err := s.db.Select("id", "name").Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	for _, ag := range agents {
+		names[ag.ID] = ag.Name
+	}
+
+	byContainer := map[[2]string]*ContainerUptime{}
+	for _, span := range spans {
+		start, end := span.StartedAt, span.EndedAt
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		seconds := end.Sub(start).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+		k := [2]string{span.AgentID, span.ContainerName}
+		up, ok := byContainer[k]
+		if !ok {
+			host := names[span.AgentID]
+			if host == "" {
+				host = span.AgentID
+			}
+			up = &ContainerUptime{AgentID: span.AgentID, Host: host, ContainerName: span.ContainerName}
+			byContainer[k] = up
+		}
+		up.ObservedSeconds += seconds
+		if span.Running {
+			up.RunningSeconds += seconds
+		}
+	}
+
+	result := make([]ContainerUptime, 0, len(byContainer))
+	for _, up := range byContainer {
+		up.Availability = up.RunningSeconds / up.ObservedSeconds * 100
+		result = append(result, *up)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Host != result[j].Host {
+			return result[i].Host < result[j].Host
+		}
+		return result[i].ContainerName < result[j].ContainerName
+	})
+	return result, nil
+}
+
+// PruneRunning removes samples and state spans that ended before cutoff.
+func (s *Service) PruneRunning(cutoff time.Time) (int64, error) {
+	if s.db == nil {
+		return 0, errors.New("database not ready")
+	}
+	quiet := s.db.Session(&gorm.Session{Logger: logger.Discard})
+	samples := quiet.Where("sampled_at < ?", cutoff.UTC()).Delete(&domain.RunningSample{})
+	if samples.Error != nil {
+		return 0, samples.Error
+	}
+	spans := quiet.Where("ended_at < ?", cutoff.UTC()).Delete(&domain.ContainerStateSpan{})
+	if spans.Error != nil {
+		return samples.RowsAffected, spans.Error
+	}
+	return samples.RowsAffected + spans.RowsAffected, nil
+}
+
+func (s *Service) location() *time.Location {
+	if s.timezone == nil {
+		return time.Local
+	}
+	return s.timezone
+}
+
+// hostAgentID maps a host query value to the stored agent ID.
+func hostAgentID(host string) string {
+	if host == LocalHost {
+		return ""
+	}
+	return host
+}
@@ -1,7 +1,6 @@
 package metrics
 
 import (
-	"context"
 	"testing"
 	"time"
 
@@ -17,7 +16,12 @@ func setupMetricsDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("open db: %v", err)
 	}
-	if err := db.AutoMigrate(&domain.RunningSnapshot{}); err != nil {
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.RunningSnapshot{}, &domain.RunningSample{}, &domain.ContainerStateSpan{}, &domain.Agent{}); err != nil {
 		t.Fatalf("migrate: %v", err)
 	}
 	return db
@@ -27,7 +31,8 @@ func TestRecordRunningSnapshot(t *testing.T) {
 	db := setupMetricsDB(t)
 	svc := NewService(db, time.UTC)
 
-	svc.ensureRunningSnapshot(context.Background())
+	svc.ensureRunningSnapshot(3, 5, time.Now())
+	svc.ensureRunningSnapshot(4, 5, time.Now())
 
 	var rows []domain.RunningSnapshot
 	if err := db.Find(&rows).Error; err != nil {
@@ -36,7 +41,95 @@ func TestRecordRunningSnapshot(t *testing.T) {
 	if len(rows) != 1 {
 		t.Fatalf("expected 1 snapshot, got %d", len(rows))
 	}
-	if rows[0].Running < 0 || rows[0].Total < 0 {
+	if rows[0].Running != 4 || rows[0].Total != 5 {
 		t.Fatalf("unexpected snapshot values: %+v", rows[0])
 	}
 }
+
+func TestRunningSeriesAndUptime(t *testing.T) {
+	db := setupMetricsDB(t)
+	svc := NewService(db, time.UTC)
+	if err := db.Create(&domain.Agent{ID: "a1", Name: "edge"}).Error; err != nil {
+		t.Fatalf("create agent: %v", err)
+	}
+
+	// A Monday morning: web runs throughout, db stops after 30 minutes and its agent is
+	// offline between 60 and 90 minutes.
+	t0 := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	sample := func(minute int, dbRunning bool, agentOnline bool) {
+		hosts := []hostState{{name: LocalHost, containers: []containerState{{name: "web", running: true}}}}
+		if agentOnline {
+			hosts = append(hosts, hostState{agentID: "a1", name: "edge", containers: []containerState{{name: "db", running: dbRunning}}})
+		}
+		if err := svc.record(t0.Add(time.Duration(minute)*time.Minute), hosts); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	for minute := 0; minute <= 60; minute += 5 {
+		sample(minute, minute <= 30, true)
+	}
+	sample(90, true, true)
+
+	points, err := svc.RunningSeries(SeriesQuery{From: t0, To: t0.Add(2 * time.Hour), Rollup: RollupHour})
+	if err != nil {
+		t.Fatalf("series: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("expected 2 hourly points, got %+v", points)
+	}
+	if first := points[0]; first.Samples != 12 || first.MinRunning != 1 || first.MaxRunning != 2 || first.Total != 2 {
+		t.Fatalf("unexpected first hour: %+v", first)
+	}
+
+	perHost, err := svc.RunningSeries(SeriesQuery{From: t0, To: t0.Add(2 * time.Hour), Rollup: RollupHour, ByHost: true})
+	if err != nil {
+		t.Fatalf("series by host: %v", err)
+	}
+	if len(perHost) != 4 || perHost[0].Host != "edge" || perHost[1].Host != LocalHost {
+		t.Fatalf("unexpected per-host series: %+v", perHost)
+	}
+
+	weekly, err := svc.RunningSeries(SeriesQuery{From: t0, To: t0.Add(2 * time.Hour), Rollup: RollupWeek, Host: LocalHost})
+	if err != nil {
+		t.Fatalf("weekly series: %v", err)
+	}
+	if len(weekly) != 1 || !weekly[0].Start.Equal(time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)) || weekly[0].Running != 1 {
+		t.Fatalf("unexpected weekly series: %+v", weekly)
+	}
+
+	uptime, err := svc.Uptime(UptimeQuery{From: t0, To: t0.Add(90 * time.Minute)})
+	if err != nil {
+		t.Fatalf("uptime: %v", err)
+	}
+	if len(uptime) != 2 {
+		t.Fatalf("expected 2 containers, got %+v", uptime)
+	}
+	if got := uptime[0]; got.ContainerName != "db" || got.Host != "edge" || got.ObservedSeconds != 3600 || got.Availability != 50 {
+		t.Fatalf("unexpected db uptime: %+v", got)
+	}
+	if web := uptime[1]; web.ContainerName != "web" || web.Availability != 100 {
+		t.Fatalf("unexpected web uptime: %+v", web)
+	}
+
+	// A range inside the first half hour sees db always running.
+	uptime, err = svc.Uptime(UptimeQuery{From: t0.Add(10 * time.Minute), To: t0.Add(20 * time.Minute), Host: "a1"})
+	if err != nil {
+		t.Fatalf("uptime range: %v", err)
+	}
+	if len(uptime) != 1 || uptime[0].ObservedSeconds != 600 || uptime[0].Availability != 100 {
+		t.Fatalf("unexpected ranged uptime: %+v", uptime)
+	}
+
+	removed, err := svc.PruneRunning(t0.Add(61 * time.Minute))
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if removed == 0 {
+		t.Fatalf("expected old samples to be pruned")
+	}
+	var left int64
+	db.Model(&domain.RunningSample{}).Count(&left)
+	if left != 2 {
+		t.Fatalf("expected the last sweep to remain, got %d samples", left)
+	}
+}
@@ -0,0 +1,402 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const telegramAPIBase = "https://api.telegram.org"
+
+// Overridden in tests.
+var (
+	discordAPIBase = "https://discord.com/api/v10"
+	pushoverAPIURL = "https://api.pushover.net/1/messages.json"
+)
+
+func init() {
+	Register(ChannelType{
+		Name:  "discord",
+		Label: "Discord",
+		Fields: []Field{
+			{Key: "token", Label: "Bot token", Secret: true, Required: true},
+			{Key: "channelId", Label: "Channel ID", Required: true},
+		},
+		New: func(cfg Config) (Notifier, error) {
+			return &Discord{Token: cfg.get("token", ""), ChannelID: cfg.get("channelId", "")}, nil
+		},
+	})
+	Register(ChannelType{
+		Name:  "webhook",
+		Label: "Webhook",
+		Fields: []Field{
+			{Key: "url", Label: "URL", Secret: true, Required: true},
+			{Key: "format", Label: "Payload (content or event)", Default: WebhookContent},
+			{Key: "secret", Label: "Signing secret", Secret: true},
+			{Key: "headers", Label: "Extra headers (one \"Name: value\" per line)", Secret: true},
+		},
+		New: func(cfg Config) (Notifier, error) {
+			format := cfg.get("format", WebhookContent)
+			if format != WebhookContent && format != WebhookEvent {
+				return nil, fmt.Errorf("unknown webhook payload %q", format)
+			}
+			headers, err := parseHeaders(cfg.get("headers", ""))
+			if err != nil {
+				return nil, err
+			}
+			return &Webhook{URL: cfg.get("url", ""), Format: format, Secret: cfg.get("secret", ""), Headers: headers}, nil
+		},
+	})
+	Register(ChannelType{
+		Name:   "slack",
+		Label:  "Slack",
+		Fields: []Field{{Key: "webhookUrl", Label: "Incoming webhook URL", Secret: true, Required: true}},
+		New: func(cfg Config) (Notifier, error) {
+			return &Slack{WebhookURL: cfg.get("webhookUrl", "")}, nil
+		},
+	})
+	Register(ChannelType{
+		Name:   "teams",
+		Label:  "Microsoft Teams",
+		Fields: []Field{{Key: "webhookUrl", Label: "Incoming webhook URL", Secret: true, Required: true}},
+		New: func(cfg Config) (Notifier, error) {
+			return &Teams{WebhookURL: cfg.get("webhookUrl", "")}, nil
+		},
+	})
+	Register(ChannelType{
+		Name:  "telegram",
+		Label: "Telegram",
+		Fields: []Field{
+			{Key: "botToken", Label: "Bot token", Secret: true, Required: true},
+			{Key: "chatId", Label: "Chat ID", Required: true},
+			{Key: "serverUrl", Label: "Bot API server", Default: telegramAPIBase},
+		},
+		New: func(cfg Config) (Notifier, error) {
+			return &Telegram{
+				ServerURL: cfg.get("serverUrl", telegramAPIBase),
+				BotToken:  cfg.get("botToken", ""),
+				ChatID:    cfg.get("chatId", ""),
+			}, nil
+		},
+	})
+	Register(ChannelType{
+		Name:  "gotify",
+		Label: "Gotify",
+		Fields: []Field{
+			{Key: "serverUrl", Label: "Server URL", Required: true},
+			{Key: "token", Label: "Application token", Secret: true, Required: true},
+			{Key: "priority", Label: "Priority", Default: "5"},
+		},
+		New: func(cfg Config) (Notifier, error) {
+			priority, err := priorityValue(cfg.get("priority", "5"))
+			if err != nil {
+				return nil, err
+			}
+			return &Gotify{ServerURL: cfg.get("serverUrl", ""), Token: cfg.get("token", ""), Priority: priority}, nil
+		},
+	})
+	Register(ChannelType{
+		Name:  "ntfy",
+		Label: "ntfy",
+		Fields: []Field{
+			{Key: "serverUrl", Label: "Server URL", Default: "https://ntfy.sh"},
+			{Key: "topic", Label: "Topic", Required: true},
+			{Key: "token", Label: "Access token", Secret: true},
+			{Key: "priority", Label: "Priority (1-5)", Default: "3"},
+		},
+		New: func(cfg Config) (Notifier, error) {
+			priority, err := priorityValue(cfg.get("priority", "3"))
+			if err != nil {
+				return nil, err
+			}
+			return &Ntfy{
+				ServerURL: cfg.get("serverUrl", "https://ntfy.sh"),
+				Topic:     cfg.get("topic", ""),
+				Token:     cfg.get("token", ""),
+				Priority:  priority,
+			}, nil
+		},
+	})
+	Register(ChannelType{
+		Name:  "matrix",
+		Label: "Matrix",
+		Fields: []Field{
+			{Key: "homeserverUrl", Label: "Homeserver URL", Required: true},
+			{Key: "accessToken", Label: "Access token", Secret: true, Required: true},
+			{Key: "roomId", Label: "Room ID", Required: true},
+		},
+		New: func(cfg Config) (Notifier, error) {
+			return &Matrix{
+				HomeserverURL: cfg.get("homeserverUrl", ""),
+				AccessToken:   cfg.get("accessToken", ""),
+				RoomID:        cfg.get("roomId", ""),
+			}, nil
+		},
+	})
+	Register(ChannelType{
+		Name:  "pushover",
+		Label: "Pushover",
+		Fields: []Field{
+			{Key: "appToken", Label: "Application token", Secret: true, Required: true},
+			{Key: "userKey", Label: "User or group key", Secret: true, Required: true},
+			{Key: "device", Label: "Device"},
+			{Key: "priority", Label: "Priority (-2 to 2)", Default: "0"},
+		},
+		New: func(cfg Config) (Notifier, error) {
+			priority, err := priorityValue(cfg.get("priority", "0"))
+			if err != nil {
+				return nil, err
+			}
+			return &Pushover{
+				AppToken: cfg.get("appToken", ""),
+				UserKey:  cfg.get("userKey", ""),
+				Device:   cfg.get("device", ""),
+				Priority: priority,
+			}, nil
+		},
+	})
+	Register(ChannelType{
+		Name:  "email",
+		Label: "Email",
+		Fields: []Field{
+			{Key: "to", Label: "Recipients (comma-separated)", Required: true},
+			{Key: "host", Label: "SMTP host (empty uses the SMTP settings)"},
+			{Key: "port", Label: "SMTP port"},
+			{Key: "security", Label: "Security (starttls, tls or none; empty upgrades when offered)"},
+			{Key: "user", Label: "SMTP user"},
+			{Key: "password", Label: "SMTP password", Secret: true},
+			{Key: "from", Label: "From address"},
+		},
+		New: func(cfg Config) (Notifier, error) {
+			to := cfg.get("to", "")
+			if _, err := parseRecipients([]string{to}); err != nil {
+				return nil, err
+			}
+			security := strings.ToLower(cfg.get("security", SMTPAuto))
+			if !validSecurity(security) {
+				return nil, fmt.Errorf("unknown SMTP security mode %q", security)
+			}
+			port := 0
+			if raw := cfg.get("port", ""); raw != "" {
+				v, err := strconv.Atoi(raw)
+				if err != nil || v <= 0 || v > 65535 {
+					return nil, fmt.Errorf("invalid SMTP port %q", raw)
+				}
+				port = v
+			}
+			host := cfg.get("host", "")
+			from := cfg.get("from", "")
+			if host != "" && from == "" {
+				return nil, fmt.Errorf("from address is required with a custom SMTP host")
+			}
+			server := SMTP{
+				Host:     host,
+				Port:     port,
+				Security: security,
+				User:     cfg.get("user", ""),
+				Password: cfg.get("password", ""),
+				From:     from,
+			}
+			if err := server.Validate(); err != nil {
+				return nil, err
+			}
+			return &Email{SMTP: server, To: []string{to}}, nil
+		},
+	})
+}
+
+func priorityValue(raw string) (int, error) {
+	v, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q", raw)
+	}
+	return v, nil
+}
+
+func joinURL(base string, parts ...string) string {
+	return strings.TrimRight(base, "/") + "/" + strings.Join(parts, "/")
+}
+
+// ContentMessage is the {"content": ...} body used by Discord and plain webhooks.
+type ContentMessage struct {
+	Content string `json:"content"`
+}
+
+// Discord posts to a channel as a bot.
+type Discord struct {
+	Token     string
+	ChannelID string
+}
+
+func (d *Discord) Send(ctx context.Context, msg Message) error {
+	req, err := jsonRequest("discord API", http.MethodPost,
+		joinURL(discordAPIBase, "channels", d.ChannelID, "messages"), ContentMessage{Content: msg.Text()})
+	if err != nil {
+		return err
+	}
+	req.headers = map[string]string{"Authorization": "Bot " + d.Token}
+	return req.do(ctx)
+}
+
+// Slack posts to an incoming webhook.
+type Slack struct {
+	WebhookURL string
+}
+
+func (s *Slack) Send(ctx context.Context, msg Message) error {
+	text := msg.Body
+	if msg.Title != "" {
+		text = "*" + msg.Title + "*\n" + msg.Body
+	}
+	req, err := jsonRequest("slack", http.MethodPost, s.WebhookURL, map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	return req.do(ctx)
+}
+
+// Teams posts a MessageCard to an incoming webhook.
+type Teams struct {
+	WebhookURL string
+}
+
+func (t *Teams) Send(ctx context.Context, msg Message) error {
+	title := msg.Title
+	if title == "" {
+		title = "Updockly"
+	}
+	card := map[string]interface{}{
+		"@type":    "MessageCard",
+		"@context": "https://schema.org/extensions",
+		"summary":  title,
+		"title":    title,
+		// Teams renders markdown, where a single newline is not a line break.
+		"text": strings.ReplaceAll(msg.Body, "\n", "\n\n"),
+	}
+	req, err := jsonRequest("teams", http.MethodPost, t.WebhookURL, card)
+	if err != nil {
+		return err
+	}
+	return req.do(ctx)
+}
+
+// Telegram sends through the Bot API.
+type Telegram struct {
+	ServerURL string
+	BotToken  string
+	ChatID    string
+}
+
+func (t *Telegram) Send(ctx context.Context, msg Message) error {
+	req, err := jsonRequest("telegram", http.MethodPost, joinURL(t.ServerURL, "bot"+t.BotToken, "sendMessage"), map[string]interface{}{
+		"chat_id":                  t.ChatID,
+		"text":                     msg.Text(),
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+	return req.do(ctx)
+}
+
+// Gotify pushes to a Gotify server application.
+type Gotify struct {
+	ServerURL string
+	Token     string
+	Priority  int
+}
+
+func (g *Gotify) Send(ctx context.Context, msg Message) error {
+	req, err := jsonRequest("gotify", http.MethodPost, joinURL(g.ServerURL, "message"), map[string]interface{}{
+		"title":    msg.Title,
+		"message":  msg.Body,
+		"priority": g.Priority,
+	})
+	if err != nil {
+		return err
+	}
+	req.headers = map[string]string{"X-Gotify-Key": g.Token}
+	return req.do(ctx)
+}
+
+// Ntfy publishes to a topic using the JSON API, which avoids header encoding issues.
+type Ntfy struct {
+	ServerURL string
+	Topic     string
+	Token     string
+	Priority  int
+}
+
+func (n *Ntfy) Send(ctx context.Context, msg Message) error {
+	req, err := jsonRequest("ntfy", http.MethodPost, strings.TrimRight(n.ServerURL, "/"), map[string]interface{}{
+		"topic":    n.Topic,
+		"title":    msg.Title,
+		"message":  msg.Body,
+		"priority": n.Priority,
+	})
+	if err != nil {
+		return err
+	}
+	if n.Token != "" {
+		req.headers = map[string]string{"Authorization": "Bearer " + n.Token}
+	}
+	return req.do(ctx)
+}
+
+// Matrix sends an m.text event to a room.
+type Matrix struct {
+	HomeserverURL string
+	AccessToken   string
+	RoomID        string
+}
+
+func (m *Matrix) Send(ctx context.Context, msg Message) error {
+	txnID := fmt.Sprintf("updockly-%d", time.Now().UnixNano())
+	endpoint := joinURL(m.HomeserverURL, "_matrix/client/v3/rooms", url.PathEscape(m.RoomID), "send/m.room.message", txnID)
+	req, err := jsonRequest("matrix", http.MethodPut, endpoint, map[string]string{
+		"msgtype": "m.text",
+		"body":    msg.Text(),
+	})
+	if err != nil {
+		return err
+	}
+	req.headers = map[string]string{"Authorization": "Bearer " + m.AccessToken}
+	return req.do(ctx)
+}
+
+// Pushover sends through the Pushover messages API.
+type Pushover struct {
+	AppToken string
+	UserKey  string
+	Device   string
+	Priority int
+}
+
+func (p *Pushover) Send(ctx context.Context, msg Message) error {
+	form := url.Values{}
+	form.Set("token", p.AppToken)
+	form.Set("user", p.UserKey)
+	body := msg.Body
+	if body == "" {
+		body = msg.Title
+	}
+	form.Set("message", body)
+	form.Set("priority", strconv.Itoa(p.Priority))
+	if msg.Title != "" {
+		form.Set("title", msg.Title)
+	}
+	if p.Device != "" {
+		form.Set("device", p.Device)
+	}
+	return request{
+		channel:     "pushover",
+		method:      http.MethodPost,
+		url:         pushoverAPIURL,
+		contentType: "application/x-www-form-urlencoded",
+		body:        []byte(form.Encode()),
+	}.do(ctx)
+}
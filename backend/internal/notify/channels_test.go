@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type capturedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   string
+}
+
+func captureServer(t *testing.T, status int) (*httptest.Server, func() capturedRequest) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		last capturedRequest
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		last = capturedRequest{method: r.Method, path: r.URL.RequestURI(), header: r.Header.Clone(), body: string(body)}
+		mu.Unlock()
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("nope"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() capturedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func decodeJSON(t *testing.T, body string) map[string]interface{} {
+	t.Helper()
+	var out map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &out); err != nil {
+		t.Fatalf("decode %q: %v", body, err)
+	}
+	return out
+}
+
+func TestChannelRequests(t *testing.T) {
+	srv, last := captureServer(t, http.StatusOK)
+	origDiscord, origPushover := discordAPIBase, pushoverAPIURL
+	discordAPIBase, pushoverAPIURL = srv.URL+"/discord", srv.URL+"/pushover"
+	t.Cleanup(func() { discordAPIBase, pushoverAPIURL = origDiscord, origPushover })
+
+	msg := Message{Event: EventUpdateSuccess, Title: "Update success", Body: "Container: web\nImage: nginx"}
+
+	cases := []struct {
+		typ    string
+		cfg    Config
+		check  func(t *testing.T, r capturedRequest)
+		method string
+		path   string
+	}{
+		{
+			typ: "discord", cfg: Config{"token": "bot-token", "channelId": "123"},
+			method: http.MethodPost, path: "/discord/channels/123/messages",
+			check: func(t *testing.T, r capturedRequest) {
+				if r.header.Get("Authorization") != "Bot bot-token" {
+					t.Fatalf("unexpected auth header %q", r.header.Get("Authorization"))
+				}
+				if decodeJSON(t, r.body)["content"] != msg.Text() {
+					t.Fatalf("unexpected body %s", r.body)
+				}
+			},
+		},
+		{
+			typ: "slack", cfg: Config{"webhookUrl": srv.URL + "/slack"},
+			method: http.MethodPost, path: "/slack",
+			check: func(t *testing.T, r capturedRequest) {
+				if decodeJSON(t, r.body)["text"] != "*Update success*\nContainer: web\nImage: nginx" {
+					t.Fatalf("unexpected body %s", r.body)
+				}
+			},
+		},
+		{
+			typ: "teams", cfg: Config{"webhookUrl": srv.URL + "/teams"},
+			method: http.MethodPost, path: "/teams",
+			check: func(t *testing.T, r capturedRequest) {
+				body := decodeJSON(t, r.body)
+				if body["@type"] != "MessageCard" || body["title"] != "Update success" {
+					t.Fatalf("unexpected body %s", r.body)
+				}
+			},
+		},
+		{
+			typ: "telegram", cfg: Config{"botToken": "42:abc", "chatId": "-100", "serverUrl": srv.URL},
+			method: http.MethodPost, path: "/bot42:abc/sendMessage",
+			check: func(t *testing.T, r capturedRequest) {
+				body := decodeJSON(t, r.body)
+				if body["chat_id"] != "-100" || body["text"] != msg.Text() {
+					t.Fatalf("unexpected body %s", r.body)
+				}
+			},
+		},
+		{
+			typ: "gotify", cfg: Config{"serverUrl": srv.URL + "/", "token": "app-token", "priority": "8"},
+			method: http.MethodPost, path: "/message",
+			check: func(t *testing.T, r capturedRequest) {
+				body := decodeJSON(t, r.body)
+				if r.header.Get("X-Gotify-Key") != "app-token" || body["priority"] != float64(8) || body["title"] != "Update success" {
+					t.Fatalf("unexpected request %v %s", r.header, r.body)
+				}
+			},
+		},
+		{
+			typ: "ntfy", cfg: Config{"serverUrl": srv.URL, "topic": "updates", "token": "tk"},
+			method: http.MethodPost, path: "/",
+			check: func(t *testing.T, r capturedRequest) {
+				body := decodeJSON(t, r.body)
+				if r.header.Get("Authorization") != "Bearer tk" || body["topic"] != "updates" || body["priority"] != float64(3) {
+					t.Fatalf("unexpected request %v %s", r.header, r.body)
+				}
+			},
+		},
+		{
+			typ: "matrix", cfg: Config{"homeserverUrl": srv.URL, "accessToken": "mx", "roomId": "!room:example.org"},
+			method: http.MethodPut,
+			check: func(t *testing.T, r capturedRequest) {
+				if !strings.HasPrefix(r.path, "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/updockly-") {
+					t.Fatalf("unexpected path %s", r.path)
+				}
+				if r.header.Get("Authorization") != "Bearer mx" || decodeJSON(t, r.body)["msgtype"] != "m.text" {
+					t.Fatalf("unexpected request %v %s", r.header, r.body)
+				}
+			},
+		},
+		{
+			typ: "pushover", cfg: Config{"appToken": "app", "userKey": "user", "priority": "1"},
+			method: http.MethodPost, path: "/pushover",
+			check: func(t *testing.T, r capturedRequest) {
+				form, err := url.ParseQuery(r.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if form.Get("token") != "app" || form.Get("user") != "user" || form.Get("title") != "Update success" || form.Get("priority") != "1" {
+					t.Fatalf("unexpected form %v", form)
+				}
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.typ, func(t *testing.T) {
+			n, err := New(tc.typ, tc.cfg)
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			if err := n.Send(context.Background(), msg); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			r := last()
+			if r.method != tc.method {
+				t.Fatalf("expected %s, got %s", tc.method, r.method)
+			}
+			if tc.path != "" && r.path != tc.path {
+				t.Fatalf("expected path %s, got %s", tc.path, r.path)
+			}
+			tc.check(t, r)
+		})
+	}
+}
+
+func TestChannelStatusError(t *testing.T) {
+	srv, _ := captureServer(t, http.StatusTooManyRequests)
+	err := (&Webhook{URL: srv.URL}).Send(context.Background(), Message{Body: "x"})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests || statusErr.Body != "nope" {
+		t.Fatalf("expected StatusError 429, got %v", err)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	if _, err := New("slack", Config{}); err == nil {
+		t.Fatalf("expected missing webhook URL to be rejected")
+	}
+	if _, err := New("gotify", Config{"serverUrl": "http://g", "token": "t", "priority": "high"}); err == nil {
+		t.Fatalf("expected invalid priority to be rejected")
+	}
+	if _, err := New("carrier-pigeon", Config{}); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("expected ErrUnknownType, got %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SMTP security modes. SMTPAuto upgrades with STARTTLS when the server offers it, which
+// is what net/smtp.SendMail does.
+const (
+	SMTPAuto     = ""
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+const smtpTimeout = 30 * time.Second
+
+var ErrSMTPNotConfigured = errors.New("SMTP not configured")
+
+// SMTP is an outgoing mail server.
+type SMTP struct {
+	Host     string
+	Port     int
+	Security string
+	User     string
+	Password string
+	From     string
+}
+
+// Configured reports whether a host is set.
+func (m SMTP) Configured() bool {
+	return strings.TrimSpace(m.Host) != ""
+}
+
+// Mail is one email. HTML is optional; when set the message is multipart/alternative.
+type Mail struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+var defaultSMTP atomic.Pointer[SMTP]
+
+// SetDefaultSMTP sets the server used by email channels that do not configure their own,
+// normally the SMTP settings.
+func SetDefaultSMTP(m SMTP) {
+	defaultSMTP.Store(&m)
+}
+
+func validSecurity(mode string) bool {
+	switch mode {
+	case SMTPAuto, SMTPStartTLS, SMTPTLS, SMTPNone:
+		return true
+	}
+	return false
+}
+
+// Validate checks the security mode and that credentials are not sent in the clear:
+// PLAIN auth is refused on an unencrypted connection to anything but localhost.
+func (m SMTP) Validate() error {
+	if !validSecurity(m.Security) {
+		return fmt.Errorf("unknown SMTP security mode %q", m.Security)
+	}
+	if m.Security == SMTPNone && (m.User != "" || m.Password != "") && !isLocalhost(m.Host) {
+		return errors.New("SMTP credentials need STARTTLS or TLS; security \"none\" only allows them for localhost")
+	}
+	return nil
+}
+
+// isLocalhost matches the hosts net/smtp allows PLAIN auth to without TLS.
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// Send delivers mail. SMTP replies are returned as *textproto.Error, so callers can tell
+// permanent (5xx) from temporary failures.
+func (m SMTP) Send(ctx context.Context, msg Mail) error {
+	if !m.Configured() {
+		return ErrSMTPNotConfigured
+	}
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(strings.TrimSpace(m.From))
+	if err != nil {
+		return fmt.Errorf("invalid from address %q: %w", m.From, err)
+	}
+	to, err := parseRecipients(msg.To)
+	if err != nil {
+		return err
+	}
+	data, err := msg.encode(from, to, time.Now())
+	if err != nil {
+		return err
+	}
+
+	port := m.Port
+	if port == 0 {
+		port = 587
+		if m.Security == SMTPTLS {
+			port = 465
+		}
+	}
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: m.Host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	var conn net.Conn
+	if m.Security == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("smtp dial: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(smtpTimeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if m.Security == SMTPAuto || m.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("smtp starttls: %w", err)
+			}
+		} else if m.Security == SMTPStartTLS {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+	}
+	if m.User != "" && m.Password != "" {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not offer AUTH; remove the SMTP credentials or check the security mode")
+		}
+		if err := client.Auth(smtp.PlainAuth("", m.User, m.Password, m.Host)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("smtp mail: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt.Address); err != nil {
+			return fmt.Errorf("smtp rcpt %s: %w", rcpt.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	return client.Quit()
+}
+
+// parseRecipients accepts bare or named addresses; entries may hold comma-separated
+// lists.
+func parseRecipients(raw []string) ([]*mail.Address, error) {
+	var out []*mail.Address
+	for _, entry := range raw {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		list, err := mail.ParseAddressList(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", entry, err)
+		}
+		out = append(out, list...)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no valid recipients")
+	}
+	return out, nil
+}
+
+// encode renders the message with its headers, quoted-printable bodies and CRLF line
+// endings.
+func (m Mail) encode(from *mail.Address, to []*mail.Address, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	addrs := make([]string, len(to))
+	for i, a := range to {
+		addrs[i] = a.String()
+	}
+	header("From", from.String())
+	header("To", strings.Join(addrs, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+
+	if m.HTML == "" {
+		header("Content-Type", "text/plain; charset=UTF-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func messageID(from string) string {
+	domain := "updockly.local"
+	if _, host, ok := strings.Cut(from, "@"); ok && host != "" {
+		domain = host
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
+
+var defaultHTMLTemplate = htmltemplate.Must(htmltemplate.New("email").Funcs(map[string]any{
+	"lines": func(s string) []string { return strings.Split(strings.TrimRight(s, "\n"), "\n") },
+}).Parse(`<!doctype html>
+<html><body style="font-family:-apple-system,Segoe UI,Helvetica,Arial,sans-serif;font-size:14px;color:#1f2937">
+{{if .Title}}<h2 style="font-size:18px">{{.Title}}</h2>{{end}}
+<p>{{range $i, $line := lines .Body}}{{if $i}}<br>{{end}}{{$line}}{{end}}</p>
+{{if .Links.Approve}}<p><a href="{{.Links.Approve}}">Approve update</a> &middot; <a href="{{.Links.Reject}}">Reject update</a></p>{{end}}
+{{with .Links.Container}}<p><a href="{{.}}">Open container</a></p>{{else}}{{with .Links.Agent}}<p><a href="{{.}}">Open agent</a></p>{{else}}{{with .Links.Dashboard}}<p><a href="{{.}}">Open Updockly</a></p>{{end}}{{end}}{{end}}
+</body></html>
+`))
+
+// DefaultHTML is the HTML part used when no HTML template applies: the title and body,
+// escaped, with a link into the web UI and the decision links of update requests.
+func DefaultHTML(msg Message) string {
+	var buf bytes.Buffer
+	if err := defaultHTMLTemplate.Execute(&buf, msg); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+// Email sends notifications to a fixed recipient list, through its own server or the
+// default one.
+type Email struct {
+	SMTP SMTP
+	To   []string
+}
+
+func (e *Email) Send(ctx context.Context, msg Message) error {
+	server := e.SMTP
+	if !server.Configured() {
+		if d := defaultSMTP.Load(); d != nil {
+			server = *d
+		}
+	}
+	subject := msg.Title
+	if subject == "" {
+		subject = "Updockly notification"
+	}
+	html := msg.HTML
+	if html == "" {
+		html = DefaultHTML(msg)
+	}
+	return server.Send(ctx, Mail{To: e.To, Subject: subject, Text: msg.Body, HTML: html})
+}
@@ -0,0 +1,292 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"updockly/backend/internal/domain"
+)
+
+// fakeSMTP is a plaintext SMTP server that records each transaction. Recipients listed in
+// reject are refused with a 550.
+type fakeSMTP struct {
+	addr   string
+	reject map[string]bool
+	noAuth bool
+
+	mu    sync.Mutex
+	mails []fakeMail
+}
+
+type fakeMail struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	f := &fakeSMTP{addr: ln.Addr().String(), reject: map[string]bool{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 fake ESMTP")
+	var m fakeMail
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if f.noAuth {
+				_ = tp.PrintfLine("250-fake\r\n250 8BITMIME")
+				continue
+			}
+			_ = tp.PrintfLine("250-fake\r\n250-AUTH PLAIN\r\n250 8BITMIME")
+		case "AUTH":
+			m.auth = arg
+			_ = tp.PrintfLine("235 ok")
+		case "MAIL":
+			from, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+			m.from = strings.Trim(from, "<>")
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if f.reject[rcpt] {
+				_ = tp.PrintfLine("550 no such user")
+				continue
+			}
+			m.to = append(m.to, rcpt)
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			m.data = string(data)
+			f.mu.Lock()
+			f.mails = append(f.mails, m)
+			f.mu.Unlock()
+			m = fakeMail{}
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (f *fakeSMTP) server() SMTP {
+	host, port, _ := net.SplitHostPort(f.addr)
+	p, _ := strconv.Atoi(port)
+	return SMTP{Host: host, Port: p, Security: SMTPNone, From: "Updockly <updockly@example.com>"}
+}
+
+func (f *fakeSMTP) sent() []fakeMail {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]fakeMail(nil), f.mails...)
+}
+
+func TestSMTPSendMultipart(t *testing.T) {
+	f := startFakeSMTP(t)
+	server := f.server()
+	server.User, server.Password = "bot", "s3cret"
+
+	err := server.Send(context.Background(), Mail{
+		To:      []string{"Ops <ops@example.com>, dev@example.com"},
+		Subject: "Mise à jour: web",
+		Text:    "Container: web\nImage: nginx:1.27",
+		HTML:    "<p>Container: <b>web</b></p>",
+	})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	mails := f.sent()
+	if len(mails) != 1 {
+		t.Fatalf("expected one mail, got %d", len(mails))
+	}
+	m := mails[0]
+	if m.from != "updockly@example.com" || strings.Join(m.to, ",") != "ops@example.com,dev@example.com" {
+		t.Fatalf("unexpected envelope %q -> %v", m.from, m.to)
+	}
+	if !strings.HasPrefix(m.auth, "PLAIN ") {
+		t.Fatalf("expected PLAIN auth, got %q", m.auth)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(m.data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Mise à jour: web" {
+		t.Fatalf("unexpected subject %q (%v)", subject, err)
+	}
+	if _, err := parsed.Header.Date(); err != nil {
+		t.Fatalf("expected a Date header: %v", err)
+	}
+	if id := parsed.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Fatalf("unexpected Message-ID %q", id)
+	}
+	if parsed.Header.Get("MIME-Version") != "1.0" {
+		t.Fatalf("expected MIME-Version 1.0")
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q (%v)", mediaType, err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		body, _ := io.ReadAll(part) // NextPart decodes quoted-printable
+		parts = append(parts, part.Header.Get("Content-Type")+"|"+string(body))
+	}
+	want := []string{
+		"text/plain; charset=UTF-8|Container: web\nImage: nginx:1.27",
+		"text/html; charset=UTF-8|<p>Container: <b>web</b></p>",
+	}
+	if strings.Join(parts, "\n--\n") != strings.Join(want, "\n--\n") {
+		t.Fatalf("unexpected parts %q", parts)
+	}
+}
+
+func TestSMTPSendErrors(t *testing.T) {
+	f := startFakeSMTP(t)
+	server := f.server()
+
+	server.Security = SMTPStartTLS
+	if err := server.Send(context.Background(), Mail{To: []string{"ops@example.com"}, Text: "x"}); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected required STARTTLS to fail against a plaintext server, got %v", err)
+	}
+
+	server.Security = SMTPNone
+	f.reject["gone@example.com"] = true
+	err := server.Send(context.Background(), Mail{To: []string{"gone@example.com"}, Text: "x"})
+	var reply *textproto.Error
+	if !errors.As(err, &reply) || reply.Code != 550 {
+		t.Fatalf("expected a 550 reply, got %v", err)
+	}
+	if retryable(err) {
+		t.Fatalf("expected a 5xx SMTP reply to be permanent")
+	}
+	if !retryable(&textproto.Error{Code: 451, Msg: "try later"}) {
+		t.Fatalf("expected a 4xx SMTP reply to be retried")
+	}
+
+	if err := (SMTP{}).Send(context.Background(), Mail{To: []string{"ops@example.com"}}); !errors.Is(err, ErrSMTPNotConfigured) {
+		t.Fatalf("expected ErrSMTPNotConfigured, got %v", err)
+	}
+	if err := server.Send(context.Background(), Mail{To: []string{"not an address"}}); err == nil {
+		t.Fatalf("expected invalid recipients to be rejected")
+	}
+
+	remote := SMTP{Host: "smtp.example.com", Security: SMTPNone, User: "bot", Password: "s3cret", From: "updockly@example.com"}
+	if err := remote.Validate(); err == nil {
+		t.Fatalf("expected credentials without TLS to a remote host to be rejected")
+	}
+	if err := remote.Send(context.Background(), Mail{To: []string{"ops@example.com"}, Text: "x"}); err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Fatalf("expected Send to refuse credentials without TLS, got %v", err)
+	}
+
+	f.noAuth = true
+	server.User, server.Password = "bot", "s3cret"
+	if err := server.Send(context.Background(), Mail{To: []string{"ops@example.com"}, Text: "x"}); err == nil || !strings.Contains(err.Error(), "AUTH") {
+		t.Fatalf("expected credentials to fail when the server does not offer AUTH, got %v", err)
+	}
+	if len(f.sent()) != 0 {
+		t.Fatalf("expected no mail to be sent without authenticating")
+	}
+}
+
+func TestEmailChannel(t *testing.T) {
+	f := startFakeSMTP(t)
+	SetDefaultSMTP(f.server())
+	t.Cleanup(func() { SetDefaultSMTP(SMTP{}) })
+
+	if _, err := New("email", Config{}); err == nil {
+		t.Fatalf("expected missing recipients to be rejected")
+	}
+	if _, err := New("email", Config{"to": "ops@example.com", "security": "ssl"}); err == nil {
+		t.Fatalf("expected unknown security modes to be rejected")
+	}
+	if _, err := New("email", Config{"to": "ops@example.com", "host": "smtp.example.com"}); err == nil {
+		t.Fatalf("expected a custom host without a from address to be rejected")
+	}
+	if _, err := New("email", Config{"to": "ops@example.com", "host": "smtp.example.com", "from": "updockly@example.com",
+		"security": "none", "user": "bot", "password": "s3cret"}); err == nil {
+		t.Fatalf("expected credentials without TLS to be rejected")
+	}
+
+	db := setupTestDB(t)
+	svc := NewService(db, nil)
+	for _, ch := range []domain.NotificationChannel{
+		{Name: "oncall", Type: "email", Enabled: true, Events: domain.StringList{EventUpdateFailure, EventAgentOffline},
+			Config: domain.StringMap{"to": "oncall@example.com, lead@example.com"}},
+		{Name: "team", Type: "email", Enabled: true, Events: domain.StringList{EventUpdateSuccess},
+			Config: domain.StringMap{"to": "team@example.com"}},
+	} {
+		if _, err := svc.Create(ch); err != nil {
+			t.Fatalf("create %s: %v", ch.Name, err)
+		}
+	}
+	if _, err := svc.SaveTemplate(domain.NotificationTemplate{Target: TargetEmail, Title: "[updockly] {{.Title}}"}); err != nil {
+		t.Fatalf("save template: %v", err)
+	}
+
+	dispatch(t, svc, Message{Event: EventAgentOffline, Title: "Agent offline", Body: "edge-1 <prod>"}, Route{})
+	mails := f.sent()
+	if len(mails) != 1 || strings.Join(mails[0].to, ",") != "oncall@example.com,lead@example.com" {
+		t.Fatalf("expected the offline event to reach the on-call list only, got %+v", mails)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(mails[0].data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	if subject := parsed.Header.Get("Subject"); subject != "[updockly] Agent offline" {
+		t.Fatalf("expected the shared email template to apply, got %q", subject)
+	}
+	body, _ := io.ReadAll(parsed.Body)
+	if !strings.Contains(string(body), "edge-1 &lt;prod&gt;") {
+		t.Fatalf("expected an escaped default HTML part, got %q", body)
+	}
+}
@@ -0,0 +1,120 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// StatusError is returned when a destination answers with a non-2xx status. RetryAfter
+// is set when the destination asked the sender to back off (HTTP 429).
+type StatusError struct {
+	Channel    string
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s error (%d): %s", e.Channel, e.StatusCode, e.Body)
+}
+
+// Response is the last HTTP response seen by a notifier, for the delivery log.
+type Response struct {
+	StatusCode int
+	Body       string
+}
+
+type responseKey struct{}
+
+// WithResponse returns a context in which notifiers record their HTTP response into the
+// returned Response.
+func WithResponse(ctx context.Context) (context.Context, *Response) {
+	res := &Response{}
+	return context.WithValue(ctx, responseKey{}, res), res
+}
+
+// retryAfter reads the Retry-After header (seconds or an HTTP date) or, for Discord,
+// the retry_after field of the JSON body.
+func retryAfter(header http.Header, body []byte) time.Duration {
+	if v := strings.TrimSpace(header.Get("Retry-After")); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+			return time.Duration(secs * float64(time.Second))
+		}
+		if at, err := http.ParseTime(v); err == nil {
+			if d := time.Until(at); d > 0 {
+				return d
+			}
+			return 0
+		}
+	}
+	var payload struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.RetryAfter > 0 {
+		return time.Duration(payload.RetryAfter * float64(time.Second))
+	}
+	return 0
+}
+
+type request struct {
+	channel     string
+	method      string
+	url         string
+	contentType string
+	headers     map[string]string
+	body        []byte
+}
+
+func jsonRequest(channel, method, url string, payload interface{}) (request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return request{}, fmt.Errorf("encode %s payload: %w", channel, err)
+	}
+	return request{channel: channel, method: method, url: url, contentType: "application/json", body: body}, nil
+}
+
+func (r request) do(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url, bytes.NewReader(r.body))
+	if err != nil {
+		return fmt.Errorf("build %s request: %w", r.channel, err)
+	}
+	if r.contentType != "" {
+		req.Header.Set("Content-Type", r.contentType)
+	}
+	for k, v := range r.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", r.channel, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	if rec, ok := ctx.Value(responseKey{}).(*Response); ok {
+		rec.StatusCode = resp.StatusCode
+		rec.Body = strings.TrimSpace(string(respBody))
+	}
+	if resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(respBody))
+		if msg == "" {
+			msg = resp.Status
+		}
+		statusErr := &StatusError{Channel: r.channel, StatusCode: resp.StatusCode, Body: msg}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			statusErr.RetryAfter = retryAfter(resp.Header, respBody)
+		}
+		return statusErr
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+// Package notify delivers notifications to pluggable channel types (Discord, Slack,
+// ntfy, ...). Channel instances live in the database; see Service.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"updockly/backend/internal/domain"
+)
+
+// Event kinds a channel can subscribe to.
+const (
+	EventUpdateSuccess   = "update-success"
+	EventUpdateFailure   = "update-failure"
+	EventUpdateRollback  = "update-rollback"
+	EventUpdateAvailable = "update-available"
+	EventUpdateApproval  = "update-approval"
+	EventAgentOffline    = "agent-offline"
+	EventAgentOnline     = "agent-online"
+	EventUpdateDigest    = "update-digest"
+	EventRecap           = "recap"
+	EventTest            = "test"
+)
+
+// Events lists every event kind in display order.
+var Events = []string{
+	EventUpdateSuccess,
+	EventUpdateFailure,
+	EventUpdateRollback,
+	EventUpdateAvailable,
+	EventUpdateApproval,
+	EventAgentOffline,
+	EventAgentOnline,
+	EventUpdateDigest,
+	EventRecap,
+	EventTest,
+}
+
+// Severities, lowest first.
+const (
+	SeverityInfo    = "info"
+	SeverityWarning = "warning"
+	SeverityError   = "error"
+)
+
+// Severities lists every severity, lowest first.
+var Severities = []string{SeverityInfo, SeverityWarning, SeverityError}
+
+// DefaultSeverity is the severity of an event when the sender does not set one.
+func DefaultSeverity(event string) string {
+	switch event {
+	case EventUpdateFailure, EventAgentOffline:
+		return SeverityError
+	case EventUpdateRollback, EventUpdateApproval:
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+// severityRank orders severities; unknown values rank as info.
+func severityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return 0
+}
+
+var ErrUnknownType = errors.New("unknown notification channel type")
+
+// Message is a notification and the data model of its templates (see template.go).
+// Title may be empty; channels without a native title field prepend it to the body.
+type Message struct {
+	// ID identifies the event; Enqueue assigns it.
+	ID       string
+	Event    string
+	Severity string
+	Title    string
+	Body     string
+	// HTML is an optional HTML rendering of Body, used by email.
+	HTML      string
+	Time      time.Time
+	Status    string
+	Source    string
+	Details   string
+	Container *ContainerInfo
+	Agent     *AgentInfo
+	Links     Links
+	Recap     *Recap
+	Digest    *Digest
+}
+
+// ContainerInfo describes the container an event is about. Digests are set when known;
+// Release is set for update events when the image's OCI labels were looked up.
+type ContainerInfo struct {
+	ID        string
+	Name      string
+	Image     string
+	OldDigest string
+	NewDigest string
+	Labels    map[string]string
+	Release   *ReleaseInfo
+}
+
+// ReleaseInfo is the version change of an update, from the OCI labels of the running and
+// new image. Releases lists the GitHub releases in between, newest first.
+type ReleaseInfo struct {
+	CurrentVersion string
+	Version        string
+	Revision       string
+	Source         string
+	URL            string
+	Releases       []domain.Release
+}
+
+// AgentInfo describes the agent an event is about; nil for the local host.
+type AgentInfo struct {
+	ID       string
+	Name     string
+	Hostname string
+}
+
+// Links point into the web UI. Approve and Reject are signed links that decide an
+// update request; they are set for update-approval events only.
+type Links struct {
+	Dashboard string
+	Container string
+	History   string
+	Agent     string
+	Approve   string
+	Reject    string
+}
+
+// Recap sections. A recap schedule picks any of them; none means all.
+const (
+	RecapUpdates   = "updates"
+	RecapFailures  = "failures"
+	RecapRollbacks = "rollbacks"
+	RecapPending   = "pending"
+	RecapOffline   = "offline"
+	RecapUptime    = "uptime"
+)
+
+var RecapSections = []string{RecapUpdates, RecapFailures, RecapRollbacks, RecapPending, RecapOffline, RecapUptime}
+
+// Recap summarises activity over a period. The counts and Entries always cover the
+// update history; the other fields are filled only for the sections listed in Sections.
+type Recap struct {
+	// Name is the recap schedule that produced it.
+	Name    string
+	Since   time.Time
+	Until   time.Time
+	Success int
+	Failed  int
+	Total   int
+	Entries []RecapEntry
+	// More counts entries left out of Entries.
+	More     int
+	Sections []string
+	// Hosts breaks the updates down per host, the local host first.
+	Hosts     []RecapHost
+	Failures  []RecapEntry
+	Rollbacks []RecapEntry
+	Pending   []RecapPendingUpdate
+	Offline   []RecapAgent
+	Uptime    *RecapUptimeStats
+}
+
+// Has reports whether the recap includes section.
+func (r *Recap) Has(section string) bool {
+	return Subscribed(r.Sections, section)
+}
+
+// RecapHost counts the updates of the local host (empty AgentID) or one agent.
+type RecapHost struct {
+	Name      string
+	AgentID   string
+	Success   int
+	Failed    int
+	Rollbacks int
+	Total     int
+}
+
+// RecapPendingUpdate is an available update not applied yet.
+type RecapPendingUpdate struct {
+	Host      string
+	Container string
+	Image     string
+	FirstSeen time.Time
+}
+
+// RecapAgent is an agent that is offline at the end of the period.
+type RecapAgent struct {
+	Name     string
+	AgentID  string
+	LastSeen time.Time
+}
+
+// RecapUptimeStats is the share of containers running, from the daily running snapshots
+// in the period.
+type RecapUptimeStats struct {
+	Percent float64
+	Days    []RecapUptimeDay
+}
+
+// RecapUptimeDay is one daily running snapshot.
+type RecapUptimeDay struct {
+	Date    time.Time
+	Running int
+	Total   int
+}
+
+// RecapEntry is one history entry in a recap.
+type RecapEntry struct {
+	Time      time.Time
+	Container string
+	Image     string
+	Source    string
+	Agent     string
+	Status    string
+	Message   string
+}
+
+// Digest lists available updates of containers without auto-update, grouped by host.
+type Digest struct {
+	Since time.Time
+	Hosts []DigestHost
+	// New counts the items in Hosts; Pending counts updates already sent in an earlier
+	// digest that are still not applied.
+	New     int
+	Pending int
+}
+
+// DigestHost is the local host (empty AgentID) or one agent.
+type DigestHost struct {
+	Name    string
+	AgentID string
+	Items   []DigestItem
+}
+
+// DigestItem is one container with an update available.
+type DigestItem struct {
+	Container string
+	Image     string
+	FirstSeen time.Time
+	// Link opens the container in the web UI; ReleaseNotes comes from the image's
+	// org.opencontainers.image.source label and may be empty.
+	Link         string
+	ReleaseNotes string
+}
+
+// Text is the title and body as a single plain-text block.
+func (m Message) Text() string {
+	if m.Title == "" {
+		return m.Body
+	}
+	if m.Body == "" {
+		return m.Title
+	}
+	return m.Title + "\n" + m.Body
+}
+
+// Notifier delivers a message to one destination.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config holds the settings of one channel instance, keyed by Field.Key.
+type Config map[string]string
+
+func (c Config) get(key, fallback string) string {
+	if v := strings.TrimSpace(c[key]); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Field describes one setting of a channel type.
+type Field struct {
+	Key      string `json:"key"`
+	Label    string `json:"label"`
+	Secret   bool   `json:"secret,omitempty"`
+	Required bool   `json:"required,omitempty"`
+	Default  string `json:"default,omitempty"`
+}
+
+// ChannelType is a kind of destination and the constructor for its notifiers.
+type ChannelType struct {
+	Name   string                         `json:"name"`
+	Label  string                         `json:"label"`
+	Fields []Field                        `json:"fields"`
+	New    func(Config) (Notifier, error) `json:"-"`
+}
+
+// Validate reports missing required fields.
+func (t ChannelType) Validate(cfg Config) error {
+	var missing []string
+	for _, f := range t.Fields {
+		if f.Required && strings.TrimSpace(cfg[f.Key]) == "" {
+			missing = append(missing, f.Key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s requires %s", t.Label, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (t ChannelType) secret(key string) bool {
+	for _, f := range t.Fields {
+		if f.Key == key {
+			return f.Secret
+		}
+	}
+	return false
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]ChannelType{}
+)
+
+// Register adds a channel type, replacing any existing type with the same name.
+func Register(t ChannelType) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[t.Name] = t
+}
+
+// Lookup returns the registered channel type called name.
+func Lookup(name string) (ChannelType, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	t, ok := registry[name]
+	return t, ok
+}
+
+// Types returns all registered channel types sorted by name.
+func Types() []ChannelType {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	out := make([]ChannelType, 0, len(registry))
+	for _, t := range registry {
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// New builds a notifier for a channel of the given type.
+func New(typeName string, cfg Config) (Notifier, error) {
+	t, ok := Lookup(typeName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, typeName)
+	}
+	if err := t.Validate(cfg); err != nil {
+		return nil, err
+	}
+	return t.New(cfg)
+}
+
+// Subscribed reports whether a channel with the given event filter receives event.
+// An empty filter subscribes to everything.
+func Subscribed(filter []string, event string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, e := range filter {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,564 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/metrics"
+)
+
+// Delivery statuses. A pending delivery with attempts is waiting for a retry.
+const (
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+const (
+	maxAttempts       = 8
+	baseBackoff       = 30 * time.Second
+	maxBackoff        = time.Hour
+	sendTimeout       = 15 * time.Second
+	claimLease        = 2 * time.Minute
+	pollInterval      = 5 * time.Second
+	deliveryRetention = 30 * 24 * time.Hour
+	maxResponseLength = 2048
+)
+
+// minInterval spaces consecutive sends to one destination of these types, below their
+// documented per-channel limits.
+var minInterval = map[string]time.Duration{
+	"discord":  time.Second,
+	"slack":    time.Second,
+	"telegram": time.Second,
+	"matrix":   500 * time.Millisecond,
+}
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrNotResendable = errors.New("only dead deliveries can be re-sent")
+	// ErrTargetUnconfigured is wrapped by an outbox resolve function for a target that
+	// was removed from the configuration; its deliveries fail without retries.
+	ErrTargetUnconfigured = errors.New("destination is no longer configured")
+)
+
+// Target is a destination that is not a channel instance, such as the Discord bot from
+// runtime settings. Its notifier is resolved when the delivery is sent.
+type Target struct {
+	ID   string
+	Name string
+	Type string
+}
+
+// Enqueue queues msg, rendered with each destination's template, for the enabled
+// channels selected by route and for the extra targets. A matched route overrides
+// channel event subscriptions. Template errors are returned as *TemplateError but the
+// built-in text is queued instead, so the event is not lost; see Queued.
+func (s *Service) Enqueue(msg Message, route Route, extra []Target) error {
+	if s == nil || s.db == nil {
+		return nil
+	}
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+	var channels []domain.NotificationChannel
+	if err := s.db.Where("enabled = ?", true).Order("created_at ASC").Find(&channels).Error; err != nil {
+		return err
+	}
+	templates, err := s.templatesFor(msg.Event)
+	if err != nil {
+		return err
+	}
+
+	var (
+		errs       []error
+		deliveries []domain.NotificationDelivery
+	)
+	add := func(target Target, templateTargets ...string) {
+		rendered, err := renderFor(templates, msg, templateTargets...)
+		if err != nil {
+			errs = append(errs, &TemplateError{Target: target.Name, Err: err})
+		}
+		payload, err := json.Marshal(rendered)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: encode message: %w", target.Name, err))
+			return
+		}
+		deliveries = append(deliveries, domain.NotificationDelivery{
+			Target:        target.ID,
+			TargetName:    target.Name,
+			TargetType:    target.Type,
+			Event:         msg.Event,
+			Title:         rendered.Title,
+			Message:       payload,
+			Status:        DeliveryPending,
+			NextAttemptAt: time.Now().UTC(),
+		})
+	}
+	for _, t := range extra {
+		add(t, SettingsChannel)
+	}
+	for _, ch := range channels {
+		if route.Matched && !route.Includes(ch.ID) {
+			continue
+		}
+		if !route.Matched && !Subscribed(ch.Events, msg.Event) {
+			continue
+		}
+		target := Target{ID: ch.ID, Name: ch.Name, Type: ch.Type}
+		if ch.Type == "email" {
+			// Email channels fall back to the shared email template.
+			add(target, ch.ID, TargetEmail)
+		} else {
+			add(target, ch.ID)
+		}
+	}
+	if len(deliveries) > 0 {
+		if err := s.db.Create(&deliveries).Error; err != nil {
+			errs = append(errs, fmt.Errorf("queue notifications: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TemplateError is a template that failed to render for a destination when a message
+// was queued. The message was queued with the built-in text instead.
+type TemplateError struct {
+	Target string
+	Err    error
+}
+
+func (e *TemplateError) Error() string { return fmt.Sprintf("%s: %v", e.Target, e.Err) }
+func (e *TemplateError) Unwrap() error { return e.Err }
+
+// Queued reports whether a message was queued despite the error Enqueue returned, that
+// is when only templates failed.
+func Queued(err error) bool {
+	if err == nil {
+		return true
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if !Queued(e) {
+				return false
+			}
+		}
+		return true
+	}
+	var tplErr *TemplateError
+	return errors.As(err, &tplErr)
+}
+
+// DeliveryQuery filters the delivery log. Cursor is the ID returned as the next cursor
+// by the previous page.
+type DeliveryQuery struct {
+	Status string
+	Event  string
+	Target string
+	Cursor string
+	Limit  int
+}
+
+// Deliveries returns the newest deliveries matching q and the cursor of the next page,
+// or "" on the last page.
+func (s *Service) Deliveries(q DeliveryQuery) ([]domain.NotificationDelivery, string, error) {
+	if s.db == nil {
+		return nil, "", errors.New("database not ready")
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := s.db.Model(&domain.NotificationDelivery{})
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	if q.Event != "" {
+		query = query.Where("event = ?", q.Event)
+	}
+	if q.Target != "" {
+		query = query.Where("target = ?", q.Target)
+	}
+	if q.Cursor != "" {
+		cursor, err := strconv.ParseUint(q.Cursor, 10, 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		query = query.Where("id < ?", cursor)
+	}
+	deliveries := []domain.NotificationDelivery{}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&deliveries).Error; err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		next = strconv.FormatUint(uint64(deliveries[limit-1].ID), 10)
+	}
+	return deliveries, next, nil
+}
+
+// Delivery returns one delivery with its attempts, oldest first.
+func (s *Service) Delivery(id uint) (*domain.NotificationDelivery, []domain.NotificationAttempt, error) {
+	if s.db == nil {
+		return nil, nil, errors.New("database not ready")
+	}
+	var d domain.NotificationDelivery
+	if err := s.db.First(&d, "id = ?", id).Error; err != nil {
+		return nil, nil, err
+	}
+	attempts := []domain.NotificationAttempt{}
+	if err := s.db.Where("delivery_id = ?", id).Order("id ASC").Find(&attempts).Error; err != nil {
+		return nil, nil, err
+	}
+	return &d, attempts, nil
+}
+
+// Resend queues a dead delivery again with a fresh retry budget.
+func (s *Service) Resend(id uint) (*domain.NotificationDelivery, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	var d domain.NotificationDelivery
+	if err := s.db.First(&d, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if d.Status != DeliveryDead {
+		return nil, ErrNotResendable
+	}
+	d.Status = DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = time.Now().UTC()
+	if err := s.db.Model(&d).Select("status", "attempts", "next_attempt_at").Updates(&d).Error; err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// PruneDeliveries removes finished deliveries created before cutoff and their attempts.
+func (s *Service) PruneDeliveries(cutoff time.Time) (int64, error) {
+	if s.db == nil {
+		return 0, errors.New("database not ready")
+	}
+	var removed int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		finished := tx.Model(&domain.NotificationDelivery{}).Select("id").
+			Where("status IN ? AND created_at < ?", []string{DeliveryDelivered, DeliveryDead}, cutoff)
+		if err := tx.Where("delivery_id IN (?)", finished).Delete(&domain.NotificationAttempt{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("status IN ? AND created_at < ?", []string{DeliveryDelivered, DeliveryDead}, cutoff).Delete(&domain.NotificationDelivery{})
+		removed = res.RowsAffected
+		return res.Error
+	})
+	return removed, err
+}
+
+// Outbox sends queued deliveries, retrying failures with exponential backoff and
+// spacing sends per destination. Rate limit state is kept in memory, so a single Outbox
+// should drain the queue.
+type Outbox struct {
+	resolve func(target string) (Notifier, error)
+	log     *slog.Logger
+	wake    chan struct{}
+	now     func() time.Time
+
+	mu        sync.Mutex
+	notBefore map[string]time.Time
+}
+
+// NewOutbox returns an outbox. resolve builds notifiers for targets that are not channel
+// instances; it may be nil when there are none. It returns nil, nil for channel IDs and
+// an error wrapping ErrTargetUnconfigured for targets that no longer exist.
+func NewOutbox(resolve func(target string) (Notifier, error), log *slog.Logger) *Outbox {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Outbox{
+		resolve:   resolve,
+		log:       log,
+		wake:      make(chan struct{}, 1),
+		now:       time.Now,
+		notBefore: map[string]time.Time{},
+	}
+}
+
+// Wake makes Run process the queue without waiting for the next poll.
+func (o *Outbox) Wake() {
+	if o == nil {
+		return
+	}
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes the queue until ctx is done. service is called on every pass so the
+// outbox follows database reconfiguration.
+func (o *Outbox) Run(ctx context.Context, service func() *Service) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	var lastPrune time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+		svc := service()
+		if svc == nil || svc.db == nil {
+			continue
+		}
+		if err := o.Process(ctx, svc); err != nil {
+			o.log.Warn("notification outbox failed", "error", err)
+		}
+		if time.Since(lastPrune) > time.Hour {
+			lastPrune = time.Now()
+			if _, err := svc.PruneDeliveries(o.now().Add(-deliveryRetention)); err != nil {
+				o.log.Warn("notification delivery prune failed", "error", err)
+			}
+		}
+	}
+}
+
+// Process sends every delivery that is due and not held back by its rate limit.
+func (o *Outbox) Process(ctx context.Context, svc *Service) error {
+	// Sends interrupted by a restart are retried once their claim expires; a claim that
+	// has not expired may belong to another replica that is still sending.
+	err := svc.db.Model(&domain.NotificationDelivery{}).
+		Where("status = ? AND (claimed_at IS NULL OR claimed_at < ?)", DeliverySending, o.now().UTC().Add(-claimLease)).
+		Updates(map[string]interface{}{"status": DeliveryPending, "claimed_at": nil}).Error
+	if err != nil {
+		return err
+	}
+	var due []domain.NotificationDelivery
+	err = svc.db.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, o.now().UTC()).
+		Order("id ASC").Limit(100).Find(&due).Error
+	if err != nil {
+		return err
+	}
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !o.allowed(d.Target) {
+			continue
+		}
+		claim := svc.db.Model(&domain.NotificationDelivery{}).
+			Where("id = ? AND status = ?", d.ID, DeliveryPending).
+			Updates(map[string]interface{}{"status": DeliverySending, "claimed_at": o.now().UTC()})
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected != 1 {
+			continue
+		}
+		if err := o.send(ctx, svc, d); err != nil {
+			o.release(svc, d.ID)
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *Outbox) send(ctx context.Context, svc *Service, d domain.NotificationDelivery) error {
+	var msg Message
+	n, err := o.notifier(svc, d.Target)
+	var unusable *unusableTarget
+	permanent := errors.As(err, &unusable)
+	if err == nil {
+		if err = json.Unmarshal(d.Message, &msg); err != nil {
+			permanent = true
+		}
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	sendCtx, res := WithResponse(sendCtx)
+	start := time.Now()
+	if err == nil {
+		err = n.Send(sendCtx, msg)
+		permanent = err != nil && !retryable(err)
+	}
+	cancel()
+	elapsed := time.Since(start)
+	o.sent(d.Target, d.TargetType, err)
+
+	now := o.now().UTC()
+	var previous int64
+	if err := svc.db.Model(&domain.NotificationAttempt{}).Where("delivery_id = ?", d.ID).Count(&previous).Error; err != nil {
+		return err
+	}
+	attempt := domain.NotificationAttempt{
+		DeliveryID: d.ID,
+		Attempt:    int(previous) + 1,
+		StatusCode: res.StatusCode,
+		Response:   truncate(res.Body, maxResponseLength),
+		DurationMs: elapsed.Milliseconds(),
+	}
+	updates := map[string]interface{}{"attempts": d.Attempts + 1, "claimed_at": nil}
+	switch {
+	case err == nil:
+		updates["status"] = DeliveryDelivered
+		updates["delivered_at"] = now
+		updates["last_error"] = ""
+	case permanent || d.Attempts+1 >= maxAttempts:
+		attempt.Error = err.Error()
+		updates["status"] = DeliveryDead
+		updates["last_error"] = err.Error()
+		metrics.NotificationFailed(d.TargetType, true)
+	default:
+		attempt.Error = err.Error()
+		metrics.NotificationFailed(d.TargetType, false)
+		updates["status"] = DeliveryPending
+		updates["last_error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(backoff(d.Attempts+1, err))
+	}
+	return svc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.NotificationDelivery{}).Where("id = ?", d.ID).Updates(updates).Error
+	})
+}
+
+// release returns a claimed delivery to the queue when its result could not be stored.
+// If that fails too, the claim expires and Process picks the delivery up again.
+func (o *Outbox) release(svc *Service, id uint) {
+	err := svc.db.Model(&domain.NotificationDelivery{}).
+		Where("id = ? AND status = ?", id, DeliverySending).
+		Updates(map[string]interface{}{"status": DeliveryPending, "claimed_at": nil}).Error
+	if err != nil {
+		o.log.Warn("notification delivery release failed", "delivery", id, "error", err)
+	}
+}
+
+// unusableTarget is a target that cannot be sent to until it is configured again, so
+// its deliveries fail permanently.
+type unusableTarget struct{ err error }
+
+func (u *unusableTarget) Error() string { return u.err.Error() }
+func (u *unusableTarget) Unwrap() error { return u.err }
+
+// notifier resolves a delivery target. Channels that were deleted, disabled or left with
+// an invalid config since the delivery was queued, and settings destinations that were
+// removed, are unusable; other errors, such as the database being briefly unavailable,
+// are retried.
+func (o *Outbox) notifier(svc *Service, target string) (Notifier, error) {
+	if o.resolve != nil {
+		n, err := o.resolve(target)
+		if errors.Is(err, ErrTargetUnconfigured) {
+			return nil, &unusableTarget{err}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n != nil {
+			return n, nil
+		}
+	}
+	ch, err := svc.Get(target)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &unusableTarget{errors.New("channel no longer exists")}
+	}
+	if errors.Is(err, ErrChannelSecret) {
+		return nil, &unusableTarget{err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ch.Enabled {
+		return nil, &unusableTarget{errors.New("channel is disabled")}
+	}
+	n, err := svc.Notifier(*ch)
+	if err != nil {
+		return nil, &unusableTarget{err}
+	}
+	return n, nil
+}
+
+func (o *Outbox) allowed(target string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return !o.now().Before(o.notBefore[target])
+}
+
+// sent holds back the next send to target by the type's interval, or for as long as the
+// destination asked when it answered 429.
+func (o *Outbox) sent(target, typ string, err error) {
+	now := o.now()
+	next := now.Add(minInterval[typ])
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests {
+		wait := statusErr.RetryAfter
+		if wait <= 0 {
+			wait = baseBackoff
+		}
+		if until := now.Add(wait); until.After(next) {
+			next = until
+		}
+	}
+	o.mu.Lock()
+	o.notBefore[target] = next
+	o.mu.Unlock()
+}
+
+// retryable reports whether a failed send may succeed later: network errors, timeouts,
+// rate limits and server errors. Other client errors need a configuration change and are
+// dead-lettered straight away.
+func retryable(err error) bool {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		// SMTP 5xx replies are permanent; 4xx ones are worth retrying.
+		return smtpErr.Code < 500
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return true
+	}
+	switch {
+	case statusErr.StatusCode == http.StatusTooManyRequests, statusErr.StatusCode == http.StatusRequestTimeout:
+		return true
+	case statusErr.StatusCode >= 500:
+		return true
+	}
+	return false
+}
+
+// backoff is the wait before retrying after the given number of attempts: 30s doubling
+// up to an hour, or the destination's Retry-After when it sent one.
+func backoff(attempts int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter
+	}
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,364 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/vault"
+)
+
+// scriptedServer answers each request with the next scripted status, repeating the last.
+type scriptedServer struct {
+	mu       sync.Mutex
+	statuses []int
+	headers  map[string]string
+	body     string
+	requests int
+}
+
+func (s *scriptedServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := s.statuses[0]
+	if len(s.statuses) > 1 {
+		s.statuses = s.statuses[1:]
+	}
+	s.requests++
+	for k, v := range s.headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(s.body))
+}
+
+func (s *scriptedServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func setupOutbox(t *testing.T, script *scriptedServer) (*Service, *Outbox, *time.Time) {
+	t.Helper()
+	srv := httptest.NewServer(script)
+	t.Cleanup(srv.Close)
+	svc := NewService(setupTestDB(t), vault.NewVault("test-key"))
+	if _, err := svc.Create(domain.NotificationChannel{
+		Name:    "hook",
+		Type:    "webhook",
+		Enabled: true,
+		Config:  domain.StringMap{"url": srv.URL},
+	}); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	// Run slightly ahead of the wall clock so freshly enqueued deliveries are due.
+	now := time.Now().Add(time.Second)
+	outbox := NewOutbox(nil, nil)
+	outbox.now = func() time.Time { return now }
+	return svc, outbox, &now
+}
+
+func onlyDelivery(t *testing.T, svc *Service) (domain.NotificationDelivery, []domain.NotificationAttempt) {
+	t.Helper()
+	list, _, err := svc.Deliveries(DeliveryQuery{})
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected one delivery, got %d %v", len(list), err)
+	}
+	d, attempts, err := svc.Delivery(list[0].ID)
+	if err != nil {
+		t.Fatalf("load delivery: %v", err)
+	}
+	return *d, attempts
+}
+
+func TestOutboxRetriesWithBackoff(t *testing.T) {
+	script := &scriptedServer{statuses: []int{http.StatusBadGateway, http.StatusOK}, body: "upstream down"}
+	svc, outbox, now := setupOutbox(t, script)
+	ctx := context.Background()
+
+	if err := svc.Enqueue(Message{Event: EventUpdateFailure, Body: "boom"}, Route{}, nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := outbox.Process(ctx, svc); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	d, attempts := onlyDelivery(t, svc)
+	if d.Status != DeliveryPending || d.Attempts != 1 || d.LastError == "" {
+		t.Fatalf("expected a pending retry, got %+v", d)
+	}
+	if len(attempts) != 1 || attempts[0].StatusCode != http.StatusBadGateway || attempts[0].Response != "upstream down" {
+		t.Fatalf("unexpected attempt log %+v", attempts)
+	}
+	if wait := d.NextAttemptAt.Sub(*now); wait < baseBackoff-time.Second || wait > baseBackoff+time.Second {
+		t.Fatalf("expected a %s backoff, got %s", baseBackoff, wait)
+	}
+
+	// Not due yet.
+	if err := outbox.Process(ctx, svc); err != nil || script.count() != 1 {
+		t.Fatalf("expected no send before the backoff elapsed, got %d requests %v", script.count(), err)
+	}
+
+	*now = now.Add(baseBackoff + time.Second)
+	if err := outbox.Process(ctx, svc); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	d, attempts = onlyDelivery(t, svc)
+	if d.Status != DeliveryDelivered || d.DeliveredAt == nil || len(attempts) != 2 || attempts[1].StatusCode != http.StatusOK {
+		t.Fatalf("expected delivery on retry, got %+v %+v", d, attempts)
+	}
+}
+
+func TestOutboxHonoursRetryAfter(t *testing.T) {
+	script := &scriptedServer{statuses: []int{http.StatusTooManyRequests, http.StatusOK}, headers: map[string]string{"Retry-After": "120"}}
+	svc, outbox, now := setupOutbox(t, script)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := svc.Enqueue(Message{Event: EventUpdateSuccess, Body: "ok"}, Route{}, nil); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	if err := outbox.Process(ctx, svc); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	// The 429 holds back the second delivery to the same destination as well.
+	if script.count() != 1 {
+		t.Fatalf("expected a single request while rate limited, got %d", script.count())
+	}
+	list, _, _ := svc.Deliveries(DeliveryQuery{Status: DeliveryPending})
+	if len(list) != 2 {
+		t.Fatalf("expected both deliveries to stay pending, got %+v", list)
+	}
+	limited := list[1]
+	if wait := limited.NextAttemptAt.Sub(*now); wait < 119*time.Second || wait > 121*time.Second {
+		t.Fatalf("expected Retry-After to set the next attempt, got %s", wait)
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if err := outbox.Process(ctx, svc); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	delivered, _, _ := svc.Deliveries(DeliveryQuery{Status: DeliveryDelivered})
+	if len(delivered) != 2 {
+		t.Fatalf("expected both deliveries after the wait, got %d", len(delivered))
+	}
+}
+
+func TestOutboxDeadLetterAndResend(t *testing.T) {
+	script := &scriptedServer{statuses: []int{http.StatusNotFound, http.StatusOK}, body: "unknown webhook"}
+	svc, outbox, _ := setupOutbox(t, script)
+	ctx := context.Background()
+
+	if err := svc.Enqueue(Message{Event: EventUpdateFailure, Body: "boom"}, Route{}, nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	_ = outbox.Process(ctx, svc)
+	d, _ := onlyDelivery(t, svc)
+	if d.Status != DeliveryDead {
+		t.Fatalf("expected client errors to be dead-lettered immediately, got %+v", d)
+	}
+
+	if _, err := svc.Resend(d.ID); err != nil {
+		t.Fatalf("resend: %v", err)
+	}
+	outbox.notBefore = map[string]time.Time{}
+	_ = outbox.Process(ctx, svc)
+	d, attempts := onlyDelivery(t, svc)
+	if d.Status != DeliveryDelivered || len(attempts) != 2 || attempts[1].Attempt != 2 {
+		t.Fatalf("expected the re-sent delivery to go out, got %+v %+v", d, attempts)
+	}
+	if _, err := svc.Resend(d.ID); !errors.Is(err, ErrNotResendable) {
+		t.Fatalf("expected delivered notifications not to be re-sendable, got %v", err)
+	}
+}
+
+func TestOutboxGivesUpAfterMaxAttempts(t *testing.T) {
+	script := &scriptedServer{statuses: []int{http.StatusInternalServerError}}
+	svc, outbox, now := setupOutbox(t, script)
+	ctx := context.Background()
+
+	if err := svc.Enqueue(Message{Event: EventUpdateFailure, Body: "boom"}, Route{}, nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	for i := 0; i < maxAttempts+2; i++ {
+		_ = outbox.Process(ctx, svc)
+		*now = now.Add(maxBackoff + time.Second)
+	}
+	d, attempts := onlyDelivery(t, svc)
+	if d.Status != DeliveryDead || len(attempts) != maxAttempts {
+		t.Fatalf("expected dead after %d attempts, got %s with %d", maxAttempts, d.Status, len(attempts))
+	}
+}
+
+func TestOutboxRetriesWhenChannelLookupFails(t *testing.T) {
+	script := &scriptedServer{statuses: []int{http.StatusOK}}
+	svc, outbox, now := setupOutbox(t, script)
+	ctx := context.Background()
+
+	if err := svc.Enqueue(Message{Event: EventUpdateFailure, Body: "boom"}, Route{}, nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	// Losing the channels table stands in for the database failing the lookup.
+	if err := svc.db.Exec("ALTER TABLE notification_channels RENAME TO channels_away").Error; err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	_ = outbox.Process(ctx, svc)
+	d, _ := onlyDelivery(t, svc)
+	if d.Status != DeliveryPending || d.Attempts != 1 {
+		t.Fatalf("expected a failed lookup to be retried, got %+v", d)
+	}
+
+	if err := svc.db.Exec("ALTER TABLE channels_away RENAME TO notification_channels").Error; err != nil {
+		t.Fatalf("rename back: %v", err)
+	}
+	*now = now.Add(maxBackoff + time.Second)
+	outbox.notBefore = map[string]time.Time{}
+	_ = outbox.Process(ctx, svc)
+	if d, _ := onlyDelivery(t, svc); d.Status != DeliveryDelivered || script.count() != 1 {
+		t.Fatalf("expected the retry to go out, got %+v after %d requests", d, script.count())
+	}
+}
+
+func TestOutboxResolvesExtraTargets(t *testing.T) {
+	srv, last := captureServer(t, http.StatusOK)
+	svc := NewService(setupTestDB(t), nil)
+	outbox := NewOutbox(func(target string) (Notifier, error) {
+		if target == "settings:webhook" {
+			return &Webhook{URL: srv.URL + "/settings"}, nil
+		}
+		return nil, nil
+	}, nil)
+
+	extra := []Target{{ID: "settings:webhook", Name: "Webhook (settings)", Type: "webhook"}, {ID: "gone", Name: "gone"}}
+	if err := svc.Enqueue(Message{Event: EventRecap, Body: "recap"}, Route{}, extra); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := outbox.Process(context.Background(), svc); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if last().path != "/settings" {
+		t.Fatalf("expected delivery to the settings webhook, got %q", last().path)
+	}
+	dead, _, _ := svc.Deliveries(DeliveryQuery{Status: DeliveryDead})
+	if len(dead) != 1 || dead[0].Target != "gone" || dead[0].LastError != "channel no longer exists" {
+		t.Fatalf("expected unknown targets to be dead-lettered, got %+v", dead)
+	}
+}
+
+func TestOutboxReclaimsExpiredClaims(t *testing.T) {
+	script := &scriptedServer{statuses: []int{http.StatusOK}}
+	svc, outbox, now := setupOutbox(t, script)
+	ctx := context.Background()
+
+	if err := svc.Enqueue(Message{Event: EventUpdateFailure, Body: "boom"}, Route{}, nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	// Another replica is sending it.
+	svc.db.Model(&domain.NotificationDelivery{}).Where("1 = 1").
+		Updates(map[string]interface{}{"status": DeliverySending, "claimed_at": now.UTC()})
+	if err := outbox.Process(ctx, svc); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if d, _ := onlyDelivery(t, svc); d.Status != DeliverySending || script.count() != 0 {
+		t.Fatalf("expected a live claim to be left alone, got %+v after %d requests", d, script.count())
+	}
+
+	// That replica died mid-send.
+	*now = now.Add(claimLease + time.Second)
+	if err := outbox.Process(ctx, svc); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if d, _ := onlyDelivery(t, svc); d.Status != DeliveryDelivered || d.ClaimedAt != nil || script.count() != 1 {
+		t.Fatalf("expected an expired claim to be sent again, got %+v after %d requests", d, script.count())
+	}
+}
+
+func TestOutboxReleasesClaimWhenResultIsLost(t *testing.T) {
+	script := &scriptedServer{statuses: []int{http.StatusOK}}
+	svc, outbox, _ := setupOutbox(t, script)
+
+	if err := svc.Enqueue(Message{Event: EventUpdateFailure, Body: "boom"}, Route{}, nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := svc.db.Exec("ALTER TABLE notification_attempts RENAME TO attempts_away").Error; err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if err := outbox.Process(context.Background(), svc); err == nil {
+		t.Fatalf("expected the lost result to be reported")
+	}
+	var d domain.NotificationDelivery
+	if err := svc.db.First(&d).Error; err != nil || d.Status != DeliveryPending || d.ClaimedAt != nil {
+		t.Fatalf("expected the claim to be released, got %+v (%v)", d, err)
+	}
+}
+
+func TestOutboxRetriesWhenTargetResolveFails(t *testing.T) {
+	svc := NewService(setupTestDB(t), nil)
+	resolveErr := errors.New("settings unavailable")
+	outbox := NewOutbox(func(target string) (Notifier, error) {
+		if target == "settings:discord" {
+			return nil, fmt.Errorf("discord: %w", ErrTargetUnconfigured)
+		}
+		return nil, resolveErr
+	}, nil)
+
+	extra := []Target{{ID: "settings:webhook", Name: "Webhook (settings)", Type: "webhook"}, {ID: "settings:discord", Name: "Discord", Type: "discord"}}
+	if err := svc.Enqueue(Message{Event: EventRecap, Body: "recap"}, Route{}, extra); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := outbox.Process(context.Background(), svc); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	pending, _, _ := svc.Deliveries(DeliveryQuery{Status: DeliveryPending})
+	if len(pending) != 1 || pending[0].Target != "settings:webhook" || pending[0].LastError != resolveErr.Error() {
+		t.Fatalf("expected a failed resolve to be retried, got %+v", pending)
+	}
+	dead, _, _ := svc.Deliveries(DeliveryQuery{Status: DeliveryDead})
+	if len(dead) != 1 || dead[0].Target != "settings:discord" {
+		t.Fatalf("expected a removed destination to be dead-lettered, got %+v", dead)
+	}
+}
+
+func TestDeliveriesPaginationAndPrune(t *testing.T) {
+	svc := NewService(setupTestDB(t), nil)
+	for i := 0; i < 3; i++ {
+		if err := svc.Enqueue(Message{Event: EventTest}, Route{}, []Target{{ID: "t", Name: "t"}}); err != nil {
+			t.Fatalf("enqueue: %v", err)
+		}
+	}
+	page, next, err := svc.Deliveries(DeliveryQuery{Limit: 2})
+	if err != nil || len(page) != 2 || next == "" {
+		t.Fatalf("unexpected first page %d %q %v", len(page), next, err)
+	}
+	page, next, _ = svc.Deliveries(DeliveryQuery{Limit: 2, Cursor: next})
+	if len(page) != 1 || next != "" {
+		t.Fatalf("unexpected last page %d %q", len(page), next)
+	}
+	if _, _, err := svc.Deliveries(DeliveryQuery{Cursor: "abc"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+
+	svc.db.Model(&domain.NotificationDelivery{}).Where("id = ?", page[0].ID).Update("status", DeliveryDelivered)
+	removed, err := svc.PruneDeliveries(time.Now().Add(time.Minute))
+	if err != nil || removed != 1 {
+		t.Fatalf("expected only the finished delivery to be pruned, got %d %v", removed, err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if got := retryAfter(http.Header{"Retry-After": {"3"}}, nil); got != 3*time.Second {
+		t.Fatalf("expected 3s from the header, got %s", got)
+	}
+	if got := retryAfter(http.Header{}, []byte(`{"message":"You are being rate limited.","retry_after":1.5,"global":false}`)); got != 1500*time.Millisecond {
+		t.Fatalf("expected 1.5s from the Discord body, got %s", got)
+	}
+	if got := retryAfter(http.Header{}, []byte("slow down")); got != 0 {
+		t.Fatalf("expected no hint, got %s", got)
+	}
+}
@@ -0,0 +1,293 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/domain"
+)
+
+// SettingsChannel is the channel ID rules use for the Discord and webhook destinations
+// configured in runtime settings.
+const SettingsChannel = "settings"
+
+// LocalAgent matches events about containers on the server's own Docker host.
+const LocalAgent = "local"
+
+var ErrInvalidRule = errors.New("invalid notification rule")
+
+// Route is the outcome of evaluating the rules for one message. When no rule matched,
+// delivery falls back to channel subscriptions.
+type Route struct {
+	Matched  bool     `json:"matched"`
+	Rules    []string `json:"rules"`
+	Channels []string `json:"channels"`
+}
+
+// Includes reports whether the route delivers to the channel with the given ID.
+func (r Route) Includes(id string) bool {
+	for _, ch := range r.Channels {
+		if ch == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate applies rules in order to msg. Every matching rule adds its channels until a
+// matching rule with Stop set. Disabled rules are skipped.
+func Evaluate(rules []domain.NotificationRule, msg Message) Route {
+	route := Route{Rules: []string{}, Channels: []string{}}
+	for _, rule := range rules {
+		if !rule.Enabled || !MatchRule(rule, msg) {
+			continue
+		}
+		route.Matched = true
+		route.Rules = append(route.Rules, rule.ID)
+		for _, ch := range rule.Channels {
+			if !route.Includes(ch) {
+				route.Channels = append(route.Channels, ch)
+			}
+		}
+		if rule.Stop {
+			break
+		}
+	}
+	return route
+}
+
+// MatchRule reports whether msg satisfies every condition of rule. Agent, container and
+// image patterns are case-insensitive globs where * matches any run of characters; a
+// label condition is either "key" (present) or "key=pattern".
+func MatchRule(rule domain.NotificationRule, msg Message) bool {
+	if !Subscribed(rule.Events, msg.Event) {
+		return false
+	}
+	if rule.MinSeverity != "" {
+		severity := msg.Severity
+		if severity == "" {
+			severity = DefaultSeverity(msg.Event)
+		}
+		if severityRank(severity) < severityRank(rule.MinSeverity) {
+			return false
+		}
+	}
+	if len(rule.Agents) > 0 && !matchAgent(rule.Agents, msg) {
+		return false
+	}
+	var name, image string
+	var labels map[string]string
+	if msg.Container != nil {
+		name, image, labels = msg.Container.Name, msg.Container.Image, msg.Container.Labels
+	}
+	if len(rule.Containers) > 0 && (msg.Container == nil || !matchAny(rule.Containers, name)) {
+		return false
+	}
+	if len(rule.Images) > 0 && (msg.Container == nil || !matchAny(rule.Images, image)) {
+		return false
+	}
+	for _, cond := range rule.Labels {
+		key, pattern, hasValue := strings.Cut(cond, "=")
+		value, ok := labels[strings.TrimSpace(key)]
+		if !ok || (hasValue && !globMatch(strings.TrimSpace(pattern), value)) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAgent(patterns []string, msg Message) bool {
+	if msg.Agent == nil {
+		// Events without an agent or container (recaps) belong to no host.
+		return msg.Container != nil && matchAny(patterns, LocalAgent)
+	}
+	return matchAny(patterns, msg.Agent.ID) || matchAny(patterns, msg.Agent.Name) || matchAny(patterns, msg.Agent.Hostname)
+}
+
+func matchAny(patterns []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, p := range patterns {
+		if globMatch(p, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch matches value against a pattern where * matches any run of characters
+// (including /) and ? a single character. Unlike path.Match this suits image references.
+func globMatch(pattern, value string) bool {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	return err == nil && re.MatchString(value)
+}
+
+// ListRules returns every rule in evaluation order.
+func (s *Service) ListRules() ([]domain.NotificationRule, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	var rules []domain.NotificationRule
+	if err := s.db.Order("priority ASC").Order("created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (s *Service) GetRule(id string) (*domain.NotificationRule, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	var rule domain.NotificationRule
+	if err := s.db.First(&rule, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *Service) CreateRule(rule domain.NotificationRule) (*domain.NotificationRule, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	rule.ID = ""
+	if err := s.validateRule(&rule); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *Service) UpdateRule(id string, rule domain.NotificationRule) (*domain.NotificationRule, error) {
+	existing, err := s.GetRule(id)
+	if err != nil {
+		return nil, err
+	}
+	rule.ID = existing.ID
+	rule.CreatedAt = existing.CreatedAt
+	if err := s.validateRule(&rule); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *Service) DeleteRule(id string) error {
+	if s.db == nil {
+		return errors.New("database not ready")
+	}
+	res := s.db.Delete(&domain.NotificationRule{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Route evaluates the enabled rules for msg.
+func (s *Service) Route(msg Message) (Route, error) {
+	if s == nil || s.db == nil {
+		return Route{}, nil
+	}
+	var rules []domain.NotificationRule
+	if err := s.db.Where("enabled = ?", true).Order("priority ASC").Order("created_at ASC").Find(&rules).Error; err != nil {
+		return Route{}, err
+	}
+	return Evaluate(rules, msg), nil
+}
+
+// forgetChannel removes a deleted channel from the rules that route to it.
+func (s *Service) forgetChannel(id string) error {
+	var rules []domain.NotificationRule
+	if err := s.db.Find(&rules).Error; err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		kept := make(domain.StringList, 0, len(rule.Channels))
+		for _, ch := range rule.Channels {
+			if ch != id {
+				kept = append(kept, ch)
+			}
+		}
+		if len(kept) == len(rule.Channels) {
+			continue
+		}
+		if err := s.db.Model(&rule).Update("channels", kept).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Service) validateRule(rule *domain.NotificationRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRule)
+	}
+	rule.Events = cleanList(rule.Events)
+	for _, e := range rule.Events {
+		if !Subscribed(Events, e) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidRule, e)
+		}
+	}
+	rule.MinSeverity = strings.ToLower(strings.TrimSpace(rule.MinSeverity))
+	if rule.MinSeverity != "" && !Subscribed(Severities, rule.MinSeverity) {
+		return fmt.Errorf("%w: unknown severity %q", ErrInvalidRule, rule.MinSeverity)
+	}
+	rule.Agents = cleanList(rule.Agents)
+	rule.Containers = cleanList(rule.Containers)
+	rule.Images = cleanList(rule.Images)
+	rule.Labels = cleanList(rule.Labels)
+	for _, cond := range rule.Labels {
+		if key, _, _ := strings.Cut(cond, "="); strings.TrimSpace(key) == "" {
+			return fmt.Errorf("%w: label condition %q has no key", ErrInvalidRule, cond)
+		}
+	}
+	rule.Channels = cleanList(rule.Channels)
+	for _, id := range rule.Channels {
+		if id == SettingsChannel {
+			continue
+		}
+		var count int64
+		if err := s.db.Model(&domain.NotificationChannel{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalidRule, id)
+		}
+	}
+	return nil
+}
+
+func cleanList(values domain.StringList) domain.StringList {
+	out := domain.StringList{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
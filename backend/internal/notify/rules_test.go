@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/vault"
+)
+
+func TestMatchRule(t *testing.T) {
+	dbFailure := Message{
+		Event:     EventUpdateFailure,
+		Container: &ContainerInfo{Name: "orders-db", Image: "docker.io/library/postgres:16", Labels: map[string]string{"tier": "database", "team": "dba"}},
+		Agent:     &AgentInfo{ID: "a1", Name: "prod-eu-1", Hostname: "eu1.internal"},
+	}
+	localSuccess := Message{Event: EventUpdateSuccess, Container: &ContainerInfo{Name: "web", Image: "nginx:1.27"}}
+	recap := Message{Event: EventRecap}
+
+	cases := []struct {
+		name string
+		rule domain.NotificationRule
+		msg  Message
+		want bool
+	}{
+		{"empty rule matches everything", domain.NotificationRule{}, recap, true},
+		{"event filter", domain.NotificationRule{Events: domain.StringList{EventUpdateSuccess}}, dbFailure, false},
+		{"min severity reached", domain.NotificationRule{MinSeverity: SeverityWarning}, dbFailure, true},
+		{"min severity missed", domain.NotificationRule{MinSeverity: SeverityWarning}, localSuccess, false},
+		{"explicit severity wins", domain.NotificationRule{MinSeverity: SeverityError}, Message{Event: EventUpdateSuccess, Severity: SeverityError}, true},
+		{"agent by name glob", domain.NotificationRule{Agents: domain.StringList{"PROD-*"}}, dbFailure, true},
+		{"agent by hostname", domain.NotificationRule{Agents: domain.StringList{"eu1.internal"}}, dbFailure, true},
+		{"agent mismatch", domain.NotificationRule{Agents: domain.StringList{"dev-*"}}, dbFailure, false},
+		{"local agent", domain.NotificationRule{Agents: domain.StringList{LocalAgent}}, localSuccess, true},
+		{"local agent skips recaps", domain.NotificationRule{Agents: domain.StringList{LocalAgent}}, recap, false},
+		{"container glob", domain.NotificationRule{Containers: domain.StringList{"web", "*-db"}}, dbFailure, true},
+		{"container required", domain.NotificationRule{Containers: domain.StringList{"*"}}, recap, false},
+		{"image glob spans slashes", domain.NotificationRule{Images: domain.StringList{"*/postgres:*"}}, dbFailure, true},
+		{"image mismatch", domain.NotificationRule{Images: domain.StringList{"mysql*"}}, dbFailure, false},
+		{"label present", domain.NotificationRule{Labels: domain.StringList{"team"}}, dbFailure, true},
+		{"label value", domain.NotificationRule{Labels: domain.StringList{"tier=data*", "team=dba"}}, dbFailure, true},
+		{"label value mismatch", domain.NotificationRule{Labels: domain.StringList{"tier=frontend"}}, dbFailure, false},
+		{"label missing", domain.NotificationRule{Labels: domain.StringList{"tier"}}, localSuccess, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := MatchRule(tc.rule, tc.msg); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rules := []domain.NotificationRule{
+		{ID: "dev", Enabled: true, Events: domain.StringList{EventUpdateSuccess}, Agents: domain.StringList{"dev-*"}, Stop: true},
+		{ID: "disabled", Enabled: false, Channels: domain.StringList{"nowhere"}},
+		{ID: "db", Enabled: true, Events: domain.StringList{EventUpdateFailure}, Labels: domain.StringList{"tier=database"}, Channels: domain.StringList{"dba"}},
+		{ID: "all-failures", Enabled: true, MinSeverity: SeverityError, Channels: domain.StringList{"dba", "infra"}},
+	}
+
+	devSuccess := Message{Event: EventUpdateSuccess, Agent: &AgentInfo{Name: "dev-1"}, Container: &ContainerInfo{Name: "api"}}
+	if got := Evaluate(rules, devSuccess); !got.Matched || len(got.Channels) != 0 {
+		t.Fatalf("expected dev successes to be dropped, got %+v", got)
+	}
+
+	dbFailure := Message{Event: EventUpdateFailure, Container: &ContainerInfo{Name: "pg", Labels: map[string]string{"tier": "database"}}}
+	got := Evaluate(rules, dbFailure)
+	want := Route{Matched: true, Rules: []string{"db", "all-failures"}, Channels: []string{"dba", "infra"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	if got := Evaluate(rules, Message{Event: EventRecap}); got.Matched {
+		t.Fatalf("expected recaps to fall through to subscriptions, got %+v", got)
+	}
+}
+
+func TestServiceRoute(t *testing.T) {
+	srv, last := captureServer(t, http.StatusOK)
+	svc := NewService(setupTestDB(t), vault.NewVault("test-key"))
+
+	create := func(name string) string {
+		t.Helper()
+		ch, err := svc.Create(domain.NotificationChannel{
+			Name:    name,
+			Type:    "slack",
+			Enabled: true,
+			Events:  domain.StringList{EventUpdateSuccess},
+			Config:  domain.StringMap{"webhookUrl": srv.URL + "/" + name},
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		return ch.ID
+	}
+	create("everyone")
+	infra := create("infra")
+
+	if _, err := svc.CreateRule(domain.NotificationRule{Name: "bad", Channels: domain.StringList{"missing"}}); !errors.Is(err, ErrInvalidRule) {
+		t.Fatalf("expected unknown channels to be rejected, got %v", err)
+	}
+	if _, err := svc.CreateRule(domain.NotificationRule{Name: "bad", MinSeverity: "catastrophic"}); !errors.Is(err, ErrInvalidRule) {
+		t.Fatalf("expected unknown severity to be rejected, got %v", err)
+	}
+	rule, err := svc.CreateRule(domain.NotificationRule{
+		Name:     "offline to infra",
+		Enabled:  true,
+		Events:   domain.StringList{EventAgentOffline, " "},
+		Channels: domain.StringList{infra, SettingsChannel},
+	})
+	if err != nil {
+		t.Fatalf("create rule: %v", err)
+	}
+	if len(rule.Events) != 1 {
+		t.Fatalf("expected blank entries to be dropped, got %v", rule.Events)
+	}
+
+	msg := Message{Event: EventAgentOffline, Agent: &AgentInfo{Name: "edge"}}
+	route, err := svc.Route(msg)
+	if err != nil {
+		t.Fatalf("route: %v", err)
+	}
+	if !route.Matched || !route.Includes(SettingsChannel) {
+		t.Fatalf("unexpected route %+v", route)
+	}
+	// The rule overrides the channel's success-only subscription.
+	dispatch(t, svc, msg, route)
+	if last().path != "/infra" {
+		t.Fatalf("expected delivery to infra, got %q", last().path)
+	}
+
+	if err := svc.Delete(infra); err != nil {
+		t.Fatalf("delete channel: %v", err)
+	}
+	reloaded, err := svc.GetRule(rule.ID)
+	if err != nil {
+		t.Fatalf("get rule: %v", err)
+	}
+	if !reflect.DeepEqual([]string(reloaded.Channels), []string{SettingsChannel}) {
+		t.Fatalf("expected deleted channel to be removed from rules, got %v", reloaded.Channels)
+	}
+}
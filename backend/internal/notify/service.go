@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/vault"
+)
+
+// Mask replaces secret config values in API responses. Sending it back on update keeps
+// the stored value.
+const Mask = "********"
+
+var ErrInvalidChannel = errors.New("invalid notification channel")
+
+// ErrChannelSecret is returned when a channel's stored secrets cannot be decrypted, as
+// after the vault key changed.
+var ErrChannelSecret = errors.New("channel secrets cannot be decrypted")
+
+// Service stores channel instances and dispatches messages to them.
+type Service struct {
+	db    *gorm.DB
+	vault *vault.Vault
+}
+
+func NewService(db *gorm.DB, vault *vault.Vault) *Service {
+	return &Service{db: db, vault: vault}
+}
+
+// List returns every channel with secrets decrypted.
+func (s *Service) List() ([]domain.NotificationChannel, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	var channels []domain.NotificationChannel
+	if err := s.db.Order("created_at ASC").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	for i := range channels {
+		if err := s.decrypt(&channels[i]); err != nil {
+			return nil, err
+		}
+	}
+	return channels, nil
+}
+
+// Get returns one channel with secrets decrypted.
+func (s *Service) Get(id string) (*domain.NotificationChannel, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	var ch domain.NotificationChannel
+	if err := s.db.First(&ch, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.decrypt(&ch); err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+func (s *Service) Create(ch domain.NotificationChannel) (*domain.NotificationChannel, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	ch.ID = ""
+	if err := validate(&ch); err != nil {
+		return nil, err
+	}
+	if err := s.save(&ch); err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// Update replaces a channel's settings. Secret values left empty or masked keep their
+// stored value.
+func (s *Service) Update(id string, ch domain.NotificationChannel) (*domain.NotificationChannel, error) {
+	existing, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if ch.Type == "" {
+		ch.Type = existing.Type
+	}
+	if ch.Type == existing.Type {
+		t, _ := Lookup(ch.Type)
+		for key, value := range existing.Config {
+			if t.secret(key) && (ch.Config[key] == "" || ch.Config[key] == Mask) {
+				if ch.Config == nil {
+					ch.Config = domain.StringMap{}
+				}
+				ch.Config[key] = value
+			}
+		}
+	}
+	ch.ID = existing.ID
+	ch.CreatedAt = existing.CreatedAt
+	if err := validate(&ch); err != nil {
+		return nil, err
+	}
+	if err := s.save(&ch); err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+func (s *Service) Delete(id string) error {
+	if s.db == nil {
+		return errors.New("database not ready")
+	}
+	res := s.db.Delete(&domain.NotificationChannel{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return s.forgetChannel(id)
+}
+
+// HasEnabled reports whether any channel instance is enabled.
+func (s *Service) HasEnabled() bool {
+	if s == nil || s.db == nil {
+		return false
+	}
+	var count int64
+	if err := s.db.Model(&domain.NotificationChannel{}).Where("enabled = ?", true).Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Notifier builds the notifier for a decrypted channel.
+func (s *Service) Notifier(ch domain.NotificationChannel) (Notifier, error) {
+	return New(ch.Type, Config(ch.Config))
+}
+
+// Redact masks secret config values for API responses.
+func Redact(ch domain.NotificationChannel) domain.NotificationChannel {
+	t, _ := Lookup(ch.Type)
+	cfg := make(domain.StringMap, len(ch.Config))
+	for key, value := range ch.Config {
+		if t.secret(key) && value != "" {
+			value = Mask
+		}
+		cfg[key] = value
+	}
+	ch.Config = cfg
+	return ch
+}
+
+func validate(ch *domain.NotificationChannel) error {
+	ch.Name = strings.TrimSpace(ch.Name)
+	if ch.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidChannel)
+	}
+	t, ok := Lookup(ch.Type)
+	if !ok {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidChannel, ch.Type)
+	}
+	for _, e := range ch.Events {
+		if !Subscribed(Events, e) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidChannel, e)
+		}
+	}
+	cfg := domain.StringMap{}
+	for _, f := range t.Fields {
+		if v := strings.TrimSpace(ch.Config[f.Key]); v != "" {
+			cfg[f.Key] = v
+		}
+	}
+	ch.Config = cfg
+	if _, err := New(ch.Type, Config(cfg)); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidChannel, err)
+	}
+	return nil
+}
+
+// save encrypts secret values on a copy so ch keeps the plaintext config.
+func (s *Service) save(ch *domain.NotificationChannel) error {
+	stored := *ch
+	stored.Config = make(domain.StringMap, len(ch.Config))
+	t, _ := Lookup(ch.Type)
+	for key, value := range ch.Config {
+		if t.secret(key) && s.vault != nil {
+			enc, err := s.vault.Encrypt(value)
+			if err != nil {
+				return fmt.Errorf("encrypt %s: %w", key, err)
+			}
+			value = enc
+		}
+		stored.Config[key] = value
+	}
+	if err := s.db.Save(&stored).Error; err != nil {
+		return err
+	}
+	ch.ID = stored.ID
+	ch.CreatedAt = stored.CreatedAt
+	ch.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (s *Service) decrypt(ch *domain.NotificationChannel) error {
+	if s.vault == nil {
+		return nil
+	}
+	t, _ := Lookup(ch.Type)
+	for key, value := range ch.Config {
+		if !t.secret(key) || value == "" {
+			continue
+		}
+		plain, err := s.vault.Decrypt(value)
+		if err != nil {
+			return fmt.Errorf("%w: %s for channel %s: %v", ErrChannelSecret, key, ch.Name, err)
+		}
+		ch.Config[key] = plain
+	}
+	return nil
+}
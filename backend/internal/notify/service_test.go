@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/vault"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(
+		&domain.NotificationChannel{},
+		&domain.NotificationRule{},
+		&domain.NotificationTemplate{},
+		&domain.NotificationDelivery{},
+		&domain.NotificationAttempt{},
+	); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// dispatch queues msg and drains the queue with a fresh outbox.
+func dispatch(t *testing.T, svc *Service, msg Message, route Route) {
+	t.Helper()
+	if err := svc.Enqueue(msg, route, nil); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if err := NewOutbox(nil, nil).Process(context.Background(), svc); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+}
+
+func TestServiceEncryptsSecrets(t *testing.T) {
+	db := setupTestDB(t)
+	svc := NewService(db, vault.NewVault("test-key"))
+
+	ch, err := svc.Create(domain.NotificationChannel{
+		Name:    "ops",
+		Type:    "gotify",
+		Enabled: true,
+		Config:  domain.StringMap{"serverUrl": "https://gotify.example", "token": "s3cret", "bogus": "dropped"},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, ok := ch.Config["bogus"]; ok {
+		t.Fatalf("expected unknown config keys to be dropped")
+	}
+
+	var raw domain.NotificationChannel
+	if err := db.First(&raw, "id = ?", ch.ID).Error; err != nil {
+		t.Fatalf("load raw: %v", err)
+	}
+	if raw.Config["token"] == "s3cret" || raw.Config["token"] == "" {
+		t.Fatalf("expected token to be encrypted at rest, got %q", raw.Config["token"])
+	}
+	if raw.Config["serverUrl"] != "https://gotify.example" {
+		t.Fatalf("expected non-secret values in plain text, got %q", raw.Config["serverUrl"])
+	}
+
+	loaded, err := svc.Get(ch.ID)
+	if err != nil || loaded.Config["token"] != "s3cret" {
+		t.Fatalf("expected decrypted token, got %+v %v", loaded, err)
+	}
+	if Redact(*loaded).Config["token"] != Mask {
+		t.Fatalf("expected redacted token")
+	}
+
+	// A masked secret on update keeps the stored value.
+	updated, err := svc.Update(ch.ID, domain.NotificationChannel{
+		Name:   "ops-renamed",
+		Config: domain.StringMap{"serverUrl": "https://gotify.example", "token": Mask},
+		Events: domain.StringList{EventUpdateFailure},
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if updated.Config["token"] != "s3cret" || updated.Type != "gotify" || updated.Name != "ops-renamed" {
+		t.Fatalf("unexpected update result: %+v", updated)
+	}
+}
+
+func TestServiceValidation(t *testing.T) {
+	svc := NewService(setupTestDB(t), nil)
+	cases := []domain.NotificationChannel{
+		{Type: "slack", Config: domain.StringMap{"webhookUrl": "https://hooks"}},
+		{Name: "x", Type: "fax"},
+		{Name: "x", Type: "slack"},
+		{Name: "x", Type: "slack", Config: domain.StringMap{"webhookUrl": "https://hooks"}, Events: domain.StringList{"coffee-ready"}},
+	}
+	for _, ch := range cases {
+		if _, err := svc.Create(ch); !errors.Is(err, ErrInvalidChannel) {
+			t.Fatalf("expected ErrInvalidChannel for %+v, got %v", ch, err)
+		}
+	}
+}
+
+func TestServiceDispatchFilters(t *testing.T) {
+	srv, last := captureServer(t, http.StatusOK)
+	svc := NewService(setupTestDB(t), vault.NewVault("test-key"))
+
+	create := func(name string, enabled bool, events ...string) {
+		t.Helper()
+		ch, err := svc.Create(domain.NotificationChannel{
+			Name:    name,
+			Type:    "slack",
+			Enabled: true,
+			Events:  events,
+			Config:  domain.StringMap{"webhookUrl": srv.URL + "/" + name},
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if !enabled {
+			ch.Enabled = false
+			if _, err := svc.Update(ch.ID, *ch); err != nil {
+				t.Fatalf("disable %s: %v", name, err)
+			}
+		}
+	}
+	create("failures", true, EventUpdateFailure)
+	create("disabled", false)
+
+	dispatch(t, svc, Message{Event: EventUpdateSuccess, Body: "ok"}, Route{})
+	if last().path != "" {
+		t.Fatalf("expected no delivery for an unsubscribed event, got %s", last().path)
+	}
+
+	dispatch(t, svc, Message{Event: EventUpdateFailure, Body: "boom"}, Route{})
+	if last().path != "/failures" {
+		t.Fatalf("expected delivery to the failures channel, got %q", last().path)
+	}
+	if !svc.HasEnabled() {
+		t.Fatalf("expected an enabled channel")
+	}
+}
@@ -0,0 +1,306 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+
+	"updockly/backend/internal/domain"
+)
+
+// Templates are Go text/template sources executed against a Message; HTML templates use
+// html/template so values are escaped. The fields available are:
+//
+//	.ID .Event .Severity .Time .Status .Source .Details
+//	.Title .Body                 the built-in rendering, for wrapping rather than replacing it
+//	.Container  .ID .Name .Image .OldDigest .NewDigest .Labels (nil for agent and recap events)
+//	            .Release .CurrentVersion .Version .Revision .Source .URL .Releases (update
+//	            events, nil when unknown); each release: .Tag .Name .Body .URL .PublishedAt
+//	.Agent      .ID .Name .Hostname (nil for local containers)
+//	.Links      .Dashboard .Container .History .Agent
+//	            .Approve .Reject (signed decision links, update-approval events only)
+//	.Recap      .Name .Since .Until .Success .Failed .Total .More .Entries (recap events only)
+//	            each entry: .Time .Container .Image .Source .Agent .Status .Message
+//	            sections: .Sections .Hosts .Failures .Rollbacks .Pending .Offline .Uptime,
+//	            and .Has "section" to test for one
+//	.Digest     .Since .New .Pending .Hosts (update-digest events only)
+//	            each host: .Name .AgentID .Items
+//	            each item: .Container .Image .FirstSeen .Link .ReleaseNotes
+//
+// Besides the text/template builtins, templates can call upper, lower, default,
+// date (layout, time) and shortDigest.
+
+// TargetEmail is the template target for notification emails.
+const TargetEmail = "email"
+
+var ErrInvalidTemplate = errors.New("invalid notification template")
+
+var templateFuncs = map[string]any{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"default": func(fallback, value any) any {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"date": func(layout string, t time.Time) string { return t.Format(layout) },
+	// shortDigest trims "sha256:" and keeps 12 hex characters, like docker images.
+	"shortDigest": func(digest string) string {
+		if _, hex, ok := strings.Cut(digest, ":"); ok {
+			digest = hex
+		}
+		if len(digest) > 12 {
+			digest = digest[:12]
+		}
+		return digest
+	},
+}
+
+// Render returns msg with the non-empty parts of tpl executed against it. Title and
+// Body see the built-in rendering, so a template can extend it with {{.Body}}.
+func Render(tpl domain.NotificationTemplate, msg Message) (Message, error) {
+	out := msg
+	var err error
+	if tpl.Title != "" {
+		if out.Title, err = execText("title", tpl.Title, msg); err != nil {
+			return msg, err
+		}
+		out.Title = strings.TrimSpace(out.Title)
+	}
+	if tpl.Body != "" {
+		if out.Body, err = execText("body", tpl.Body, msg); err != nil {
+			return msg, err
+		}
+	}
+	if tpl.HTML != "" {
+		t, err := htmltemplate.New("html").Funcs(templateFuncs).Option("missingkey=zero").Parse(tpl.HTML)
+		if err != nil {
+			return msg, fmt.Errorf("%w: html: %v", ErrInvalidTemplate, err)
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, msg); err != nil {
+			return msg, fmt.Errorf("%w: html: %v", ErrInvalidTemplate, err)
+		}
+		out.HTML = buf.String()
+	}
+	return out, nil
+}
+
+func execText(name, src string, msg Message) (string, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, msg); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, name, err)
+	}
+	return buf.String(), nil
+}
+
+// Sample returns a representative message for previewing templates of event.
+func Sample(event string) Message {
+	now := time.Now()
+	msg := Message{
+		Event:    event,
+		Severity: DefaultSeverity(event),
+		Time:     now,
+		Title:    "Sample " + event,
+		Status:   "success",
+		Source:   "schedule",
+		Details:  "Update completed",
+		Container: &ContainerInfo{
+			ID:        "3f9c2a1b7d4e",
+			Name:      "web",
+			Image:     "nginx:1.27",
+			OldDigest: "sha256:6af79ae5de407283dcea8b00d5c37ace95441fd58a8b1d2aa1ed93f5511bb18c",
+			NewDigest: "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31",
+			Labels:    map[string]string{"com.docker.compose.project": "site"},
+		},
+		Agent: &AgentInfo{ID: "agent-1", Name: "edge-1", Hostname: "edge-1.internal"},
+		Links: Links{Dashboard: "/", Container: "/?panel=containers", History: "/?panel=history", Agent: "/?panel=agents"},
+	}
+	published := now.Add(-48 * time.Hour)
+	msg.Container.Release = &ReleaseInfo{
+		CurrentVersion: "1.27.2",
+		Version:        "1.27.3",
+		Revision:       "4d1f3a7",
+		Source:         "https://github.com/nginx/nginx",
+		URL:            "https://github.com/nginx/nginx/releases",
+		Releases:       []domain.Release{{Tag: "release-1.27.3", Name: "nginx-1.27.3", Body: "Bugfix release.", URL: "https://github.com/nginx/nginx/releases/tag/release-1.27.3", PublishedAt: &published}},
+	}
+	switch event {
+	case EventUpdateFailure:
+		msg.Status, msg.Details = "error", "pull access denied"
+	case EventUpdateRollback:
+		msg.Status, msg.Details = "warning", "Update failed; the previous container was restored"
+	case EventUpdateApproval:
+		msg.Status, msg.Details = "pending", "Update waiting for approval"
+		msg.Links.Approve = "/api/update-approvals/approval-1/decision?action=approve"
+		msg.Links.Reject = "/api/update-approvals/approval-1/decision?action=reject"
+	case EventAgentOffline, EventAgentOnline:
+		msg.Container, msg.Status, msg.Details = nil, "", ""
+	case EventRecap:
+		msg.Container, msg.Agent, msg.Status, msg.Details = nil, nil, "", ""
+		failure := RecapEntry{Time: now.Add(-time.Hour), Container: "db", Image: "postgres:16", Source: "agent", Agent: "edge-1", Status: "error", Message: "pull access denied"}
+		msg.Recap = &Recap{
+			Name:    "Daily recap",
+			Since:   now.Add(-24 * time.Hour),
+			Until:   now,
+			Success: 1,
+			Failed:  1,
+			Total:   2,
+			Entries: []RecapEntry{
+				{Time: now.Add(-2 * time.Hour), Container: "web", Image: "nginx:1.27", Source: "schedule", Status: "success", Message: "Update completed"},
+				failure,
+			},
+			Sections: RecapSections,
+			Hosts: []RecapHost{
+				{Name: "local", Success: 1, Total: 1},
+				{Name: "edge-1", AgentID: "agent-1", Failed: 1, Total: 1},
+			},
+			Failures: []RecapEntry{failure},
+			Pending:  []RecapPendingUpdate{{Host: "edge-1", Container: "cache", Image: "redis:7", FirstSeen: now.Add(-3 * time.Hour)}},
+			Offline:  []RecapAgent{{Name: "edge-2", AgentID: "agent-2", LastSeen: now.Add(-30 * time.Minute)}},
+			Uptime:   &RecapUptimeStats{Percent: 95, Days: []RecapUptimeDay{{Date: now.Truncate(24 * time.Hour), Running: 19, Total: 20}}},
+		}
+	case EventUpdateDigest:
+		msg.Container, msg.Agent, msg.Status, msg.Details = nil, nil, "", ""
+		msg.Digest = &Digest{
+			Since:   now.Add(-24 * time.Hour),
+			New:     2,
+			Pending: 1,
+			Hosts: []DigestHost{
+				{Name: "local", Items: []DigestItem{{Container: "web", Image: "nginx:1.27", FirstSeen: now.Add(-3 * time.Hour), Link: "/?panel=containers", ReleaseNotes: "https://github.com/nginx/nginx/releases"}}},
+				{Name: "edge-1", AgentID: "agent-1", Items: []DigestItem{{Container: "db", Image: "postgres:16", FirstSeen: now.Add(-time.Hour), Link: "/?panel=agents"}}},
+			},
+		}
+	}
+	msg.Body = msg.Details
+	return msg
+}
+
+// ListTemplates returns every template ordered by target and event.
+func (s *Service) ListTemplates() ([]domain.NotificationTemplate, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	var templates []domain.NotificationTemplate
+	if err := s.db.Order("target ASC").Order("event ASC").Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// SaveTemplate creates or replaces the template for its target and event.
+func (s *Service) SaveTemplate(tpl domain.NotificationTemplate) (*domain.NotificationTemplate, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	if err := s.validateTemplate(&tpl); err != nil {
+		return nil, err
+	}
+	var existing domain.NotificationTemplate
+	err := s.db.Where("target = ? AND event = ?", tpl.Target, tpl.Event).First(&existing).Error
+	switch {
+	case err == nil:
+		tpl.ID = existing.ID
+		tpl.CreatedAt = existing.CreatedAt
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		tpl.ID = ""
+	default:
+		return nil, err
+	}
+	if err := s.db.Save(&tpl).Error; err != nil {
+		return nil, err
+	}
+	return &tpl, nil
+}
+
+func (s *Service) DeleteTemplate(id string) error {
+	if s.db == nil {
+		return errors.New("database not ready")
+	}
+	res := s.db.Delete(&domain.NotificationTemplate{}, "id = ?", id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Render applies the template configured for target to msg, preferring one specific to
+// msg.Event. Without a template msg is returned unchanged.
+func (s *Service) Render(target string, msg Message) (Message, error) {
+	if s == nil || s.db == nil {
+		return msg, nil
+	}
+	templates, err := s.templatesFor(msg.Event)
+	if err != nil {
+		return msg, err
+	}
+	return renderFor(templates, msg, target)
+}
+
+// templatesFor loads the templates that apply to event, keyed by target and event.
+func (s *Service) templatesFor(event string) (map[[2]string]domain.NotificationTemplate, error) {
+	var templates []domain.NotificationTemplate
+	if err := s.db.Where("event = ? OR event = ''", event).Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[[2]string]domain.NotificationTemplate, len(templates))
+	for _, t := range templates {
+		out[[2]string{t.Target, t.Event}] = t
+	}
+	return out, nil
+}
+
+// renderFor renders msg with the template of the first target that has one.
+func renderFor(templates map[[2]string]domain.NotificationTemplate, msg Message, targets ...string) (Message, error) {
+	for _, target := range targets {
+		tpl, ok := templates[[2]string{target, msg.Event}]
+		if !ok {
+			tpl, ok = templates[[2]string{target, ""}]
+		}
+		if ok {
+			return Render(tpl, msg)
+		}
+	}
+	return msg, nil
+}
+
+func (s *Service) validateTemplate(tpl *domain.NotificationTemplate) error {
+	tpl.Target = strings.TrimSpace(tpl.Target)
+	tpl.Event = strings.TrimSpace(tpl.Event)
+	switch tpl.Target {
+	case "":
+		return fmt.Errorf("%w: target is required", ErrInvalidTemplate)
+	case SettingsChannel, TargetEmail:
+	default:
+		var count int64
+		if err := s.db.Model(&domain.NotificationChannel{}).Where("id = ?", tpl.Target).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalidTemplate, tpl.Target)
+		}
+	}
+	if tpl.Event != "" && !Subscribed(Events, tpl.Event) {
+		return fmt.Errorf("%w: unknown event %q", ErrInvalidTemplate, tpl.Event)
+	}
+	if tpl.Title == "" && tpl.Body == "" && tpl.HTML == "" {
+		return fmt.Errorf("%w: title, body or html is required", ErrInvalidTemplate)
+	}
+	// Render a sample so parse errors and bad field references surface on save.
+	_, err := Render(*tpl, Sample(tpl.Event))
+	return err
+}
@@ -0,0 +1,95 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"updockly/backend/internal/domain"
+	"updockly/backend/internal/vault"
+)
+
+func TestRender(t *testing.T) {
+	msg := Sample(EventUpdateSuccess)
+	msg.Container.Name = "<web>"
+
+	out, err := Render(domain.NotificationTemplate{
+		Title: "{{upper .Event}} {{.Container.Name}}",
+		Body:  "{{.Container.Image}} {{shortDigest .Container.OldDigest}} -> {{shortDigest .Container.NewDigest}} on {{.Agent.Name}}\n{{.Body}}",
+		HTML:  "<b>{{.Container.Name}}</b> <a href=\"{{.Links.Container}}\">open</a>",
+	}, msg)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if out.Title != "UPDATE-SUCCESS <web>" {
+		t.Fatalf("unexpected title %q", out.Title)
+	}
+	if out.Body != "nginx:1.27 6af79ae5de40 -> 0d17b565c37b on edge-1\nUpdate completed" {
+		t.Fatalf("unexpected body %q", out.Body)
+	}
+	if !strings.Contains(out.HTML, "<b>&lt;web&gt;</b>") || !strings.Contains(out.HTML, `href="/?panel=containers"`) {
+		t.Fatalf("expected escaped html, got %q", out.HTML)
+	}
+
+	if _, err := Render(domain.NotificationTemplate{Body: "{{.Nope}}"}, msg); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("expected ErrInvalidTemplate for an unknown field, got %v", err)
+	}
+	if _, err := Render(domain.NotificationTemplate{Body: "{{if}}"}, msg); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("expected ErrInvalidTemplate for a parse error, got %v", err)
+	}
+
+	recap, err := Render(domain.NotificationTemplate{Body: "{{.Recap.Success}}/{{.Recap.Total}}{{range .Recap.Entries}} {{.Container}}{{end}}"}, Sample(EventRecap))
+	if err != nil || recap.Body != "1/2 web db" {
+		t.Fatalf("unexpected recap rendering %q %v", recap.Body, err)
+	}
+}
+
+func TestServiceTemplates(t *testing.T) {
+	srv, last := captureServer(t, http.StatusOK)
+	svc := NewService(setupTestDB(t), vault.NewVault("test-key"))
+	ch, err := svc.Create(domain.NotificationChannel{
+		Name:    "ops",
+		Type:    "slack",
+		Enabled: true,
+		Config:  domain.StringMap{"webhookUrl": srv.URL},
+	})
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+
+	if _, err := svc.SaveTemplate(domain.NotificationTemplate{Target: "missing", Body: "x"}); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("expected unknown targets to be rejected, got %v", err)
+	}
+	if _, err := svc.SaveTemplate(domain.NotificationTemplate{Target: ch.ID, Body: "{{.Missing}}"}); !errors.Is(err, ErrInvalidTemplate) {
+		t.Fatalf("expected broken templates to be rejected, got %v", err)
+	}
+	if _, err := svc.SaveTemplate(domain.NotificationTemplate{Target: ch.ID, Body: "generic {{.Event}}"}); err != nil {
+		t.Fatalf("save generic: %v", err)
+	}
+	first, err := svc.SaveTemplate(domain.NotificationTemplate{Target: ch.ID, Event: EventUpdateFailure, Body: "failed"})
+	if err != nil {
+		t.Fatalf("save specific: %v", err)
+	}
+	second, err := svc.SaveTemplate(domain.NotificationTemplate{Target: ch.ID, Event: EventUpdateFailure, Body: "failed: {{.Details}}"})
+	if err != nil || second.ID != first.ID {
+		t.Fatalf("expected save to replace the template for the same target and event, got %+v %v", second, err)
+	}
+
+	send := func(event string) string {
+		t.Helper()
+		dispatch(t, svc, Message{Event: event, Details: "boom"}, Route{})
+		return decodeJSON(t, last().body)["text"].(string)
+	}
+	if got := send(EventUpdateFailure); got != "failed: boom" {
+		t.Fatalf("expected the event template, got %q", got)
+	}
+	if got := send(EventAgentOffline); got != "generic agent-offline" {
+		t.Fatalf("expected the generic template, got %q", got)
+	}
+
+	rendered, err := svc.Render(TargetEmail, Message{Event: EventTest, Body: "unchanged"})
+	if err != nil || rendered.Body != "unchanged" {
+		t.Fatalf("expected messages without a template to pass through, got %+v %v", rendered, err)
+	}
+}
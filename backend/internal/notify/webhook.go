@@ -0,0 +1,322 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"updockly/backend/internal/domain"
+)
+
+// Webhook payload formats.
+const (
+	// WebhookContent posts {"content": "<title and body>"}, which Discord-compatible
+	// endpoints accept as is.
+	WebhookContent = "content"
+	// WebhookEvent posts the structured EventPayload.
+	WebhookEvent = "event"
+)
+
+// Headers set on webhook requests. EventIDHeader is shared by every destination of an
+// event and stays the same across retries, so receivers can drop duplicates. When the webhook has a secret, SignatureHeader
+// carries "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>", keyed with
+// the secret. Receivers should recompute it and reject requests whose TimestampHeader is
+// more than a few minutes old, so a captured request cannot be replayed later.
+const (
+	EventHeader     = "X-Updockly-Event"
+	EventIDHeader   = "X-Updockly-Event-Id"
+	TimestampHeader = "X-Updockly-Timestamp"
+	SignatureHeader = "X-Updockly-Signature"
+)
+
+// EventPayload is the JSON body of event-format webhooks.
+type EventPayload struct {
+	ID        string            `json:"id,omitempty"`
+	Event     string            `json:"event"`
+	Severity  string            `json:"severity"`
+	Timestamp time.Time         `json:"timestamp"`
+	Title     string            `json:"title"`
+	Body      string            `json:"body"`
+	Status    string            `json:"status,omitempty"`
+	Source    string            `json:"source,omitempty"`
+	Details   string            `json:"details,omitempty"`
+	Container *ContainerPayload `json:"container,omitempty"`
+	Agent     *AgentPayload     `json:"agent,omitempty"`
+	Links     *LinksPayload     `json:"links,omitempty"`
+	Recap     *RecapPayload     `json:"recap,omitempty"`
+	Digest    *DigestPayload    `json:"digest,omitempty"`
+}
+
+type ContainerPayload struct {
+	ID        string            `json:"id,omitempty"`
+	Name      string            `json:"name"`
+	Image     string            `json:"image,omitempty"`
+	OldDigest string            `json:"oldDigest,omitempty"`
+	NewDigest string            `json:"newDigest,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Release   *ReleasePayload   `json:"release,omitempty"`
+}
+
+type ReleasePayload struct {
+	CurrentVersion string           `json:"currentVersion,omitempty"`
+	Version        string           `json:"version,omitempty"`
+	Revision       string           `json:"revision,omitempty"`
+	Source         string           `json:"source,omitempty"`
+	URL            string           `json:"url,omitempty"`
+	Releases       []domain.Release `json:"releases,omitempty"`
+}
+
+type AgentPayload struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+type LinksPayload struct {
+	Dashboard string `json:"dashboard,omitempty"`
+	Container string `json:"container,omitempty"`
+	History   string `json:"history,omitempty"`
+	Agent     string `json:"agent,omitempty"`
+	Approve   string `json:"approve,omitempty"`
+	Reject    string `json:"reject,omitempty"`
+}
+
+type RecapPayload struct {
+	Name      string                `json:"name,omitempty"`
+	Since     time.Time             `json:"since"`
+	Until     time.Time             `json:"until"`
+	Success   int                   `json:"success"`
+	Failed    int                   `json:"failed"`
+	Total     int                   `json:"total"`
+	More      int                   `json:"more,omitempty"`
+	Entries   []RecapEntryPayload   `json:"entries"`
+	Sections  []string              `json:"sections,omitempty"`
+	Hosts     []RecapHostPayload    `json:"hosts,omitempty"`
+	Failures  []RecapEntryPayload   `json:"failures,omitempty"`
+	Rollbacks []RecapEntryPayload   `json:"rollbacks,omitempty"`
+	Pending   []RecapPendingPayload `json:"pending,omitempty"`
+	Offline   []RecapAgentPayload   `json:"offline,omitempty"`
+	Uptime    *RecapUptimePayload   `json:"uptime,omitempty"`
+}
+
+type RecapEntryPayload struct {
+	Time      time.Time `json:"time"`
+	Container string    `json:"container"`
+	Image     string    `json:"image,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Agent     string    `json:"agent,omitempty"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+}
+
+type RecapHostPayload struct {
+	Name      string `json:"name"`
+	AgentID   string `json:"agentId,omitempty"`
+	Success   int    `json:"success"`
+	Failed    int    `json:"failed"`
+	Rollbacks int    `json:"rollbacks"`
+	Total     int    `json:"total"`
+}
+
+type RecapPendingPayload struct {
+	Host      string    `json:"host"`
+	Container string    `json:"container"`
+	Image     string    `json:"image"`
+	FirstSeen time.Time `json:"firstSeen"`
+}
+
+type RecapAgentPayload struct {
+	Name     string    `json:"name"`
+	AgentID  string    `json:"agentId"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+type RecapUptimePayload struct {
+	Percent float64                 `json:"percent"`
+	Days    []RecapUptimeDayPayload `json:"days"`
+}
+
+type RecapUptimeDayPayload struct {
+	Date    time.Time `json:"date"`
+	Running int       `json:"running"`
+	Total   int       `json:"total"`
+}
+
+type DigestPayload struct {
+	Since   time.Time           `json:"since"`
+	New     int                 `json:"new"`
+	Pending int                 `json:"pending"`
+	Hosts   []DigestHostPayload `json:"hosts"`
+}
+
+type DigestHostPayload struct {
+	Name    string              `json:"name"`
+	AgentID string              `json:"agentId,omitempty"`
+	Items   []DigestItemPayload `json:"items"`
+}
+
+type DigestItemPayload struct {
+	Container    string    `json:"container"`
+	Image        string    `json:"image"`
+	FirstSeen    time.Time `json:"firstSeen"`
+	Link         string    `json:"link,omitempty"`
+	ReleaseNotes string    `json:"releaseNotes,omitempty"`
+}
+
+// NewEventPayload converts a message to its webhook representation.
+func NewEventPayload(msg Message) EventPayload {
+	severity := msg.Severity
+	if severity == "" {
+		severity = DefaultSeverity(msg.Event)
+	}
+	p := EventPayload{
+		ID:        msg.ID,
+		Event:     msg.Event,
+		Severity:  severity,
+		Timestamp: msg.Time.UTC(),
+		Title:     msg.Title,
+		Body:      msg.Body,
+		Status:    msg.Status,
+		Source:    msg.Source,
+		Details:   msg.Details,
+	}
+	if c := msg.Container; c != nil {
+		p.Container = &ContainerPayload{ID: c.ID, Name: c.Name, Image: c.Image, OldDigest: c.OldDigest, NewDigest: c.NewDigest, Labels: c.Labels}
+		if r := c.Release; r != nil {
+			p.Container.Release = &ReleasePayload{
+				CurrentVersion: r.CurrentVersion, Version: r.Version, Revision: r.Revision, Source: r.Source, URL: r.URL, Releases: r.Releases,
+			}
+		}
+	}
+	if a := msg.Agent; a != nil {
+		p.Agent = &AgentPayload{ID: a.ID, Name: a.Name, Hostname: a.Hostname}
+	}
+	if msg.Links != (Links{}) {
+		p.Links = &LinksPayload{
+			Dashboard: msg.Links.Dashboard, Container: msg.Links.Container, History: msg.Links.History, Agent: msg.Links.Agent,
+			Approve: msg.Links.Approve, Reject: msg.Links.Reject,
+		}
+	}
+	if r := msg.Recap; r != nil {
+		p.Recap = &RecapPayload{
+			Name: r.Name, Since: r.Since.UTC(), Until: r.Until.UTC(), Success: r.Success, Failed: r.Failed, Total: r.Total, More: r.More,
+			Entries: recapEntryPayloads(r.Entries), Sections: r.Sections,
+			Failures: recapEntryPayloads(r.Failures), Rollbacks: recapEntryPayloads(r.Rollbacks),
+		}
+		if p.Recap.Entries == nil {
+			p.Recap.Entries = []RecapEntryPayload{}
+		}
+		for _, h := range r.Hosts {
+			p.Recap.Hosts = append(p.Recap.Hosts, RecapHostPayload{
+				Name: h.Name, AgentID: h.AgentID, Success: h.Success, Failed: h.Failed, Rollbacks: h.Rollbacks, Total: h.Total,
+			})
+		}
+		for _, u := range r.Pending {
+			p.Recap.Pending = append(p.Recap.Pending, RecapPendingPayload{Host: u.Host, Container: u.Container, Image: u.Image, FirstSeen: u.FirstSeen.UTC()})
+		}
+		for _, a := range r.Offline {
+			p.Recap.Offline = append(p.Recap.Offline, RecapAgentPayload{Name: a.Name, AgentID: a.AgentID, LastSeen: a.LastSeen.UTC()})
+		}
+		if u := r.Uptime; u != nil {
+			p.Recap.Uptime = &RecapUptimePayload{Percent: u.Percent, Days: []RecapUptimeDayPayload{}}
+			for _, d := range u.Days {
+				p.Recap.Uptime.Days = append(p.Recap.Uptime.Days, RecapUptimeDayPayload{Date: d.Date.UTC(), Running: d.Running, Total: d.Total})
+			}
+		}
+	}
+	if d := msg.Digest; d != nil {
+		p.Digest = &DigestPayload{Since: d.Since.UTC(), New: d.New, Pending: d.Pending, Hosts: []DigestHostPayload{}}
+		for _, h := range d.Hosts {
+			host := DigestHostPayload{Name: h.Name, AgentID: h.AgentID, Items: []DigestItemPayload{}}
+			for _, item := range h.Items {
+				host.Items = append(host.Items, DigestItemPayload{
+					Container: item.Container, Image: item.Image, FirstSeen: item.FirstSeen.UTC(), Link: item.Link, ReleaseNotes: item.ReleaseNotes,
+				})
+			}
+			p.Digest.Hosts = append(p.Digest.Hosts, host)
+		}
+	}
+	return p
+}
+
+func recapEntryPayloads(entries []RecapEntry) []RecapEntryPayload {
+	var out []RecapEntryPayload
+	for _, e := range entries {
+		out = append(out, RecapEntryPayload{
+			Time: e.Time.UTC(), Container: e.Container, Image: e.Image, Source: e.Source, Agent: e.Agent, Status: e.Status, Message: e.Message,
+		})
+	}
+	return out
+}
+
+// Sign returns the SignatureHeader value for body sent at timestamp (Unix seconds).
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseHeaders reads one "Name: value" header per line.
+func parseHeaders(raw string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header line %q, expected \"Name: value\"", line)
+		}
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "X-Updockly-") {
+			return nil, fmt.Errorf("header %s is reserved", name)
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// Webhook posts to an arbitrary URL, either as {"content": ...} or as an EventPayload,
+// signed when Secret is set.
+type Webhook struct {
+	URL     string
+	Format  string
+	Secret  string
+	Headers map[string]string
+}
+
+func (w *Webhook) Send(ctx context.Context, msg Message) error {
+	var payload interface{} = ContentMessage{Content: msg.Text()}
+	if w.Format == WebhookEvent {
+		payload = NewEventPayload(msg)
+	}
+	req, err := jsonRequest("webhook", http.MethodPost, w.URL, payload)
+	if err != nil {
+		return err
+	}
+	req.headers = make(map[string]string, len(w.Headers)+4)
+	for k, v := range w.Headers {
+		req.headers[k] = v
+	}
+	if msg.Event != "" {
+		req.headers[EventHeader] = msg.Event
+	}
+	if msg.ID != "" {
+		req.headers[EventIDHeader] = msg.ID
+	}
+	ts := time.Now().Unix()
+	req.headers[TimestampHeader] = strconv.FormatInt(ts, 10)
+	if w.Secret != "" {
+		req.headers[SignatureHeader] = Sign(w.Secret, ts, req.body)
+	}
+	return req.do(ctx)
+}
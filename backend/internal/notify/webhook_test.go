@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebhookEventPayloadIsSigned(t *testing.T) {
+	srv, last := captureServer(t, http.StatusOK)
+	n, err := New("webhook", Config{
+		"url":     srv.URL + "/hook",
+		"format":  WebhookEvent,
+		"secret":  "s3cret",
+		"headers": "Authorization: Bearer abc\n\nx-team:  platform ",
+	})
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	msg := Message{
+		ID:        "evt-1",
+		Event:     EventUpdateSuccess,
+		Title:     "Update success",
+		Body:      "web updated",
+		Time:      at,
+		Status:    "success",
+		Source:    "auto",
+		Container: &ContainerInfo{ID: "c1", Name: "web", Image: "nginx:1.27", OldDigest: "sha256:old", NewDigest: "sha256:new"},
+		Agent:     &AgentInfo{ID: "a1", Name: "edge"},
+		Links:     Links{Container: "https://updockly.example/?panel=containers"},
+	}
+	before := time.Now().Unix()
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	r := last()
+
+	if r.header.Get("Authorization") != "Bearer abc" || r.header.Get("X-Team") != "platform" {
+		t.Fatalf("expected custom headers, got %v", r.header)
+	}
+	if r.header.Get(EventHeader) != EventUpdateSuccess || r.header.Get(EventIDHeader) != "evt-1" {
+		t.Fatalf("expected event headers, got %v", r.header)
+	}
+	ts, err := strconv.ParseInt(r.header.Get(TimestampHeader), 10, 64)
+	if err != nil || ts < before || ts > time.Now().Unix() {
+		t.Fatalf("unexpected timestamp %q", r.header.Get(TimestampHeader))
+	}
+	if got := r.header.Get(SignatureHeader); got != Sign("s3cret", ts, []byte(r.body)) {
+		t.Fatalf("signature %q does not match the body", got)
+	}
+	if Sign("other", ts, []byte(r.body)) == r.header.Get(SignatureHeader) {
+		t.Fatal("expected the signature to depend on the secret")
+	}
+
+	body := decodeJSON(t, r.body)
+	if body["id"] != "evt-1" || body["event"] != EventUpdateSuccess || body["severity"] != SeverityInfo {
+		t.Fatalf("unexpected envelope %s", r.body)
+	}
+	if body["timestamp"] != "2026-03-01T11:00:00Z" {
+		t.Fatalf("expected a UTC timestamp, got %v", body["timestamp"])
+	}
+	container, _ := body["container"].(map[string]interface{})
+	if container["oldDigest"] != "sha256:old" || container["newDigest"] != "sha256:new" || container["id"] != "c1" {
+		t.Fatalf("unexpected container %v", body["container"])
+	}
+	if agent, _ := body["agent"].(map[string]interface{}); agent["id"] != "a1" {
+		t.Fatalf("unexpected agent %v", body["agent"])
+	}
+	if _, ok := body["recap"]; ok {
+		t.Fatalf("expected recap to be omitted, got %s", r.body)
+	}
+}
+
+func TestWebhookContentPayloadIsUnsignedByDefault(t *testing.T) {
+	srv, last := captureServer(t, http.StatusOK)
+	n, err := New("webhook", Config{"url": srv.URL})
+	if err != nil {
+		t.Fatalf("new webhook: %v", err)
+	}
+	msg := Message{Event: EventTest, Title: "Test", Body: "hello"}
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	r := last()
+	if decodeJSON(t, r.body)["content"] != msg.Text() {
+		t.Fatalf("unexpected body %s", r.body)
+	}
+	if r.header.Get(SignatureHeader) != "" {
+		t.Fatalf("expected no signature without a secret, got %q", r.header.Get(SignatureHeader))
+	}
+}
+
+func TestWebhookConfigValidation(t *testing.T) {
+	cases := map[string]Config{
+		"unknown format":  {"url": "http://x", "format": "xml"},
+		"malformed line":  {"url": "http://x", "headers": "Authorization Bearer abc"},
+		"space in name":   {"url": "http://x", "headers": "X Team: a"},
+		"reserved header": {"url": "http://x", "headers": "x-updockly-signature: forged"},
+	}
+	for name, cfg := range cases {
+		if _, err := New("webhook", cfg); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"updockly/backend/internal/domain"
+)
+
+// GitHubAPI is the public GitHub REST API.
+const GitHubAPI = "https://api.github.com"
+
+// maxReleasePages bounds how far back GitHub releases are listed, 100 per page.
+const maxReleasePages = 3
+
+// ReleaseSource lists the published releases of a repository, newest first.
+type ReleaseSource interface {
+	Releases(ctx context.Context, owner, repo string) ([]domain.Release, error)
+}
+
+// GitHubClient lists releases with the GitHub REST API. Without a token requests are
+// anonymous and rate limited to 60 an hour per IP.
+type GitHubClient struct {
+	// BaseURL defaults to GitHubAPI; set it for GitHub Enterprise or tests.
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+func (g *GitHubClient) Releases(ctx context.Context, owner, repo string) ([]domain.Release, error) {
+	base := strings.TrimRight(g.BaseURL, "/")
+	if base == "" {
+		base = GitHubAPI
+	}
+	client := g.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	var out []domain.Release
+	for page := 1; page <= maxReleasePages; page++ {
+		endpoint := fmt.Sprintf("%s/repos/%s/%s/releases?per_page=100&page=%d", base, url.PathEscape(owner), url.PathEscape(repo), page)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		if g.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+g.Token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var body []struct {
+			TagName     string     `json:"tag_name"`
+			Name        string     `json:"name"`
+			Body        string     `json:"body"`
+			HTMLURL     string     `json:"html_url"`
+			Draft       bool       `json:"draft"`
+			Prerelease  bool       `json:"prerelease"`
+			PublishedAt *time.Time `json:"published_at"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("github releases of %s/%s: %s", owner, repo, resp.Status)
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("github releases of %s/%s: %w", owner, repo, err)
+		}
+		for _, r := range body {
+			if r.Draft {
+				continue
+			}
+			out = append(out, domain.Release{
+				Tag: r.TagName, Name: r.Name, Body: r.Body, URL: r.HTMLURL, Prerelease: r.Prerelease, PublishedAt: r.PublishedAt,
+			})
+		}
+		if len(body) < 100 {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,256 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// OCI annotation keys read from image labels.
+const (
+	LabelVersion  = "org.opencontainers.image.version"
+	LabelSource   = "org.opencontainers.image.source"
+	LabelRevision = "org.opencontainers.image.revision"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// maxDocumentSize bounds manifests and image configs read from a registry.
+	maxDocumentSize = 4 << 20
+)
+
+var manifestAccept = strings.Join([]string{
+	specs.MediaTypeImageIndex,
+	specs.MediaTypeImageManifest,
+	mediaTypeDockerManifestList,
+	mediaTypeDockerManifest,
+}, ", ")
+
+// Registry reads image labels from a registry over the distribution API, without
+// pulling. Only anonymous pulls are supported: registries that need credentials for a
+// repository report an error.
+type Registry struct {
+	// Client defaults to an http.Client with a 30 second timeout.
+	Client *http.Client
+	// Platform ("os/arch") selects the image from a multi-platform index; empty picks
+	// the first linux image.
+	Platform string
+}
+
+// Labels returns the labels in the config of the image ref points to.
+func (r *Registry) Labels(ctx context.Context, ref string) (map[string]string, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(ref))
+	if err != nil {
+		return nil, fmt.Errorf("parse image reference %q: %w", ref, err)
+	}
+	repo := &repository{client: r.client(), host: reference.Domain(named), path: reference.Path(named)}
+	if repo.host == dockerHubDomain {
+		repo.host = dockerHubRegistry
+	}
+	target := "latest"
+	if digested, ok := named.(reference.Digested); ok {
+		target = digested.Digest().String()
+	} else if tagged, ok := named.(reference.Tagged); ok {
+		target = tagged.Tag()
+	}
+
+	var manifest specs.Manifest
+	for depth := 0; ; depth++ {
+		var doc struct {
+			specs.Manifest
+			Manifests []specs.Descriptor `json:"manifests"`
+		}
+		mediaType, err := repo.getJSON(ctx, "manifests/"+target, manifestAccept, &doc)
+		if err != nil {
+			return nil, err
+		}
+		if mediaType == "" {
+			mediaType = doc.MediaType
+		}
+		if mediaType != specs.MediaTypeImageIndex && mediaType != mediaTypeDockerManifestList {
+			manifest = doc.Manifest
+			break
+		}
+		if depth > 0 {
+			return nil, errors.New("nested image index")
+		}
+		desc, ok := r.pick(doc.Manifests)
+		if !ok {
+			return nil, fmt.Errorf("no image for platform %q in %s", r.Platform, ref)
+		}
+		target = desc.Digest.String()
+	}
+	if manifest.Config.Digest == "" {
+		return nil, fmt.Errorf("manifest of %s has no config", ref)
+	}
+
+	var config specs.Image
+	if _, err := repo.getJSON(ctx, "blobs/"+manifest.Config.Digest.String(), "", &config); err != nil {
+		return nil, err
+	}
+	labels := config.Config.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	// Labels set only as manifest annotations still describe the image.
+	for key, value := range manifest.Annotations {
+		if _, ok := labels[key]; !ok && strings.HasPrefix(key, "org.opencontainers.image.") {
+			labels[key] = value
+		}
+	}
+	return labels, nil
+}
+
+// pick chooses the image for the configured platform from an index. Attestations are
+// listed with an "unknown" platform and never picked.
+func (r *Registry) pick(manifests []specs.Descriptor) (specs.Descriptor, bool) {
+	wantOS, wantArch, _ := strings.Cut(r.Platform, "/")
+	if wantOS == "" {
+		wantOS = "linux"
+	}
+	for _, m := range manifests {
+		p := m.Platform
+		if p == nil || p.OS != wantOS {
+			continue
+		}
+		if wantArch == "" || p.Architecture == wantArch {
+			return m, true
+		}
+	}
+	return specs.Descriptor{}, false
+}
+
+func (r *Registry) client() *http.Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// repository is one repository on a registry. The bearer token from the first
+// challenge is reused for later requests.
+type repository struct {
+	client *http.Client
+	host   string
+	path   string
+	token  string
+}
+
+// getJSON fetches a manifest or blob and decodes it, returning the response media type.
+func (p *repository) getJSON(ctx context.Context, resource, accept string, out any) (string, error) {
+	endpoint := "https://" + p.host + "/v2/" + p.path + "/" + resource
+	resp, err := p.get(ctx, endpoint, accept)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && p.token == "" {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := p.authenticate(ctx, challenge); err != nil {
+			return "", err
+		}
+		if resp, err = p.get(ctx, endpoint, accept); err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry %s: GET %s: %s", p.host, resource, resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(out); err != nil {
+		return "", fmt.Errorf("registry %s: decode %s: %w", p.host, resource, err)
+	}
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	return strings.TrimSpace(mediaType), nil
+}
+
+func (p *repository) get(ctx context.Context, endpoint, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	return p.client.Do(req)
+}
+
+// authenticate requests an anonymous pull token from the realm of a Bearer challenge.
+func (p *repository) authenticate(ctx context.Context, challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("registry %s requires %s authentication", p.host, strings.TrimSpace(scheme))
+	}
+	values := parseChallenge(params)
+	realm, err := url.Parse(values["realm"])
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("registry %s: invalid token realm %q", p.host, values["realm"])
+	}
+	query := realm.Query()
+	if service := values["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", "repository:"+p.path+":pull")
+	realm.RawQuery = query.Encode()
+
+	resp, err := p.get(ctx, realm.String(), "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry %s: token request: %s", p.host, resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&body); err != nil {
+		return fmt.Errorf("registry %s: decode token: %w", p.host, err)
+	}
+	p.token = body.Token
+	if p.token == "" {
+		p.token = body.AccessToken
+	}
+	if p.token == "" {
+		return fmt.Errorf("registry %s: empty token", p.host)
+	}
+	return nil
+}
+
+// parseChallenge splits the comma-separated key="value" parameters of a challenge.
+func parseChallenge(params string) map[string]string {
+	out := map[string]string{}
+	for params != "" {
+		var key, value string
+		key, params, _ = strings.Cut(params, "=")
+		key = strings.ToLower(strings.TrimSpace(strings.TrimLeft(key, ", ")))
+		if strings.HasPrefix(params, `"`) {
+			value, params, _ = strings.Cut(params[1:], `"`)
+		} else {
+			value, params, _ = strings.Cut(params, ",")
+		}
+		params = strings.TrimLeft(params, ", ")
+		if key != "" {
+			out[key] = value
+		}
+	}
+	return out
+}
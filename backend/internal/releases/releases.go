@@ -0,0 +1,203 @@
+// Package releases describes available image updates: the OCI labels of the remote
+// image and, for sources hosted on GitHub, the release notes since the running version.
+package releases
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"updockly/backend/internal/domain"
+)
+
+// defaultMaxReleases caps the releases returned by a lookup.
+const defaultMaxReleases = 20
+
+// Notes describes an update from the running image to the remote one.
+type Notes struct {
+	CurrentVersion  string
+	CurrentRevision string
+	Version         string
+	Revision        string
+	Source          string
+	Releases        []domain.Release
+}
+
+// Lookup reads remote image labels and fetches release notes. GitHub may be nil to
+// only read labels.
+type Lookup struct {
+	Registry *Registry
+	GitHub   ReleaseSource
+	// MaxReleases caps the releases returned, newest first; 0 means 20.
+	MaxReleases int
+}
+
+// Lookup describes the update of image from a container whose labels are current. The
+// running version and revision come from current, since container labels include those
+// of their image. Notes read before an error are returned with it.
+func (l *Lookup) Lookup(ctx context.Context, image string, current map[string]string) (Notes, error) {
+	notes := Notes{
+		CurrentVersion:  strings.TrimSpace(current[LabelVersion]),
+		CurrentRevision: strings.TrimSpace(current[LabelRevision]),
+		Source:          strings.TrimSpace(current[LabelSource]),
+	}
+	registry := l.Registry
+	if registry == nil {
+		registry = &Registry{}
+	}
+	remote, err := registry.Labels(ctx, image)
+	if err != nil {
+		return notes, err
+	}
+	notes.Version = strings.TrimSpace(remote[LabelVersion])
+	notes.Revision = strings.TrimSpace(remote[LabelRevision])
+	if source := strings.TrimSpace(remote[LabelSource]); source != "" {
+		notes.Source = source
+	}
+
+	owner, repo, ok := GitHubRepo(notes.Source)
+	if !ok || l.GitHub == nil || notes.Version == "" || notes.Version == notes.CurrentVersion {
+		return notes, nil
+	}
+	list, err := l.GitHub.Releases(ctx, owner, repo)
+	if err != nil {
+		return notes, err
+	}
+	limit := l.MaxReleases
+	if limit <= 0 {
+		limit = defaultMaxReleases
+	}
+	notes.Releases = Between(list, notes.CurrentVersion, notes.Version)
+	if len(notes.Releases) > limit {
+		notes.Releases = notes.Releases[:limit]
+	}
+	return notes, nil
+}
+
+// GitHubRepo returns the repository of a github.com source URL.
+func GitHubRepo(source string) (owner, repo string, ok bool) {
+	u, err := url.Parse(strings.TrimSpace(source))
+	if err != nil || !strings.EqualFold(u.Hostname(), "github.com") {
+		return "", "", false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], strings.TrimSuffix(parts[1], ".git"), true
+}
+
+// Between returns the releases after from up to and including to, newest first. Tags
+// are compared as versions when both bounds parse as one, ignoring prefixes such as
+// "v" or "release-"; pre-releases are left out unless to is one. Otherwise the list
+// order is used, which needs both tags to be found. An empty from returns only the
+// release of to.
+func Between(list []domain.Release, from, to string) []domain.Release {
+	toVer, toOK := parseVersion(to)
+	fromVer, fromOK := parseVersion(from)
+	if toOK && (fromOK || from == "") {
+		var out []domain.Release
+		for _, r := range list {
+			v, ok := parseVersion(r.Tag)
+			if !ok || v.compare(toVer) > 0 || (r.Prerelease && toVer.pre == "") {
+				continue
+			}
+			if from == "" {
+				if v.compare(toVer) == 0 {
+					out = append(out, r)
+				}
+				continue
+			}
+			if v.compare(fromVer) > 0 {
+				out = append(out, r)
+			}
+		}
+		sort.SliceStable(out, func(i, j int) bool {
+			a, _ := parseVersion(out[i].Tag)
+			b, _ := parseVersion(out[j].Tag)
+			return a.compare(b) > 0
+		})
+		return out
+	}
+
+	toIdx, fromIdx := -1, -1
+	for i, r := range list {
+		if toIdx < 0 && sameTag(r.Tag, to) {
+			toIdx = i
+		}
+		if fromIdx < 0 && from != "" && sameTag(r.Tag, from) {
+			fromIdx = i
+		}
+	}
+	switch {
+	case toIdx < 0:
+		return nil
+	case from == "":
+		return list[toIdx : toIdx+1]
+	case fromIdx > toIdx:
+		return list[toIdx:fromIdx]
+	}
+	return nil
+}
+
+func sameTag(tag, version string) bool {
+	tag, version = strings.TrimSpace(tag), strings.TrimSpace(version)
+	return tag != "" && (tag == version || strings.TrimPrefix(strings.ToLower(tag), "v") == strings.TrimPrefix(strings.ToLower(version), "v"))
+}
+
+// version is a dotted numeric version with an optional pre-release suffix.
+type version struct {
+	parts []int
+	pre   string
+}
+
+// parseVersion reads the version starting at the first digit of s, so "v1.2.3" and
+// "release-1.2.3" parse like "1.2.3". Build metadata after "+" is ignored.
+func parseVersion(s string) (version, bool) {
+	start := strings.IndexAny(s, "0123456789")
+	if start < 0 {
+		return version{}, false
+	}
+	core, _, _ := strings.Cut(s[start:], "+")
+	core, pre, _ := strings.Cut(core, "-")
+	var v version
+	for _, field := range strings.Split(core, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return version{}, false
+		}
+		v.parts = append(v.parts, n)
+	}
+	v.pre = pre
+	return v, true
+}
+
+// compare orders versions numerically; a pre-release sorts before its release.
+func (v version) compare(o version) int {
+	for i := 0; i < len(v.parts) || i < len(o.parts); i++ {
+		a, b := 0, 0
+		if i < len(v.parts) {
+			a = v.parts[i]
+		}
+		if i < len(o.parts) {
+			b = o.parts[i]
+		}
+		if a != b {
+			if a < b {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	}
+	return strings.Compare(v.pre, o.pre)
+}
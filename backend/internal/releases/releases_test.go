@@ -0,0 +1,217 @@
+package releases
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"updockly/backend/internal/domain"
+)
+
+var (
+	amd64Digest  = "sha256:" + strings.Repeat("a", 64)
+	arm64Digest  = "sha256:" + strings.Repeat("b", 64)
+	configDigest = "sha256:" + strings.Repeat("c", 64)
+)
+
+// startRegistry serves one multi-platform image, acme/app:1.1, behind an anonymous
+// token challenge like Docker Hub's.
+func startRegistry(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var tokens atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:acme/app:pull" || r.URL.Query().Get("service") != "stub" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			tokens.Add(1)
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "anon"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer anon" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="stub",scope="repository:acme/app:pull"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/acme/app/manifests/1.1":
+			w.Header().Set("Content-Type", specs.MediaTypeImageIndex)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"schemaVersion": 2,
+				"mediaType":     specs.MediaTypeImageIndex,
+				"manifests": []map[string]any{
+					{"mediaType": specs.MediaTypeImageManifest, "digest": arm64Digest, "size": 1, "platform": map[string]string{"os": "linux", "architecture": "arm64"}},
+					{"mediaType": specs.MediaTypeImageManifest, "digest": amd64Digest, "size": 1, "platform": map[string]string{"os": "linux", "architecture": "amd64"}},
+					{"mediaType": specs.MediaTypeImageManifest, "digest": arm64Digest, "size": 1, "platform": map[string]string{"os": "unknown", "architecture": "unknown"}},
+				},
+			})
+		case "/v2/acme/app/manifests/" + amd64Digest:
+			w.Header().Set("Content-Type", specs.MediaTypeImageManifest)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"schemaVersion": 2,
+				"config":        map[string]any{"mediaType": specs.MediaTypeImageConfig, "digest": configDigest, "size": 1},
+				"annotations":   map[string]string{LabelRevision: "from-annotation", "com.example.other": "x"},
+			})
+		case "/v2/acme/app/blobs/" + configDigest:
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"architecture": "amd64",
+				"os":           "linux",
+				"config": map[string]any{"Labels": map[string]string{
+					LabelVersion: "1.1.1",
+					LabelSource:  "https://github.com/acme/app.git",
+				}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &tokens
+}
+
+func startGitHub(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/app/releases" || r.Header.Get("Authorization") != "Bearer gh-token" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("page") != "1" {
+			_, _ = w.Write([]byte("[]"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]map[string]any{
+			{"tag_name": "v1.2.0-rc.1", "name": "1.2.0 RC", "prerelease": true, "html_url": "https://github.com/acme/app/releases/tag/v1.2.0-rc.1"},
+			{"tag_name": "v1.2.0", "name": "Draft", "draft": true},
+			{"tag_name": "v1.1.1", "name": "1.1.1", "body": "Fixes a crash.", "html_url": "https://github.com/acme/app/releases/tag/v1.1.1", "published_at": "2026-10-01T12:00:00Z"},
+			{"tag_name": "v1.1.0", "name": "1.1.0", "body": "Adds export."},
+			{"tag_name": "v1.0.0", "name": "1.0.0"},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRegistryLabels(t *testing.T) {
+	srv, tokens := startRegistry(t)
+	ref := strings.TrimPrefix(srv.URL, "https://") + "/acme/app:1.1"
+
+	registry := &Registry{Client: srv.Client(), Platform: "linux/amd64"}
+	labels, err := registry.Labels(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("labels: %v", err)
+	}
+	if labels[LabelVersion] != "1.1.1" || labels[LabelSource] != "https://github.com/acme/app.git" || labels[LabelRevision] != "from-annotation" {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+	if _, ok := labels["com.example.other"]; ok {
+		t.Fatalf("expected only OCI annotations to be merged, got %v", labels)
+	}
+	if n := tokens.Load(); n != 1 {
+		t.Fatalf("expected the token to be requested once, got %d", n)
+	}
+
+	if _, err := (&Registry{Client: srv.Client(), Platform: "linux/s390x"}).Labels(context.Background(), ref); err == nil {
+		t.Fatalf("expected a missing platform to fail")
+	}
+	if _, err := registry.Labels(context.Background(), strings.TrimPrefix(srv.URL, "https://")+"/acme/app:2.0"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected an unknown tag to fail with 404, got %v", err)
+	}
+}
+
+func TestLookupReleaseNotes(t *testing.T) {
+	registry, _ := startRegistry(t)
+	github := startGitHub(t)
+	lookup := &Lookup{
+		Registry: &Registry{Client: registry.Client(), Platform: "linux/amd64"},
+		GitHub:   &GitHubClient{BaseURL: github.URL, Token: "gh-token"},
+	}
+	ref := strings.TrimPrefix(registry.URL, "https://") + "/acme/app:1.1"
+
+	notes, err := lookup.Lookup(context.Background(), ref, map[string]string{LabelVersion: "1.0.0", LabelRevision: "abc123"})
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if notes.CurrentVersion != "1.0.0" || notes.CurrentRevision != "abc123" || notes.Version != "1.1.1" || notes.Revision != "from-annotation" {
+		t.Fatalf("unexpected versions %+v", notes)
+	}
+	var tags []string
+	for _, r := range notes.Releases {
+		tags = append(tags, r.Tag)
+	}
+	if strings.Join(tags, ",") != "v1.1.1,v1.1.0" {
+		t.Fatalf("expected the releases after the running version, got %v", tags)
+	}
+	if notes.Releases[0].Body != "Fixes a crash." || notes.Releases[0].PublishedAt == nil {
+		t.Fatalf("unexpected release %+v", notes.Releases[0])
+	}
+
+	// Already on the remote version: labels only.
+	notes, err = lookup.Lookup(context.Background(), ref, map[string]string{LabelVersion: "1.1.1"})
+	if err != nil || notes.Releases != nil {
+		t.Fatalf("expected no releases for the same version, got %+v (%v)", notes, err)
+	}
+
+	lookup.GitHub = &GitHubClient{BaseURL: github.URL}
+	notes, err = lookup.Lookup(context.Background(), ref, map[string]string{LabelVersion: "1.0.0"})
+	if err == nil || notes.Version != "1.1.1" {
+		t.Fatalf("expected a GitHub error with the labels kept, got %+v (%v)", notes, err)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	list := []domain.Release{{Tag: "gamma"}, {Tag: "beta"}, {Tag: "alpha"}}
+	tags := func(rs []domain.Release) string {
+		var out []string
+		for _, r := range rs {
+			out = append(out, r.Tag)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := tags(Between(list, "alpha", "gamma")); got != "gamma,beta" {
+		t.Fatalf("expected the list order for unversioned tags, got %q", got)
+	}
+	if got := tags(Between(list, "", "beta")); got != "beta" {
+		t.Fatalf("expected only the target release without a running version, got %q", got)
+	}
+	if got := tags(Between(list, "gamma", "alpha")); got != "" {
+		t.Fatalf("expected nothing for a downgrade, got %q", got)
+	}
+
+	versions := []domain.Release{{Tag: "release-1.27.3"}, {Tag: "release-1.26.9"}, {Tag: "release-1.27.2"}, {Tag: "release-1.27.0"}}
+	if got := tags(Between(versions, "1.27.0", "1.27.3")); got != "release-1.27.3,release-1.27.2" {
+		t.Fatalf("expected versions compared past the tag prefix, got %q", got)
+	}
+	rc := []domain.Release{{Tag: "v2.0.0-rc.2", Prerelease: true}, {Tag: "v2.0.0-rc.1", Prerelease: true}, {Tag: "v1.9.0"}}
+	if got := tags(Between(rc, "1.9.0", "2.0.0-rc.2")); got != "v2.0.0-rc.2,v2.0.0-rc.1" {
+		t.Fatalf("expected pre-releases when updating to one, got %q", got)
+	}
+}
+
+func TestGitHubRepo(t *testing.T) {
+	for source, want := range map[string]string{
+		"https://github.com/acme/app":           "acme/app",
+		"https://github.com/acme/app.git":       "acme/app",
+		"https://github.com/acme/app/tree/main": "acme/app",
+		"https://gitlab.com/acme/app":           "",
+		"https://github.com/acme":               "",
+		"":                                      "",
+	} {
+		owner, repo, ok := GitHubRepo(source)
+		got := ""
+		if ok {
+			got = owner + "/" + repo
+		}
+		if got != want {
+			t.Fatalf("GitHubRepo(%q) = %q, want %q", source, got, want)
+		}
+	}
+}
@@ -19,10 +19,19 @@ func Merge(base config.RuntimeSettings, stored config.RuntimeSettings) config.Ru
 	if stored.Timezone != "" {
 		merged.Timezone = stored.Timezone
 	}
+	if stored.LogLevel != "" {
+		merged.LogLevel = stored.LogLevel
+	}
 	merged.HideSupport = stored.HideSupport
 	merged.AutoPrune = stored.AutoPrune
 	merged.Notifications = stored.Notifications
 	merged.SSO = stored.SSO
+	merged.WebAuthn = stored.WebAuthn
+	// Records saved before the password policy existed keep the env defaults.
+	if stored.PasswordPolicy != (config.PasswordPolicySettings{}) {
+		merged.PasswordPolicy = stored.PasswordPolicy
+	}
+	merged.LDAP = stored.LDAP
 
 	if merged.Timezone == "" {
 		merged.Timezone = "UTC"
@@ -47,6 +56,11 @@ func NormalizeForStorage(base config.RuntimeSettings, incoming config.RuntimeSet
 		}
 	}
 
+	normalized.LogLevel = strings.ToLower(strings.TrimSpace(incoming.LogLevel))
+	if normalized.LogLevel == "" {
+		normalized.LogLevel = base.LogLevel
+	}
+
 	normalized.Notifications = incoming.Notifications
 	if normalized.Notifications.SMTP.Port == 0 {
 		normalized.Notifications.SMTP.Port = base.Notifications.SMTP.Port
@@ -56,6 +70,11 @@ func NormalizeForStorage(base config.RuntimeSettings, incoming config.RuntimeSet
 	}
 
 	normalized.SSO = incoming.SSO
+	normalized.WebAuthn = incoming.WebAuthn
+	if incoming.PasswordPolicy != (config.PasswordPolicySettings{}) {
+		normalized.PasswordPolicy = incoming.PasswordPolicy
+	}
+	normalized.LDAP = incoming.LDAP
 
 	return normalized
 }
@@ -60,3 +60,20 @@ func TestNormalizeForStorageKeepsEnvDefaults(t *testing.T) {
 		t.Fatalf("SMTP port should inherit base default, got %d", normalized.Notifications.SMTP.Port)
 	}
 }
+
+func TestLogLevelFallsBackToEnv(t *testing.T) {
+	base := config.RuntimeSettings{LogLevel: "warn"}
+
+	if merged := Merge(base, config.RuntimeSettings{}); merged.LogLevel != "warn" {
+		t.Fatalf("log level should come from env when not stored, got %q", merged.LogLevel)
+	}
+	if merged := Merge(base, config.RuntimeSettings{LogLevel: "debug"}); merged.LogLevel != "debug" {
+		t.Fatalf("stored log level should overlay, got %q", merged.LogLevel)
+	}
+	if normalized := NormalizeForStorage(base, config.RuntimeSettings{LogLevel: " DEBUG "}); normalized.LogLevel != "debug" {
+		t.Fatalf("log level should be normalized, got %q", normalized.LogLevel)
+	}
+	if normalized := NormalizeForStorage(base, config.RuntimeSettings{}); normalized.LogLevel != "warn" {
+		t.Fatalf("log level should fallback to base when empty, got %q", normalized.LogLevel)
+	}
+}
@@ -61,6 +61,11 @@ func (s *Store) Load() (config.RuntimeSettings, bool, error) {
 				data.SSO.ClientSecret = v
 			}
 		}
+		if data.LDAP.BindPassword != "" {
+			if v, err := s.vault.Decrypt(data.LDAP.BindPassword); err == nil {
+				data.LDAP.BindPassword = v
+			}
+		}
 	}
 
 	return data, true, nil
@@ -89,6 +94,11 @@ func (s *Store) Save(settings config.RuntimeSettings) (config.RuntimeSettings, e
 				stripped.SSO.ClientSecret = v
 			}
 		}
+		if stripped.LDAP.BindPassword != "" {
+			if v, err := s.vault.Encrypt(stripped.LDAP.BindPassword); err == nil {
+				stripped.LDAP.BindPassword = v
+			}
+		}
 	}
 
 	rec := Record{
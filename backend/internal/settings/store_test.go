@@ -7,6 +7,7 @@ import (
 	"gorm.io/gorm"
 
 	"updockly/backend/internal/config"
+	"updockly/backend/internal/vault"
 )
 
 func setupTestDB(t *testing.T) *gorm.DB {
@@ -66,3 +67,31 @@ func TestStoreSaveStripsEnvBackedFields(t *testing.T) {
 		t.Fatalf("unexpected stored payload: %+v", loaded)
 	}
 }
+
+func TestStoreEncryptsLDAPBindPassword(t *testing.T) {
+	db := setupTestDB(t)
+	v := vault.NewVault("test-vault-key-32-bytes-long-ok!", "", "")
+	store := NewStore(db, v)
+
+	if _, err := store.Save(config.RuntimeSettings{
+		LDAP: config.LDAPSettings{Enabled: true, BindPassword: "s3cret"},
+	}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	var rec Record
+	if err := db.First(&rec, 1).Error; err != nil {
+		t.Fatalf("read record: %v", err)
+	}
+	if rec.Data.LDAP.BindPassword == "" || rec.Data.LDAP.BindPassword == "s3cret" {
+		t.Fatalf("expected bind password to be encrypted at rest, got %q", rec.Data.LDAP.BindPassword)
+	}
+
+	loaded, _, err := store.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if loaded.LDAP.BindPassword != "s3cret" {
+		t.Fatalf("expected decrypted bind password, got %q", loaded.LDAP.BindPassword)
+	}
+}
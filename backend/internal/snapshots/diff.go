@@ -0,0 +1,167 @@
+package snapshots
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"updockly/backend/internal/containers"
+)
+
+// Change kinds.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// Change is one difference between two config snapshots. Key names the env variable,
+// mount destination, port, label or network; it is empty for single values.
+type Change struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// Diff lists what changed between two config snapshots, by section.
+type Diff struct {
+	Image         *Change  `json:"image,omitempty"`
+	Env           []Change `json:"env"`
+	Mounts        []Change `json:"mounts"`
+	Ports         []Change `json:"ports"`
+	Labels        []Change `json:"labels"`
+	RestartPolicy *Change  `json:"restartPolicy,omitempty"`
+	Networks      []Change `json:"networks"`
+}
+
+// Empty reports whether the snapshots are the same in every section.
+func (d Diff) Empty() bool {
+	return d.Image == nil && d.RestartPolicy == nil && len(d.Env) == 0 && len(d.Mounts) == 0 &&
+		len(d.Ports) == 0 && len(d.Labels) == 0 && len(d.Networks) == 0
+}
+
+// Compare diffs the config snapshot before against after.
+func Compare(before, after *containers.ConfigSnapshot) Diff {
+	return Diff{
+		Image:         compareValue(before.Config.Image, after.Config.Image),
+		Env:           compareMaps(envMap(before), envMap(after)),
+		Mounts:        compareMaps(mountMap(before), mountMap(after)),
+		Ports:         compareMaps(portMap(before), portMap(after)),
+		Labels:        compareMaps(before.Config.Labels, after.Config.Labels),
+		RestartPolicy: compareValue(restartPolicy(before), restartPolicy(after)),
+		Networks:      compareMaps(networkMap(before), networkMap(after)),
+	}
+}
+
+func compareValue(before, after string) *Change {
+	if before == after {
+		return nil
+	}
+	return &Change{Kind: kindOf(before != "", after != ""), Before: before, After: after}
+}
+
+func compareMaps(before, after map[string]string) []Change {
+	keys := make(map[string]struct{}, len(before)+len(after))
+	for k := range before {
+		keys[k] = struct{}{}
+	}
+	for k := range after {
+		keys[k] = struct{}{}
+	}
+	changes := []Change{}
+	for k := range keys {
+		b, inBefore := before[k]
+		a, inAfter := after[k]
+		if inBefore && inAfter && a == b {
+			continue
+		}
+		changes = append(changes, Change{Kind: kindOf(inBefore, inAfter), Key: k, Before: b, After: a})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+func kindOf(before, after bool) string {
+	switch {
+	case !before:
+		return Added
+	case !after:
+		return Removed
+	default:
+		return Changed
+	}
+}
+
+func envMap(snap *containers.ConfigSnapshot) map[string]string {
+	out := make(map[string]string, len(snap.Config.Env))
+	for _, kv := range snap.Config.Env {
+		key, value, _ := strings.Cut(kv, "=")
+		out[key] = value
+	}
+	return out
+}
+
+// mountMap keys binds and mounts by their destination in the container.
+func mountMap(snap *containers.ConfigSnapshot) map[string]string {
+	out := make(map[string]string)
+	for _, bind := range snap.HostConfig.Binds {
+		parts := strings.Split(bind, ":")
+		if len(parts) < 2 {
+			continue
+		}
+		value := parts[0]
+		if len(parts) > 2 {
+			value += " (" + strings.Join(parts[2:], ":") + ")"
+		}
+		out[parts[1]] = value
+	}
+	for _, m := range snap.HostConfig.Mounts {
+		value := fmt.Sprintf("%s %s", m.Type, m.Source)
+		if m.ReadOnly {
+			value += " (ro)"
+		}
+		out[m.Target] = strings.TrimSpace(value)
+	}
+	return out
+}
+
+// portMap keys published ports by container port and protocol, as 80/tcp.
+func portMap(snap *containers.ConfigSnapshot) map[string]string {
+	out := make(map[string]string)
+	for port, bindings := range snap.HostConfig.PortBindings {
+		hosts := make([]string, 0, len(bindings))
+		for _, b := range bindings {
+			host := b.HostPort
+			if b.HostIP != "" {
+				host = b.HostIP + ":" + host
+			}
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		out[string(port)] = strings.Join(hosts, ", ")
+	}
+	return out
+}
+
+func restartPolicy(snap *containers.ConfigSnapshot) string {
+	policy := string(snap.HostConfig.RestartPolicy.Name)
+	if policy != "" && snap.HostConfig.RestartPolicy.MaximumRetryCount > 0 {
+		policy = fmt.Sprintf("%s:%d", policy, snap.HostConfig.RestartPolicy.MaximumRetryCount)
+	}
+	return policy
+}
+
+// networkMap keys networks by name, with the aliases the container has in each.
+func networkMap(snap *containers.ConfigSnapshot) map[string]string {
+	out := make(map[string]string, len(snap.Networks))
+	for name, endpoint := range snap.Networks {
+		var aliases []string
+		if endpoint != nil {
+			aliases = append(aliases, endpoint.Aliases...)
+		}
+		sort.Strings(aliases)
+		out[name] = strings.Join(aliases, ", ")
+	}
+	return out
+}
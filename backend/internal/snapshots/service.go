@@ -0,0 +1,143 @@
+package snapshots
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/containers"
+	"updockly/backend/internal/domain"
+)
+
+// Reasons a config snapshot was recorded.
+const (
+	// ReasonObserved is the config a container was found running with before a change,
+	// recorded when no version matches it yet.
+	ReasonObserved = "observed"
+	ReasonUpdate   = "update"
+	ReasonRollback = "rollback"
+	ReasonRestore  = "restore"
+	ReasonManual   = "manual"
+)
+
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Record stores snap as the next version of its container, unless it does not differ
+// from the latest version; created is false and the latest version is returned then.
+func (s *Service) Record(snap domain.ContainerConfigSnapshot) (domain.ContainerConfigSnapshot, bool, error) {
+	if s.db == nil {
+		return snap, false, errors.New("database not ready")
+	}
+	parsed, err := containers.ParseConfigSnapshot(snap.Config)
+	if err != nil {
+		return snap, false, err
+	}
+	snap.ContainerName = strings.TrimPrefix(strings.TrimSpace(snap.ContainerName), "/")
+	if snap.ContainerName == "" {
+		snap.ContainerName = parsed.Name
+	}
+	if snap.ContainerName == "" {
+		return snap, false, errors.New("container name is required")
+	}
+	if snap.Image == "" {
+		snap.Image = parsed.Config.Image
+	}
+
+	// Versions are unique per container; a concurrent Record that takes the same
+	// version makes the insert fail, and the next attempt numbers after it.
+	for attempt := 1; ; attempt++ {
+		var latest domain.ContainerConfigSnapshot
+		err = s.quiet().Where("agent_id = ? AND container_name = ?", snap.AgentID, snap.ContainerName).
+			Order("version DESC").First(&latest).Error
+		switch {
+		case err == nil:
+			if prev, perr := containers.ParseConfigSnapshot(latest.Config); perr == nil && Compare(prev, parsed).Empty() {
+				return latest, false, nil
+			}
+			snap.Version = latest.Version + 1
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			snap.Version = 1
+		default:
+			return snap, false, err
+		}
+		snap.ID = ""
+		err = s.quiet().Create(&snap).Error
+		if err == nil {
+			return snap, true, nil
+		}
+		if attempt == recordAttempts || !s.versionTaken(snap) {
+			return snap, false, err
+		}
+	}
+}
+
+// recordAttempts bounds how often Record renumbers after losing a race for a version.
+const recordAttempts = 5
+
+func (s *Service) versionTaken(snap domain.ContainerConfigSnapshot) bool {
+	var count int64
+	err := s.quiet().Model(&domain.ContainerConfigSnapshot{}).
+		Where("agent_id = ? AND container_name = ? AND version = ?", snap.AgentID, snap.ContainerName, snap.Version).
+		Count(&count).Error
+	return err == nil && count > 0
+}
+
+// List returns snapshots newest first, for one container when name is set. agentID
+// selects the agent; empty means local containers.
+func (s *Service) List(agentID, name string, limit int) ([]domain.ContainerConfigSnapshot, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := s.db.Where("agent_id = ?", strings.TrimSpace(agentID))
+	if name = strings.TrimPrefix(strings.TrimSpace(name), "/"); name != "" {
+		query = query.Where("container_name = ?", name)
+	}
+	var rows []domain.ContainerConfigSnapshot
+	err := query.Order("created_at DESC").Order("version DESC").Limit(limit).Find(&rows).Error
+	return rows, err
+}
+
+func (s *Service) Get(id string) (domain.ContainerConfigSnapshot, error) {
+	var snap domain.ContainerConfigSnapshot
+	if s.db == nil {
+		return snap, errors.New("database not ready")
+	}
+	err := s.db.First(&snap, "id = ?", strings.TrimSpace(id)).Error
+	return snap, err
+}
+
+// Diff compares two stored snapshots, from the first to the second.
+func (s *Service) Diff(fromID, toID string) (Diff, error) {
+	from, err := s.Get(fromID)
+	if err != nil {
+		return Diff{}, err
+	}
+	to, err := s.Get(toID)
+	if err != nil {
+		return Diff{}, err
+	}
+	before, err := containers.ParseConfigSnapshot(from.Config)
+	if err != nil {
+		return Diff{}, err
+	}
+	after, err := containers.ParseConfigSnapshot(to.Config)
+	if err != nil {
+		return Diff{}, err
+	}
+	return Compare(before, after), nil
+}
+
+func (s *Service) quiet() *gorm.DB {
+	return s.db.Session(&gorm.Session{Logger: logger.Discard})
+}
@@ -0,0 +1,157 @@
+package snapshots
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/containers"
+	"updockly/backend/internal/domain"
+)
+
+func setupSnapshotsDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.ContainerConfigSnapshot{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func webConfig(image string, env ...string) *containers.ConfigSnapshot {
+	return &containers.ConfigSnapshot{
+		Name:   "web",
+		Config: &container.Config{Image: image, Env: env, Labels: map[string]string{"tier": "front"}},
+		HostConfig: &container.HostConfig{
+			Binds:         []string{"/srv/web:/usr/share/nginx/html:ro"},
+			PortBindings:  nat.PortMap{"80/tcp": {{HostPort: "8080"}}},
+			RestartPolicy: container.RestartPolicy{Name: container.RestartPolicyAlways},
+		},
+		Networks: map[string]*network.EndpointSettings{"front": {Aliases: []string{"web"}}},
+	}
+}
+
+func raw(t *testing.T, snap *containers.ConfigSnapshot) domain.RawJSON {
+	t.Helper()
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return data
+}
+
+func TestCompare(t *testing.T) {
+	before := webConfig("nginx:1.27", "MODE=old", "TOKEN=a")
+	after := webConfig("nginx:1.28", "MODE=new", "DEBUG=1")
+	after.Config.Labels = map[string]string{"tier": "front", "team": "web"}
+	after.HostConfig.Binds = nil
+	after.HostConfig.Mounts = []mount.Mount{{Type: mount.TypeVolume, Source: "web-data", Target: "/data"}}
+	after.HostConfig.PortBindings = nat.PortMap{"80/tcp": {{HostIP: "127.0.0.1", HostPort: "8080"}}}
+	after.HostConfig.RestartPolicy = container.RestartPolicy{Name: container.RestartPolicyOnFailure, MaximumRetryCount: 3}
+
+	diff := Compare(before, after)
+	if diff.Image == nil || diff.Image.Kind != Changed || diff.Image.After != "nginx:1.28" {
+		t.Fatalf("unexpected image change %+v", diff.Image)
+	}
+	wantEnv := []Change{
+		{Kind: Added, Key: "DEBUG", After: "1"},
+		{Kind: Changed, Key: "MODE", Before: "old", After: "new"},
+		{Kind: Removed, Key: "TOKEN", Before: "a"},
+	}
+	if len(diff.Env) != len(wantEnv) {
+		t.Fatalf("expected %+v, got %+v", wantEnv, diff.Env)
+	}
+	for i := range wantEnv {
+		if diff.Env[i] != wantEnv[i] {
+			t.Fatalf("expected %+v, got %+v", wantEnv, diff.Env)
+		}
+	}
+	if len(diff.Mounts) != 2 || diff.Mounts[0].Key != "/data" || diff.Mounts[1].Kind != Removed || diff.Mounts[1].Before != "/srv/web (ro)" {
+		t.Fatalf("unexpected mount changes %+v", diff.Mounts)
+	}
+	if len(diff.Ports) != 1 || diff.Ports[0].After != "127.0.0.1:8080" {
+		t.Fatalf("unexpected port changes %+v", diff.Ports)
+	}
+	if len(diff.Labels) != 1 || diff.Labels[0].Key != "team" || diff.Labels[0].Kind != Added {
+		t.Fatalf("unexpected label changes %+v", diff.Labels)
+	}
+	if diff.RestartPolicy == nil || diff.RestartPolicy.Before != "always" || diff.RestartPolicy.After != "on-failure:3" {
+		t.Fatalf("unexpected restart policy change %+v", diff.RestartPolicy)
+	}
+	if len(diff.Networks) != 0 || diff.Empty() {
+		t.Fatalf("unexpected network changes %+v", diff.Networks)
+	}
+	if !Compare(before, webConfig("nginx:1.27", "MODE=old", "TOKEN=a")).Empty() {
+		t.Fatalf("expected identical configs to compare equal")
+	}
+}
+
+func TestRecordVersions(t *testing.T) {
+	svc := NewService(setupSnapshotsDB(t))
+
+	first, created, err := svc.Record(domain.ContainerConfigSnapshot{Reason: ReasonObserved, Config: raw(t, webConfig("nginx:1.27", "MODE=old"))})
+	if err != nil || !created || first.Version != 1 || first.ContainerName != "web" || first.Image != "nginx:1.27" {
+		t.Fatalf("unexpected first version %+v created=%v (%v)", first, created, err)
+	}
+	// The same config does not add a version.
+	if same, created, err := svc.Record(domain.ContainerConfigSnapshot{ContainerName: "web", Reason: ReasonManual, Config: raw(t, webConfig("nginx:1.27", "MODE=old"))}); err != nil || created || same.ID != first.ID {
+		t.Fatalf("expected the latest version back, got %+v created=%v (%v)", same, created, err)
+	}
+	second, created, err := svc.Record(domain.ContainerConfigSnapshot{ContainerName: "web", Reason: ReasonUpdate, Config: raw(t, webConfig("nginx:1.27", "MODE=new"))})
+	if err != nil || !created || second.Version != 2 {
+		t.Fatalf("unexpected second version %+v created=%v (%v)", second, created, err)
+	}
+	// Versions count per agent.
+	if other, _, err := svc.Record(domain.ContainerConfigSnapshot{AgentID: "a1", ContainerName: "web", Config: raw(t, webConfig("nginx:1.27"))}); err != nil || other.Version != 1 {
+		t.Fatalf("expected a separate version for the agent container, got %+v (%v)", other, err)
+	}
+	if _, _, err := svc.Record(domain.ContainerConfigSnapshot{ContainerName: "web", Config: domain.RawJSON(`{"name":"web"}`)}); err == nil {
+		t.Fatalf("expected an incomplete config to be refused")
+	}
+
+	local, err := svc.List("", "web", 0)
+	if err != nil || len(local) != 2 || local[0].ID != second.ID {
+		t.Fatalf("expected both local versions newest first, got %+v (%v)", local, err)
+	}
+	diff, err := svc.Diff(first.ID, second.ID)
+	if err != nil || len(diff.Env) != 1 || diff.Env[0].Key != "MODE" {
+		t.Fatalf("unexpected diff %+v (%v)", diff, err)
+	}
+}
+
+func TestRecordRenumbersAfterConcurrentVersion(t *testing.T) {
+	db := setupSnapshotsDB(t)
+	svc := NewService(db)
+
+	// Another recording takes version 1 between the lookup and the insert.
+	raced := false
+	err := db.Callback().Query().After("gorm:query").Register("test:race", func(tx *gorm.DB) {
+		if _, ok := tx.Statement.Dest.(*domain.ContainerConfigSnapshot); ok && !raced {
+			raced = true
+			other := domain.ContainerConfigSnapshot{ContainerName: "web", Version: 1, Config: raw(t, webConfig("nginx:1.26"))}
+			if err := db.Create(&other).Error; err != nil {
+				t.Errorf("create competing snapshot: %v", err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	snap, created, err := svc.Record(domain.ContainerConfigSnapshot{Config: raw(t, webConfig("nginx:1.27")), Reason: ReasonUpdate})
+	if err != nil || !created || snap.Version != 2 {
+		t.Fatalf("expected the snapshot to be recorded as version 2, got %+v %v %v", snap, created, err)
+	}
+}
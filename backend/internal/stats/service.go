@@ -0,0 +1,206 @@
+package stats
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/domain"
+)
+
+// Resolutions of the stored buckets. Every reading is added to one bucket of each; fine
+// buckets show recent usage and coarse ones are kept longer.
+const (
+	Fine   = 5 * time.Minute
+	Coarse = time.Hour
+)
+
+var ErrInvalidResolution = errors.New("resolution must be 5m or 1h")
+
+// Reading is one resource reading of an agent's host, when ContainerName is empty, or
+// of a container. The IO fields are cumulative byte counters.
+type Reading struct {
+	ContainerID     string
+	ContainerName   string
+	CPU             float64
+	MemoryBytes     int64
+	MemoryLimit     int64
+	MemoryPercent   float64
+	NetRxBytes      int64
+	NetTxBytes      int64
+	BlockReadBytes  int64
+	BlockWriteBytes int64
+}
+
+// Point is the usage over one bucket. Rates are bytes per second since the previous
+// bucket; they are zero when a counter went back, as it does when a container is
+// recreated.
+type Point struct {
+	Time           time.Time `json:"time"`
+	CPUPercent     float64   `json:"cpuPercent"`
+	MemoryBytes    int64     `json:"memoryBytes"`
+	MemoryLimit    int64     `json:"memoryLimit"`
+	MemoryPercent  float64   `json:"memoryPercent"`
+	NetRxRate      float64   `json:"netRxBytesPerSec"`
+	NetTxRate      float64   `json:"netTxBytesPerSec"`
+	BlockReadRate  float64   `json:"blockReadBytesPerSec"`
+	BlockWriteRate float64   `json:"blockWriteBytesPerSec"`
+	ContainerID    string    `json:"containerId,omitempty"`
+	Samples        int       `json:"samples"`
+}
+
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// ParseResolution reads a resolution query value. Empty picks one with Pick.
+func ParseResolution(value string) (time.Duration, error) {
+	switch strings.TrimSpace(value) {
+	case "":
+		return 0, nil
+	case "5m":
+		return Fine, nil
+	case "1h":
+		return Coarse, nil
+	}
+	return 0, ErrInvalidResolution
+}
+
+// Pick returns the fine resolution when from is still within its retention.
+func Pick(from, now time.Time, fineRetention time.Duration) time.Duration {
+	if !from.Before(now.Add(-fineRetention)) {
+		return Fine
+	}
+	return Coarse
+}
+
+// Record adds the readings an agent sent at at to their buckets.
+func (s *Service) Record(agentID string, at time.Time, readings []Reading) error {
+	if s.db == nil {
+		return errors.New("database not ready")
+	}
+	if len(readings) == 0 {
+		return nil
+	}
+	return s.db.Session(&gorm.Session{Logger: logger.Discard}).Transaction(func(tx *gorm.DB) error {
+		for _, r := range readings {
+			if r.MemoryPercent == 0 && r.MemoryLimit > 0 {
+				r.MemoryPercent = float64(r.MemoryBytes) / float64(r.MemoryLimit) * 100
+			}
+			for _, res := range []time.Duration{Fine, Coarse} {
+				if err := addReading(tx, agentID, at, res, r); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func addReading(tx *gorm.DB, agentID string, at time.Time, res time.Duration, r Reading) error {
+	// Buckets are stored in UTC so lookups match on SQLite, which compares text.
+	bucket := at.UTC().Truncate(res)
+	var row domain.ResourceSample
+	err := tx.Where("agent_id = ? AND container_name = ? AND resolution = ? AND bucket_start = ?",
+		agentID, r.ContainerName, int(res.Seconds()), bucket).Limit(1).Find(&row).Error
+	if err != nil {
+		return err
+	}
+	if row.ID == 0 {
+		row = domain.ResourceSample{
+			AgentID:       agentID,
+			ContainerName: r.ContainerName,
+			Resolution:    int(res.Seconds()),
+			BucketStart:   bucket,
+		}
+	}
+	row.ContainerID = r.ContainerID
+	row.Samples++
+	row.CPUSum += r.CPU
+	row.MemorySum += float64(r.MemoryBytes)
+	row.MemoryPctSum += r.MemoryPercent
+	row.MemoryLimit = r.MemoryLimit
+	row.NetRxBytes = r.NetRxBytes
+	row.NetTxBytes = r.NetTxBytes
+	row.BlockReadBytes = r.BlockReadBytes
+	row.BlockWriteBytes = r.BlockWriteBytes
+	return tx.Save(&row).Error
+}
+
+// Range returns the buckets of a series between from and to, oldest first. container is
+// empty for the agent's host.
+func (s *Service) Range(agentID, container string, from, to time.Time, res time.Duration) ([]Point, error) {
+	if s.db == nil {
+		return nil, errors.New("database not ready")
+	}
+	var rows []domain.ResourceSample
+	// One bucket before from gives the first point its rates.
+	err := s.db.Where("agent_id = ? AND container_name = ? AND resolution = ? AND bucket_start >= ? AND bucket_start <= ?",
+		agentID, container, int(res.Seconds()), from.UTC().Truncate(res).Add(-res), to.UTC()).
+		Order("bucket_start ASC").Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]Point, 0, len(rows))
+	start := from.UTC().Truncate(res)
+	for i, row := range rows {
+		if row.BucketStart.Before(start) || row.Samples == 0 {
+			continue
+		}
+		n := float64(row.Samples)
+		p := Point{
+			Time:          row.BucketStart,
+			CPUPercent:    row.CPUSum / n,
+			MemoryBytes:   int64(row.MemorySum / n),
+			MemoryLimit:   row.MemoryLimit,
+			MemoryPercent: row.MemoryPctSum / n,
+			ContainerID:   row.ContainerID,
+			Samples:       row.Samples,
+		}
+		if i > 0 {
+			prev := rows[i-1]
+			if seconds := row.BucketStart.Sub(prev.BucketStart).Seconds(); seconds > 0 {
+				p.NetRxRate = rate(prev.NetRxBytes, row.NetRxBytes, seconds)
+				p.NetTxRate = rate(prev.NetTxBytes, row.NetTxBytes, seconds)
+				p.BlockReadRate = rate(prev.BlockReadBytes, row.BlockReadBytes, seconds)
+				p.BlockWriteRate = rate(prev.BlockWriteBytes, row.BlockWriteBytes, seconds)
+			}
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
+func rate(before, after int64, seconds float64) float64 {
+	if after < before {
+		return 0
+	}
+	return float64(after-before) / seconds
+}
+
+// Prune removes fine buckets older than fineRetention and coarse ones older than
+// coarseRetention.
+func (s *Service) Prune(now time.Time, fineRetention, coarseRetention time.Duration) (int64, error) {
+	if s.db == nil {
+		return 0, errors.New("database not ready")
+	}
+	quiet := s.db.Session(&gorm.Session{Logger: logger.Discard})
+	var removed int64
+	for res, keep := range map[time.Duration]time.Duration{Fine: fineRetention, Coarse: coarseRetention} {
+		result := quiet.Where("resolution = ? AND bucket_start < ?", int(res.Seconds()), now.UTC().Add(-keep)).
+			Delete(&domain.ResourceSample{})
+		if result.Error != nil {
+			return removed, result.Error
+		}
+		removed += result.RowsAffected
+	}
+	return removed, nil
+}
@@ -0,0 +1,101 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/domain"
+)
+
+func setupStatsDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.ResourceSample{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+func TestRecordAndRange(t *testing.T) {
+	svc := NewService(setupStatsDB(t))
+	base := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	web := func(cpu float64, mem, rx int64) Reading {
+		return Reading{ContainerID: "c1", ContainerName: "web", CPU: cpu, MemoryBytes: mem, MemoryLimit: 1000, NetRxBytes: rx}
+	}
+	// Two readings in the first five minutes, one in the next, then the container is
+	// recreated and its counters start again.
+	readings := []struct {
+		at time.Duration
+		r  Reading
+	}{
+		{0, web(10, 100, 0)},
+		{2 * time.Minute, web(30, 300, 600)},
+		{5 * time.Minute, web(20, 200, 3600)},
+		{10 * time.Minute, web(5, 50, 100)},
+	}
+	for _, rd := range readings {
+		if err := svc.Record("a1", base.Add(rd.at), []Reading{rd.r, {CPU: 50, MemoryPercent: 40}}); err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+
+	points, err := svc.Range("a1", "web", base, base.Add(time.Hour), Fine)
+	if err != nil || len(points) != 3 {
+		t.Fatalf("expected three 5-minute points, got %+v (%v)", points, err)
+	}
+	first := points[0]
+	if first.CPUPercent != 20 || first.MemoryBytes != 200 || first.MemoryPercent != 20 || first.Samples != 2 {
+		t.Fatalf("expected the first bucket to average its readings, got %+v", first)
+	}
+	if points[1].NetRxRate != 10 {
+		t.Fatalf("expected 3000 bytes over 300s, got %v", points[1].NetRxRate)
+	}
+	if points[2].NetRxRate != 0 {
+		t.Fatalf("expected a counter reset to give no rate, got %v", points[2].NetRxRate)
+	}
+
+	// A range that starts later still gets rates from the bucket before it.
+	if later, _ := svc.Range("a1", "web", base.Add(5*time.Minute), base.Add(time.Hour), Fine); len(later) != 2 || later[0].NetRxRate != 10 {
+		t.Fatalf("unexpected points %+v", later)
+	}
+
+	hourly, err := svc.Range("a1", "web", base, base.Add(time.Hour), Coarse)
+	if err != nil || len(hourly) != 1 || hourly[0].Samples != 4 || hourly[0].CPUPercent != 16.25 {
+		t.Fatalf("expected one hourly point over all readings, got %+v (%v)", hourly, err)
+	}
+	host, err := svc.Range("a1", "", base, base.Add(time.Hour), Coarse)
+	if err != nil || len(host) != 1 || host[0].CPUPercent != 50 || host[0].MemoryPercent != 40 {
+		t.Fatalf("unexpected host series %+v (%v)", host, err)
+	}
+
+	removed, err := svc.Prune(base.Add(2*time.Hour), time.Hour, 48*time.Hour)
+	if err != nil || removed != 6 {
+		t.Fatalf("expected the fine buckets of both series to be pruned, got %d (%v)", removed, err)
+	}
+	if hourly, _ := svc.Range("a1", "web", base, base.Add(time.Hour), Coarse); len(hourly) != 1 {
+		t.Fatalf("expected the hourly bucket to be kept, got %+v", hourly)
+	}
+}
+
+func TestResolution(t *testing.T) {
+	now := time.Now()
+	if Pick(now.Add(-time.Hour), now, 48*time.Hour) != Fine || Pick(now.Add(-72*time.Hour), now, 48*time.Hour) != Coarse {
+		t.Fatalf("expected fine buckets within their retention only")
+	}
+	if res, err := ParseResolution("1h"); err != nil || res != Coarse {
+		t.Fatalf("unexpected resolution %v (%v)", res, err)
+	}
+	if _, err := ParseResolution("1m"); err != ErrInvalidResolution {
+		t.Fatalf("expected ErrInvalidResolution, got %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package throttle
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/domain"
+)
+
+var ErrNotFound = errors.New("throttle key not found")
+
+// Policy controls when a key gets locked and for how long. Each consecutive
+// lockout doubles the previous duration up to MaxLockout.
+type Policy struct {
+	MaxFailures int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// ResetAfter clears the failure counter after this much inactivity.
+	ResetAfter time.Duration
+	// LockoutMemory forgets previous lockouts after this much inactivity.
+	LockoutMemory time.Duration
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxFailures:   5,
+		BaseLockout:   15 * time.Minute,
+		MaxLockout:    24 * time.Hour,
+		ResetAfter:    30 * time.Minute,
+		LockoutMemory: 24 * time.Hour,
+	}
+}
+
+// RequestPolicy caps how often a request may be made rather than punishing failures:
+// every request counts, and a key that hits the limit waits a fixed BaseLockout that does
+// not grow with repeated lockouts.
+func RequestPolicy() Policy {
+	return Policy{
+		MaxFailures:   5,
+		BaseLockout:   15 * time.Minute,
+		MaxLockout:    15 * time.Minute,
+		ResetAfter:    15 * time.Minute,
+		LockoutMemory: 15 * time.Minute,
+	}
+}
+
+// Result describes the state of a key after a failure was recorded.
+type Result struct {
+	State domain.LoginThrottle
+	// Locked is true when this failure triggered a new lockout.
+	Locked bool
+}
+
+// Limiter throttles repeated failures per key.
+type Limiter interface {
+	// Check reports whether the key is currently blocked and for how long.
+	Check(key string) (time.Duration, bool, error)
+	// Fail records a failed attempt and applies a lockout once the policy threshold is hit.
+	Fail(key string) (Result, error)
+	// Reset clears state after a successful attempt.
+	Reset(key string) error
+	// List returns keys with recent failures or an active lockout.
+	List() ([]domain.LoginThrottle, error)
+	// Unlock removes a key entirely, including its lockout history.
+	Unlock(key string) error
+}
+
+func (p Policy) lockoutFor(level int) time.Duration {
+	d := p.BaseLockout
+	for i := 1; i < level; i++ {
+		d *= 2
+		if d >= p.MaxLockout {
+			return p.MaxLockout
+		}
+	}
+	if p.MaxLockout > 0 && d > p.MaxLockout {
+		return p.MaxLockout
+	}
+	return d
+}
+
+// decay forgets stale counters; it never lifts an active lockout.
+func (p Policy) decay(state *domain.LoginThrottle, now time.Time) {
+	if state.BlockedUntil != nil && state.BlockedUntil.After(now) {
+		return
+	}
+	idle := now.Sub(state.LastFailureAt)
+	if idle > p.ResetAfter {
+		state.Failures = 0
+	}
+	if idle > p.LockoutMemory {
+		state.Lockouts = 0
+	}
+}
+
+func (p Policy) remaining(state domain.LoginThrottle, now time.Time) (time.Duration, bool) {
+	if state.BlockedUntil != nil && state.BlockedUntil.After(now) {
+		return state.BlockedUntil.Sub(now), true
+	}
+	return 0, false
+}
+
+func (p Policy) registerFailure(state *domain.LoginThrottle, now time.Time) bool {
+	p.decay(state, now)
+	state.Failures++
+	state.LastFailureAt = now
+	if state.Failures < p.MaxFailures {
+		return false
+	}
+	state.Lockouts++
+	until := now.Add(p.lockoutFor(state.Lockouts))
+	state.BlockedUntil = &until
+	state.Failures = 0
+	return true
+}
+
+func (p Policy) stale(state domain.LoginThrottle, now time.Time) bool {
+	if _, blocked := p.remaining(state, now); blocked {
+		return false
+	}
+	return now.Sub(state.LastFailureAt) > p.LockoutMemory
+}
+
+// DBLimiter persists throttle state so it is shared between replicas.
+type DBLimiter struct {
+	db     *gorm.DB
+	policy Policy
+	now    func() time.Time
+}
+
+func NewDBLimiter(db *gorm.DB, policy Policy) *DBLimiter {
+	return &DBLimiter{db: db, policy: policy, now: time.Now}
+}
+
+func (l *DBLimiter) silent() *gorm.DB {
+	return l.db.Session(&gorm.Session{Logger: logger.Discard})
+}
+
+func (l *DBLimiter) Check(key string) (time.Duration, bool, error) {
+	var state domain.LoginThrottle
+	err := l.silent().Where("key = ?", key).First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	d, blocked := l.policy.remaining(state, l.now())
+	return d, blocked, nil
+}
+
+func (l *DBLimiter) Fail(key string) (Result, error) {
+	var res Result
+	now := l.now()
+	err := l.silent().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&domain.LoginThrottle{Key: key, LastFailureAt: now}).Error; err != nil {
+			return err
+		}
+		query := tx
+		// Serialize concurrent failures for the same key; SQLite already locks the database for writes.
+		if tx.Dialector.Name() == "postgres" {
+			query = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var state domain.LoginThrottle
+		if err := query.Where("key = ?", key).First(&state).Error; err != nil {
+			return err
+		}
+		res.Locked = l.policy.registerFailure(&state, now)
+		res.State = state
+		return tx.Save(&state).Error
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	// Opportunistically drop keys nobody has touched in a while.
+	_ = l.silent().
+		Where("last_failure_at < ? AND (blocked_until IS NULL OR blocked_until < ?)", now.Add(-l.policy.LockoutMemory), now).
+		Delete(&domain.LoginThrottle{}).Error
+	return res, nil
+}
+
+// Reset clears the failure counter but keeps lockout history so repeat offenders still escalate.
+func (l *DBLimiter) Reset(key string) error {
+	return l.silent().Model(&domain.LoginThrottle{}).Where("key = ?", key).Update("failures", 0).Error
+}
+
+func (l *DBLimiter) List() ([]domain.LoginThrottle, error) {
+	now := l.now()
+	states := []domain.LoginThrottle{}
+	if err := l.silent().
+		Where("failures > 0 OR blocked_until > ?", now).
+		Order("updated_at DESC").
+		Find(&states).Error; err != nil {
+		return nil, err
+	}
+	out := states[:0]
+	for _, st := range states {
+		l.policy.decay(&st, now)
+		if st.Failures > 0 || (st.BlockedUntil != nil && st.BlockedUntil.After(now)) {
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+func (l *DBLimiter) Unlock(key string) error {
+	result := l.silent().Where("key = ?", key).Delete(&domain.LoginThrottle{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MemoryLimiter keeps throttle state in-process. It is used before a database is configured.
+type MemoryLimiter struct {
+	mu     sync.Mutex
+	policy Policy
+	states map[string]domain.LoginThrottle
+	now    func() time.Time
+}
+
+func NewMemoryLimiter(policy Policy) *MemoryLimiter {
+	return &MemoryLimiter{policy: policy, states: make(map[string]domain.LoginThrottle), now: time.Now}
+}
+
+func (l *MemoryLimiter) Check(key string) (time.Duration, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state, ok := l.states[key]
+	if !ok {
+		return 0, false, nil
+	}
+	now := l.now()
+	if l.policy.stale(state, now) {
+		delete(l.states, key)
+		return 0, false, nil
+	}
+	d, blocked := l.policy.remaining(state, now)
+	return d, blocked, nil
+}
+
+func (l *MemoryLimiter) Fail(key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	state := l.states[key]
+	state.Key = key
+	now := l.now()
+	locked := l.policy.registerFailure(&state, now)
+	state.UpdatedAt = now
+	l.states[key] = state
+	return Result{State: state, Locked: locked}, nil
+}
+
+func (l *MemoryLimiter) Reset(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if state, ok := l.states[key]; ok {
+		state.Failures = 0
+		l.states[key] = state
+	}
+	return nil
+}
+
+func (l *MemoryLimiter) List() ([]domain.LoginThrottle, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	out := make([]domain.LoginThrottle, 0, len(l.states))
+	for _, st := range l.states {
+		l.policy.decay(&st, now)
+		if st.Failures > 0 || (st.BlockedUntil != nil && st.BlockedUntil.After(now)) {
+			out = append(out, st)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	return out, nil
+}
+
+func (l *MemoryLimiter) Unlock(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.states[key]; !ok {
+		return ErrNotFound
+	}
+	delete(l.states, key)
+	return nil
+}
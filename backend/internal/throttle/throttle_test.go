@@ -0,0 +1,151 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"updockly/backend/internal/domain"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestDBLimiter(t *testing.T, clock *fakeClock) *DBLimiter {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&domain.LoginThrottle{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	l := NewDBLimiter(db, DefaultPolicy())
+	l.now = clock.now
+	return l
+}
+
+func limiters(t *testing.T, clock *fakeClock) map[string]Limiter {
+	mem := NewMemoryLimiter(DefaultPolicy())
+	mem.now = clock.now
+	return map[string]Limiter{
+		"memory": mem,
+		"db":     newTestDBLimiter(t, clock),
+	}
+}
+
+func failN(t *testing.T, l Limiter, key string, n int) Result {
+	t.Helper()
+	var res Result
+	for i := 0; i < n; i++ {
+		var err error
+		if res, err = l.Fail(key); err != nil {
+			t.Fatalf("fail: %v", err)
+		}
+	}
+	return res
+}
+
+func TestProgressiveLockout(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	for name, l := range limiters(t, clock) {
+		t.Run(name, func(t *testing.T) {
+			if res := failN(t, l, "k", 4); res.Locked {
+				t.Fatalf("locked too early")
+			}
+			res := failN(t, l, "k", 1)
+			if !res.Locked || res.State.Lockouts != 1 {
+				t.Fatalf("expected first lockout, got %+v", res)
+			}
+			d, blocked, _ := l.Check("k")
+			if !blocked || d != 15*time.Minute {
+				t.Fatalf("expected 15m block, got %v %v", d, blocked)
+			}
+
+			clock.advance(16 * time.Minute)
+			if _, blocked, _ := l.Check("k"); blocked {
+				t.Fatalf("expected block to expire")
+			}
+			res = failN(t, l, "k", 5)
+			if !res.Locked || res.State.Lockouts != 2 {
+				t.Fatalf("expected second lockout, got %+v", res)
+			}
+			if d, _, _ := l.Check("k"); d != 30*time.Minute {
+				t.Fatalf("expected doubled lockout, got %v", d)
+			}
+
+			// A successful attempt resets failures but not the escalation level.
+			clock.advance(31 * time.Minute)
+			if err := l.Reset("k"); err != nil {
+				t.Fatalf("reset: %v", err)
+			}
+			if res := failN(t, l, "k", 5); res.State.Lockouts != 3 {
+				t.Fatalf("expected escalation to persist, got %+v", res)
+			}
+		})
+	}
+}
+
+func TestFailuresDecayAfterInactivity(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	for name, l := range limiters(t, clock) {
+		t.Run(name, func(t *testing.T) {
+			key := "decay-" + name
+			failN(t, l, key, 4)
+			clock.advance(31 * time.Minute)
+			if res := failN(t, l, key, 1); res.Locked || res.State.Failures != 1 {
+				t.Fatalf("expected counter reset after idle period, got %+v", res)
+			}
+		})
+	}
+}
+
+func TestUnlockAndList(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	for name, l := range limiters(t, clock) {
+		t.Run(name, func(t *testing.T) {
+			failN(t, l, "a", 5)
+			failN(t, l, "b", 1)
+			states, err := l.List()
+			if err != nil || len(states) != 2 {
+				t.Fatalf("expected two keys, got %v %v", states, err)
+			}
+			if err := l.Unlock("a"); err != nil {
+				t.Fatalf("unlock: %v", err)
+			}
+			if _, blocked, _ := l.Check("a"); blocked {
+				t.Fatalf("expected a to be unlocked")
+			}
+			if err := l.Unlock("missing"); err != ErrNotFound {
+				t.Fatalf("expected ErrNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLockoutCappedAtMax(t *testing.T) {
+	p := DefaultPolicy()
+	if got := p.lockoutFor(20); got != p.MaxLockout {
+		t.Fatalf("expected cap %v, got %v", p.MaxLockout, got)
+	}
+}
+
+func TestRequestPolicyDoesNotEscalate(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewMemoryLimiter(RequestPolicy())
+	l.now = clock.now
+	for round := 1; round <= 3; round++ {
+		res := failN(t, l, "k", 5)
+		if !res.Locked || res.State.BlockedUntil.Sub(clock.t) != 15*time.Minute {
+			t.Fatalf("round %d: expected a fixed 15m wait, got %+v", round, res)
+		}
+		clock.advance(15*time.Minute + time.Second)
+	}
+}
@@ -0,0 +1,105 @@
+// Package tracing sets up OpenTelemetry tracing. Spans are only exported when an OTLP
+// endpoint is configured; otherwise the global no-op provider is kept.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName is reported as service.name unless OTEL_SERVICE_NAME is set.
+const ServiceName = "updockly-api"
+
+const tracerName = "updockly/backend"
+
+// Setup installs a tracer provider exporting to endpoint over OTLP/HTTP and returns a
+// function flushing it on shutdown. With an empty endpoint nothing is exported. The
+// exporter and sampler also read the standard OTEL_* variables, such as
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_TRACES_SAMPLER.
+func Setup(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("build trace resource: %w", err)
+	}
+	// Merged last so OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win.
+	if env, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, env); err == nil {
+			res = merged
+		}
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, when set, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Steps traces the consecutive steps of an operation as child spans of the span in
+// the context it was created with; starting a step ends the previous one.
+type Steps struct {
+	parent  context.Context
+	current trace.Span
+}
+
+func NewSteps(ctx context.Context) *Steps {
+	return &Steps{parent: ctx}
+}
+
+// Next ends the current step and starts one named name, returning the context to run
+// it with.
+func (s *Steps) Next(name string) context.Context {
+	s.End(nil)
+	ctx, span := Start(s.parent, name)
+	s.current = span
+	return ctx
+}
+
+// End ends the current step, recording err on it.
+func (s *Steps) End(err error) {
+	if s.current != nil {
+		End(s.current, err)
+		s.current = nil
+	}
+}
+
+// TraceParent returns the W3C traceparent of the span in ctx, or an empty string when
+// it is not being traced.
+func TraceParent(ctx context.Context) string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
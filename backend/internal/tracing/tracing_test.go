@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestStepsAndTraceParent(t *testing.T) {
+	if TraceParent(context.Background()) != "" {
+		t.Fatalf("expected no traceparent without a span")
+	}
+	recorder := recordSpans(t)
+
+	ctx, span := Start(context.Background(), "container.update")
+	parent := TraceParent(ctx)
+	if !strings.HasPrefix(parent, "00-"+span.SpanContext().TraceID().String()) {
+		t.Fatalf("unexpected traceparent %q", parent)
+	}
+	steps := NewSteps(ctx)
+	steps.Next("pull")
+	steps.Next("start")
+	steps.End(errors.New("start failed"))
+	End(span, nil)
+
+	ended := recorder.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(ended))
+	}
+	pull, start := ended[0], ended[1]
+	if pull.Name() != "pull" || start.Name() != "start" {
+		t.Fatalf("unexpected step order: %s, %s", pull.Name(), start.Name())
+	}
+	if pull.Parent().SpanID() != span.SpanContext().SpanID() || start.Parent().SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("expected the steps to be children of the operation")
+	}
+	if pull.Status().Code == codes.Error || start.Status().Code != codes.Error {
+		t.Fatalf("expected only the failing step to be marked, got %v and %v", pull.Status(), start.Status())
+	}
+}
+
+func TestGormPluginTracesOnlyTracedContexts(t *testing.T) {
+	recorder := recordSpans(t)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.Use(GormPlugin{}); err != nil {
+		t.Fatalf("register plugin: %v", err)
+	}
+	type row struct{ ID int }
+	if err := db.AutoMigrate(&row{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	var rows []row
+	if err := db.Find(&rows).Error; err != nil {
+		t.Fatalf("untraced query: %v", err)
+	}
+	if n := len(recorder.Ended()); n != 0 {
+		t.Fatalf("expected no spans without a traced context, got %d", n)
+	}
+
+	ctx, span := Start(context.Background(), "request")
+	if err := db.WithContext(ctx).Find(&rows).Error; err != nil {
+		t.Fatalf("traced query: %v", err)
+	}
+	span.End()
+	ended := recorder.Ended()
+	if len(ended) != 2 || ended[0].Name() != "db.query" || ended[0].Parent().SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("expected a db.query child span, got %d spans", len(ended))
+	}
+}
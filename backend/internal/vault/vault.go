@@ -3,6 +3,7 @@ package vault
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
@@ -121,3 +122,16 @@ func (v *Vault) Decrypt(value string) (string, error) {
 	plain, _, err := v.DecryptWithInfo(value)
 	return plain, err
 }
+
+// MACKeys derives keys for signing data that is not encrypted, one per vault key with the
+// primary first: sign with the first and accept any, so signatures made before a key
+// rotation still verify. purpose keeps the keys of different uses apart.
+func (v *Vault) MACKeys(purpose string) [][]byte {
+	keys := make([][]byte, 0, len(v.fallbackKeys)+1)
+	for _, key := range append([][]byte{v.primaryKey}, v.fallbackKeys...) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(purpose))
+		keys = append(keys, mac.Sum(nil))
+	}
+	return keys
+}
@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -55,3 +56,14 @@ func TestVaultStableKey(t *testing.T) {
 		t.Fatalf("cross-instance decryption mismatch")
 	}
 }
+
+func TestVaultMACKeys(t *testing.T) {
+	rotated := NewVault("new-key", "old-key").MACKeys("audit")
+	old := NewVault("old-key").MACKeys("audit")
+	if len(rotated) != 2 || !bytes.Equal(rotated[1], old[0]) || bytes.Equal(rotated[0], old[0]) {
+		t.Fatalf("expected the old key to follow the new one after a rotation")
+	}
+	if bytes.Equal(old[0], NewVault("old-key").MACKeys("other")[0]) {
+		t.Fatalf("expected keys for different purposes to differ")
+	}
+}
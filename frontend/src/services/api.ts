@@ -52,13 +52,40 @@ export interface ApiUser {
   role: string;
   email?: string;
   twoFactorEnabled?: boolean;
+  webauthnEnabled?: boolean;
+  // Set while the password is past its maximum age: the session can only change it.
+  passwordExpired?: boolean;
+  // Set for admins who must register a security key before using Updockly.
+  webauthnEnrollmentRequired?: boolean;
 }
 
+export type SecondFactorMethod = "totp" | "webauthn";
+
 export interface LoginResponse {
   token?: string;
   user?: ApiUser;
   twoFactorRequired?: boolean;
   tempToken?: string;
+  methods?: SecondFactorMethod[];
+}
+
+// WebAuthnOptions are the options of a WebAuthn ceremony started by the server.
+export interface WebAuthnOptions {
+  sessionId: string;
+  options: { publicKey: Record<string, any> };
+}
+
+export interface SecurityKey {
+  id: string;
+  name: string;
+  credentialId: string;
+  attestationType: string;
+  transports?: string[];
+  backupEligible: boolean;
+  backupState: boolean;
+  lastUsedAt?: string;
+  lastUsedIp?: string;
+  createdAt: string;
 }
 
 export interface HealthResponse {
@@ -95,6 +122,9 @@ export interface UpdateHistory {
   containerName: string;
   image: string;
   imageDigest?: string;
+  previousImageId?: string;
+  previousDigest?: string;
+  newImageId?: string;
   agentId?: string;
   agentName?: string;
   source: string;
@@ -104,6 +134,28 @@ export interface UpdateHistory {
   updatedAt?: string;
 }
 
+export interface ResourcePoint {
+  time: string;
+  cpuPercent: number;
+  memoryBytes: number;
+  memoryLimit: number;
+  memoryPercent: number;
+  netRxBytesPerSec: number;
+  netTxBytesPerSec: number;
+  blockReadBytesPerSec: number;
+  blockWriteBytesPerSec: number;
+  containerId?: string;
+  samples: number;
+}
+
+export interface ResourceSeries {
+  agentId: string;
+  container: string;
+  resolution: number;
+  points: ResourcePoint[];
+  updates: UpdateHistory[];
+}
+
 export interface RunningHistoryEntry {
   id: string;
   date: string;
@@ -111,6 +163,31 @@ export interface RunningHistoryEntry {
   total: number;
 }
 
+export interface RunningRollupPoint {
+  start: string;
+  agentId?: string;
+  host?: string;
+  running: number;
+  total: number;
+  minRunning: number;
+  maxRunning: number;
+  samples: number;
+}
+
+export interface RunningSeries {
+  rollup: "hour" | "day" | "week";
+  points: RunningRollupPoint[];
+}
+
+export interface ContainerUptime {
+  agentId?: string;
+  host: string;
+  containerName: string;
+  runningSeconds: number;
+  observedSeconds: number;
+  availability: number;
+}
+
 export interface Schedule {
   ID: string;
   Name: string;
@@ -135,10 +212,67 @@ export interface Agent {
   cpu?: number;
   memory?: number;
   tokenBound?: boolean;
+  requireApproval?: boolean;
 }
 
 export type ApiAgent = Agent;
 
+export interface UpdateApproval {
+  id: string;
+  agentId: string;
+  agentName: string;
+  containerId: string;
+  containerName: string;
+  image: string;
+  digest?: string;
+  status:
+    | "pending"
+    | "approved"
+    | "rejected"
+    | "queued"
+    | "completed"
+    | "failed"
+    | "expired";
+  decidedBy?: string;
+  decidedAt?: string;
+  note?: string;
+  commandId?: string;
+  message?: string;
+  closedAt?: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface ConfigSnapshot {
+  id: string;
+  agentId?: string;
+  containerName: string;
+  containerId: string;
+  version: number;
+  image: string;
+  reason: "observed" | "update" | "rollback" | "restore" | "manual";
+  historyId?: string;
+  config?: Record<string, unknown>;
+  createdAt: string;
+}
+
+export interface ConfigChange {
+  kind: "added" | "removed" | "changed";
+  key?: string;
+  before?: string;
+  after?: string;
+}
+
+export interface ConfigDiff {
+  image?: ConfigChange;
+  env: ConfigChange[];
+  mounts: ConfigChange[];
+  ports: ConfigChange[];
+  labels: ConfigChange[];
+  restartPolicy?: ConfigChange;
+  networks: ConfigChange[];
+}
+
 export interface AgentWithToken extends Agent {
   token?: string;
 }
@@ -156,6 +290,29 @@ export interface AgentContainer {
   checkedAt?: string;
 }
 
+export interface Release {
+  tag: string;
+  name?: string;
+  body?: string;
+  url?: string;
+  prerelease?: boolean;
+  publishedAt?: string;
+}
+
+export interface ReleaseNotes {
+  containerName: string;
+  image: string;
+  currentVersion?: string;
+  currentRevision?: string;
+  version?: string;
+  revision?: string;
+  source?: string;
+  url?: string;
+  releases: Release[];
+  error?: string;
+  checkedAt: string;
+}
+
 export interface AgentCommand {
   id: string;
   agentId: string;
@@ -311,6 +468,57 @@ export const api = {
       body: JSON.stringify({ tempToken, code }),
     }),
 
+  beginSecurityKey2FA: (tempToken: string) =>
+    request<WebAuthnOptions>("/auth/2fa/webauthn/begin", {
+      method: "POST",
+      body: JSON.stringify({ tempToken }),
+    }),
+
+  verifySecurityKey2FA: (tempToken: string, sessionId: string, credential: unknown) =>
+    request<LoginResponse>("/auth/2fa/verify", {
+      method: "POST",
+      body: JSON.stringify({ tempToken, method: "webauthn", sessionId, credential }),
+    }),
+
+  beginPasskeyLogin: () =>
+    request<WebAuthnOptions>("/auth/webauthn/login/begin", { method: "POST" }, true),
+
+  finishPasskeyLogin: (sessionId: string, credential: unknown) =>
+    request<LoginResponse>(
+      "/auth/webauthn/login/finish",
+      {
+        method: "POST",
+        body: JSON.stringify({ sessionId, credential }),
+      },
+      true,
+    ),
+
+  listSecurityKeys: () =>
+    request<{ enabled: boolean; passwordless: boolean; credentials: SecurityKey[] }>(
+      "/2fa/webauthn/credentials",
+    ),
+
+  beginSecurityKeyRegistration: () =>
+    request<WebAuthnOptions>("/2fa/webauthn/register/begin", { method: "POST" }),
+
+  finishSecurityKeyRegistration: (sessionId: string, name: string, credential: unknown) =>
+    request<SecurityKey>("/2fa/webauthn/register/finish", {
+      method: "POST",
+      body: JSON.stringify({ sessionId, name, credential }),
+    }),
+
+  renameSecurityKey: (id: string, name: string) =>
+    request<{ message: string }>(`/2fa/webauthn/credentials/${id}`, {
+      method: "PUT",
+      body: JSON.stringify({ name }),
+    }),
+
+  deleteSecurityKey: (id: string, password: string) =>
+    request<{ message: string }>(`/2fa/webauthn/credentials/${id}`, {
+      method: "DELETE",
+      body: JSON.stringify({ password }),
+    }),
+
   resetPassword: (payload: { username: string; recoveryCode: string; newPassword: string }) =>
     request<LoginResponse>("/auth/reset-password", {
       method: "POST",
@@ -444,6 +652,13 @@ export const api = {
     request<{ message: string }>(`/containers/${id}/restart`, { method: "POST" }),
   getContainerLogs: (id: string, tail = 200) =>
     request<{ logs: string }>(`/containers/${id}/logs?tail=${tail}`),
+  getContainerReleaseNotes: (id: string, refresh = false) =>
+    request<ReleaseNotes>(
+      `/containers/${id}/release-notes${refresh ? "?refresh=true" : ""}`,
+      {},
+      false,
+      45000
+    ),
   rollbackContainer: (id: string, image: string, historyId?: string) =>
     request<{ message: string; newId?: string }>(`/containers/${id}/rollback`, {
       method: "POST",
@@ -458,6 +673,37 @@ export const api = {
   getUpdateHistory: (limit = 200) =>
     request<UpdateHistory[]>(`/history?limit=${limit}`),
   getRunningHistory: () => request<RunningHistoryEntry[]>(`/metrics/running-history`),
+  getRunningSeries: (
+    params: {
+      from?: string;
+      to?: string;
+      rollup?: "hour" | "day" | "week";
+      host?: string;
+      byHost?: boolean;
+    } = {}
+  ) => {
+    const query = new URLSearchParams();
+    Object.entries(params).forEach(([key, value]) => {
+      if (value) query.set(key, String(value));
+    });
+    const suffix = query.toString() ? `?${query}` : "";
+    return request<RunningSeries>(`/metrics/running${suffix}`);
+  },
+  getContainerUptime: (
+    params: {
+      from?: string;
+      to?: string;
+      host?: string;
+      container?: string;
+    } = {}
+  ) => {
+    const query = new URLSearchParams();
+    Object.entries(params).forEach(([key, value]) => {
+      if (value) query.set(key, value);
+    });
+    const suffix = query.toString() ? `?${query}` : "";
+    return request<ContainerUptime[]>(`/metrics/uptime${suffix}`);
+  },
 
   getSetupStatus: () =>
     request<{ needsSetup: boolean }>("/auth/setup/status", {}, true, 500),
@@ -510,18 +756,68 @@ export const api = {
     }),
 
   getAgents: () => request<ApiAgent[]>("/agents"),
-  createAgent: (payload: { name: string; hostname?: string; notes?: string; tlsEnabled?: boolean }) =>
+  createAgent: (payload: {
+    name: string;
+    hostname?: string;
+    notes?: string;
+    tlsEnabled?: boolean;
+    requireApproval?: boolean;
+  }) =>
     request<AgentWithToken>("/agents", {
       method: "POST",
       body: JSON.stringify(payload),
     }),
   rotateAgentToken: (id: string) =>
     request<AgentWithToken>(`/agents/${id}/rotate-token`, { method: "POST" }),
-  updateAgent: (id: string, payload: { name: string; hostname?: string; notes?: string; tlsEnabled?: boolean }) =>
+  updateAgent: (
+    id: string,
+    payload: {
+      name: string;
+      hostname?: string;
+      notes?: string;
+      tlsEnabled?: boolean;
+      requireApproval?: boolean;
+    }
+  ) =>
     request<Agent>(`/agents/${id}`, {
       method: "PUT",
       body: JSON.stringify(payload),
     }),
+  getUpdateApprovals: (open = true) =>
+    request<UpdateApproval[]>(`/update-approvals${open ? "?open=true" : ""}`),
+  approveUpdate: (id: string, note = "") =>
+    request<UpdateApproval>(`/update-approvals/${id}/approve`, {
+      method: "POST",
+      body: JSON.stringify({ note }),
+    }),
+  rejectUpdate: (id: string, note = "") =>
+    request<UpdateApproval>(`/update-approvals/${id}/reject`, {
+      method: "POST",
+      body: JSON.stringify({ note }),
+    }),
+  getConfigSnapshots: (containerName: string, agentId = "") =>
+    request<ConfigSnapshot[]>(
+      `/config-snapshots?container=${encodeURIComponent(
+        containerName
+      )}&agentId=${encodeURIComponent(agentId)}`
+    ),
+  diffConfigSnapshots: (from: string, to: string) =>
+    request<{
+      from: ConfigSnapshot;
+      to: ConfigSnapshot;
+      changed: boolean;
+      diff: ConfigDiff;
+    }>(`/config-snapshots/diff?from=${from}&to=${to}`),
+  captureConfigSnapshot: (containerId: string) =>
+    request<ConfigSnapshot>(`/config-snapshots`, {
+      method: "POST",
+      body: JSON.stringify({ containerId }),
+    }),
+  restoreConfigSnapshot: (id: string) =>
+    request<{ message: string; newId?: string; commandId?: string }>(
+      `/config-snapshots/${id}/restore`,
+      { method: "POST" }
+    ),
   toggleAgentContainerAutoUpdate: (
     agentId: string,
     containerId: string,
@@ -560,6 +856,30 @@ export const api = {
     request<{ logs?: string; message?: string }>(
       `/agents/${agentId}/containers/${containerId}/logs?tail=${tail}`
     ),
+  getAgentContainerReleaseNotes: (
+    agentId: string,
+    containerId: string,
+    refresh = false
+  ) =>
+    request<ReleaseNotes>(
+      `/agents/${agentId}/containers/${containerId}/release-notes${
+        refresh ? "?refresh=true" : ""
+      }`,
+      {},
+      false,
+      45000
+    ),
+  getAgentStats: (
+    agentId: string,
+    params: { container?: string; from?: string; to?: string } = {}
+  ) => {
+    const query = new URLSearchParams();
+    Object.entries(params).forEach(([key, value]) => {
+      if (value) query.set(key, value);
+    });
+    const suffix = query.toString() ? `?${query}` : "";
+    return request<ResourceSeries>(`/agents/${agentId}/stats${suffix}`);
+  },
   createAgentCommand: (id: string, type: string, containerId: string) =>
     request<AgentCommand>(`/agents/${id}/commands`, {
       method: "POST",
@@ -594,7 +914,10 @@ export const api = {
   },
 
   getPublicConfig: () =>
-    request<{ sso: { enabled: boolean; provider: string } }>("/auth/config", {}, true),
+    request<{
+      sso: { enabled: boolean; provider: string };
+      webauthn?: { enabled: boolean; passwordless: boolean };
+    }>("/auth/config", {}, true),
 };
 
 interface loginRequest {
@@ -0,0 +1,90 @@
+// The server sends WebAuthn options as JSON with binary fields encoded as
+// base64url and expects credentials back in the same encoding.
+
+type JsonOptions = { publicKey: Record<string, any> };
+
+export const webauthnSupported = () =>
+  typeof window !== "undefined" &&
+  typeof window.PublicKeyCredential !== "undefined" &&
+  Boolean(navigator.credentials);
+
+const toBuffer = (value: string): ArrayBuffer => {
+  const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+  const padded = base64 + "=".repeat((4 - (base64.length % 4)) % 4);
+  const binary = atob(padded);
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes.buffer;
+};
+
+const fromBuffer = (value: ArrayBuffer | null | undefined): string => {
+  if (!value) return "";
+  const bytes = new Uint8Array(value);
+  let binary = "";
+  for (const byte of bytes) {
+    binary += String.fromCharCode(byte);
+  }
+  return btoa(binary)
+    .replace(/\+/g, "-")
+    .replace(/\//g, "_")
+    .replace(/=+$/, "");
+};
+
+const decodeDescriptors = (list?: Array<Record<string, any>>) =>
+  list?.map((descriptor) => ({ ...descriptor, id: toBuffer(descriptor.id) }));
+
+// createCredential runs the registration ceremony for a new security key.
+export const createCredential = async (options: JsonOptions) => {
+  const publicKey = options.publicKey;
+  const credential = (await navigator.credentials.create({
+    publicKey: {
+      ...publicKey,
+      challenge: toBuffer(publicKey.challenge),
+      user: { ...publicKey.user, id: toBuffer(publicKey.user.id) },
+      excludeCredentials: decodeDescriptors(publicKey.excludeCredentials),
+    } as PublicKeyCredentialCreationOptions,
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error("Security key registration was cancelled");
+  }
+  const response = credential.response as AuthenticatorAttestationResponse;
+  return {
+    id: credential.id,
+    rawId: fromBuffer(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: fromBuffer(response.clientDataJSON),
+      attestationObject: fromBuffer(response.attestationObject),
+      transports: response.getTransports?.() ?? [],
+    },
+  };
+};
+
+// getAssertion asks a registered security key to sign the server's challenge.
+export const getAssertion = async (options: JsonOptions) => {
+  const publicKey = options.publicKey;
+  const credential = (await navigator.credentials.get({
+    publicKey: {
+      ...publicKey,
+      challenge: toBuffer(publicKey.challenge),
+      allowCredentials: decodeDescriptors(publicKey.allowCredentials),
+    } as PublicKeyCredentialRequestOptions,
+  })) as PublicKeyCredential | null;
+  if (!credential) {
+    throw new Error("Security key verification was cancelled");
+  }
+  const response = credential.response as AuthenticatorAssertionResponse;
+  return {
+    id: credential.id,
+    rawId: fromBuffer(credential.rawId),
+    type: credential.type,
+    response: {
+      clientDataJSON: fromBuffer(response.clientDataJSON),
+      authenticatorData: fromBuffer(response.authenticatorData),
+      signature: fromBuffer(response.signature),
+      userHandle: fromBuffer(response.userHandle),
+    },
+  };
+};
@@ -61,6 +61,7 @@ export interface SMTPSettingsState {
   password: string;
   from: string;
   tls: boolean;
+  security: "" | "starttls" | "tls" | "none";
   enabled: boolean;
 }
 
@@ -73,6 +74,13 @@ export interface NotificationSettingsState {
   recapTime: string;
   notificationCron: string;
   smtp: SMTPSettingsState;
+  updateDigest: DigestSettingsState;
+}
+
+export interface DigestSettingsState {
+  frequency: "" | "daily" | "weekly";
+  time: string;
+  weekday: string;
 }
 
 export interface SSOSettingsState {
@@ -88,6 +96,7 @@ export interface SettingsFormState {
   databaseUrl: string;
   clientOrigin: string;
   timezone: string;
+  logLevel: string;
   jwtSecret?: string;
   vaultKey?: string;
   recoveryCodes?: string[];
@@ -6,14 +6,18 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/distribution/reference"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
@@ -21,6 +25,15 @@ import (
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type heartbeatPayload struct {
@@ -31,6 +44,22 @@ type heartbeatPayload struct {
 	Containers    []containerSnapshot `json:"containers,omitempty"`
 	CPU           float64             `json:"cpu,omitempty"`
 	Memory        float64             `json:"memory,omitempty"`
+	Stats         []containerStats    `json:"stats,omitempty"`
+}
+
+// containerStats is one reading of a running container's resource usage. CPU is a
+// percentage of one core; the network and block IO fields are cumulative byte counters
+// since the container started.
+type containerStats struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	CPU         float64 `json:"cpu"`
+	MemoryBytes int64   `json:"memoryBytes"`
+	MemoryLimit int64   `json:"memoryLimit"`
+	NetRxBytes  int64   `json:"netRxBytes"`
+	NetTxBytes  int64   `json:"netTxBytes"`
+	BlockRead   int64   `json:"blockReadBytes"`
+	BlockWrite  int64   `json:"blockWriteBytes"`
 }
 
 type containerSnapshot struct {
@@ -45,10 +74,44 @@ type containerSnapshot struct {
 	Labels          []string `json:"labels,omitempty"`
 }
 
+// configSnapshot is the part of a container inspect needed to create it again. The
+// server keeps it with the update history and sends it back with a rollback.
+type configSnapshot struct {
+	Name       string                               `json:"name"`
+	Config     *container.Config                    `json:"config"`
+	HostConfig *container.HostConfig                `json:"hostConfig"`
+	Networks   map[string]*network.EndpointSettings `json:"networks,omitempty"`
+}
+
+// provenance records the images a container ran before and after an update or
+// rollback, by ID and repo digest, and its config before and after.
+type provenance struct {
+	PreviousImageID string
+	PreviousDigest  string
+	NewImageID      string
+	NewDigest       string
+	Config          configSnapshot
+	NewConfig       configSnapshot
+}
+
+func (p provenance) addTo(result map[string]interface{}) {
+	result["previousImageId"] = p.PreviousImageID
+	result["previousDigest"] = p.PreviousDigest
+	result["newImageId"] = p.NewImageID
+	result["newDigest"] = p.NewDigest
+	if p.Config.Config != nil {
+		result["config"] = p.Config
+	}
+	if p.NewConfig.Config != nil {
+		result["newConfig"] = p.NewConfig
+	}
+}
+
 type agentCommand struct {
-	ID      string                 `json:"id"`
-	Type    string                 `json:"type"`
-	Payload map[string]interface{} `json:"payload"`
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	Payload     map[string]interface{} `json:"payload"`
+	TraceParent string                 `json:"traceParent"`
 }
 
 func main() {
@@ -60,8 +123,10 @@ func main() {
 		userAgent  = "updockly-agent/0.1.0"
 		dockerHost = os.Getenv("DOCKER_HOST")
 		debug      = strings.EqualFold(envOrDefault("UPDOCKLY_DEBUG", "false"), "true")
+		logFormat  = envOrDefault("UPDOCKLY_LOG_FORMAT", "text")
 		cmdPoll    = envOrDefaultDuration("UPDOCKLY_COMMAND_POLL", 5*time.Second)
 		caCertPath = envOrDefault("UPDOCKLY_CA_CERT", "")
+		noStats    = strings.EqualFold(envOrDefault("UPDOCKLY_COLLECT_STATS", "true"), "false")
 	)
 
 	flag.StringVar(&serverURL, "server", serverURL, "Updockly server URL (e.g. https://updockly.example.com)")
@@ -69,16 +134,24 @@ func main() {
 	flag.DurationVar(&interval, "interval", interval, "Heartbeat interval")
 	flag.StringVar(&agentName, "name", agentName, "Agent name override (sent as hostname if provided)")
 	flag.StringVar(&caCertPath, "ca-cert", caCertPath, "Path to trusted CA certificate file")
+	flag.StringVar(&logFormat, "log-format", logFormat, "Log format: text or json")
 	flag.Parse()
 
+	slog.SetDefault(newLogger(logFormat, debug))
+
 	if serverURL == "" || token == "" {
-		fmt.Println("UPDOCKLY_SERVER and UPDOCKLY_AGENT_TOKEN are required")
+		slog.Error("UPDOCKLY_SERVER and UPDOCKLY_AGENT_TOKEN are required")
+		os.Exit(1)
+	}
+
+	if err := setupTracing(context.Background(), envOrDefault("OTEL_EXPORTER_OTLP_ENDPOINT", ""), userAgent); err != nil {
+		slog.Error("failed to set up tracing", "error", err)
 		os.Exit(1)
 	}
 
 	httpClient, err := createHTTPClient(caCertPath)
 	if err != nil {
-		fmt.Printf("failed to create http client: %v\n", err)
+		slog.Error("failed to create http client", "error", err)
 		os.Exit(1)
 	}
 
@@ -87,14 +160,14 @@ func main() {
 	commandBase := serverURL + "/api/agents"
 
 	for {
-		payload := gatherDockerInfo(agentName, dockerHost, userAgent)
+		payload := gatherDockerInfo(agentName, dockerHost, userAgent, !noStats)
 		if err := sendHeartbeat(httpClient, endpoint, token, payload, userAgent); err != nil {
-			fmt.Printf("heartbeat error: %v\n", err)
+			slog.Warn("heartbeat failed", "error", err)
 		}
 		deadline := time.Now().Add(interval)
 		for {
-			if err := processCommands(httpClient, commandBase, token, dockerHost, userAgent, debug); err != nil {
-				fmt.Printf("command processing error: %v\n", err)
+			if err := processCommands(httpClient, commandBase, token, dockerHost, userAgent); err != nil {
+				slog.Warn("command processing failed", "error", err)
 			}
 			if time.Now().After(deadline) {
 				break
@@ -108,6 +181,19 @@ func main() {
 	}
 }
 
+// newLogger builds the agent logger: text by default, JSON when format is "json" so
+// log collectors can parse the command_id and container_id fields.
+func newLogger(format string, debug bool) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if debug {
+		opts.Level = slog.LevelDebug
+	}
+	if strings.EqualFold(strings.TrimSpace(format), "json") {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
+
 func createHTTPClient(caCertPath string) (*http.Client, error) {
 	if caCertPath == "" {
 		return &http.Client{Timeout: 10 * time.Second}, nil
@@ -133,7 +219,7 @@ func createHTTPClient(caCertPath string) (*http.Client, error) {
 	}, nil
 }
 
-func gatherDockerInfo(agentName, dockerHost, userAgent string) heartbeatPayload {
+func gatherDockerInfo(agentName, dockerHost, userAgent string, withStats bool) heartbeatPayload {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -221,11 +307,101 @@ func gatherDockerInfo(agentName, dockerHost, userAgent string) heartbeatPayload
 			})
 		}
 		payload.Containers = list
+		if withStats {
+			payload.Stats = gatherContainerStats(cli, containers)
+		}
 	}
 
 	return payload
 }
 
+// gatherContainerStats reads the stats of the running containers, a few at a time. Each
+// read takes about a second because Docker samples CPU twice.
+func gatherContainerStats(cli *client.Client, containers []container.Summary) []containerStats {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		stats []containerStats
+		slots = make(chan struct{}, 4)
+	)
+	for _, c := range containers {
+		if c.State != "running" {
+			continue
+		}
+		name := c.ID
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		wg.Add(1)
+		go func(id, name string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			st, err := readContainerStats(ctx, cli, id)
+			if err != nil {
+				return
+			}
+			st.ID, st.Name = id, name
+			mu.Lock()
+			stats = append(stats, st)
+			mu.Unlock()
+		}(c.ID, name)
+	}
+	wg.Wait()
+	return stats
+}
+
+func readContainerStats(ctx context.Context, cli *client.Client, containerID string) (containerStats, error) {
+	var st containerStats
+	resp, err := cli.ContainerStats(ctx, containerID, false)
+	if err != nil {
+		return st, err
+	}
+	defer resp.Body.Close()
+	var raw container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return st, err
+	}
+
+	// Same as docker stats: the container's share of the host's CPU time, scaled to
+	// the number of CPUs, and memory without the inactive page cache.
+	cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+	cpus := float64(raw.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		st.CPU = cpuDelta / systemDelta * cpus * 100
+	}
+	usage := raw.MemoryStats.Usage
+	cache := raw.MemoryStats.Stats["inactive_file"]
+	if cache == 0 {
+		cache = raw.MemoryStats.Stats["total_inactive_file"]
+	}
+	if cache < usage {
+		usage -= cache
+	}
+	st.MemoryBytes = int64(usage)
+	st.MemoryLimit = int64(raw.MemoryStats.Limit)
+	for _, n := range raw.Networks {
+		st.NetRxBytes += int64(n.RxBytes)
+		st.NetTxBytes += int64(n.TxBytes)
+	}
+	for _, entry := range raw.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			st.BlockRead += int64(entry.Value)
+		case "write":
+			st.BlockWrite += int64(entry.Value)
+		}
+	}
+	return st, nil
+}
+
 func sendHeartbeat(client *http.Client, endpoint, token string, payload heartbeatPayload, userAgent string) error {
 	body, err := json.Marshal(payload)
 	if err != nil {
@@ -268,9 +444,9 @@ func envOrDefaultDuration(key string, def time.Duration) time.Duration {
 	return def
 }
 
-func processCommands(client *http.Client, baseURL, token, dockerHost, userAgent string, debug bool) error {
+func processCommands(client *http.Client, baseURL, token, dockerHost, userAgent string) error {
 	for {
-		cmd, err := fetchNextCommand(client, baseURL, token, userAgent, debug)
+		cmd, err := fetchNextCommand(client, baseURL, token, userAgent)
 		if err != nil {
 			return err
 		}
@@ -278,87 +454,104 @@ func processCommands(client *http.Client, baseURL, token, dockerHost, userAgent
 			return nil
 		}
 
-		cid := containerIDFromPayload(cmd.Payload)
-		if cid == "" {
-			_ = reportCommand(client, baseURL, token, cmd.ID, "error", nil, "missing containerId", debug)
+		log := slog.With("command_id", cmd.ID, "command", cmd.Type, "container_id", containerIDFromPayload(cmd.Payload))
+		log.Debug("received command", "payload", cmd.Payload)
+		start := time.Now()
+		ctx, span := startCommandSpan(*cmd)
+		result, err := runCommand(ctx, *cmd, dockerHost, userAgent)
+		endSpan(span, err)
+		if err != nil {
+			log.Warn("command failed", "duration_ms", time.Since(start).Milliseconds(), "error", err)
+			if err := reportCommand(client, baseURL, token, cmd.ID, "error", nil, err.Error()); err != nil {
+				log.Warn("reporting command failed", "error", err)
+			}
 			continue
 		}
+		log.Info("command completed", "duration_ms", time.Since(start).Milliseconds())
+		if err := reportCommand(client, baseURL, token, cmd.ID, "completed", result, ""); err != nil {
+			return err
+		}
+	}
+}
 
-		switch cmd.Type {
-		case "check-update":
-			available, err := runCheckUpdate(dockerHost, userAgent, cid)
-			if err != nil {
-				_ = reportCommand(client, baseURL, token, cmd.ID, "error", nil, err.Error(), debug)
-				continue
-			}
-			result := map[string]interface{}{
-				"containerId":     cid,
-				"updateAvailable": available,
-			}
-			if err := reportCommand(client, baseURL, token, cmd.ID, "completed", result, "", debug); err != nil {
-				return err
-			}
-		case "update-container":
-			snapshot, err := runUpdateContainer(dockerHost, userAgent, cid)
-			if err != nil {
-				_ = reportCommand(client, baseURL, token, cmd.ID, "error", nil, err.Error(), debug)
-				continue
-			}
-			result := map[string]interface{}{
-				"containerId": cid,
-				"container":   snapshot,
-			}
-			if err := reportCommand(client, baseURL, token, cmd.ID, "completed", result, "", debug); err != nil {
-				return err
-			}
-		case "rollback-container":
-			targetImage := ""
-			if v, ok := cmd.Payload["image"].(string); ok {
-				targetImage = strings.TrimSpace(v)
-			}
-			if targetImage == "" {
-				_ = reportCommand(client, baseURL, token, cmd.ID, "error", nil, "missing target image", debug)
-				continue
-			}
-			snapshot, err := runRollbackContainer(dockerHost, userAgent, cid, targetImage)
-			if err != nil {
-				_ = reportCommand(client, baseURL, token, cmd.ID, "error", nil, err.Error(), debug)
-				continue
-			}
-			result := map[string]interface{}{
-				"containerId": cid,
-				"container":   snapshot,
-				"image":       targetImage,
-			}
-			if err := reportCommand(client, baseURL, token, cmd.ID, "completed", result, "", debug); err != nil {
-				return err
-			}
-		case "fetch-logs":
-			tail := 200
-			if v, ok := cmd.Payload["tail"].(float64); ok {
-				if v > 0 && v <= 2000 {
-					tail = int(v)
-				}
-			}
-			logs, err := runFetchLogs(dockerHost, userAgent, cid, tail)
-			if err != nil {
-				_ = reportCommand(client, baseURL, token, cmd.ID, "error", nil, err.Error(), debug)
-				continue
-			}
-			result := map[string]interface{}{
-				"containerId": cid,
-				"logs":        logs,
-			}
-			if err := reportCommand(client, baseURL, token, cmd.ID, "completed", result, "", debug); err != nil {
-				return err
+// runCommand runs one command and returns the result to report.
+func runCommand(ctx context.Context, cmd agentCommand, dockerHost, userAgent string) (map[string]interface{}, error) {
+	cid := containerIDFromPayload(cmd.Payload)
+	if cid == "" {
+		return nil, errors.New("missing containerId")
+	}
+
+	switch cmd.Type {
+	case "check-update":
+		available, digest, err := runCheckUpdate(ctx, dockerHost, userAgent, cid)
+		if err != nil {
+			return nil, err
+		}
+		result := map[string]interface{}{
+			"containerId":     cid,
+			"updateAvailable": available,
+		}
+		if available && digest != "" {
+			result["availableDigest"] = digest
+		}
+		return result, nil
+	case "update-container":
+		digest, _ := cmd.Payload["digest"].(string)
+		snapshot, prov, err := runUpdateContainer(ctx, dockerHost, userAgent, cid, strings.TrimSpace(digest))
+		if err != nil {
+			return nil, err
+		}
+		result := map[string]interface{}{
+			"containerId": cid,
+			"container":   snapshot,
+		}
+		prov.addTo(result)
+		return result, nil
+	case "rollback-container":
+		targetImage := ""
+		if v, ok := cmd.Payload["image"].(string); ok {
+			targetImage = strings.TrimSpace(v)
+		}
+		if targetImage == "" {
+			return nil, errors.New("missing target image")
+		}
+		name, _ := cmd.Payload["name"].(string)
+		cfg, err := configFromPayload(cmd.Payload)
+		if err != nil {
+			return nil, err
+		}
+		snapshot, prov, err := runRollbackContainer(ctx, dockerHost, userAgent, cid, strings.TrimSpace(name), targetImage, cfg)
+		if err != nil {
+			return nil, err
+		}
+		result := map[string]interface{}{
+			"containerId": cid,
+			"container":   snapshot,
+			"image":       targetImage,
+		}
+		prov.addTo(result)
+		return result, nil
+	case "fetch-logs":
+		tail := 200
+		if v, ok := cmd.Payload["tail"].(float64); ok {
+			if v > 0 && v <= 2000 {
+				tail = int(v)
 			}
-		default:
-			_ = reportCommand(client, baseURL, token, cmd.ID, "error", nil, "unsupported command type", debug)
 		}
+		logs, err := runFetchLogs(ctx, dockerHost, userAgent, cid, tail)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"containerId": cid,
+			"logs":        logs,
+		}, nil
+	default:
+		return nil, errors.New("unsupported command type")
 	}
 }
 
-func fetchNextCommand(client *http.Client, baseURL, token, userAgent string, debug bool) (*agentCommand, error) {
+func fetchNextCommand(client *http.Client, baseURL, token, userAgent string) (*agentCommand, error) {
 	req, err := http.NewRequest(http.MethodGet, baseURL+"/commands/next", nil)
 	if err != nil {
 		return nil, err
@@ -383,13 +576,10 @@ func fetchNextCommand(client *http.Client, baseURL, token, userAgent string, deb
 	if err := json.NewDecoder(resp.Body).Decode(&cmd); err != nil {
 		return nil, err
 	}
-	if debug {
-		fmt.Printf("%s debug: received command %+v\n", time.Now().Format("2006/01/02 - 15:04:05"), cmd)
-	}
 	return &cmd, nil
 }
 
-func reportCommand(client *http.Client, baseURL, token, id, status string, result map[string]interface{}, errMsg string, debug bool) error {
+func reportCommand(client *http.Client, baseURL, token, id, status string, result map[string]interface{}, errMsg string) error {
 	payload := map[string]interface{}{
 		"status": status,
 	}
@@ -399,9 +589,7 @@ func reportCommand(client *http.Client, baseURL, token, id, status string, resul
 	if errMsg != "" {
 		payload["error"] = errMsg
 	}
-	if debug {
-		fmt.Printf("%s debug: reporting command %s status=%s result=%v error=%s\n", time.Now().Format("2006/01/02 - 15:04:05"), id, status, result, errMsg)
-	}
+	slog.Debug("reporting command", "command_id", id, "status", status, "result", result, "error", errMsg)
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return err
@@ -435,30 +623,51 @@ func containerIDFromPayload(payload map[string]interface{}) string {
 	return ""
 }
 
-func runCheckUpdate(dockerHost, userAgent, containerID string) (bool, error) {
+// configFromPayload reads the config snapshot sent with a rollback; it is nil when the
+// server has none and the container keeps its current config.
+func configFromPayload(payload map[string]interface{}) (*configSnapshot, error) {
+	raw, ok := payload["config"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config snapshot: %w", err)
+	}
+	var cfg configSnapshot
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config snapshot: %w", err)
+	}
+	if cfg.Config == nil || cfg.HostConfig == nil {
+		return nil, fmt.Errorf("invalid config snapshot: incomplete")
+	}
+	return &cfg, nil
+}
+
+func runCheckUpdate(ctx context.Context, dockerHost, userAgent, containerID string) (bool, string, error) {
 	cli, err := newDockerClient(dockerHost, userAgent)
 	if err != nil {
-		return false, err
+		return false, "", err
 	}
 	defer cli.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
 
 	return isUpdateAvailableLocal(ctx, cli, containerID)
 }
 
-func runUpdateContainer(dockerHost, userAgent, containerID string) (containerSnapshot, error) {
+func runUpdateContainer(ctx context.Context, dockerHost, userAgent, containerID, digest string) (containerSnapshot, provenance, error) {
 	cli, err := newDockerClient(dockerHost, userAgent)
 	if err != nil {
-		return containerSnapshot{}, err
+		return containerSnapshot{}, provenance{}, err
 	}
 	defer cli.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	return updateContainerLocal(ctx, cli, containerID)
+	return updateContainerLocal(ctx, cli, containerID, digest)
 }
 
 func newDockerClient(dockerHost, userAgent string) (*client.Client, error) {
@@ -473,51 +682,81 @@ func newDockerClient(dockerHost, userAgent string) (*client.Client, error) {
 	return client.NewClientWithOpts(opts...)
 }
 
-func isUpdateAvailableLocal(ctx context.Context, cli *client.Client, containerID string) (bool, error) {
+// isUpdateAvailableLocal reports whether the registry has another image for the tag a
+// container runs and, if so, that image as a digest reference in the tag's repository.
+func isUpdateAvailableLocal(ctx context.Context, cli *client.Client, containerID string) (bool, string, error) {
 	containerInfo, err := cli.ContainerInspect(ctx, containerID)
 	if err != nil {
-		return false, fmt.Errorf("inspect container %s: %w", containerID, err)
+		return false, "", fmt.Errorf("inspect container %s: %w", containerID, err)
 	}
 
 	localImageInfo, err := cli.ImageInspect(ctx, containerInfo.Image)
 	if err != nil {
-		return false, fmt.Errorf("inspect local image %s: %w", containerInfo.Image, err)
+		return false, "", fmt.Errorf("inspect local image %s: %w", containerInfo.Image, err)
 	}
 
 	dist, err := cli.DistributionInspect(ctx, containerInfo.Config.Image, "")
 	if err != nil {
-		return false, fmt.Errorf("distribution inspect %s: %w", containerInfo.Config.Image, err)
+		return false, "", fmt.Errorf("distribution inspect %s: %w", containerInfo.Config.Image, err)
 	}
 
 	remoteDigest := dist.Descriptor.Digest.String()
 	for _, localDigest := range localImageInfo.RepoDigests {
 		if strings.Contains(localDigest, remoteDigest) {
-			return false, nil
+			return false, "", nil
 		}
 	}
-	return true, nil
+	pinned := ""
+	if named, err := reference.ParseNormalizedNamed(containerInfo.Config.Image); err == nil {
+		pinned = reference.FamiliarName(named) + "@" + remoteDigest
+	}
+	return true, pinned, nil
 }
 
-func updateContainerLocal(ctx context.Context, cli *client.Client, containerID string) (containerSnapshot, error) {
+// updateContainerLocal recreates a container with the latest image of its tag, or with
+// digest when the server pinned the update to the image that was approved.
+func updateContainerLocal(ctx context.Context, cli *client.Client, containerID, digest string) (_ containerSnapshot, prov provenance, err error) {
+	steps := &traceSteps{parent: ctx}
+	defer func() { steps.end(err) }()
+
 	containerInfo, err := cli.ContainerInspect(ctx, containerID)
 	if err != nil {
-		return containerSnapshot{}, fmt.Errorf("inspect container %s: %w", containerID, err)
+		return containerSnapshot{}, prov, fmt.Errorf("inspect container %s: %w", containerID, err)
 	}
+	prov.PreviousImageID, prov.PreviousDigest = imageProvenance(ctx, cli, containerInfo.Image, containerInfo.Config.Image)
+	prov.Config = snapshotConfig(containerInfo)
 
-	out, err := cli.ImagePull(ctx, containerInfo.Config.Image, image.PullOptions{})
+	pullRef := containerInfo.Config.Image
+	if digest != "" {
+		if pullRef, err = pinnedUpdateImage(containerInfo.Config.Image, digest); err != nil {
+			return containerSnapshot{}, prov, err
+		}
+	}
+
+	ctx = steps.next("agent.update.pull")
+	out, err := cli.ImagePull(ctx, pullRef, image.PullOptions{})
 	if err != nil {
-		return containerSnapshot{}, fmt.Errorf("pull image %s: %w", containerInfo.Config.Image, err)
+		return containerSnapshot{}, prov, fmt.Errorf("pull image %s: %w", pullRef, err)
 	}
 	defer out.Close()
 	// Drain output to avoid blocking
 	_, _ = io.Copy(io.Discard, out)
+	// The container keeps running the tag, so the tag is moved to the pinned image.
+	if pullRef != containerInfo.Config.Image {
+		if err := cli.ImageTag(ctx, pullRef, containerInfo.Config.Image); err != nil {
+			return containerSnapshot{}, prov, fmt.Errorf("tag image %s as %s: %w", pullRef, containerInfo.Config.Image, err)
+		}
+	}
+	prov.NewImageID, prov.NewDigest = imageProvenance(ctx, cli, containerInfo.Config.Image, containerInfo.Config.Image)
 
+	ctx = steps.next("agent.update.stop")
 	if err := cli.ContainerStop(ctx, containerID, container.StopOptions{}); err != nil {
-		return containerSnapshot{}, fmt.Errorf("stop container %s: %w", containerID, err)
+		return containerSnapshot{}, prov, fmt.Errorf("stop container %s: %w", containerID, err)
 	}
 
+	ctx = steps.next("agent.update.remove")
 	if err := cli.ContainerRemove(ctx, containerID, container.RemoveOptions{RemoveVolumes: true, Force: true}); err != nil {
-		return containerSnapshot{}, fmt.Errorf("remove container %s: %w", containerID, err)
+		return containerSnapshot{}, prov, fmt.Errorf("remove container %s: %w", containerID, err)
 	}
 
 	networkingConfig := &network.NetworkingConfig{EndpointsConfig: make(map[string]*network.EndpointSettings)}
@@ -525,64 +764,162 @@ func updateContainerLocal(ctx context.Context, cli *client.Client, containerID s
 		networkingConfig.EndpointsConfig[netName] = endpoint
 	}
 
+	ctx = steps.next("agent.update.recreate")
 	resp, err := cli.ContainerCreate(ctx, containerInfo.Config, containerInfo.HostConfig, networkingConfig, nil, containerInfo.Name)
 	if err != nil {
-		return containerSnapshot{}, fmt.Errorf("recreate container %s: %w", containerInfo.Name, err)
+		return containerSnapshot{}, prov, fmt.Errorf("recreate container %s: %w", containerInfo.Name, err)
 	}
 
+	ctx = steps.next("agent.update.start")
 	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return containerSnapshot{}, fmt.Errorf("start new container %s: %w", resp.ID, err)
+		return containerSnapshot{}, prov, fmt.Errorf("start new container %s: %w", resp.ID, err)
+	}
+	if info, err := cli.ContainerInspect(ctx, resp.ID); err == nil {
+		prov.NewConfig = snapshotConfig(info)
 	}
 
-	return snapshotContainer(ctx, cli, resp.ID), nil
+	return snapshotContainer(ctx, cli, resp.ID), prov, nil
 }
 
-func runRollbackContainer(dockerHost, userAgent, containerID, targetImage string) (containerSnapshot, error) {
+// runRollbackContainer recreates a container from targetImage, with cfg when the server
+// sent the config from before the update. The container is looked up by name when the
+// ID recorded in history has since been replaced.
+func runRollbackContainer(ctx context.Context, dockerHost, userAgent, containerID, name, targetImage string, cfg *configSnapshot) (containerSnapshot, provenance, error) {
+	var prov provenance
 	cli, err := newDockerClient(dockerHost, userAgent)
 	if err != nil {
-		return containerSnapshot{}, err
+		return containerSnapshot{}, prov, err
 	}
 	defer cli.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
 	containerInfo, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil && name != "" {
+		containerInfo, err = cli.ContainerInspect(ctx, name)
+	}
 	if err != nil {
-		return containerSnapshot{}, fmt.Errorf("inspect container %s: %w", containerID, err)
+		return containerSnapshot{}, prov, fmt.Errorf("inspect container %s: %w", containerID, err)
 	}
+	containerID = containerInfo.ID
+	prov.PreviousImageID, prov.PreviousDigest = imageProvenance(ctx, cli, containerInfo.Image, containerInfo.Config.Image)
+	prov.Config = snapshotConfig(containerInfo)
 
-	out, err := cli.ImagePull(ctx, targetImage, image.PullOptions{})
-	if err != nil {
-		return containerSnapshot{}, fmt.Errorf("pull image %s: %w", targetImage, err)
+	config, hostConfig := containerInfo.Config, containerInfo.HostConfig
+	networks := containerInfo.NetworkSettings.Networks
+	if cfg != nil {
+		config, hostConfig, networks = cfg.Config, cfg.HostConfig, cfg.Networks
 	}
-	defer out.Close()
-	_, _ = io.Copy(io.Discard, out)
+
+	if err := ensureRollbackImage(ctx, cli, targetImage); err != nil {
+		return containerSnapshot{}, prov, err
+	}
+	prov.NewImageID, prov.NewDigest = imageProvenance(ctx, cli, targetImage, config.Image)
 
 	if err := cli.ContainerStop(ctx, containerID, container.StopOptions{}); err != nil {
-		return containerSnapshot{}, fmt.Errorf("stop container %s: %w", containerID, err)
+		return containerSnapshot{}, prov, fmt.Errorf("stop container %s: %w", containerID, err)
 	}
 
 	if err := cli.ContainerRemove(ctx, containerID, container.RemoveOptions{RemoveVolumes: true, Force: true}); err != nil {
-		return containerSnapshot{}, fmt.Errorf("remove container %s: %w", containerID, err)
+		return containerSnapshot{}, prov, fmt.Errorf("remove container %s: %w", containerID, err)
 	}
 
 	networkingConfig := &network.NetworkingConfig{EndpointsConfig: make(map[string]*network.EndpointSettings)}
-	for netName, endpoint := range containerInfo.NetworkSettings.Networks {
+	for netName, endpoint := range networks {
 		networkingConfig.EndpointsConfig[netName] = endpoint
 	}
 
-	containerInfo.Config.Image = targetImage
-	resp, err := cli.ContainerCreate(ctx, containerInfo.Config, containerInfo.HostConfig, networkingConfig, nil, containerInfo.Name)
+	config.Image = targetImage
+	resp, err := cli.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, containerInfo.Name)
 	if err != nil {
-		return containerSnapshot{}, fmt.Errorf("recreate container %s: %w", containerInfo.Name, err)
+		return containerSnapshot{}, prov, fmt.Errorf("recreate container %s: %w", containerInfo.Name, err)
 	}
 
 	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return containerSnapshot{}, fmt.Errorf("start new container %s: %w", resp.ID, err)
+		return containerSnapshot{}, prov, fmt.Errorf("start new container %s: %w", resp.ID, err)
+	}
+	if info, err := cli.ContainerInspect(ctx, resp.ID); err == nil {
+		prov.NewConfig = snapshotConfig(info)
+	}
+
+	return snapshotContainer(ctx, cli, resp.ID), prov, nil
+}
+
+// pinnedUpdateImage checks that digest is a digest reference in the repository of the
+// tag a container runs and returns it.
+func pinnedUpdateImage(tag, digest string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(tag)
+	if err != nil {
+		return "", fmt.Errorf("parse image %s: %w", tag, err)
+	}
+	pinned, err := reference.ParseNormalizedNamed(digest)
+	if err != nil {
+		return "", fmt.Errorf("parse digest %s: %w", digest, err)
+	}
+	if _, ok := pinned.(reference.Canonical); !ok || pinned.Name() != named.Name() {
+		return "", fmt.Errorf("digest %s is not an image of %s", digest, tag)
+	}
+	return reference.FamiliarString(pinned), nil
+}
+
+// ensureRollbackImage makes targetImage available for a rollback. Digest references and
+// image IDs are immutable, so a local copy is used without contacting the registry. Tags
+// are pulled, falling back to the local copy when the registry cannot be reached.
+func ensureRollbackImage(ctx context.Context, cli *client.Client, targetImage string) error {
+	_, inspectErr := cli.ImageInspect(ctx, targetImage)
+	if strings.HasPrefix(targetImage, "sha256:") {
+		if inspectErr != nil {
+			return fmt.Errorf("image %s is no longer on the host: %w", targetImage, inspectErr)
+		}
+		return nil
+	}
+	if inspectErr == nil && strings.Contains(targetImage, "@sha256:") {
+		return nil
 	}
+	out, err := cli.ImagePull(ctx, targetImage, image.PullOptions{})
+	if err != nil {
+		if inspectErr == nil {
+			return nil
+		}
+		return fmt.Errorf("pull image %s: %w", targetImage, err)
+	}
+	defer out.Close()
+	_, _ = io.Copy(io.Discard, out)
+	return nil
+}
 
-	return snapshotContainer(ctx, cli, resp.ID), nil
+func snapshotConfig(info container.InspectResponse) configSnapshot {
+	snap := configSnapshot{Config: info.Config}
+	if info.ContainerJSONBase != nil {
+		snap.Name = strings.TrimPrefix(info.Name, "/")
+		snap.HostConfig = info.HostConfig
+	}
+	if info.NetworkSettings != nil {
+		snap.Networks = info.NetworkSettings.Networks
+	}
+	return snap
+}
+
+// imageProvenance returns the ID of an image and its repo digest in the repository of
+// ref, falling back to its first repo digest; both are empty when the image cannot be
+// inspected.
+func imageProvenance(ctx context.Context, cli *client.Client, imageRef, ref string) (string, string) {
+	if strings.TrimSpace(imageRef) == "" {
+		return "", ""
+	}
+	inspect, err := cli.ImageInspect(ctx, imageRef)
+	if err != nil || len(inspect.RepoDigests) == 0 {
+		return inspect.ID, ""
+	}
+	if named, err := reference.ParseNormalizedNamed(ref); err == nil {
+		for _, d := range inspect.RepoDigests {
+			if candidate, err := reference.ParseNormalizedNamed(d); err == nil && candidate.Name() == named.Name() {
+				return inspect.ID, d
+			}
+		}
+	}
+	return inspect.ID, inspect.RepoDigests[0]
 }
 
 func snapshotContainer(ctx context.Context, cli *client.Client, containerID string) containerSnapshot {
@@ -629,14 +966,14 @@ func snapshotContainer(ctx context.Context, cli *client.Client, containerID stri
 	}
 }
 
-func runFetchLogs(dockerHost, userAgent, containerID string, tail int) (string, error) {
+func runFetchLogs(ctx context.Context, dockerHost, userAgent, containerID string, tail int) (string, error) {
 	cli, err := newDockerClient(dockerHost, userAgent)
 	if err != nil {
 		return "", err
 	}
 	defer cli.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	reader, err := cli.ContainerLogs(ctx, containerID, container.LogsOptions{
@@ -659,3 +996,77 @@ func runFetchLogs(dockerHost, userAgent, containerID string, tail int) (string,
 	}
 	return combined, nil
 }
+
+// setupTracing exports spans to endpoint over OTLP/HTTP. With an empty endpoint the
+// global no-op provider stays in place, so commands are not traced. Spans are batched
+// and sent every few seconds while the agent runs.
+func setupTracing(ctx context.Context, endpoint, userAgent string) error {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if endpoint == "" {
+		return nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName("updockly-agent"),
+		semconv.ServiceVersion(strings.TrimPrefix(userAgent, "updockly-agent/")),
+	))
+	if err != nil {
+		return err
+	}
+	if env, err := resource.New(ctx, resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, env); err == nil {
+			res = merged
+		}
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return nil
+}
+
+// startCommandSpan starts the span of a command as a child of the server span that
+// queued it, when the server sent one.
+func startCommandSpan(cmd agentCommand) (context.Context, trace.Span) {
+	ctx := context.Background()
+	if cmd.TraceParent != "" {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier{"traceparent": cmd.TraceParent})
+	}
+	return otel.Tracer("updockly-agent").Start(ctx, "agent.command "+cmd.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("command.id", cmd.ID),
+			attribute.String("command.type", cmd.Type),
+			attribute.String("container.id", containerIDFromPayload(cmd.Payload)),
+		))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceSteps traces the consecutive steps of an operation as child spans of parent;
+// starting a step ends the previous one.
+type traceSteps struct {
+	parent  context.Context
+	current trace.Span
+}
+
+func (s *traceSteps) next(name string) context.Context {
+	s.end(nil)
+	ctx, span := otel.Tracer("updockly-agent").Start(s.parent, name)
+	s.current = span
+	return ctx
+}
+
+func (s *traceSteps) end(err error) {
+	if s.current != nil {
+		endSpan(s.current, err)
+		s.current = nil
+	}
+}